@@ -0,0 +1,564 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"regexp"
+	"runtime"
+	"runtime/debug"
+	"slices"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	cconf "github.com/densify-dev/container-config/config"
+	"github.com/densify-dev/container-data-collection/internal/common"
+	"github.com/densify-dev/container-data-collection/internal/pipeline"
+)
+
+type command struct {
+	name        string
+	description string
+	run         func(args []string) common.ExitCode
+}
+
+const (
+	collectCmd  = "collect"
+	validateCmd = "validate"
+	planCmd     = "plan"
+	diagnoseCmd = "diagnose"
+	versionCmd  = "version"
+	pseudoCmd   = "pseudonyms"
+	helpCmd     = "help"
+	jsonFlag    = "json"
+	jsonUsage   = "print JSON instead of text"
+	formatFlag  = "output-format"
+	formatUsage = "comma-separated output formats: csv, parquet, jsonl, otlp, remote-write"
+	bundleFlag  = "bundle"
+	bundleUsage = "archive the outputs per cluster or per run: cluster, run (default none)"
+	compFlag    = "bundle-compression"
+	compUsage   = "compression of the archives: gzip, zstd"
+	existFlag   = "on-existing"
+	existUsage  = "what to do with output files left by an earlier run: overwrite, append, fail"
+	labelFlag   = "label-policy"
+	labelUsage  = "YAML file of the label allow, deny and redaction rules of the attributes outputs (redaction key in $" + common.LabelRedactionKeyEnv + ")"
+	customFlag  = "custom-metrics"
+	customUsage = "YAML file of the custom workload metrics, collected with the built-in ones, of the custom attributes and of the query overrides"
+	pseudoFlag  = "pseudonymize"
+	pseudoUsage = "replace the entity names in all outputs by keyed pseudonyms (key in $" + common.PseudonymKeyEnv + ")"
+	mapFlag     = "pseudonym-mapping"
+	mapUsage    = "file of the reverse mapping of the pseudonyms, encrypted with the key in $" + common.PseudonymMappingKeyEnv
+	logFmtFlag  = "log-format"
+	logFmtUsage = "format of the log messages: text, json"
+	levelFlag   = "log-level"
+	levelUsage  = "minimum level of the log messages: debug, info, warn, error (default debug if the debug parameter is set, else info)"
+	logSizeFlag = "log-max-size"
+	logSizeUse  = "size in MiB at which the log files are rotated"
+	logNumFlag  = "log-max-files"
+	logNumUsage = "number of rotated log files kept per cluster"
+	csvFlag     = "csv-version"
+	csvUsage    = "CSV encoding: 1 (legacy, values made safe by replacing commas, quotes etc.), 2 (RFC 4180, values quoted and kept as they are)"
+	s3Flag      = "s3-"
+	otlpFlag    = "otlp-"
+	rwFlag      = "remote-write-"
+	metricsFlag = "metrics-"
+	traceFlag   = "trace-"
+	program     = "dataCollection"
+)
+
+var commands []*command
+
+func init() {
+	commands = []*command{
+		{name: collectCmd, description: "collect data from Prometheus and write it under data/ (default)", run: collect},
+		{name: validateCmd, description: "validate the configuration and cluster filters, offline", run: validate},
+		{name: planCmd, description: "show the queries a collection would issue, without contacting Prometheus", run: plan},
+		{name: diagnoseCmd, description: "check connectivity to Prometheus and detect exporters per cluster", run: diagnose},
+		{name: pseudoCmd, description: "decrypt a pseudonym mapping file and print the names by pseudonym", run: pseudonymMapping},
+		{name: versionCmd, description: "print the version and build metadata", run: version},
+		{name: helpCmd, description: "print this help", run: help},
+	}
+}
+
+// run dispatches to the subcommand; no arguments (or flags only) means collect, to keep
+// existing deployments (entry.sh runs the binary with no arguments) working
+func run(args []string) common.ExitCode {
+	name := collectCmd
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		name = args[0]
+		args = args[1:]
+	}
+	for _, cmd := range commands {
+		if cmd.name == name {
+			return cmd.run(args)
+		}
+	}
+	_, _ = fmt.Fprintf(os.Stderr, "unknown command %q\n", name)
+	printUsage(os.Stderr)
+	return common.ExitUsage
+}
+
+func help([]string) common.ExitCode {
+	printUsage(os.Stdout)
+	return common.ExitOK
+}
+
+func printUsage(w io.Writer) {
+	_, _ = fmt.Fprintf(w, "Usage: %s [command] [flags]\n\nCommands:\n", program)
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	for _, cmd := range commands {
+		_, _ = fmt.Fprintf(tw, "  %s\t%s\n", cmd.name, cmd.description)
+	}
+	_ = tw.Flush()
+	_, _ = fmt.Fprintln(w, "\nExit codes:")
+	for ec := common.ExitOK; ec <= common.ExitInterrupted; ec++ {
+		_, _ = fmt.Fprintf(tw, "  %d\t%v\n", ec, ec)
+	}
+	_ = tw.Flush()
+}
+
+func newFlagSet(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(program+common.Space+name, flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	return fs
+}
+
+// parseFlags parses the subcommand flags; if not ok, the subcommand should exit with ec
+func parseFlags(fs *flag.FlagSet, args []string) (rest []string, ok bool, ec common.ExitCode) {
+	if err := fs.Parse(args); err != nil {
+		if err != flag.ErrHelp {
+			ec = common.ExitUsage
+		}
+		return
+	}
+	return fs.Args(), true, common.ExitOK
+}
+
+// setup reads the configuration and starts a run configured with it and with cfg (the default configuration if
+// nil), which must be ended; args which are not flags of the subcommand are passed on to the configuration reader
+func setup(args []string, cfg *common.RunConfig) *common.RunContext {
+	os.Args = append(os.Args[:1], args...)
+	params, err := cconf.ReadConfig()
+	if err != nil {
+		common.FatalErrorExitCode(common.ExitConfig, err, "Failed to read configuration:")
+	}
+	rc := common.NewRunContext(context.Background(), cfg)
+	pipeline.Configure(rc, params)
+	return rc
+}
+
+func collect(args []string) common.ExitCode {
+	fs := newFlagSet(collectCmd)
+	formats := fs.String(formatFlag, common.CsvFormat, formatUsage)
+	bundle := fs.String(bundleFlag, common.BundleNone, bundleUsage)
+	compression := fs.String(compFlag, common.Gzip, compUsage)
+	existing := fs.String(existFlag, common.ExistingOverwrite, existUsage)
+	csvVersion := fs.Int(csvFlag, common.CsvLegacy, csvUsage)
+	logFormat := fs.String(logFmtFlag, common.TextLogFormat, logFmtUsage)
+	logLevel := fs.String(levelFlag, common.Empty, levelUsage)
+	logMaxSize := fs.Int(logSizeFlag, common.DefaultLogMaxSize, logSizeUse)
+	logMaxFiles := fs.Int(logNumFlag, common.DefaultLogMaxFiles, logNumUsage)
+	labelPolicy := fs.String(labelFlag, common.Empty, labelUsage)
+	customMetrics := fs.String(customFlag, common.Empty, customUsage)
+	pseudonymize := fs.Bool(pseudoFlag, false, pseudoUsage)
+	mapping := fs.String(mapFlag, common.DefaultPseudonymMapping, mapUsage)
+	s3Upload := s3UploadFlags(fs)
+	otlpExport, otlpHeaders := otlpExportFlags(fs)
+	remoteWrite, rwMatch, rwHeaders := remoteWriteFlags(fs)
+	selfMetrics := selfMetricsFlags(fs)
+	traceExport, traceHeaders := traceExportFlags(fs)
+	rest, ok, ec := parseFlags(fs, args)
+	if !ok {
+		return ec
+	}
+	cfg := common.NewRunConfig()
+	if err := cfg.SetLogging(*logFormat, *logLevel, *logMaxSize, *logMaxFiles); err != nil {
+		_, _ = fmt.Fprintln(os.Stderr, err)
+		return common.ExitUsage
+	}
+	if err := cfg.SetOutputFormats(strings.Split(*formats, common.Comma)...); err != nil {
+		_, _ = fmt.Fprintln(os.Stderr, err)
+		return common.ExitUsage
+	}
+	if slices.Contains(strings.Split(*formats, common.Comma), common.OtlpFormat) {
+		if err := setOtlpExport(cfg, otlpExport, *otlpHeaders); err != nil {
+			_, _ = fmt.Fprintln(os.Stderr, err)
+			return common.ExitUsage
+		}
+	}
+	if slices.Contains(strings.Split(*formats, common.Comma), common.RemoteWriteFormat) {
+		if err := setRemoteWrite(cfg, remoteWrite, *rwMatch, *rwHeaders); err != nil {
+			_, _ = fmt.Fprintln(os.Stderr, err)
+			return common.ExitUsage
+		}
+	}
+	if err := cfg.SetBundle(*bundle, *compression); err != nil {
+		_, _ = fmt.Fprintln(os.Stderr, err)
+		return common.ExitUsage
+	}
+	if err := cfg.SetExistingPolicy(*existing); err != nil {
+		_, _ = fmt.Fprintln(os.Stderr, err)
+		return common.ExitUsage
+	}
+	if err := cfg.SetCsvVersion(*csvVersion); err != nil {
+		_, _ = fmt.Fprintln(os.Stderr, err)
+		return common.ExitUsage
+	}
+	if err := cfg.SetLabelPolicy(*labelPolicy); err != nil {
+		_, _ = fmt.Fprintln(os.Stderr, err)
+		return common.ExitConfig
+	}
+	if err := cfg.SetCustomConfig(*customMetrics); err != nil {
+		_, _ = fmt.Fprintln(os.Stderr, err)
+		return common.ExitConfig
+	}
+	if *pseudonymize {
+		if err := cfg.SetPseudonymization(*mapping); err != nil {
+			_, _ = fmt.Fprintln(os.Stderr, err)
+			return common.ExitConfig
+		}
+	}
+	if err := cfg.SetS3Upload(s3Upload); err != nil {
+		_, _ = fmt.Fprintln(os.Stderr, err)
+		return common.ExitUsage
+	}
+	if err := cfg.SetSelfMetrics(selfMetrics); err != nil {
+		_, _ = fmt.Fprintln(os.Stderr, err)
+		return common.ExitUsage
+	}
+	if traceExport.Endpoint != common.Empty {
+		if err := setTraceExport(cfg, traceExport, *traceHeaders); err != nil {
+			_, _ = fmt.Fprintln(os.Stderr, err)
+			return common.ExitUsage
+		}
+	}
+	rc := setup(rest, cfg)
+	defer rc.End()
+	stagesDone := handleShutdown(rc)
+	pipeline.Start(rc)
+	pipeline.CollectEntities(rc, 0)
+	close(stagesDone)
+	return finish(rc)
+}
+
+// finish finishes the run and shuts the exporters of the process down; both the main path and the signal
+// handler may call it, only the first call does so
+func finish(rc *common.RunContext) common.ExitCode {
+	return rc.FinishOnce(func() common.ExitCode {
+		code := pipeline.Finish(rc)
+		pipeline.Shutdown(rc)
+		return code
+	})
+}
+
+// selfMetricsFlags binds the -metrics-* flags of the publication of the metrics of the collector itself
+func selfMetricsFlags(fs *flag.FlagSet) *common.SelfMetrics {
+	sm := &common.SelfMetrics{}
+	fs.StringVar(&sm.Textfile, metricsFlag+"textfile", common.Empty, "write the collector metrics to this node-exporter textfile (e.g. <textfile directory>/densify.prom) at the end of the run")
+	fs.StringVar(&sm.Listen, metricsFlag+"listen", common.Empty, "serve the collector metrics on /metrics at this address (e.g. :9464) while the collection runs")
+	fs.StringVar(&sm.PushUrl, metricsFlag+"push-url", common.Empty, "push the collector metrics to this Pushgateway at the end of the run")
+	fs.StringVar(&sm.PushJob, metricsFlag+"push-job", common.DefaultSelfMetricsJob, "job of the collector metrics pushed")
+	return sm
+}
+
+// s3UploadFlags binds the -s3-* flags, the upload is enabled by -s3-bucket
+func s3UploadFlags(fs *flag.FlagSet) *common.S3Upload {
+	u := &common.S3Upload{}
+	fs.StringVar(&u.Bucket, s3Flag+"bucket", common.Empty, "upload the outputs (or bundles) to this S3 bucket after the collection")
+	fs.StringVar(&u.Prefix, s3Flag+"prefix", common.DefaultS3Prefix, "key prefix template, with the fields .Cluster, .Date and .RunId")
+	fs.StringVar(&u.Endpoint, s3Flag+"endpoint", common.Empty, "endpoint URL of an S3-compatible object storage")
+	fs.StringVar(&u.Region, s3Flag+"region", common.DefaultS3Region, "bucket region")
+	fs.BoolVar(&u.PathStyle, s3Flag+"path-style", false, "path-style bucket addressing, required by most S3-compatible object storages")
+	fs.StringVar(&u.Sse, s3Flag+"sse", common.Empty, "server-side encryption: AES256, aws:kms, aws:kms:dsse")
+	fs.StringVar(&u.SseKmsKeyId, s3Flag+"sse-kms-key-id", common.Empty, "KMS key ID of the aws:kms server-side encryption")
+	fs.IntVar(&u.PartSizeMiB, s3Flag+"part-size", common.DefaultS3PartSize, "multipart upload part size in MiB")
+	fs.IntVar(&u.MaxAttempts, s3Flag+"max-attempts", common.DefaultS3Attempts, "maximum attempts per request, retrying failed ones")
+	return u
+}
+
+// otlpExportFlags binds the -otlp-* flags of the otlp output format
+func otlpExportFlags(fs *flag.FlagSet) (*common.OtlpExport, *string) {
+	oe := &common.OtlpExport{}
+	fs.StringVar(&oe.Endpoint, otlpFlag+"endpoint", common.Empty, "OTLP/HTTP receiver URL (e.g. http://localhost:4318) or OTLP/gRPC receiver host:port")
+	fs.StringVar(&oe.Protocol, otlpFlag+"protocol", common.OtlpHttp, "OTLP protocol: http, grpc")
+	fs.BoolVar(&oe.Insecure, otlpFlag+"insecure", false, "OTLP/gRPC without TLS")
+	fs.DurationVar(&oe.Timeout, otlpFlag+"timeout", common.DefaultOtlpTimeout, "OTLP export timeout")
+	headers := fs.String(otlpFlag+"headers", common.Empty, "comma-separated key=value headers of the OTLP requests")
+	return oe, headers
+}
+
+func setOtlpExport(cfg *common.RunConfig, oe *common.OtlpExport, headers string) (err error) {
+	if oe.Headers, err = parseHeaders(headers); err == nil {
+		err = cfg.SetOtlpExport(oe)
+	}
+	return
+}
+
+// traceExportFlags binds the -trace-* flags, the tracing is enabled by -trace-endpoint
+func traceExportFlags(fs *flag.FlagSet) (*common.OtlpExport, *string) {
+	oe := &common.OtlpExport{}
+	fs.StringVar(&oe.Endpoint, traceFlag+"endpoint", common.Empty, "export the spans of the run to this OTLP/HTTP receiver URL (e.g. http://localhost:4318) or OTLP/gRPC receiver host:port")
+	fs.StringVar(&oe.Protocol, traceFlag+"protocol", common.OtlpHttp, "OTLP protocol of the spans: http, grpc")
+	fs.BoolVar(&oe.Insecure, traceFlag+"insecure", false, "OTLP/gRPC without TLS")
+	fs.DurationVar(&oe.Timeout, traceFlag+"timeout", common.DefaultOtlpTimeout, "span export timeout")
+	headers := fs.String(traceFlag+"headers", common.Empty, "comma-separated key=value headers of the span export requests")
+	return oe, headers
+}
+
+func setTraceExport(cfg *common.RunConfig, oe *common.OtlpExport, headers string) (err error) {
+	if oe.Headers, err = parseHeaders(headers); err == nil {
+		err = cfg.SetTraceExport(oe)
+	}
+	return
+}
+
+// remoteWriteFlags binds the -remote-write-* flags of the remote-write output format
+func remoteWriteFlags(fs *flag.FlagSet) (*common.RemoteWrite, *string, *string) {
+	rw := &common.RemoteWrite{}
+	fs.StringVar(&rw.Url, rwFlag+"url", common.Empty, "Prometheus remote-write endpoint URL")
+	fs.StringVar(&rw.Prefix, rwFlag+"prefix", common.DefaultRemoteWritePrefix, "prefix of the metric names written")
+	fs.DurationVar(&rw.Timeout, rwFlag+"timeout", common.DefaultRemoteWriteTimeout, "remote-write request timeout")
+	match := fs.String(rwFlag+"match", common.Empty, "regular expression of the workload outputs written (e.g. cpu_utilization), all by default")
+	headers := fs.String(rwFlag+"headers", common.Empty, "comma-separated key=value headers of the remote-write requests")
+	return rw, match, headers
+}
+
+func setRemoteWrite(cfg *common.RunConfig, rw *common.RemoteWrite, match, headers string) (err error) {
+	if match != common.Empty {
+		if rw.Match, err = regexp.Compile(match); err != nil {
+			return
+		}
+	}
+	if rw.Headers, err = parseHeaders(headers); err == nil {
+		err = cfg.SetRemoteWrite(rw)
+	}
+	return
+}
+
+// parseHeaders parses comma-separated key=value headers
+func parseHeaders(headers string) (map[string]string, error) {
+	if headers == common.Empty {
+		return nil, nil
+	}
+	m := make(map[string]string)
+	for _, header := range strings.Split(headers, common.Comma) {
+		k, v, f := strings.Cut(header, "=")
+		if !f {
+			return nil, fmt.Errorf("invalid header %s, expecting key=value", header)
+		}
+		m[strings.TrimSpace(k)] = strings.TrimSpace(v)
+	}
+	return m, nil
+}
+
+// shutdownGracePeriod is the time the stages get to drain after a termination signal before their open
+// files are abandoned, well within the default k8s termination grace period (30s)
+const shutdownGracePeriod = 15 * time.Second
+
+// handleShutdown cancels the in-flight queries on SIGTERM / SIGINT; the stages then drain and the run
+// finishes as partial. If they do not drain in time (or on a second signal), the open workload files are
+// abandoned in their temporary files and the partial-run manifest is written right away.
+func handleShutdown(rc *common.RunContext) chan struct{} {
+	stagesDone := make(chan struct{})
+	sigs := make(chan os.Signal, 2)
+	signal.Notify(sigs, syscall.SIGTERM, os.Interrupt)
+	go func() {
+		sig := <-sigs
+		rc.LogAll(1, common.Warn, "Received %v, shutting down", sig)
+		rc.Interrupt(sig.String())
+		select {
+		case <-stagesDone:
+			// the run finishes on its usual path
+			return
+		case <-time.After(shutdownGracePeriod):
+			rc.LogAll(1, common.Warn, "Stages did not finish within %v, abandoning open files", shutdownGracePeriod)
+		case sig = <-sigs:
+			rc.LogAll(1, common.Warn, "Received %v again, abandoning open files", sig)
+		}
+		rc.AbandonOpenFiles()
+		os.Exit(int(finish(rc)))
+	}()
+	return stagesDone
+}
+
+func validate(args []string) common.ExitCode {
+	rest, ok, ec := parseFlags(newFlagSet(validateCmd), args)
+	if !ok {
+		return ec
+	}
+	rc := setup(rest, nil)
+	defer rc.End()
+	fmt.Printf("Configuration is valid: %d cluster(s) %v, collection window %v ending %s, history %d\n",
+		rc.NumClusters(), rc.ClusterNames(), rc.Interval(), rc.FormatCurrentTime(), rc.Params().Collection.HistoryInt)
+	return common.ExitOK
+}
+
+func plan(args []string) common.ExitCode {
+	fs := newFlagSet(planCmd)
+	asJson := fs.Bool(jsonFlag, false, jsonUsage)
+	customMetrics := fs.String(customFlag, common.Empty, customUsage)
+	rest, ok, ec := parseFlags(fs, args)
+	if !ok {
+		return ec
+	}
+	cfg := common.NewRunConfig()
+	if err := cfg.SetCustomConfig(*customMetrics); err != nil {
+		_, _ = fmt.Fprintln(os.Stderr, err)
+		return common.ExitConfig
+	}
+	cfg.SetDryRun(true)
+	rc := setup(rest, cfg)
+	defer rc.End()
+	// collectors write (empty) files as they go, keep them away from the real data folder
+	dir, err := os.MkdirTemp(common.Empty, program+"-plan-")
+	if err != nil {
+		rc.FatalErrorExitCode(common.ExitOutput, err, "Failed to create temporary directory:")
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+	rc.SetRootFolder(dir)
+	if err = rc.MkdirAll(); err != nil {
+		rc.FatalErrorExitCode(common.ExitOutput, err, "Failed to create directories:")
+	}
+	pipeline.DetectExporters(rc)
+	// one stage at a time, so that the queries are listed in a stable order
+	pipeline.CollectEntities(rc, 1)
+	pqs := rc.PlannedQueries()
+	if *asJson {
+		return printJson(pqs)
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	_, _ = fmt.Fprintln(tw, "CLUSTER\tAPI\tSTEP\tOVERRIDE\tQUERY")
+	overridden := 0
+	for _, pq := range pqs {
+		_, _ = fmt.Fprintf(tw, "%s\t%s\t%v\t%s\t%s\n", pq.Cluster, pq.Api, pq.Step, pq.Override, pq.Query)
+		if pq.Override != common.Empty {
+			overridden++
+		}
+	}
+	_ = tw.Flush()
+	fmt.Printf("%d queries, %d overridden\n", len(pqs), overridden)
+	return common.ExitOK
+}
+
+type diagnosis struct {
+	PrometheusVersion string                   `json:"prometheusVersion"`
+	Platform          string                   `json:"platform"`
+	UpCount           int                      `json:"upCount"`
+	Clusters          []*common.CoverageReport `json:"clusters"`
+	Overrides         []string                 `json:"overrides,omitempty"`
+}
+
+func diagnose(args []string) common.ExitCode {
+	fs := newFlagSet(diagnoseCmd)
+	asJson := fs.Bool(jsonFlag, false, jsonUsage)
+	customMetrics := fs.String(customFlag, common.Empty, customUsage)
+	rest, ok, ec := parseFlags(fs, args)
+	if !ok {
+		return ec
+	}
+	cfg := common.NewRunConfig()
+	if err := cfg.SetCustomConfig(*customMetrics); err != nil {
+		_, _ = fmt.Fprintln(os.Stderr, err)
+		return common.ExitConfig
+	}
+	rc := setup(rest, cfg)
+	defer rc.End()
+	d := &diagnosis{Platform: rc.PlatformName(), Overrides: rc.QueryOverrides()}
+	// the first query fails with ExitConnection if Prometheus cannot be reached
+	d.UpCount = rc.CheckPrometheusUp()
+	d.PrometheusVersion, _ = rc.GetPrometheusVersion()
+	if err := rc.CalculateScrapeIntervals(); err != nil {
+		rc.FatalErrorExitCode(common.ExitPrometheus, err, "Failed to calculate scrape intervals:")
+	}
+	if err := rc.CheckCoverage(); err != nil {
+		rc.FatalErrorExitCode(common.ExitPrometheus, err, "Failed to check metrics coverage:")
+	}
+	ec = common.ExitOK
+	for _, cl := range rc.ClusterNames() {
+		cd := rc.GetCoverageReport(cl)
+		for _, ei := range cd.Exporters {
+			if ei.Required && !ei.Detected {
+				ec = common.ExitMissingExporters
+			}
+		}
+		d.Clusters = append(d.Clusters, cd)
+	}
+	if *asJson {
+		if jec := printJson(d); jec != common.ExitOK {
+			return jec
+		}
+		return ec
+	}
+	fmt.Printf("Prometheus version %s, platform %s, %d up sample(s)\n", d.PrometheusVersion, d.Platform, d.UpCount)
+	if len(d.Overrides) > 0 {
+		fmt.Printf("Query overrides: %s\n", strings.Join(d.Overrides, ", "))
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	_, _ = fmt.Fprintln(tw, "CLUSTER\tEXPORTER\tREQUIRED\tDETECTED\tJOB\tSCRAPE INTERVAL")
+	for _, cd := range d.Clusters {
+		for _, ei := range cd.Exporters {
+			_, _ = fmt.Fprintf(tw, "%s\t%s\t%t\t%t\t%s\t%v\n", cd.Cluster, ei.Name, ei.Required, ei.Detected, ei.Job, ei.ScrapeInterval)
+		}
+	}
+	_, _ = fmt.Fprintln(tw)
+	_, _ = fmt.Fprintln(tw, "CLUSTER\tMISSING METRIC\tEXPORTER\tEMPTY OUTPUTS\tREMEDIATION")
+	for _, cd := range d.Clusters {
+		for _, mc := range cd.Metrics {
+			if !mc.Present {
+				_, _ = fmt.Fprintf(tw, "%s\t%s\t%s\t%d\t%s\n", cd.Cluster, mc.Metric, mc.Exporter, len(mc.EmptyOutputs), mc.Remediation)
+			}
+		}
+	}
+	_ = tw.Flush()
+	if ec != common.ExitOK {
+		fmt.Println("Required exporter(s) missing for some cluster(s)")
+	}
+	return ec
+}
+
+func pseudonymMapping(args []string) common.ExitCode {
+	fs := newFlagSet(pseudoCmd)
+	fileName := fs.String(mapFlag, common.DefaultPseudonymMapping, mapUsage)
+	if _, ok, ec := parseFlags(fs, args); !ok {
+		return ec
+	}
+	mapping, err := common.ReadPseudonymMapping(*fileName)
+	if err != nil {
+		_, _ = fmt.Fprintln(os.Stderr, err)
+		return common.ExitConfig
+	}
+	return printJson(mapping)
+}
+
+func version(args []string) common.ExitCode {
+	if _, ok, ec := parseFlags(newFlagSet(versionCmd), args); !ok {
+		return ec
+	}
+	fmt.Printf("Container data collection version %s\n", common.Version)
+	fmt.Printf("go version %s %s/%s\n", runtime.Version(), runtime.GOOS, runtime.GOARCH)
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		fmt.Printf("module %s %s\n", bi.Main.Path, bi.Main.Version)
+		for _, bs := range bi.Settings {
+			if strings.HasPrefix(bs.Key, "vcs") || bs.Key == "CGO_ENABLED" {
+				fmt.Printf("%s %s\n", bs.Key, bs.Value)
+			}
+		}
+	}
+	return common.ExitOK
+}
+
+func printJson(v any) common.ExitCode {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent(common.Empty, "  ")
+	if err := enc.Encode(v); err != nil {
+		common.LogError(err, "failed to encode JSON:")
+		return common.ExitFailure
+	}
+	return common.ExitOK
+}
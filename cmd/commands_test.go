@@ -0,0 +1,38 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/densify-dev/container-data-collection/internal/common"
+)
+
+func TestRunExitCodes(t *testing.T) {
+	missing := filepath.Join(t.TempDir(), "missing.yaml")
+	tests := []struct {
+		name string
+		args []string
+		ec   common.ExitCode
+	}{
+		{"unknown command", []string{"nope"}, common.ExitUsage},
+		{"help", []string{helpCmd}, common.ExitOK},
+		{"version", []string{versionCmd}, common.ExitOK},
+		{"unknown flag", []string{versionCmd, "-x"}, common.ExitUsage},
+		{"flag help", []string{collectCmd, "-h"}, common.ExitOK},
+		{"output format", []string{collectCmd, "-" + formatFlag, "xml"}, common.ExitUsage},
+		{"default collect", []string{"-" + existFlag, "keep"}, common.ExitUsage},
+		{"bundle", []string{collectCmd, "-" + bundleFlag, "tar"}, common.ExitUsage},
+		{"csv version", []string{collectCmd, "-" + csvFlag, "3"}, common.ExitUsage},
+		{"log format", []string{collectCmd, "-" + logFmtFlag, "xml"}, common.ExitUsage},
+		{"label policy", []string{collectCmd, "-" + labelFlag, missing}, common.ExitConfig},
+		{"custom metrics", []string{collectCmd, "-" + customFlag, missing}, common.ExitConfig},
+		{"plan custom metrics", []string{planCmd, "-" + customFlag, missing}, common.ExitConfig},
+		{"diagnose custom metrics", []string{diagnoseCmd, "-" + customFlag, missing}, common.ExitConfig},
+		{"pseudonym mapping", []string{pseudoCmd, "-" + mapFlag, missing}, common.ExitConfig},
+	}
+	for _, test := range tests {
+		if ec := run(test.args); ec != test.ec {
+			t.Errorf("%s: exit code %v, want %v", test.name, ec, test.ec)
+		}
+	}
+}
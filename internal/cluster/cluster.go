@@ -2,7 +2,6 @@ package cluster
 
 import (
 	"fmt"
-	"os"
 
 	"github.com/densify-dev/container-data-collection/internal/common"
 	"github.com/densify-dev/container-data-collection/internal/kubernetes"
@@ -14,17 +13,30 @@ type cluster struct {
 	cpuLimit, cpuRequest, memLimit, memRequest int
 }
 
-var clusters = make(map[string]*cluster)
+// state holds the clusters of a run
+type state struct {
+	rc            *common.RunContext
+	clusters      map[string]*cluster
+	indicators    *common.Indicators
+	queryWrappers []*node.QueryWrapper
+}
+
+type stateKey struct{}
 
-var indicators = make(map[string]int)
+func getState(rc *common.RunContext) *state {
+	return common.CollectorState(rc, stateKey{}, func(rc *common.RunContext) *state {
+		return &state{rc: rc, clusters: make(map[string]*cluster), indicators: common.NewIndicators()}
+	})
+}
 
 type clusterMetricHolder struct {
+	st     *state
 	metric string
 }
 
-func createCluster(name string) {
-	if _, f := clusters[name]; !f {
-		clusters[name] = &cluster{
+func (st *state) createCluster(name string) {
+	if _, f := st.clusters[name]; !f {
+		st.clusters[name] = &cluster{
 			cpuLimit:   common.UnknownValue,
 			cpuRequest: common.UnknownValue,
 			memLimit:   common.UnknownValue,
@@ -36,11 +48,11 @@ func createCluster(name string) {
 func (cmh *clusterMetricHolder) getClusterMetric(clusterName string, result model.Matrix) {
 	var cl *cluster
 	var f bool
-	if cl, f = clusters[clusterName]; !f {
+	if cl, f = cmh.st.clusters[clusterName]; !f {
 		return
 	}
 	if l := result.Len(); l > 0 {
-		indicators[cmh.metric] = indicators[cmh.metric] + 1
+		cmh.st.indicators.Inc(cmh.metric)
 	}
 	for _, ss := range result {
 		value := common.LastValue(ss)
@@ -71,71 +83,63 @@ func (cmh *clusterMetricHolder) getClusterMetric(clusterName string, result mode
 	}
 }
 
-func writeConfig() {
-	for name := range clusters {
-		writeConf(name)
+func (st *state) writeConfig() {
+	for name := range st.clusters {
+		st.writeConf(name)
 	}
 }
 
-func writeConf(name string) {
-	configWrite, err := os.Create(common.GetFileNameByType(name, common.ClusterEntityKind, common.Config))
+var configSchema = common.NewSchema(common.ClusterEntityKind, common.Config, 1).
+	Add(common.TimeColumn, false, "AuditTime").
+	Add(common.StringColumn, false, "Name")
+
+func (st *state) writeConf(name string) {
+	configWrite, err := st.rc.NewSchemaSink(name, configSchema)
 	if err != nil {
-		common.LogError(err, common.DefaultLogFormat, name, common.ClusterEntityKind)
+		st.rc.LogError(err, common.DefaultLogFormat, name, common.ClusterEntityKind)
 		return
 	}
 
-	defer func(file *os.File) {
-		if err = file.Close(); err != nil {
-			common.LogError(err, common.DefaultLogFormat, name, common.ClusterEntityKind)
+	defer func(sink common.Sink) {
+		if err = sink.Close(); err != nil {
+			st.rc.LogError(err, common.DefaultLogFormat, name, common.ClusterEntityKind)
 		}
 	}(configWrite)
 
-	if _, err = fmt.Fprintln(configWrite, "AuditTime,Name"); err != nil {
-		common.LogError(err, common.DefaultLogFormat, name, common.ClusterEntityKind)
-		return
-	}
-
-	if _, err = fmt.Fprintf(configWrite, "%s,%s\n", common.FormatCurrentTime(), name); err != nil {
-		common.LogError(err, common.DefaultLogFormat, name, common.ClusterEntityKind)
+	if err = configWrite.WriteRecord(st.rc.CurrentTime(), name); err != nil {
+		st.rc.LogError(err, common.DefaultLogFormat, name, common.ClusterEntityKind)
 		return
 	}
 }
 
-func writeAttributes() {
-	for name, cl := range clusters {
-		writeAttrs(name, cl)
+func (st *state) writeAttributes() {
+	for name, cl := range st.clusters {
+		st.writeAttrs(name, cl)
 	}
 }
 
-func writeAttrs(name string, cl *cluster) {
-	attributeWrite, err := os.Create(common.GetFileNameByType(name, common.ClusterEntityKind, common.Attributes))
+var attributesSchema = common.NewSchema(common.ClusterEntityKind, common.Attributes, 1).
+	Add(common.StringColumn, false, "Name", "VirtualTechnology", "VirtualDomain").
+	Add(common.IntColumn, true, "CpuLimit", "CpuRequest", "MemoryLimit", "MemoryRequest").
+	Add(common.StringColumn, false, "K8sVersion")
+
+func (st *state) writeAttrs(name string, cl *cluster) {
+	attributeWrite, err := st.rc.NewSchemaSink(name, attributesSchema)
 	if err != nil {
-		common.LogError(err, common.DefaultLogFormat, name, common.ClusterEntityKind)
+		st.rc.LogError(err, common.DefaultLogFormat, name, common.ClusterEntityKind)
 		return
 	}
-	defer func(file *os.File) {
-		if err = file.Close(); err != nil {
-			common.LogError(err, common.DefaultLogFormat, name, common.ClusterEntityKind)
+	defer func(sink common.Sink) {
+		if err = sink.Close(); err != nil {
+			st.rc.LogError(err, common.DefaultLogFormat, name, common.ClusterEntityKind)
 		}
 	}(attributeWrite)
 
-	if _, err = fmt.Fprintln(attributeWrite, "Name,VirtualTechnology,VirtualDomain,CpuLimit,CpuRequest,MemoryLimit,MemoryRequest,K8sVersion"); err != nil {
-		common.LogError(err, common.DefaultLogFormat, name, common.ClusterEntityKind)
-		return
-	}
-	if _, err = fmt.Fprintf(attributeWrite, "%s,Clusters,%s", name, name); err != nil {
-		common.LogError(err, common.DefaultLogFormat, name, common.ClusterEntityKind)
-		return
-	}
-	values := []int{cl.cpuLimit, cl.cpuRequest, cl.memLimit, cl.memRequest}
-	for _, value := range values {
-		if err = common.PrintCSVNumberValue(attributeWrite, value, false); err != nil {
-			common.LogError(err, common.DefaultLogFormat, name, common.ClusterEntityKind)
-			return
-		}
-	}
-	if err = common.PrintCSVStringValue(attributeWrite, kubernetes.GetClusterVersion(name), true); err != nil {
-		common.LogError(err, common.DefaultLogFormat, name, common.ClusterEntityKind)
+	values := []any{name, "Clusters", name}
+	values = append(values, common.KnownValues(cl.cpuLimit, cl.cpuRequest, cl.memLimit, cl.memRequest)...)
+	values = append(values, kubernetes.GetClusterVersion(st.rc, name))
+	if err = attributeWrite.WriteRecord(values...); err != nil {
+		st.rc.LogError(err, common.DefaultLogFormat, name, common.ClusterEntityKind)
 		return
 	}
 }
@@ -158,104 +162,117 @@ var queryWrappersMap = map[string]*node.QueryWrapper{
 	},
 }
 
-var queryWrappers []*node.QueryWrapper
-
-func Metrics() {
-	for _, clusterName := range common.ClusterNames {
-		createCluster(clusterName)
+func Metrics(rc *common.RunContext) {
+	st := getState(rc)
+	for _, clusterName := range rc.ClusterNames() {
+		st.createCluster(clusterName)
 	}
 	var query string
-	range5Min := common.TimeRange()
-	cmh := &clusterMetricHolder{metric: common.Limits}
+	range5Min := rc.TimeRange()
+	cmh := &clusterMetricHolder{st: st, metric: common.Limits}
 	query = `sum(kube_pod_container_resource_limits{} or (kube_pod_init_container_resource_limits{} * on (namespace, pod, container) group_left kube_pod_init_container_info{restart_policy="Always"})) by (resource)`
-	_, _ = common.CollectAndProcessMetric(query, range5Min, cmh.getClusterMetric)
-	if common.Found(indicators, common.Limits, false) {
+	_, _ = rc.CollectAndProcessMetric(query, range5Min, cmh.getClusterMetric)
+	if rc.Found(st.indicators, common.Limits, false) {
 		cmh.metric = common.CpuLimit
 		query = `sum(kube_pod_container_resource_limits_cpu_cores{}*1000)`
-		_, _ = common.CollectAndProcessMetric(query, range5Min, cmh.getClusterMetric)
+		_, _ = rc.CollectAndProcessMetric(query, range5Min, cmh.getClusterMetric)
 		cmh.metric = common.MemLimit
 		query = `sum(kube_pod_container_resource_limits_memory_bytes{}/1024/1024)`
-		_, _ = common.CollectAndProcessMetric(query, range5Min, cmh.getClusterMetric)
+		_, _ = rc.CollectAndProcessMetric(query, range5Min, cmh.getClusterMetric)
 	}
 	cmh.metric = common.Requests
 	query = `sum(kube_pod_container_resource_requests or (kube_pod_init_container_resource_requests{} * on (namespace, pod, container) group_left kube_pod_init_container_info{restart_policy="Always"})) by (resource)`
-	_, _ = common.CollectAndProcessMetric(query, range5Min, cmh.getClusterMetric)
-	if common.Found(indicators, common.Requests, false) {
+	_, _ = rc.CollectAndProcessMetric(query, range5Min, cmh.getClusterMetric)
+	if rc.Found(st.indicators, common.Requests, false) {
 		cmh.metric = common.CpuRequest
 		query = `sum(kube_pod_container_resource_requests_cpu_cores{}*1000)`
-		_, _ = common.CollectAndProcessMetric(query, range5Min, cmh.getClusterMetric)
+		_, _ = rc.CollectAndProcessMetric(query, range5Min, cmh.getClusterMetric)
 		cmh.metric = common.MemRequest
 		query = `sum(kube_pod_container_resource_requests_memory_bytes{}/1024/1024)`
-		_, _ = common.CollectAndProcessMetric(query, range5Min, cmh.getClusterMetric)
+		_, _ = rc.CollectAndProcessMetric(query, range5Min, cmh.getClusterMetric)
 	}
-	writeConfig()
-	writeAttributes()
+	st.writeConfig()
+	st.writeAttributes()
 
-	common.GetConditionalMetricsWorkload(indicators, common.Requests, map[string][]model.LabelName{common.Empty: nil}, common.ClusterEntityKind, common.Metric)
+	rc.GetConditionalMetricsWorkload(st.indicators, common.Requests, map[string][]model.LabelName{common.Empty: nil}, common.ClusterEntityKind, common.Metric)
 
 	// bail out if detected that Prometheus Node Exporter metrics are not present for any cluster
-	if !node.HasNodeExporter(range5Min) {
+	if !node.HasNodeExporter(rc, range5Min) {
 		err := fmt.Errorf("prometheus node exporter metrics not present for any cluster")
-		common.LogError(err, "entity=%s", common.ClusterEntityKind)
+		rc.LogError(err, "entity=%s", common.ClusterEntityKind)
 		return
 	}
 
-	for _, qw := range node.GetQueryWrappers(&queryWrappers, queryWrappersMap) {
+	for _, qw := range node.GetQueryWrappers(rc, &st.queryWrappers, queryWrappersMap) {
 
-		query = fmtQuery(`avg(sum(irate(node_cpu_seconds_total{mode!="idle"}[%sm])) by (%s) / on (%s) group_left count(node_cpu_seconds_total{mode="idle"}) by (%s) *100)`, qw, 1, 3)
-		common.CpuUtilization.GetWorkload(query, nil, common.ClusterEntityKind)
+		query = fmtQuery(rc, `avg(sum(irate(node_cpu_seconds_total{mode!="idle"}[%sm])) by (%s) / on (%s) group_left count(node_cpu_seconds_total{mode="idle"}) by (%s) *100)`, qw, 1, 3)
+		common.CpuUtilization.GetWorkload(rc, query, nil, common.ClusterEntityKind)
 
 		query = `sum(node_memory_MemTotal_bytes{} - node_memory_MemFree_bytes{})`
-		common.MemoryBytes.GetWorkload(query, nil, common.ClusterEntityKind)
+		common.MemoryBytes.GetWorkload(rc, query, nil, common.ClusterEntityKind)
 
-		query = fmt.Sprintf("sum(%s)", node.GetMemActualQuery())
-		common.MemoryActualWorkload.GetWorkload(query, nil, common.ClusterEntityKind)
+		query = fmt.Sprintf("sum(%s)", node.GetMemActualQuery(rc))
+		common.MemoryActualWorkload.GetWorkload(rc, query, nil, common.ClusterEntityKind)
 
-		query = fmtQuery(`sum(sum(irate(node_disk_read_bytes_total{device!~"dm-.*"}[%sm])) by (%s))`, qw, 1, 1)
-		common.DiskReadBytes.GetWorkload(query, nil, common.ClusterEntityKind)
+		query = fmtQuery(rc, `sum(sum(irate(node_disk_read_bytes_total{device!~"dm-.*"}[%sm])) by (%s))`, qw, 1, 1)
+		common.DiskReadBytes.GetWorkload(rc, query, nil, common.ClusterEntityKind)
 
-		query = fmtQuery(`sum(sum(irate(node_disk_written_bytes_total{device!~"dm-.*"}[%sm])) by (%s))`, qw, 1, 1)
-		common.DiskWriteBytes.GetWorkload(query, nil, common.ClusterEntityKind)
+		query = fmtQuery(rc, `sum(sum(irate(node_disk_written_bytes_total{device!~"dm-.*"}[%sm])) by (%s))`, qw, 1, 1)
+		common.DiskWriteBytes.GetWorkload(rc, query, nil, common.ClusterEntityKind)
 
-		query = fmtQuery(`sum(sum(irate(node_disk_read_bytes_total{device!~"dm-.*"}[%sm]) + irate(node_disk_written_bytes_total{device!~"dm-.*"}[%sm])) by (%s))`, qw, 2, 1)
-		common.DiskTotalBytes.GetWorkload(query, nil, common.ClusterEntityKind)
+		query = fmtQuery(rc, `sum(sum(irate(node_disk_read_bytes_total{device!~"dm-.*"}[%sm]) + irate(node_disk_written_bytes_total{device!~"dm-.*"}[%sm])) by (%s))`, qw, 2, 1)
+		common.DiskTotalBytes.GetWorkload(rc, query, nil, common.ClusterEntityKind)
 
-		query = fmtQuery(`sum(sum(irate(node_disk_reads_completed_total{device!~"dm-.*"}[%sm])) by (%s))`, qw, 1, 1)
-		common.DiskReadOps.GetWorkload(query, nil, common.ClusterEntityKind)
+		query = fmtQuery(rc, `sum(sum(irate(node_disk_reads_completed_total{device!~"dm-.*"}[%sm])) by (%s))`, qw, 1, 1)
+		common.DiskReadOps.GetWorkload(rc, query, nil, common.ClusterEntityKind)
 
-		query = fmtQuery(`sum(sum(irate(node_disk_writes_completed_total{device!~"dm-.*"}[%sm])) by (%s))`, qw, 1, 1)
-		common.DiskWriteOps.GetWorkload(query, nil, common.ClusterEntityKind)
+		query = fmtQuery(rc, `sum(sum(irate(node_disk_writes_completed_total{device!~"dm-.*"}[%sm])) by (%s))`, qw, 1, 1)
+		common.DiskWriteOps.GetWorkload(rc, query, nil, common.ClusterEntityKind)
 
-		query = fmtQuery(`sum(sum((irate(node_disk_reads_completed_total{device!~"dm-.*"}[%sm]) + irate(node_disk_writes_completed_total{device!~"dm-.*"}[%sm]))) by (%s))`, qw, 2, 1)
-		common.DiskTotalOps.GetWorkload(query, nil, common.ClusterEntityKind)
+		query = fmtQuery(rc, `sum(sum((irate(node_disk_reads_completed_total{device!~"dm-.*"}[%sm]) + irate(node_disk_writes_completed_total{device!~"dm-.*"}[%sm]))) by (%s))`, qw, 2, 1)
+		common.DiskTotalOps.GetWorkload(rc, query, nil, common.ClusterEntityKind)
 
-		query = fmtQuery(`sum(sum(irate(node_network_receive_bytes_total{device!~"veth.*|docker.*|cilium.*|lxc.*"}[%sm])) by (%s))`, qw, 1, 1)
-		common.NetReceivedBytes.GetWorkload(query, nil, common.ClusterEntityKind)
+		query = fmtQuery(rc, `sum(sum(irate(node_network_receive_bytes_total{device!~"veth.*|docker.*|cilium.*|lxc.*"}[%sm])) by (%s))`, qw, 1, 1)
+		common.NetReceivedBytes.GetWorkload(rc, query, nil, common.ClusterEntityKind)
 
-		query = fmtQuery(`sum(sum(irate(node_network_transmit_bytes_total{device!~"veth.*|docker.*|cilium.*|lxc.*"}[%sm])) by (%s))`, qw, 1, 1)
-		common.NetSentBytes.GetWorkload(query, nil, common.ClusterEntityKind)
+		query = fmtQuery(rc, `sum(sum(irate(node_network_transmit_bytes_total{device!~"veth.*|docker.*|cilium.*|lxc.*"}[%sm])) by (%s))`, qw, 1, 1)
+		common.NetSentBytes.GetWorkload(rc, query, nil, common.ClusterEntityKind)
 
-		query = fmtQuery(`sum(sum(irate(node_network_transmit_bytes_total{device!~"veth.*|docker.*|cilium.*|lxc.*"}[%sm]) + irate(node_network_receive_bytes_total{device!~"veth.*|docker.*|cilium.*|lxc.*"}[%sm])) by (%s))`, qw, 2, 1)
-		common.NetTotalBytes.GetWorkload(query, nil, common.ClusterEntityKind)
+		query = fmtQuery(rc, `sum(sum(irate(node_network_transmit_bytes_total{device!~"veth.*|docker.*|cilium.*|lxc.*"}[%sm]) + irate(node_network_receive_bytes_total{device!~"veth.*|docker.*|cilium.*|lxc.*"}[%sm])) by (%s))`, qw, 2, 1)
+		common.NetTotalBytes.GetWorkload(rc, query, nil, common.ClusterEntityKind)
 
-		query = fmtQuery(`sum(sum(irate(node_network_receive_packets_total{device!~"veth.*|docker.*|cilium.*|lxc.*"}[%sm])) by (%s))`, qw, 1, 1)
-		common.NetReceivedPackets.GetWorkload(query, nil, common.ClusterEntityKind)
+		query = fmtQuery(rc, `sum(sum(irate(node_network_receive_packets_total{device!~"veth.*|docker.*|cilium.*|lxc.*"}[%sm])) by (%s))`, qw, 1, 1)
+		common.NetReceivedPackets.GetWorkload(rc, query, nil, common.ClusterEntityKind)
 
-		query = fmtQuery(`sum(sum(irate(node_network_transmit_packets_total{device!~"veth.*|docker.*|cilium.*|lxc.*"}[%sm])) by (%s))`, qw, 1, 1)
-		common.NetSentPackets.GetWorkload(query, nil, common.ClusterEntityKind)
+		query = fmtQuery(rc, `sum(sum(irate(node_network_transmit_packets_total{device!~"veth.*|docker.*|cilium.*|lxc.*"}[%sm])) by (%s))`, qw, 1, 1)
+		common.NetSentPackets.GetWorkload(rc, query, nil, common.ClusterEntityKind)
 
-		query = fmtQuery(`sum(sum(irate(node_network_transmit_packets_total{device!~"veth.*|docker.*|cilium.*|lxc.*"}[%sm]) + irate(node_network_receive_packets_total{device!~"veth.*|docker.*|cilium.*|lxc.*"}[%sm])) by (%s))`, qw, 2, 1)
-		common.NetTotalPackets.GetWorkload(query, nil, common.ClusterEntityKind)
+		query = fmtQuery(rc, `sum(sum(irate(node_network_transmit_packets_total{device!~"veth.*|docker.*|cilium.*|lxc.*"}[%sm]) + irate(node_network_receive_packets_total{device!~"veth.*|docker.*|cilium.*|lxc.*"}[%sm])) by (%s))`, qw, 2, 1)
+		common.NetTotalPackets.GetWorkload(rc, query, nil, common.ClusterEntityKind)
 	}
 }
 
-func fmtQuery(queryFmt string, qw *node.QueryWrapper, numSampleRate, numLabel int) string {
+func fmtQuery(rc *common.RunContext, queryFmt string, qw *node.QueryWrapper, numSampleRate, numLabel int) string {
 	s := make([]any, numSampleRate+numLabel)
 	for i := 0; i < numSampleRate; i++ {
-		s[i] = common.Params.Collection.SampleRateSt
+		s[i] = rc.Params().Collection.SampleRateSt
 	}
 	for i := 0; i < numLabel; i++ {
 		s[numSampleRate+i] = qw.MetricField[0]
 	}
 	return fmt.Sprintf(queryFmt, s...)
 }
+
+var _ = common.RegisterCoverage(
+	&common.CoverageMetric{Names: []string{"node_cpu_seconds_total"}, Exporter: common.NodeExporter,
+		Outputs: common.WorkloadOutputs(common.ClusterEntityKind, common.CpuUtilization)},
+	&common.CoverageMetric{Names: []string{"node_memory_MemTotal_bytes"}, Exporter: common.NodeExporter,
+		Outputs: common.WorkloadOutputs(common.ClusterEntityKind, common.MemoryBytes)},
+	&common.CoverageMetric{Names: []string{"node_memory_Cached_bytes"}, Exporter: common.NodeExporter,
+		Outputs: common.WorkloadOutputs(common.ClusterEntityKind, common.MemoryActualWorkload)},
+)
+
+var _ = common.RegisterOverridableOutputs(common.ClusterEntityKind, append(common.ConditionalMetricHolders(),
+	common.CpuUtilization, common.MemoryBytes, common.MemoryActualWorkload,
+	common.DiskReadBytes, common.DiskWriteBytes, common.DiskTotalBytes, common.DiskReadOps, common.DiskWriteOps, common.DiskTotalOps,
+	common.NetReceivedBytes, common.NetSentBytes, common.NetTotalBytes, common.NetReceivedPackets, common.NetSentPackets, common.NetTotalPackets)...)
@@ -0,0 +1,77 @@
+package common
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// batchSink is the base of the sinks sending the workload samples to an endpoint in batches (otlp, remote
+// write): it checks the records, groups the values of the samples by entity and sends a batch once it has
+// size values; the config and attributes records are checked only
+type batchSink[E any] struct {
+	spec     *OutputSpec
+	endpoint string
+	size     int
+	entities map[string]*E
+	order    []string
+	values   int
+	// newEntity returns the batch entry of an entity
+	newEntity func(entity []string) *E
+	// add adds the values of a sample to the entry of its entity, returning the number of values added
+	add func(e *E, s *Sample) int
+	// send sends the entries of a batch, in the order of their first sample
+	send func(ctx context.Context, batch []*E) error
+}
+
+func newBatchSink[E any](spec *OutputSpec, endpoint string, size int) *batchSink[E] {
+	return &batchSink[E]{spec: spec, endpoint: endpoint, size: size, entities: make(map[string]*E)}
+}
+
+func (bs *batchSink[E]) Name() string {
+	return JoinNoSep(bs.endpoint, "/", bs.spec.Cluster, "/", bs.spec.EntityKind, "/", bs.spec.Name)
+}
+
+func (bs *batchSink[E]) WriteRecord(values ...any) error {
+	if l := len(values); l != len(bs.spec.Columns) {
+		return fmt.Errorf("%s: %d values for %d columns", bs.Name(), l, len(bs.spec.Columns))
+	}
+	return nil
+}
+
+func (bs *batchSink[E]) WriteSample(s *Sample) error {
+	if l := len(s.Entity) + 1 + len(s.Values); l != len(bs.spec.Columns) {
+		return fmt.Errorf("%s: %d values for %d columns", bs.Name(), l, len(bs.spec.Columns))
+	}
+	key := strings.Join(s.Entity, Comma)
+	e, f := bs.entities[key]
+	if !f {
+		e = bs.newEntity(s.Entity)
+		bs.entities[key] = e
+		bs.order = append(bs.order, key)
+	}
+	bs.values += bs.add(e, s)
+	if bs.values >= bs.size {
+		return bs.flush()
+	}
+	return nil
+}
+
+// flush sends the batch and starts a new one
+func (bs *batchSink[E]) flush() error {
+	if bs.values == 0 {
+		return nil
+	}
+	batch := make([]*E, 0, len(bs.order))
+	for _, key := range bs.order {
+		batch = append(batch, bs.entities[key])
+	}
+	clear(bs.entities)
+	bs.order = bs.order[:0]
+	bs.values = 0
+	return bs.send(bs.spec.Context(), batch)
+}
+
+func (bs *batchSink[E]) Close() error {
+	return bs.flush()
+}
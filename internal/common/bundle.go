@@ -0,0 +1,264 @@
+package common
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+const (
+	BundleNone    = ""
+	BundleCluster = "cluster"
+	BundleRun     = "run"
+	Gzip          = "gzip"
+	Zstd          = "zstd"
+)
+
+const (
+	bundleManifestFileName = "manifest.json"
+	runBundleName          = "bundle"
+	tarExt                 = ".tar"
+	checksumExt            = ".sha256"
+)
+
+var bundleExts = map[string]string{
+	Gzip: ".gz",
+	Zstd: ".zst",
+}
+
+// SetBundle sets whether the outputs are archived per cluster or per run (none by default) and the
+// compression of the archives
+func (cfg *RunConfig) SetBundle(scope, compression string) error {
+	switch scope {
+	case BundleNone, BundleCluster, BundleRun:
+	default:
+		return fmt.Errorf("unknown bundle scope %s, supported: %s, %s", scope, BundleCluster, BundleRun)
+	}
+	if _, f := bundleExts[compression]; !f {
+		return fmt.Errorf("unknown bundle compression %s, supported: %s", compression, strings.Join(SortedKeySet(bundleExts), Comma))
+	}
+	cfg.bundleScope = scope
+	cfg.bundleCompression = compression
+	return nil
+}
+
+type BundleFile struct {
+	Path   string `json:"path"`
+	Sha256 string `json:"sha256"`
+	Size   int64  `json:"size"`
+	Rows   *int   `json:"rows,omitempty"`
+	// SchemaVersion is the version of the schema of an output, see schemas.json
+	SchemaVersion int `json:"schemaVersion,omitempty"`
+}
+
+// BundleManifest is the first entry of a bundle, listing the other entries
+type BundleManifest struct {
+	Version     string        `json:"collectorVersion"`
+	Status      string        `json:"status"`
+	Cluster     string        `json:"cluster,omitempty"`
+	CsvVersion  int           `json:"csvVersion"`
+	WindowStart time.Time     `json:"windowStart"`
+	WindowEnd   time.Time     `json:"windowEnd"`
+	Files       []*BundleFile `json:"files"`
+}
+
+// WriteBundles archives the outputs of each cluster (data/<cluster>.tar.gz) or of the run (data/bundle.tar.gz),
+// each with a manifest.json of the files and a .sha256 file of the archive checksum
+func (rc *RunContext) WriteBundles() error {
+	switch rc.config.bundleScope {
+	case BundleCluster:
+		var errs []error
+		for _, cluster := range rc.clusterNames {
+			errs = append(errs, rc.writeBundle(rc.clusterFolder(cluster), rc.newBundleManifest(cluster)))
+		}
+		return errors.Join(errs...)
+	case BundleRun:
+		return rc.writeBundle(runBundleName, rc.newBundleManifest(Empty))
+	}
+	return nil
+}
+
+func (rc *RunContext) newBundleManifest(cluster string) *BundleManifest {
+	bm := &BundleManifest{Version: Version, Status: RunComplete, Cluster: rc.clusterFolder(cluster), CsvVersion: rc.config.csvVersion, WindowStart: rc.windowStart(), WindowEnd: rc.currentTime}
+	if rc.Interrupted() {
+		bm.Status = RunPartial
+	}
+	return bm
+}
+
+// writeBundle archives the files under data/<cluster> of the manifest, or all the files under data/ if its
+// cluster is empty
+func (rc *RunContext) writeBundle(name string, bm *BundleManifest) (err error) {
+	bm.Files = []*BundleFile{}
+	if err = filepath.WalkDir(filepath.Join(rc.rootFolder, bm.Cluster), func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || isBundle(path) || rc.config.isLocalOnly(path) {
+			return err
+		}
+		bf, err := rc.newBundleFile(path)
+		if err == nil {
+			bm.Files = append(bm.Files, bf)
+		}
+		return err
+	}); err != nil {
+		return
+	}
+	var manifest []byte
+	if manifest, err = json.MarshalIndent(bm, Empty, "  "); err != nil {
+		return
+	}
+	fileName := rc.bundleFileName(name)
+	var file *os.File
+	if file, err = createTempFile(fileName); err != nil {
+		return
+	}
+	of := &atomicFile{File: file, fileName: fileName}
+	defer func() {
+		if err == nil {
+			if err = of.Close(); err == nil {
+				err = writeChecksum(fileName)
+			}
+		} else {
+			of.discard()
+		}
+	}()
+	bw := bufio.NewWriter(file)
+	var cw io.WriteCloser
+	if cw, err = newCompressor(bw, rc.config.bundleCompression); err != nil {
+		return
+	}
+	tw := tar.NewWriter(cw)
+	if err = addToTar(tw, rc.currentTime, bundleManifestFileName, int64(len(manifest)), bytes.NewReader(manifest)); err != nil {
+		return
+	}
+	for _, bf := range bm.Files {
+		if err = rc.addFileToTar(tw, bf); err != nil {
+			return
+		}
+	}
+	if err = tw.Close(); err == nil {
+		if err = cw.Close(); err == nil {
+			err = bw.Flush()
+		}
+	}
+	return
+}
+
+// isBundle returns whether the file is a bundle, its checksum or a temporary file
+func isBundle(path string) bool {
+	if strings.HasSuffix(path, checksumExt) || strings.HasSuffix(path, tmpExt) {
+		return true
+	}
+	for _, ext := range bundleExts {
+		if strings.HasSuffix(path, tarExt+ext) {
+			return true
+		}
+	}
+	return false
+}
+
+func (rc *RunContext) windowStart() time.Time {
+	return rc.currentTime.Add(-rc.interval * time.Duration(rc.params.Collection.HistoryInt))
+}
+
+// bundleFileName returns the file of a bundle, with the extension of its compression
+func (rc *RunContext) bundleFileName(name string) string {
+	return filepath.Join(rc.rootFolder, name+tarExt+bundleExts[rc.config.bundleCompression])
+}
+
+func newCompressor(w io.Writer, compression string) (io.WriteCloser, error) {
+	if compression == Zstd {
+		return zstd.NewWriter(w)
+	}
+	return gzip.NewWriter(w), nil
+}
+
+func (rc *RunContext) newBundleFile(path string) (bf *BundleFile, err error) {
+	rel, _ := filepath.Rel(rc.rootFolder, path)
+	bf = &BundleFile{Path: filepath.ToSlash(rel), SchemaVersion: rc.schemaVersion(rel)}
+	var file *os.File
+	if file, err = os.Open(path); err != nil {
+		return
+	}
+	defer func() { _ = file.Close() }()
+	h := sha256.New()
+	var rows int
+	lc := &lineCounter{}
+	if bf.Size, err = io.Copy(io.MultiWriter(h, lc), file); err != nil {
+		return
+	}
+	bf.Sha256 = hex.EncodeToString(h.Sum(nil))
+	switch filepath.Ext(path) {
+	case fileExt:
+		// the header row is not a row
+		rows = max(lc.lines-1, 0)
+		bf.Rows = &rows
+	case jsonlFileExt:
+		rows = lc.lines
+		bf.Rows = &rows
+	case parquetFileExt:
+		if rows, err = parquetRows(path); err != nil {
+			return
+		}
+		bf.Rows = &rows
+	}
+	return
+}
+
+// lineCounter counts the lines written to it
+type lineCounter struct {
+	lines int
+}
+
+func (lc *lineCounter) Write(p []byte) (int, error) {
+	lc.lines += bytes.Count(p, []byte(lf))
+	return len(p), nil
+}
+
+func (rc *RunContext) addFileToTar(tw *tar.Writer, bf *BundleFile) error {
+	file, err := os.Open(filepath.Join(rc.rootFolder, filepath.FromSlash(bf.Path)))
+	if err != nil {
+		return err
+	}
+	defer func() { _ = file.Close() }()
+	// the file may have grown since it was checksummed (e.g. the log), only its checksummed part is archived
+	return addToTar(tw, rc.currentTime, bf.Path, bf.Size, io.LimitReader(file, bf.Size))
+}
+
+// addToTar adds an entry; the entries have the collection time as modification time and no owner, so that
+// archiving the same files gives the same archive
+func addToTar(tw *tar.Writer, modTime time.Time, name string, size int64, r io.Reader) (err error) {
+	hdr := &tar.Header{Name: name, Mode: logFilePerm, Size: size, ModTime: modTime, Typeflag: tar.TypeReg, Format: tar.FormatPAX}
+	if err = tw.WriteHeader(hdr); err == nil {
+		_, err = io.Copy(tw, r)
+	}
+	return
+}
+
+// writeChecksum writes the SHA-256 of the file to <file>.sha256, in the sha256sum format
+func writeChecksum(fileName string) error {
+	file, err := os.Open(fileName)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = file.Close() }()
+	h := sha256.New()
+	if _, err = io.Copy(h, file); err != nil {
+		return err
+	}
+	sum := fmt.Sprintf("%s  %s\n", hex.EncodeToString(h.Sum(nil)), filepath.Base(fileName))
+	return writeFileAtomic(fileName+checksumExt, []byte(sum))
+}
@@ -0,0 +1,129 @@
+package common
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+func readBundle(t *testing.T, fileName string) map[string]string {
+	t.Helper()
+	file, err := os.Open(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = file.Close() }()
+	var r io.Reader
+	if strings.HasSuffix(fileName, bundleExts[Zstd]) {
+		var zr *zstd.Decoder
+		if zr, err = zstd.NewReader(file); err != nil {
+			t.Fatal(err)
+		}
+		defer zr.Close()
+		r = zr
+	} else if r, err = gzip.NewReader(file); err != nil {
+		t.Fatal(err)
+	}
+	tr := tar.NewReader(r)
+	entries := make(map[string]string)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		b, err := io.ReadAll(tr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(entries) == 0 && hdr.Name != bundleManifestFileName {
+			t.Errorf("first entry = %s, want %s", hdr.Name, bundleManifestFileName)
+		}
+		entries[hdr.Name] = string(b)
+	}
+	return entries
+}
+
+func TestWriteBundle(t *testing.T) {
+	for _, compression := range []string{Gzip, Zstd} {
+		t.Run(compression, func(t *testing.T) {
+			cfg := NewRunConfig()
+			if err := cfg.SetBundle(BundleCluster, compression); err != nil {
+				t.Fatal(err)
+			}
+			rc := newTestOutputRunContext(t, cfg)
+			csvFile := filepath.Join(rc.rootFolder, "c1", NodeEntityKind, "attributes.csv")
+			if err := os.WriteFile(csvFile, []byte("Name\nn1\nn2\n"), logFilePerm); err != nil {
+				t.Fatal(err)
+			}
+			fileName := filepath.Join(rc.rootFolder, "c1"+tarExt+bundleExts[compression])
+			if err := rc.writeBundle("c1", &BundleManifest{Version: Version, Status: RunComplete, Cluster: "c1"}); err != nil {
+				t.Fatalf("writeBundle() error = %v", err)
+			}
+			entries := readBundle(t, fileName)
+			var bm BundleManifest
+			if err := json.Unmarshal([]byte(entries[bundleManifestFileName]), &bm); err != nil {
+				t.Fatal(err)
+			}
+			if l := len(bm.Files); l != 1 {
+				t.Fatalf("manifest files = %d, want 1", l)
+			}
+			bf := bm.Files[0]
+			if bf.Path != "c1/node/attributes.csv" || bf.Size != 11 || bf.Rows == nil || *bf.Rows != 2 ||
+				bf.Sha256 != "cff62e26c31f7968fc1498fcb0010ff953df53b9dd26744fa3fcd6535894bb6b" {
+				t.Errorf("manifest file = %+v", bf)
+			}
+			if entries[bf.Path] != "Name\nn1\nn2\n" {
+				t.Errorf("entry %s = %q", bf.Path, entries[bf.Path])
+			}
+			// the same files give the same bundle
+			sum, err := os.ReadFile(fileName + checksumExt)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err = rc.writeBundle("c1", &BundleManifest{Version: Version, Status: RunComplete, Cluster: "c1"}); err != nil {
+				t.Fatalf("writeBundle() error = %v", err)
+			}
+			if again, _ := os.ReadFile(fileName + checksumExt); string(again) != string(sum) {
+				t.Errorf("checksum = %s, want %s", again, sum)
+			}
+		})
+	}
+}
+
+func TestBundleFileRows(t *testing.T) {
+	rc := newTestOutputRunContext(t, nil)
+	sink, err := newParquetSink(&OutputSpec{Cluster: "c1", EntityKind: NodeEntityKind, Name: "attributes", Columns: []string{"Name"}, folder: rc.rootFolder, config: rc.config})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"n1", "n2", "n3"} {
+		if err = sink.WriteRecord(name); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = sink.Close(); err != nil {
+		t.Fatal(err)
+	}
+	jsonlFile := filepath.Join(rc.rootFolder, "c1", NodeEntityKind, "attributes"+jsonlFileExt)
+	if err = os.WriteFile(jsonlFile, []byte("{}\n{}\n"), logFilePerm); err != nil {
+		t.Fatal(err)
+	}
+	for path, want := range map[string]int{sink.Name(): 3, jsonlFile: 2} {
+		bf, err := rc.newBundleFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if bf.Rows == nil || *bf.Rows != want {
+			t.Errorf("%s rows = %v, want %d", bf.Path, bf.Rows, want)
+		}
+	}
+}
@@ -3,6 +3,7 @@ package common
 import (
 	_ "embed"
 	cconf "github.com/densify-dev/container-config/config"
+	"slices"
 	"strings"
 	"time"
 )
@@ -13,68 +14,72 @@ import (
 //go:embed version.txt
 var version string
 var Version = strings.TrimSpace(version)
-var Params *cconf.Parameters
-var CurrentTime time.Time
-var Interval time.Duration
-var Step time.Duration
 
-func SetCurrentTime() {
-	t := time.Now().UTC()
-	Interval = time.Duration(Params.Collection.IntervalSize)
-	switch Params.Collection.Interval {
+// SetClock sets the clock the collection window of the run ends at, the system clock by default
+func (rc *RunContext) SetClock(clock func() time.Time) {
+	rc.clock = clock
+}
+
+// SetParams sets the parameters of the run
+func (rc *RunContext) SetParams(params *cconf.Parameters) {
+	rc.params = params
+}
+
+// Params are the parameters of the run
+func (rc *RunContext) Params() *cconf.Parameters {
+	return rc.params
+}
+
+// SetCurrentTime sets the collection window of the run, which ends at the current time, by the parameters
+func (rc *RunContext) SetCurrentTime() {
+	t := rc.clock().UTC()
+	c := rc.params.Collection
+	rc.interval = time.Duration(c.IntervalSize)
+	switch c.Interval {
 	case Days:
-		CurrentTime = time.Date(t.Year(), t.Month(), t.Day()-Params.Collection.OffsetInt, 0, 0, 0, 0, t.Location())
-		Interval *= time.Hour * 24
+		rc.currentTime = time.Date(t.Year(), t.Month(), t.Day()-c.OffsetInt, 0, 0, 0, 0, t.Location())
+		rc.interval *= time.Hour * 24
 	case Hours:
-		CurrentTime = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()-Params.Collection.OffsetInt, 0, 0, 0, t.Location())
-		Interval *= time.Hour
+		rc.currentTime = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()-c.OffsetInt, 0, 0, 0, t.Location())
+		rc.interval *= time.Hour
 	default:
-		CurrentTime = time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute()-Params.Collection.OffsetInt, 0, 0, t.Location())
-		Interval *= time.Minute
+		rc.currentTime = time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute()-c.OffsetInt, 0, 0, t.Location())
+		rc.interval *= time.Minute
 	}
-	Step = time.Minute * time.Duration(Params.Collection.SampleRate)
+	rc.step = time.Minute * time.Duration(c.SampleRate)
 }
 
-// AddToLabelMap is used to add values to label map used for attributes
-func AddToLabelMap(key string, value string, labelPath map[string]string) {
-	if _, ok := labelPath[key]; !ok {
-		value = strings.ReplaceAll(strings.ReplaceAll(value, lf, Empty), cr, Empty)
-		if len(value) > maxLabelValueLen {
-			labelPath[key] = value[:maxLabelValueLen]
-		} else {
-			labelPath[key] = value
-		}
-		return
-	}
-	if strings.Contains(value, semicolonStr) {
-		currValue := Empty
-		for _, l := range value {
-			currValue = currValue + string(l)
-			if l == semicolon {
-				AddToLabelMap(key, currValue[:len(currValue)-1], labelPath)
-				currValue = Empty
-			}
-		}
-		AddToLabelMap(key, currValue, labelPath)
-		return
-	}
-	currValue := Empty
-	notPresent := true
-	for _, l := range labelPath[key] {
-		currValue = currValue + string(l)
-		if l == semicolon {
-			if currValue[:len(currValue)-1] == value {
-				notPresent = false
-				break
-			}
-			currValue = Empty
-		}
+// CurrentTime is the end of the collection window of the run
+func (rc *RunContext) CurrentTime() time.Time {
+	return rc.currentTime
+}
+
+// Interval is the length of an interval of the collection window of the run
+func (rc *RunContext) Interval() time.Duration {
+	return rc.interval
+}
+
+// Step is the step of the range queries of the run
+func (rc *RunContext) Step() time.Duration {
+	return rc.step
+}
+
+// LabelValues holds the distinct values of the labels of an entity, in the order they are found
+type LabelValues map[string][]string
+
+// Value returns the value of a label, the values of a multi-valued label joined by semicolons
+func (lvs LabelValues) Value(key string) (value string, f bool) {
+	var values []string
+	if values, f = lvs[key]; f {
+		value = strings.Join(values, semicolonStr)
 	}
-	if currValue != value && notPresent {
-		if len(value) > maxLabelValueLen {
-			labelPath[key] = labelPath[key] + semicolonStr + value[:maxLabelValueLen]
-		} else {
-			labelPath[key] = labelPath[key] + semicolonStr + value
-		}
+	return
+}
+
+// AddToLabelMap is used to add values to label map used for attributes; the values are kept in full (the
+// sinks truncate, join or escape them as their format requires), a multi-valued label keeping its distinct values
+func AddToLabelMap(key string, value string, labels LabelValues) {
+	if !slices.Contains(labels[key], value) {
+		labels[key] = append(labels[key], value)
 	}
 }
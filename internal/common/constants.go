@@ -291,7 +291,6 @@ const (
 	cr                 = "\r"
 	lf                 = "\n"
 	semicolonStr       = ";"
-	semicolon          = ';'
 	colon              = ":"
 	Braces             = leftBrace + rightBrace
 	leftBraceComma     = leftBrace + Comma
@@ -309,17 +308,14 @@ const (
 	// labelsPlaceholder contains - on purpose - characters which are invalid for model.LabelName
 	labelsPlaceholder     = NonNameString + `CLUSTER_LABELS` + NonNameString
 	emptyByClause         = Space + "by" + Space + Brackets
-	queryLogPrefix        = "%v:"
-	queryLogSuffix        = "query = %s"
-	queryLogFormat        = queryLogPrefix + Space + queryLogSuffix
-	clusterQueryLogFormat = queryLogPrefix + Space + ClusterFormat + Space + queryLogSuffix
+	queryLogFormat        = "api=%v query=%s"
+	clusterQueryLogFormat = ClusterFormat + Space + queryLogFormat
 	EntityFormat          = "entity=%s"
 	ClusterFileFormat     = "cluster=%s file=%s"
 )
 
 const (
-	maxKeyLen        = 250
-	maxLabelValueLen = 255
+	maxKeyLen = 250
 )
 
 func camelCase(s string) string {
@@ -0,0 +1,224 @@
+package common
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sync"
+
+	"github.com/prometheus/common/model"
+)
+
+// CoverageMetric is a metric a collector needs, with the outputs of the collector which stay empty without it
+type CoverageMetric struct {
+	// Names holds the metric name followed by its alternatives (e.g. older kube-state-metrics names);
+	// the metric is covered if any of them is present
+	Names    []string
+	Exporter string
+	// Outputs are files ("<entity>/<file>.csv", see Schema.FileOutput and WorkloadOutputs) and columns
+	// ("<entity>/<file>.csv:<column>", see Schema.ColumnOutputs)
+	Outputs []string
+	// Hint is the remediation if the metric is missing, the one of its exporter by default
+	Hint string
+}
+
+var (
+	coverageMetrics   []*CoverageMetric
+	coverageMetricsMu sync.Mutex
+)
+
+// RegisterCoverage registers the metrics a collector needs, declared next to the collector so that the
+// outputs are those it writes; the outputs of a metric registered by several collectors are merged. It
+// returns true, to be called in a package-level variable declaration.
+func RegisterCoverage(cms ...*CoverageMetric) bool {
+	coverageMetricsMu.Lock()
+	defer coverageMetricsMu.Unlock()
+	coverageMetrics = append(coverageMetrics, cms...)
+	return true
+}
+
+// registeredCoverage returns the registered metrics, merged by metric name, in the order of registration
+func registeredCoverage() (cms []*CoverageMetric) {
+	coverageMetricsMu.Lock()
+	defer coverageMetricsMu.Unlock()
+	byName := make(map[string]*CoverageMetric, len(coverageMetrics))
+	for _, cm := range coverageMetrics {
+		merged, f := byName[cm.Names[0]]
+		if !f {
+			merged = &CoverageMetric{Names: slices.Clone(cm.Names), Exporter: cm.Exporter, Hint: cm.Hint}
+			byName[cm.Names[0]] = merged
+			cms = append(cms, merged)
+		}
+		for _, name := range cm.Names[1:] {
+			if !slices.Contains(merged.Names, name) {
+				merged.Names = append(merged.Names, name)
+			}
+		}
+		for _, o := range cm.Outputs {
+			if !slices.Contains(merged.Outputs, o) {
+				merged.Outputs = append(merged.Outputs, o)
+			}
+		}
+		if merged.Hint == Empty {
+			merged.Hint = cm.Hint
+		}
+	}
+	return
+}
+
+func outputFile(entityKind, name string) string {
+	return filepath.Join(entityKind, name+fileExt)
+}
+
+// FileOutput returns the coverage output of the file of the schema
+func (s *Schema) FileOutput() string {
+	return outputFile(s.EntityKind, s.Name)
+}
+
+// ColumnOutputs returns the coverage outputs of columns of the schema; it panics if the schema has no such
+// column, which is a programming error
+func (s *Schema) ColumnOutputs(columns ...string) []string {
+	ocs := make([]string, len(columns))
+	for i, column := range columns {
+		if !slices.Contains(s.ColumnNames(), column) {
+			panic(fmt.Sprintf("no column %s in %s", column, s.key()))
+		}
+		ocs[i] = s.FileOutput() + colon + column
+	}
+	return ocs
+}
+
+// WorkloadOutputs returns the coverage outputs of workload files
+func WorkloadOutputs(entityKind string, wmhs ...*WorkloadMetricHolder) []string {
+	files := make([]string, len(wmhs))
+	for i, wmh := range wmhs {
+		files[i] = outputFile(entityKind, wmh.GetFileName())
+	}
+	return files
+}
+
+// Outputs joins groups of coverage outputs
+func Outputs(groups ...[]string) (ocs []string) {
+	for _, group := range groups {
+		ocs = append(ocs, group...)
+	}
+	return
+}
+
+// KsmLabelsHint is the remediation of the missing kube-state-metrics label metrics
+const KsmLabelsHint = "kube-state-metrics v2 exports only allowlisted labels, set --metric-labels-allowlist (e.g. pods=[*],namespaces=[*],nodes=[*])"
+
+var exporterHints = map[string]string{
+	Cadvisor:                 "scrape the kubelet cAdvisor endpoint (/metrics/cadvisor) on every node, keeping the container, pod and namespace labels",
+	NodeExporter:             "deploy prometheus-node-exporter as a DaemonSet and scrape it on every node",
+	Ksm:                      "deploy kube-state-metrics and scrape it; metrics missing while the exporter is present are usually disabled resources (--resources) or an old version",
+	Ossm:                     "on OpenShift, scrape openshift-state-metrics; not needed on other distributions",
+	Dcgm:                     "if the cluster has NVIDIA GPUs, deploy the NVIDIA DCGM exporter (or the kubex GPU process exporter)",
+	EphemeralStorageExporter: "deploy k8s-ephemeral-storage-metrics to collect ephemeral storage usage",
+	KubexGpu:                 "if the cluster has GPUs, deploy the kubex GPU process exporter (or the NVIDIA DCGM exporter)",
+	Beyla:                    "deploy Grafana Beyla to detect container runtimes (e.g. JVM)",
+}
+
+// CheckCoverage queries which of the metrics the collectors need are present; the exporters must have been
+// detected first by CalculateScrapeIntervals
+func (rc *RunContext) CheckCoverage() (err error) {
+	var names []string
+	for _, cm := range registeredCoverage() {
+		for _, name := range cm.Names {
+			names = append(names, regexp.QuoteMeta(name))
+		}
+	}
+	query := fmt.Sprintf(`{%s=~"%s"}`, prometheusMetricName, Join(Or, names...))
+	query = aggOverTimeQuery(query, Last, rc.interval, UnknownValue)
+	query = LabelReplace(query, metricName, prometheusMetricName, HasValue)
+	query = fmt.Sprintf(allMetricsFmt, metricName, query)
+	_, err = rc.CollectAndProcessMetric(query, rc.TimeRangeEndTimeOnly(), rc.coveragePresent)
+	return
+}
+
+func (rc *RunContext) coveragePresent(cluster string, result model.Matrix) {
+	m := make(map[string]bool, result.Len())
+	for _, ss := range result {
+		if mn, f := GetLabelValue(ss, metricName); f {
+			m[mn] = true
+		}
+	}
+	rc.coveragePresentMetrics[cluster] = m
+}
+
+type ExporterCoverage struct {
+	*ExporterInfo
+	Remediation string `json:"remediation,omitempty"`
+}
+
+type MetricCoverage struct {
+	Metric       string   `json:"metric"`
+	Alternatives []string `json:"alternatives,omitempty"`
+	Exporter     string   `json:"exporter"`
+	Present      bool     `json:"present"`
+	EmptyOutputs []string `json:"emptyOutputs,omitempty"`
+	Remediation  string   `json:"remediation,omitempty"`
+}
+
+type CoverageReport struct {
+	Cluster   string              `json:"cluster"`
+	Version   string              `json:"collectorVersion"`
+	EndTime   string              `json:"endTime"`
+	Window    string              `json:"window"`
+	Exporters []*ExporterCoverage `json:"exporters"`
+	Metrics   []*MetricCoverage   `json:"metrics"`
+	// EmptyOutputs are all files ("<entity>/<file>.csv") and columns ("<entity>/<file>.csv:<column>")
+	// which will be empty as a result of missing metrics
+	EmptyOutputs []string `json:"emptyOutputs"`
+}
+
+// GetCoverageReport returns the coverage report of the cluster, valid only after CheckCoverage
+func (rc *RunContext) GetCoverageReport(cluster string) *CoverageReport {
+	cr := &CoverageReport{Cluster: rc.clusterFolder(cluster), Version: Version, EndTime: rc.FormatCurrentTime(), Window: rc.interval.String()}
+	for _, ei := range rc.GetClusterExporters(cluster) {
+		ec := &ExporterCoverage{ExporterInfo: ei}
+		if !ei.Detected {
+			ec.Remediation = exporterHints[ei.Name]
+		}
+		cr.Exporters = append(cr.Exporters, ec)
+	}
+	present := rc.coveragePresentMetrics[cluster]
+	emptyOutputs := make(map[string]bool)
+	for _, cm := range registeredCoverage() {
+		mc := &MetricCoverage{Metric: cm.Names[0], Alternatives: cm.Names[1:], Exporter: cm.Exporter}
+		mc.Present = slices.ContainsFunc(cm.Names, func(name string) bool { return present[name] })
+		if !mc.Present {
+			mc.EmptyOutputs = cm.Outputs
+			if mc.Remediation = cm.Hint; mc.Remediation == Empty {
+				mc.Remediation = exporterHints[cm.Exporter]
+			}
+			for _, o := range cm.Outputs {
+				emptyOutputs[o] = true
+			}
+		}
+		cr.Metrics = append(cr.Metrics, mc)
+	}
+	cr.EmptyOutputs = SortedKeySet(emptyOutputs)
+	return cr
+}
+
+const coverageFileName = "coverage.json"
+
+// WriteCoverageReports writes the coverage report of each cluster to data/<cluster>/coverage.json
+func (rc *RunContext) WriteCoverageReports() {
+	for _, cluster := range rc.clusterNames {
+		if err := rc.writeCoverageReport(cluster); err != nil {
+			rc.LogError(err, ClusterFileFormat, cluster, coverageFileName)
+		}
+	}
+}
+
+func (rc *RunContext) writeCoverageReport(cluster string) error {
+	b, err := json.MarshalIndent(rc.GetCoverageReport(cluster), Empty, "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(filepath.Join(rc.rootFolder, rc.clusterFolder(cluster), coverageFileName), b)
+}
@@ -0,0 +1,84 @@
+package common
+
+import (
+	"slices"
+	"testing"
+)
+
+// withCoverage replaces the registered metrics for the duration of the test
+func withCoverage(t *testing.T, cms ...*CoverageMetric) {
+	t.Helper()
+	coverageMetricsMu.Lock()
+	saved := coverageMetrics
+	coverageMetrics = nil
+	coverageMetricsMu.Unlock()
+	t.Cleanup(func() {
+		coverageMetricsMu.Lock()
+		coverageMetrics = saved
+		coverageMetricsMu.Unlock()
+	})
+	RegisterCoverage(cms...)
+}
+
+func TestRegisteredCoverage(t *testing.T) {
+	s := NewSchema(NodeEntityKind, Attributes, 1).Add(StringColumn, false, "A", "B")
+	withCoverage(t,
+		&CoverageMetric{Names: []string{"m1"}, Exporter: Ksm, Outputs: s.ColumnOutputs("A")},
+		&CoverageMetric{Names: []string{"m2"}, Exporter: NodeExporter, Outputs: WorkloadOutputs(NodeEntityKind, CpuUtilization)},
+		&CoverageMetric{Names: []string{"m1", "m1_old"}, Exporter: Ksm, Outputs: Outputs(s.ColumnOutputs("A", "B"), []string{s.FileOutput()}), Hint: "h"},
+	)
+	cms := registeredCoverage()
+	if len(cms) != 2 || cms[0].Names[0] != "m1" || cms[1].Names[0] != "m2" {
+		t.Fatalf("registered metrics not merged by name in order: %v", cms)
+	}
+	if want := []string{"m1", "m1_old"}; !slices.Equal(cms[0].Names, want) {
+		t.Errorf("names = %v, want %v", cms[0].Names, want)
+	}
+	if want := []string{"node/attributes.csv:A", "node/attributes.csv:B", "node/attributes.csv"}; !slices.Equal(cms[0].Outputs, want) {
+		t.Errorf("outputs = %v, want %v", cms[0].Outputs, want)
+	}
+	if cms[0].Hint != "h" {
+		t.Errorf("hint = %q, want h", cms[0].Hint)
+	}
+	if want := []string{"node/cpu_utilization.csv"}; !slices.Equal(cms[1].Outputs, want) {
+		t.Errorf("outputs = %v, want %v", cms[1].Outputs, want)
+	}
+}
+
+func TestColumnOutputsUnknownColumn(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("no panic for an unknown column")
+		}
+	}()
+	NewSchema(NodeEntityKind, Config, 1).Add(StringColumn, false, "A").ColumnOutputs("Missing")
+}
+
+func TestGetCoverageReport(t *testing.T) {
+	withCoverage(t,
+		&CoverageMetric{Names: []string{"present"}, Exporter: Ksm, Outputs: []string{"a.csv"}},
+		&CoverageMetric{Names: []string{"new", "old"}, Exporter: Ksm, Outputs: []string{"b.csv"}},
+		&CoverageMetric{Names: []string{"missing"}, Exporter: NodeExporter, Outputs: []string{"c.csv", "a.csv:X"}},
+		&CoverageMetric{Names: []string{"hinted"}, Exporter: Ksm, Outputs: []string{"c.csv"}, Hint: "h"},
+	)
+	rc := newTestRunContext(t, nil)
+	rc.coveragePresentMetrics["c1"] = map[string]bool{"present": true, "old": true}
+	cr := rc.GetCoverageReport("c1")
+	if len(cr.Metrics) != 4 {
+		t.Fatalf("%d metrics in the report, want 4", len(cr.Metrics))
+	}
+	for i, present := range []bool{true, true, false, false} {
+		if mc := cr.Metrics[i]; mc.Present != present {
+			t.Errorf("%s present = %v, want %v", mc.Metric, mc.Present, present)
+		}
+	}
+	if mc := cr.Metrics[2]; mc.Remediation != exporterHints[NodeExporter] || !slices.Equal(mc.EmptyOutputs, []string{"c.csv", "a.csv:X"}) {
+		t.Errorf("missing metric = %+v, want the exporter hint and its outputs", mc)
+	}
+	if mc := cr.Metrics[3]; mc.Remediation != "h" {
+		t.Errorf("remediation = %q, want the metric hint", mc.Remediation)
+	}
+	if want := []string{"a.csv:X", "c.csv"}; !slices.Equal(cr.EmptyOutputs, want) {
+		t.Errorf("empty outputs = %v, want %v", cr.EmptyOutputs, want)
+	}
+}
@@ -0,0 +1,245 @@
+package common
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// CsvLegacy is the CSV encoding read by the Densify forwarder: the values are written as they are, with
+	// the commas, quotes and line breaks of the label values and the semicolons and colons of the entity
+	// names replaced
+	CsvLegacy = 1
+	// CsvRfc4180 is the RFC 4180 CSV encoding: the values with commas, quotes or line breaks are quoted, and
+	// the values are kept as they are
+	CsvRfc4180 = 2
+)
+
+// SetCsvVersion sets the CSV encoding, legacy by default
+func (cfg *RunConfig) SetCsvVersion(version int) error {
+	switch version {
+	case CsvLegacy, CsvRfc4180:
+		cfg.csvVersion = version
+		return nil
+	}
+	return fmt.Errorf("unknown CSV version %d, supported: %d (legacy), %d (RFC 4180)", version, CsvLegacy, CsvRfc4180)
+}
+
+// csvSink writes the records of an output as the rows of a CSV file, the header row holding the column names
+type csvSink struct {
+	spec *OutputSpec
+	file *atomicFile
+	sb   strings.Builder
+	// cw writes the rows in the RFC 4180 encoding, nil in the legacy one
+	cw     *csv.Writer
+	fields []string
+}
+
+func newCsvSink(spec *OutputSpec) (Sink, error) {
+	file, appended, err := spec.createFile(fileExt, true)
+	if err != nil {
+		return nil, err
+	}
+	cs := &csvSink{spec: spec, file: file}
+	if spec.config.csvVersion == CsvRfc4180 {
+		cs.cw = csv.NewWriter(file)
+	}
+	header := JoinComma(spec.Columns...)
+	if appended {
+		// the rows are appended to an existing file only if it has the same columns
+		err = checkCsvHeader(file.Name(), header)
+	} else if cs.cw != nil {
+		err = cs.cw.Write(spec.Columns)
+	} else {
+		_, err = fmt.Fprintln(file, header)
+	}
+	if err != nil {
+		file.discard()
+		return nil, err
+	}
+	return cs, nil
+}
+
+func checkCsvHeader(fileName, header string) error {
+	file, err := os.Open(fileName)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = file.Close() }()
+	line, err := bufio.NewReader(file).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return err
+	}
+	if line = strings.TrimSuffix(line, lf); line != header {
+		return fmt.Errorf("%s: cannot append, its header %q is not %q", fileName, line, header)
+	}
+	return nil
+}
+
+func (cs *csvSink) Name() string {
+	return cs.file.Name()
+}
+
+func (cs *csvSink) WriteRecord(values ...any) error {
+	if l := len(values); l != len(cs.spec.Columns) {
+		return fmt.Errorf("%s: %d values for %d columns", cs.Name(), l, len(cs.spec.Columns))
+	}
+	if cs.cw != nil {
+		cs.fields = cs.fields[:0]
+		for _, value := range values {
+			cs.fields = append(cs.fields, csvField(value))
+		}
+		return cs.cw.Write(cs.fields)
+	}
+	cs.sb.Reset()
+	for i, value := range values {
+		if i > 0 {
+			cs.sb.WriteString(Comma)
+		}
+		writeCsvValue(&cs.sb, value)
+	}
+	return cs.writeRow()
+}
+
+func (cs *csvSink) WriteSample(s *Sample) error {
+	if l := len(s.Entity) + 1 + len(s.Values); l != len(cs.spec.Columns) {
+		return fmt.Errorf("%s: %d values for %d columns", cs.Name(), l, len(cs.spec.Columns))
+	}
+	if cs.cw != nil {
+		cs.fields = append(cs.fields[:0], s.Entity...)
+		cs.fields = append(cs.fields, FormatTime(s.Time))
+		for _, value := range s.Values {
+			cs.fields = append(cs.fields, csvField(value))
+		}
+		return cs.cw.Write(cs.fields)
+	}
+	cs.sb.Reset()
+	for _, field := range s.Entity {
+		cs.sb.WriteString(field)
+		cs.sb.WriteString(Comma)
+	}
+	cs.sb.WriteString(FormatTime(s.Time))
+	for _, value := range s.Values {
+		cs.sb.WriteString(Comma)
+		writeCsvValue(&cs.sb, value)
+	}
+	return cs.writeRow()
+}
+
+func (cs *csvSink) writeRow() (err error) {
+	cs.sb.WriteString(lf)
+	_, err = cs.file.WriteString(cs.sb.String())
+	return
+}
+
+// flush writes the rows buffered by the RFC 4180 writer
+func (cs *csvSink) flush() error {
+	if cs.cw == nil {
+		return nil
+	}
+	cs.cw.Flush()
+	return cs.cw.Error()
+}
+
+func (cs *csvSink) Close() error {
+	if err := cs.flush(); err != nil {
+		cs.file.discard()
+		return err
+	}
+	return cs.file.Close()
+}
+
+func writeCsvValue(sb *strings.Builder, value any) {
+	switch v := value.(type) {
+	case nil:
+	case string:
+		sb.WriteString(v)
+	case float32, float64:
+		_, _ = fmt.Fprintf(sb, "%f", v)
+	case bool:
+		sb.WriteString(strconv.FormatBool(v))
+	case time.Time:
+		sb.WriteString(Format(&v))
+	case LabelMap:
+		writeCsvLabelMap(sb, &v, safeLabelReplacements)
+	case json.RawMessage:
+		// quoted, as the JSON has commas
+		sb.WriteString(DoubleQuote)
+		sb.WriteString(strings.ReplaceAll(string(v), DoubleQuote, DoubleQuote+DoubleQuote))
+		sb.WriteString(DoubleQuote)
+	default:
+		_, _ = fmt.Fprintf(sb, "%v", v)
+	}
+}
+
+// csvField returns a value as an RFC 4180 field, which the CSV writer quotes if needed
+func csvField(value any) string {
+	var sb strings.Builder
+	switch v := value.(type) {
+	case LabelMap:
+		writeCsvLabelPairs(&sb, &v)
+	case json.RawMessage:
+		return string(v)
+	default:
+		writeCsvValue(&sb, value)
+	}
+	return sb.String()
+}
+
+var safeLabelReplacements = map[string]string{
+	Comma:       Space,
+	DoubleQuote: Empty,
+	Or:          Space,
+	lf:          Empty,
+	cr:          Empty,
+}
+
+// csvLabelEscaper escapes the separators of the pairs and of the values with a backslash
+var csvLabelEscaper = strings.NewReplacer(`\`, `\\`, Or, `\`+Or, semicolonStr, `\`+semicolonStr)
+
+// writeCsvLabelMap writes the labels as "key : value|" pairs sorted by key, leaving out overlong keys and
+// truncating the values
+func writeCsvLabelMap(sb *strings.Builder, lm *LabelMap, replacements map[string]string) {
+	keys := SortedKeySet(lm.Map)
+	for _, key := range keys {
+		if reject := lm.Reject[key]; reject {
+			continue
+		}
+		var maxValueLen int
+		if lkey := len(key); lkey >= maxKeyLen {
+			continue
+		} else {
+			maxValueLen = maxKeyLen + 3 - lkey
+		}
+		value := strings.Join(lm.Map[key], semicolonStr)
+		for unsafe, safe := range replacements {
+			value = strings.ReplaceAll(value, unsafe, safe)
+		}
+		if len(value) > maxValueLen {
+			value = value[:maxValueLen]
+		}
+		_, _ = fmt.Fprintf(sb, "%s : %s%s", key, value, Or)
+	}
+}
+
+// writeCsvLabelPairs writes all the labels as "key : value|" pairs sorted by key, in full: the backslashes, pipes
+// and semicolons of the keys and values are escaped with a backslash and the CSV writer quotes the rest
+func writeCsvLabelPairs(sb *strings.Builder, lm *LabelMap) {
+	for _, key := range SortedKeySet(lm.Map) {
+		if lm.Reject[key] {
+			continue
+		}
+		values := make([]string, len(lm.Map[key]))
+		for i, value := range lm.Map[key] {
+			values[i] = csvLabelEscaper.Replace(value)
+		}
+		_, _ = fmt.Fprintf(sb, "%s : %s%s", csvLabelEscaper.Replace(key), strings.Join(values, semicolonStr), Or)
+	}
+}
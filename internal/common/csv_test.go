@@ -0,0 +1,136 @@
+package common
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/common/model"
+)
+
+// newTestOutputRunContext returns a run of the given configuration (nil for the default one) writing under a
+// temporary root folder, with the folder of cluster c1 nodes, ended when the test is done
+func newTestOutputRunContext(t *testing.T, cfg *RunConfig) *RunContext {
+	t.Helper()
+	rc := newTestRunContext(t, cfg)
+	rc.SetRootFolder(t.TempDir())
+	if err := os.MkdirAll(filepath.Join(rc.rootFolder, "c1", NodeEntityKind), dirPerm); err != nil {
+		t.Fatal(err)
+	}
+	return rc
+}
+
+func newTestSink(t *testing.T, rc *RunContext, columns string) Sink {
+	t.Helper()
+	sink, err := rc.NewSink(&OutputSpec{Cluster: "c1", EntityKind: NodeEntityKind, Name: Attributes.String(), Columns: strings.Split(columns, Comma)})
+	if err != nil {
+		t.Fatalf("NewSink() error = %v", err)
+	}
+	return sink
+}
+
+func readSink(t *testing.T, sink Sink) string {
+	t.Helper()
+	if err := sink.Close(); err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.ReadFile(sink.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func TestCsvSinkWriteRecord(t *testing.T) {
+	sink := newTestSink(t, newTestOutputRunContext(t, nil), "Name,Unknown,Cpu,Gpu,Ready,CreateTime,Labels,Runtimes")
+	ct := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	labels := LabelMap{Map: LabelValues{"b": {"x,y"}, "a": {`"1"`}, "r": {"z"}}, Reject: map[string]bool{"r": true}}
+	if err := sink.WriteRecord("n1", KnownValue(UnknownValue), 4, 0.5, true, TimeValue(&ct), labels, json.RawMessage(`{"a":"b"}`)); err != nil {
+		t.Fatalf("WriteRecord() error = %v", err)
+	}
+	got := readSink(t, sink)
+	want := "Name,Unknown,Cpu,Gpu,Ready,CreateTime,Labels,Runtimes\n" +
+		`n1,,4,0.500000,true,2024-05-01T10:00:00Z,a : 1|b : x y|,"{""a"":""b""}"` + "\n"
+	if got != want {
+		t.Fatalf("CSV = %q, want %q", got, want)
+	}
+}
+
+func TestCsvSinkWriteSample(t *testing.T) {
+	sink := newTestSink(t, newTestOutputRunContext(t, nil), "ClusterName,NodeName,MetricTime,cpuUtilization")
+	s := &Sample{Entity: []string{"c1", "n1"}, Time: model.TimeFromUnix(0), Metric: "cpuUtilization", Values: []any{1.5}}
+	if err := sink.WriteSample(s); err != nil {
+		t.Fatalf("WriteSample() error = %v", err)
+	}
+	got := readSink(t, sink)
+	want := "ClusterName,NodeName,MetricTime,cpuUtilization\nc1,n1," + FormatTime(s.Time) + ",1.500000\n"
+	if got != want {
+		t.Fatalf("CSV = %q, want %q", got, want)
+	}
+}
+
+func TestCsvSinkColumnCount(t *testing.T) {
+	sink := newTestSink(t, newTestOutputRunContext(t, nil), "ClusterName,NodeName")
+	if err := sink.WriteRecord("c1"); err == nil {
+		t.Error("WriteRecord() with a missing value: expected an error")
+	}
+	if err := sink.WriteSample(&Sample{Entity: []string{"c1"}, Values: []any{1.0}}); err == nil {
+		t.Error("WriteSample() with an extra value: expected an error")
+	}
+	_ = sink.Close()
+}
+
+func TestCsvSinkRfc4180(t *testing.T) {
+	cfg := NewRunConfig()
+	if err := cfg.SetCsvVersion(CsvRfc4180); err != nil {
+		t.Fatal(err)
+	}
+	rc := newTestOutputRunContext(t, cfg)
+	sink := newTestSink(t, rc, "Name,Entity,Cpu,Labels,Runtimes")
+	labels := LabelMap{Map: LabelValues{"a": {`say "hi", bye`}, "b": {"x|y"}}}
+	if err := sink.WriteRecord("n1", rc.ReplaceColons("c:1"), 4, labels, json.RawMessage(`{"a":"b"}`)); err != nil {
+		t.Fatalf("WriteRecord() error = %v", err)
+	}
+	if err := sink.WriteSample(&Sample{Entity: []string{"c,1", rc.ReplaceSemiColons("e;1")}, Time: model.TimeFromUnix(0), Values: []any{1.5, nil}}); err != nil {
+		t.Fatalf("WriteSample() error = %v", err)
+	}
+	got := readSink(t, sink)
+	want := "Name,Entity,Cpu,Labels,Runtimes\n" +
+		`n1,c:1,4,"a : say ""hi"", bye|b : x\|y|","{""a"":""b""}"` + "\n" +
+		`"c,1",e;1,` + FormatTime(model.TimeFromUnix(0)) + ",1.500000,\n"
+	if got != want {
+		t.Fatalf("CSV = %q, want %q", got, want)
+	}
+	if err := cfg.SetCsvVersion(3); err == nil {
+		t.Error("SetCsvVersion(3): expected an error")
+	}
+}
+
+func TestCsvSinkRfc4180LongLabels(t *testing.T) {
+	cfg := NewRunConfig()
+	if err := cfg.SetCsvVersion(CsvRfc4180); err != nil {
+		t.Fatal(err)
+	}
+	sink := newTestSink(t, newTestOutputRunContext(t, cfg), "Name,Labels")
+	key := "example.com/" + strings.Repeat("k", maxKeyLen)
+	annotation := `{"selector": "app in (a|b)", "note": "` + strings.Repeat("x", 2*maxKeyLen) + `"}`
+	labels := LabelMap{Map: LabelValues{key: {annotation}, "multi": {"a;b", `c\d`}}}
+	if err := sink.WriteRecord("n1", labels); err != nil {
+		t.Fatalf("WriteRecord() error = %v", err)
+	}
+	records, err := csv.NewReader(strings.NewReader(readSink(t, sink))).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 {
+		t.Fatalf("%d records, want 2", len(records))
+	}
+	want := key + " : " + strings.ReplaceAll(annotation, "|", `\|`) + "|multi : a\\;b;c\\\\d|"
+	if got := records[1][1]; got != want {
+		t.Errorf("labels = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,352 @@
+package common
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/prometheus/common/model"
+	"go.yaml.in/yaml/v3"
+)
+
+// the conversions of the values of the custom metrics
+const (
+	BytesToMiB     = "bytesToMiB"
+	CoresToMCores  = "coresToMCores"
+	RatioToPercent = "ratioToPercent"
+)
+
+var conversions = map[string]string{
+	BytesToMiB:     fmt.Sprintf(" / %d", Mib),
+	CoresToMCores:  fmt.Sprintf(" * %d", Milli),
+	RatioToPercent: " * 100",
+}
+
+var aggregations = []string{Sum, Avg, Max, Min, Count}
+
+var customEntityKinds = []string{ContainerEntityKind, NodeEntityKind, NodeGroupEntityKind, ClusterEntityKind, RqEntityKind, CrqEntityKind}
+
+// the entity kinds of the custom attributes, those with a labels column in their attributes outputs
+var customAttributeEntityKinds = []string{ContainerEntityKind, NodeEntityKind, NodeGroupEntityKind, CrqEntityKind}
+
+// identitySeparator joins the identity fields of an entity into a key
+const identitySeparator = "\x00"
+
+var customNameRegexp = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_ ]*$`)
+
+// CustomMetric is a workload metric of an entity kind collected by a PromQL query of its own. Identity maps
+// the identity columns of the entity kind (e.g. Namespace, EntityName, EntityType and ContainerName of
+// containers, NodeName of nodes; none for the cluster) to the labels of the query results holding them.
+type CustomMetric struct {
+	Name       string            `yaml:"name"`
+	Query      string            `yaml:"query"`
+	EntityKind string            `yaml:"entityKind"`
+	Identity   map[string]string `yaml:"identity"`
+	// Aggregation is one of sum, avg, max, min, count, applied by the identity labels, if set
+	Aggregation string `yaml:"aggregation"`
+	// Conversion is one of bytesToMiB, coresToMCores, ratioToPercent, if set
+	Conversion   string `yaml:"conversion"`
+	wmh          *WorkloadMetricHolder
+	query        string
+	metricFields []model.LabelName
+}
+
+// CustomAttribute adds attributes of an entity kind (container, node, node_group or crq) taken from the
+// results of a PromQL query to the labels of its attributes output (ContainerLabels, NodeLabels, NodeLabels
+// and NamespaceLabels respectively). Identity maps the identity columns of the entity kind to the labels of the
+// results holding them, as for CustomMetric; the values are matched against the names of the entities as
+// collected, i.e. before any pseudonymization. Labels maps the attribute keys to the labels holding their
+// values; the keys go through the label policy as other labels unless prefixed with label_ or annotation_.
+type CustomAttribute struct {
+	Query      string            `yaml:"query"`
+	EntityKind string            `yaml:"entityKind"`
+	Identity   map[string]string `yaml:"identity"`
+	Labels     map[string]string `yaml:"labels"`
+	// Override - the values replace those of the collected labels and of the earlier attributes; otherwise
+	// they are only added for the keys not set yet
+	Override     bool `yaml:"override"`
+	metricFields []model.LabelName
+}
+
+// CustomConfig holds the custom metrics and attributes and the query overrides (see QueryOverride), read
+// from a YAML (or JSON) file:
+//
+//	metrics:
+//	  - name: queue depth
+//	    query: max(app_queue_depth{}) by (namespace, deployment, container)
+//	    entityKind: container
+//	    identity:
+//	      Namespace: namespace
+//	      EntityName: deployment
+//	      EntityType: owner_kind
+//	      ContainerName: container
+//	  - name: node swap used
+//	    query: node_memory_SwapTotal_bytes{} - node_memory_SwapFree_bytes{}
+//	    entityKind: node
+//	    identity:
+//	      NodeName: instance
+//	    aggregation: max
+//	    conversion: bytesToMiB
+//
+//	attributes:
+//	  - query: max(app_owner_info{}) by (namespace, deployment, container, cost_center, team)
+//	    entityKind: container
+//	    identity:
+//	      Namespace: namespace
+//	      EntityName: deployment
+//	      EntityType: owner_kind
+//	      ContainerName: container
+//	    labels:
+//	      cost_center: cost_center
+//	      label_team: team
+//	    override: true
+//
+// Each metric is written to a workload output of its entity kind named after it, e.g. queue_depth.
+// The attributes are applied in the order of the file: the values of an attribute without override are kept
+// only for the keys neither collected nor set by an earlier attribute, while those of an attribute with
+// override replace them, so the last attribute with override setting a key wins. The distinct values of
+// several series of an entity are joined as for multi-valued labels.
+type CustomConfig struct {
+	Metrics    []*CustomMetric    `yaml:"metrics"`
+	Attributes []*CustomAttribute `yaml:"attributes"`
+	Overrides  []*QueryOverride   `yaml:"overrides"`
+}
+
+// SetCustomConfig reads and validates the custom metrics file
+func (cfg *RunConfig) SetCustomConfig(fileName string) error {
+	if fileName == Empty {
+		return nil
+	}
+	b, err := os.ReadFile(fileName)
+	if err != nil {
+		return err
+	}
+	cc := &CustomConfig{}
+	if err = yaml.Unmarshal(b, cc); err != nil {
+		return fmt.Errorf("%s: %v", fileName, err)
+	}
+	if err = cc.compile(); err != nil {
+		return fmt.Errorf("%s: %v", fileName, err)
+	}
+	cfg.custom = cc
+	return nil
+}
+
+// CustomMetrics returns the custom metrics of an entity kind
+func (rc *RunContext) CustomMetrics(entityKind string) (cms []*CustomMetric) {
+	for _, cm := range rc.config.custom.Metrics {
+		if cm.EntityKind == entityKind {
+			cms = append(cms, cm)
+		}
+	}
+	return
+}
+
+// HasCustomAttributes tells if any custom attributes are configured
+func (rc *RunContext) HasCustomAttributes() bool {
+	return len(rc.config.custom.Attributes) > 0
+}
+
+// HasCustomMetrics tells if any custom metrics are configured
+func (rc *RunContext) HasCustomMetrics() bool {
+	return len(rc.config.custom.Metrics) > 0
+}
+
+func (cc *CustomConfig) compile() error {
+	names := make(map[string]bool, len(cc.Metrics))
+	for i, cm := range cc.Metrics {
+		if err := cm.compile(); err != nil {
+			return fmt.Errorf("metric %d: %v", i+1, err)
+		}
+		key := JoinSpace(cm.EntityKind, cm.wmh.GetFileName())
+		if names[key] {
+			return fmt.Errorf("metric %d: duplicate %s metric %s", i+1, cm.EntityKind, cm.Name)
+		}
+		names[key] = true
+	}
+	for i, ca := range cc.Attributes {
+		if err := ca.compile(); err != nil {
+			return fmt.Errorf("attribute %d: %v", i+1, err)
+		}
+	}
+	ids := make(map[string]bool, len(cc.Overrides))
+	for i, qo := range cc.Overrides {
+		if err := qo.compile(); err != nil {
+			return fmt.Errorf("override %d: %v", i+1, err)
+		}
+		if ids[qo.Id()] {
+			return fmt.Errorf("override %d: duplicate override of %s", i+1, qo.Id())
+		}
+		ids[qo.Id()] = true
+	}
+	return nil
+}
+
+func (ca *CustomAttribute) compile() (err error) {
+	if strings.TrimSpace(ca.Query) == Empty {
+		return fmt.Errorf("no query")
+	}
+	if !slices.Contains(customAttributeEntityKinds, ca.EntityKind) {
+		return fmt.Errorf("unknown entity kind %q, supported: %s", ca.EntityKind, strings.Join(customAttributeEntityKinds, ", "))
+	}
+	if ca.metricFields, err = identityMetricFields(ca.EntityKind, ca.Identity); err != nil {
+		return
+	}
+	if len(ca.Labels) == 0 {
+		return fmt.Errorf("no labels")
+	}
+	for key, label := range ca.Labels {
+		if key == Empty || !model.LabelName(label).IsValid() {
+			return fmt.Errorf("attribute key %q not mapped to a valid label", key)
+		}
+	}
+	return
+}
+
+func (cm *CustomMetric) compile() error {
+	if !customNameRegexp.MatchString(cm.Name) {
+		return fmt.Errorf("invalid name %q, letters, digits, spaces and underscores expected", cm.Name)
+	}
+	if strings.TrimSpace(cm.Query) == Empty {
+		return fmt.Errorf("%s: no query", cm.Name)
+	}
+	if !slices.Contains(customEntityKinds, cm.EntityKind) {
+		return fmt.Errorf("%s: unknown entity kind %q, supported: %s", cm.Name, cm.EntityKind, strings.Join(customEntityKinds, ", "))
+	}
+	var err error
+	if cm.metricFields, err = identityMetricFields(cm.EntityKind, cm.Identity); err != nil {
+		return fmt.Errorf("%s: %v", cm.Name, err)
+	}
+	labels := make([]string, len(cm.metricFields))
+	for i, mf := range cm.metricFields {
+		labels[i] = string(mf)
+	}
+	cm.query = cm.Query
+	if cm.Aggregation != Empty {
+		if !slices.Contains(aggregations, cm.Aggregation) {
+			return fmt.Errorf("%s: unknown aggregation %s, supported: %s", cm.Name, cm.Aggregation, strings.Join(aggregations, ", "))
+		}
+		cm.query = cm.Aggregation + Wrap(cm.query, Parenthesis)
+		if len(labels) > 0 {
+			cm.query += " by " + Wrap(JoinComma(labels...), Parenthesis)
+		}
+	}
+	if cm.Conversion != Empty {
+		conv, f := conversions[cm.Conversion]
+		if !f {
+			return fmt.Errorf("%s: unknown conversion %s, supported: %s, %s, %s", cm.Name, cm.Conversion, BytesToMiB, CoresToMCores, RatioToPercent)
+		}
+		cm.query = Wrap(cm.query, Parenthesis) + conv
+	}
+	cm.wmh = NewWorkloadMetricHolder(cm.Name)
+	return nil
+}
+
+// identityColumns returns the columns identifying the entities of a kind in its workload outputs, except the
+// cluster name
+func identityColumns(entityKind string) (columns []string) {
+	if entityKind == ClusterEntityKind {
+		return
+	}
+	hb := headerBuilders[entityKind]
+	if hb.includeNamespace {
+		columns = append(columns, CamelCase(Namespace))
+	}
+	return append(columns, strings.Split(hb.entityKindName, Comma)...)
+}
+
+// identityMetricFields returns the labels of the identity columns of an entity kind, in the order of the columns
+func identityMetricFields(entityKind string, identity map[string]string) ([]model.LabelName, error) {
+	columns := identityColumns(entityKind)
+	for column := range identity {
+		if !slices.Contains(columns, column) {
+			return nil, fmt.Errorf("unknown identity column %s of %s, expected: %s", column, entityKind, strings.Join(columns, ", "))
+		}
+	}
+	metricFields := make([]model.LabelName, 0, len(columns))
+	for _, column := range columns {
+		label, f := identity[column]
+		if !f || !model.LabelName(label).IsValid() {
+			return nil, fmt.Errorf("identity column %s not mapped to a valid label", column)
+		}
+		metricFields = append(metricFields, model.LabelName(label))
+	}
+	return metricFields, nil
+}
+
+// GetWorkload collects the custom metric into the workload output of its entity kind
+func (cm *CustomMetric) GetWorkload(rc *RunContext) {
+	qps := map[string]*QueryProcessor{cm.query: {MetricFields: cm.metricFields}}
+	cm.wmh.GetWorkloadQueryVariants(rc, 1, qps, cm.EntityKind)
+}
+
+// CustomAttributes holds the values of the custom attributes of an entity kind, per attribute, cluster and
+// entity identity
+type CustomAttributes struct {
+	attributes []*CustomAttribute
+	values     []map[string]map[string]LabelValues
+}
+
+// GetCustomAttributes queries the custom attributes of an entity kind; it returns nil if there are none
+func (rc *RunContext) GetCustomAttributes(entityKind string) *CustomAttributes {
+	var cas *CustomAttributes
+	for _, ca := range rc.config.custom.Attributes {
+		if ca.EntityKind != entityKind {
+			continue
+		}
+		if cas == nil {
+			cas = &CustomAttributes{}
+		}
+		values := make(map[string]map[string]LabelValues)
+		_, _ = rc.CollectAndProcessMetric(ca.Query, rc.TimeRange(), func(cluster string, result model.Matrix) {
+			ca.addValues(cluster, result, values)
+		})
+		cas.attributes = append(cas.attributes, ca)
+		cas.values = append(cas.values, values)
+	}
+	return cas
+}
+
+func (ca *CustomAttribute) addValues(cluster string, result model.Matrix, values map[string]map[string]LabelValues) {
+	fp := &FieldProvider{Cluster: cluster, MetricFields: ca.metricFields}
+	for _, ss := range result {
+		fields, ok := fp.Fields(ss.Metric)
+		if !ok {
+			continue
+		}
+		entities, f := values[cluster]
+		if !f {
+			entities = make(map[string]LabelValues)
+			values[cluster] = entities
+		}
+		id := strings.Join(fields, identitySeparator)
+		attrs, f := entities[id]
+		if !f {
+			attrs = make(LabelValues, len(ca.Labels))
+			entities[id] = attrs
+		}
+		for key, label := range ca.Labels {
+			if value := string(ss.Metric[model.LabelName(label)]); value != Empty {
+				AddToLabelMap(key, value, attrs)
+			}
+		}
+	}
+}
+
+// Merge merges the custom attributes of an entity, identified by its cluster and identity fields (in the
+// order of the identity columns), into its labels
+func (cas *CustomAttributes) Merge(cluster string, labelMap LabelValues, identity ...string) {
+	if cas == nil {
+		return
+	}
+	id := strings.Join(identity, identitySeparator)
+	for i, ca := range cas.attributes {
+		for key, values := range cas.values[i][cluster][id] {
+			if _, f := labelMap[key]; ca.Override || !f {
+				labelMap[key] = slices.Clone(values)
+			}
+		}
+	}
+}
@@ -0,0 +1,192 @@
+package common
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/common/model"
+)
+
+// setTestCustomConfig returns a run of the custom configuration, which is left empty if invalid
+func setTestCustomConfig(t *testing.T, config string) (*RunContext, error) {
+	t.Helper()
+	fileName := filepath.Join(t.TempDir(), "custom.yaml")
+	if err := os.WriteFile(fileName, []byte(config), 0600); err != nil {
+		t.Fatal(err)
+	}
+	cfg := NewRunConfig()
+	err := cfg.SetCustomConfig(fileName)
+	return newTestRunContext(t, cfg), err
+}
+
+const testCustomConfig = `
+metrics:
+  - name: queue depth
+    query: app_queue_depth{}
+    entityKind: container
+    identity:
+      Namespace: namespace
+      EntityName: deployment
+      EntityType: owner_kind
+      ContainerName: container
+  - name: node_swap_used
+    query: node_memory_SwapTotal_bytes{} - node_memory_SwapFree_bytes{}
+    entityKind: node
+    identity:
+      NodeName: instance
+    aggregation: max
+    conversion: bytesToMiB
+  - name: pending pods
+    query: kube_pod_status_phase{phase="Pending"}
+    entityKind: cluster
+    aggregation: sum
+`
+
+func TestCustomConfig(t *testing.T) {
+	rc, err := setTestCustomConfig(t, testCustomConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !rc.HasCustomMetrics() {
+		t.Fatal("no custom metrics")
+	}
+	tests := []struct {
+		entityKind, fileName, query string
+		fields                      int
+	}{
+		{ContainerEntityKind, "queue_depth", "app_queue_depth{}", 4},
+		{NodeEntityKind, "node_swap_used", "(max(node_memory_SwapTotal_bytes{} - node_memory_SwapFree_bytes{}) by (instance)) / 1048576", 1},
+		{ClusterEntityKind, "pending_pods", `sum(kube_pod_status_phase{phase="Pending"})`, 0},
+	}
+	for _, test := range tests {
+		cms := rc.CustomMetrics(test.entityKind)
+		if len(cms) != 1 {
+			t.Fatalf("%d %s metrics, want 1", len(cms), test.entityKind)
+		}
+		cm := cms[0]
+		if cm.wmh.GetFileName() != test.fileName {
+			t.Errorf("file name = %s, want %s", cm.wmh.GetFileName(), test.fileName)
+		}
+		if cm.query != test.query {
+			t.Errorf("query = %s, want %s", cm.query, test.query)
+		}
+		if len(cm.metricFields) != test.fields {
+			t.Errorf("%s: %d metric fields, want %d", cm.Name, len(cm.metricFields), test.fields)
+		}
+	}
+	if fields := rc.CustomMetrics(ContainerEntityKind)[0].metricFields; fields[1] != "deployment" || fields[2] != "owner_kind" {
+		t.Errorf("metric fields = %v, want the identity columns order", fields)
+	}
+}
+
+func TestCustomConfigErrors(t *testing.T) {
+	tests := map[string]string{
+		"entity kind":  "metrics:\n  - name: a\n    query: up\n    entityKind: hpa\n",
+		"identity":     "metrics:\n  - name: a\n    query: up\n    entityKind: node\n",
+		"column":       "metrics:\n  - name: a\n    query: up\n    entityKind: cluster\n    identity:\n      NodeName: instance\n",
+		"aggregation":  "metrics:\n  - name: a\n    query: up\n    entityKind: cluster\n    aggregation: median\n",
+		"conversion":   "metrics:\n  - name: a\n    query: up\n    entityKind: cluster\n    conversion: kb\n",
+		"no query":     "metrics:\n  - name: a\n    entityKind: cluster\n",
+		"invalid name": "metrics:\n  - name: a/b\n    query: up\n    entityKind: cluster\n",
+		"duplicate":    "metrics:\n  - name: a b\n    query: up\n    entityKind: cluster\n  - name: a_b\n    query: up\n    entityKind: cluster\n",
+	}
+	for name, config := range tests {
+		rc, err := setTestCustomConfig(t, config)
+		if err == nil {
+			t.Errorf("%s: no error", name)
+		} else if !strings.Contains(err.Error(), "metric 1") && !strings.Contains(err.Error(), "metric 2") {
+			t.Errorf("%s: error %v does not name the metric", name, err)
+		}
+		if rc.HasCustomMetrics() {
+			t.Errorf("%s: invalid config set", name)
+		}
+	}
+}
+
+const testCustomAttributes = `
+attributes:
+  - query: app_owner_info{}
+    entityKind: node
+    identity:
+      NodeName: node
+    labels:
+      team: team
+      label_tier: tier
+  - query: cost_info{}
+    entityKind: node
+    identity:
+      NodeName: node
+    labels:
+      team: owner
+      cost_center: cost_center
+    override: true
+`
+
+func TestCustomAttributes(t *testing.T) {
+	rc, err := setTestCustomConfig(t, testCustomAttributes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	results := []model.Matrix{
+		{
+			{Metric: model.Metric{"node": "n1", "team": "a", "tier": "front"}},
+			{Metric: model.Metric{"node": "n1", "team": "b"}},
+			{Metric: model.Metric{"team": "c"}},
+		},
+		{
+			{Metric: model.Metric{"node": "n1", "owner": "d"}},
+			{Metric: model.Metric{"node": "n2", "cost_center": "cc"}},
+		},
+	}
+	cas := &CustomAttributes{}
+	for i, ca := range rc.config.custom.Attributes {
+		values := make(map[string]map[string]LabelValues)
+		ca.addValues("c1", results[i], values)
+		cas.attributes = append(cas.attributes, ca)
+		cas.values = append(cas.values, values)
+	}
+	n1 := LabelValues{"label_tier": {"back"}}
+	cas.Merge("c1", n1, "n1")
+	if !slices.Equal(n1["label_tier"], []string{"back"}) || !slices.Equal(n1["team"], []string{"d"}) || len(n1) != 2 {
+		t.Errorf("n1 labels = %v, want the collected tier and the overridden team", n1)
+	}
+	n2 := LabelValues{"cost_center": {"x"}}
+	cas.Merge("c1", n2, "n2")
+	if !slices.Equal(n2["cost_center"], []string{"cc"}) {
+		t.Errorf("n2 labels = %v, want the overridden cost center", n2)
+	}
+	n3 := LabelValues{}
+	cas.Merge("c2", n3, "n1")
+	if len(n3) != 0 {
+		t.Errorf("labels of another cluster = %v, want none", n3)
+	}
+	cas.attributes[1].Override = false
+	n1 = LabelValues{}
+	cas.Merge("c1", n1, "n1")
+	if !slices.Equal(n1["team"], []string{"a", "b"}) || !slices.Equal(n1["label_tier"], []string{"front"}) {
+		t.Errorf("n1 labels = %v, want the values of the first attribute", n1)
+	}
+	var none *CustomAttributes
+	none.Merge("c1", n1, "n1")
+}
+
+func TestCustomAttributesErrors(t *testing.T) {
+	tests := map[string]string{
+		"entity kind": "attributes:\n  - query: up\n    entityKind: rq\n    labels:\n      a: b\n",
+		"identity":    "attributes:\n  - query: up\n    entityKind: node\n    labels:\n      a: b\n",
+		"labels":      "attributes:\n  - query: up\n    entityKind: node\n    identity:\n      NodeName: node\n",
+		"label":       "attributes:\n  - query: up\n    entityKind: node\n    identity:\n      NodeName: node\n    labels:\n      a: \"\"\n",
+	}
+	for name, config := range tests {
+		rc, err := setTestCustomConfig(t, config)
+		if err == nil || !strings.Contains(err.Error(), "attribute 1") {
+			t.Errorf("%s: error %v, want one naming the attribute", name, err)
+		}
+		if rc.HasCustomAttributes() {
+			t.Errorf("%s: invalid config set", name)
+		}
+	}
+}
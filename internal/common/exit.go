@@ -0,0 +1,46 @@
+package common
+
+// ExitCode is the process exit code, distinct per failure class so that the
+// caller (e.g. entry.sh or a k8s job controller) can tell them apart
+type ExitCode int
+
+const (
+	ExitOK ExitCode = iota
+	ExitFailure
+	ExitUsage
+	ExitConfig
+	ExitClusterFilter
+	ExitOutput
+	ExitConnection
+	ExitPrometheus
+	ExitMissingExporters
+	ExitInterrupted
+)
+
+func (ec ExitCode) String() (s string) {
+	switch ec {
+	case ExitOK:
+		s = "ok"
+	case ExitFailure:
+		s = "failure"
+	case ExitUsage:
+		s = "usage"
+	case ExitConfig:
+		s = "configuration"
+	case ExitClusterFilter:
+		s = "cluster filter"
+	case ExitOutput:
+		s = "output"
+	case ExitConnection:
+		s = "connection"
+	case ExitPrometheus:
+		s = "prometheus"
+	case ExitMissingExporters:
+		s = "missing exporters"
+	case ExitInterrupted:
+		s = "interrupted"
+	default:
+		s = "unknown"
+	}
+	return
+}
@@ -0,0 +1,29 @@
+package common
+
+import "testing"
+
+// the exit codes are a contract with the callers (entry.sh, job controllers), they must not change
+func TestExitCodes(t *testing.T) {
+	tests := []struct {
+		ec   ExitCode
+		code int
+		name string
+	}{
+		{ExitOK, 0, "ok"},
+		{ExitFailure, 1, "failure"},
+		{ExitUsage, 2, "usage"},
+		{ExitConfig, 3, "configuration"},
+		{ExitClusterFilter, 4, "cluster filter"},
+		{ExitOutput, 5, "output"},
+		{ExitConnection, 6, "connection"},
+		{ExitPrometheus, 7, "prometheus"},
+		{ExitMissingExporters, 8, "missing exporters"},
+		{ExitInterrupted, 9, "interrupted"},
+		{ExitInterrupted + 1, 10, "unknown"},
+	}
+	for _, test := range tests {
+		if int(test.ec) != test.code || test.ec.String() != test.name {
+			t.Errorf("exit code %d %q, want %d %q", int(test.ec), test.ec, test.code, test.name)
+		}
+	}
+}
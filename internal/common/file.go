@@ -0,0 +1,123 @@
+package common
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+const (
+	ExistingOverwrite = "overwrite"
+	ExistingAppend    = "append"
+	ExistingFail      = "fail"
+)
+
+var existingPolicies = map[string]bool{
+	ExistingOverwrite: true,
+	ExistingAppend:    true,
+	ExistingFail:      true,
+}
+
+const tmpExt = ".tmp"
+
+// SetExistingPolicy sets what happens to an output file left by an earlier run: overwrite it (the default),
+// append to it or fail
+func (cfg *RunConfig) SetExistingPolicy(policy string) error {
+	if !existingPolicies[policy] {
+		return fmt.Errorf("unknown existing files policy %s, supported: %s, %s, %s", policy, ExistingOverwrite, ExistingAppend, ExistingFail)
+	}
+	cfg.existingPolicy = policy
+	return nil
+}
+
+// atomicFile is an output written to a temporary file in its directory, which is renamed into place on Close:
+// a reader never sees a partly written output, and a crash leaves only the temporary file
+type atomicFile struct {
+	*os.File
+	fileName string
+}
+
+// createAtomicFile creates the output file, applying the existing files policy; appended is set if the content
+// of an existing file has been copied to the new one. Outputs which cannot be appended to fail on append.
+func createAtomicFile(fileName, existingPolicy string, appendable bool) (of *atomicFile, appended bool, err error) {
+	var existing *os.File
+	existing, err = os.Open(fileName)
+	switch {
+	case err == nil:
+		defer func() { _ = existing.Close() }()
+		if existingPolicy == ExistingFail {
+			return nil, false, fmt.Errorf("%s: %w", fileName, os.ErrExist)
+		}
+		if existingPolicy == ExistingAppend && !appendable {
+			return nil, false, fmt.Errorf("%s: %w, cannot append to it", fileName, os.ErrExist)
+		}
+	case os.IsNotExist(err):
+		err = nil
+	default:
+		return
+	}
+	of = &atomicFile{fileName: fileName}
+	if of.File, err = createTempFile(fileName); err != nil {
+		return nil, false, err
+	}
+	if existing != nil && existingPolicy == ExistingAppend {
+		var n int64
+		if n, err = io.Copy(of.File, existing); err != nil {
+			of.discard()
+			return nil, false, err
+		}
+		appended = n > 0
+	}
+	return
+}
+
+func createTempFile(fileName string) (file *os.File, err error) {
+	if file, err = os.CreateTemp(filepath.Dir(fileName), "."+filepath.Base(fileName)+".*"+tmpExt); err == nil {
+		if err = file.Chmod(logFilePerm); err != nil {
+			_ = file.Close()
+			_ = os.Remove(file.Name())
+		}
+	}
+	return
+}
+
+// Name is the name of the output, not of the temporary file
+func (of *atomicFile) Name() string {
+	return of.fileName
+}
+
+// Close syncs and closes the temporary file and renames it to the output, so that the output is
+// complete on disk once it has its name
+func (of *atomicFile) Close() error {
+	if err := of.File.Sync(); err != nil {
+		of.discard()
+		return err
+	}
+	if err := of.File.Close(); err != nil {
+		_ = os.Remove(of.File.Name())
+		return err
+	}
+	return os.Rename(of.File.Name(), of.fileName)
+}
+
+// discard closes and removes the temporary file, leaving the output (if any) as it was
+func (of *atomicFile) discard() {
+	_ = of.File.Close()
+	_ = os.Remove(of.File.Name())
+}
+
+// writeFileAtomic writes a whole file through a temporary file, replacing the file if it exists
+func writeFileAtomic(fileName string, b []byte) error {
+	file, err := createTempFile(fileName)
+	if err != nil {
+		return err
+	}
+	if _, err = file.Write(b); err != nil {
+		_ = file.Close()
+		_ = os.Remove(file.Name())
+		return err
+	}
+	of := &atomicFile{File: file, fileName: fileName}
+	return of.Close()
+}
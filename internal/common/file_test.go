@@ -0,0 +1,76 @@
+package common
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeTestCsv(t *testing.T, rc *RunContext, columns string, values ...any) (Sink, error) {
+	t.Helper()
+	sink, err := rc.NewSink(&OutputSpec{Cluster: "c1", EntityKind: NodeEntityKind, Name: Attributes.String(), Columns: strings.Split(columns, Comma)})
+	if err != nil {
+		return nil, err
+	}
+	if err = sink.WriteRecord(values...); err != nil {
+		t.Fatal(err)
+	}
+	return sink, nil
+}
+
+func TestAtomicFile(t *testing.T) {
+	rc := newTestOutputRunContext(t, nil)
+	sink, err := writeTestCsv(t, rc, "Name", "n1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = os.Stat(sink.Name()); !os.IsNotExist(err) {
+		t.Errorf("output exists before Close(): %v", err)
+	}
+	if got := readSink(t, sink); got != "Name\nn1\n" {
+		t.Errorf("CSV = %q", got)
+	}
+	entries, _ := os.ReadDir(filepath.Dir(sink.Name()))
+	if l := len(entries); l != 1 {
+		t.Errorf("%d files after Close(), want 1", l)
+	}
+}
+
+func TestExistingPolicy(t *testing.T) {
+	tests := []struct {
+		policy  string
+		columns string
+		want    string
+		wantErr error
+	}{
+		{policy: ExistingOverwrite, columns: "Name", want: "Name\nn2\n"},
+		{policy: ExistingAppend, columns: "Name", want: "Name\nn1\nn2\n"},
+		{policy: ExistingAppend, columns: "Node", want: "Name\nn1\n", wantErr: errors.New("header")},
+		{policy: ExistingFail, columns: "Name", want: "Name\nn1\n", wantErr: os.ErrExist},
+	}
+	for _, tt := range tests {
+		t.Run(tt.policy+"-"+tt.columns, func(t *testing.T) {
+			rc := newTestOutputRunContext(t, nil)
+			sink, err := writeTestCsv(t, rc, "Name", "n1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			fileName := sink.Name()
+			_ = readSink(t, sink)
+			if err = rc.config.SetExistingPolicy(tt.policy); err != nil {
+				t.Fatal(err)
+			}
+			if sink, err = writeTestCsv(t, rc, tt.columns, "n2"); err == nil {
+				err = sink.Close()
+			}
+			if (err != nil) != (tt.wantErr != nil) || (errors.Is(tt.wantErr, os.ErrExist) && !errors.Is(err, os.ErrExist)) {
+				t.Errorf("error = %v, want %v", err, tt.wantErr)
+			}
+			if b, _ := os.ReadFile(fileName); string(b) != tt.want {
+				t.Errorf("CSV = %q, want %q", b, tt.want)
+			}
+		})
+	}
+}
@@ -3,6 +3,7 @@ package common
 import (
 	"fmt"
 	"strings"
+	"sync"
 
 	cconf "github.com/densify-dev/container-config/config"
 	"github.com/prometheus/common/model"
@@ -32,67 +33,97 @@ type Result struct {
 
 type ClusterResultMap map[string]*Result
 
-func NumClusters() int {
-	return len(ClusterNames)
+// ClusterNames are the names of the clusters of the run, in the order of their filters
+func (rc *RunContext) ClusterNames() []string {
+	return rc.clusterNames
 }
 
-func Eval(n int, eval bool) int {
+func (rc *RunContext) NumClusters() int {
+	return len(rc.clusterNames)
+}
+
+func (rc *RunContext) Eval(n int, eval bool) int {
 	if eval {
 		return n
 	} else {
-		return NumClusters() - n
+		return rc.NumClusters() - n
 	}
 }
 
 var BoolValues = []bool{true, false}
 
-func FoundCounter(n int) (res []bool) {
+func (rc *RunContext) FoundCounter(n int) (res []bool) {
 	for _, b := range BoolValues {
-		if Eval(n, b) > 0 {
+		if rc.Eval(n, b) > 0 {
 			res = append(res, b)
 		}
 	}
 	return
 }
 
-func Found(indicators map[string]int, indicator string, eval bool) bool {
-	return Eval(indicators[indicator], eval) > 0
+// Indicators count, per indicator, the clusters for which a metric has been found; the stages of a run
+// run concurrently, so they are guarded
+type Indicators struct {
+	counts map[string]int
+	mu     sync.Mutex
+}
+
+func NewIndicators() *Indicators {
+	return &Indicators{counts: make(map[string]int)}
+}
+
+func (in *Indicators) Inc(indicator string) {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	in.counts[indicator]++
+}
+
+func (in *Indicators) Get(indicator string) int {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	return in.counts[indicator]
+}
+
+func (rc *RunContext) Found(indicators *Indicators, indicator string, eval bool) bool {
+	return rc.Eval(indicators.Get(indicator), eval) > 0
 }
 
-func FoundIndicatorCounter(indicators map[string]int, indicator string) []bool {
-	return FoundCounter(indicators[indicator])
+func (rc *RunContext) FoundIndicatorCounter(indicators *Indicators, indicator string) []bool {
+	return rc.FoundCounter(indicators.Get(indicator))
 }
 
-func RegisterClusterFilters(cfps []*cconf.ClusterFilterParameters) error {
+// RegisterClusterFilters sets the cluster filters of the run
+func (rc *RunContext) RegisterClusterFilters(cfps []*cconf.ClusterFilterParameters) error {
+	rc.clusterNames, rc.filtersByName, rc.labelFilters, rc.noIdentifiersFilter = nil, make(map[string]*ClusterFilter), make(map[model.Fingerprint]*queryLabelFilter), false
 	for _, cfp := range cfps {
-		if err := registerClusterFilter(NewClusterFilter(cfp)); err != nil {
+		if err := rc.registerClusterFilter(NewClusterFilter(cfp)); err != nil {
 			return err
 		}
 	}
-	for _, qlf := range labelFilters {
+	for _, qlf := range rc.labelFilters {
 		qlf.finalize()
 	}
 	return nil
 }
 
-func registerClusterFilter(cf *ClusterFilter) error {
-	if err := cf.validate(); err != nil {
+func (rc *RunContext) registerClusterFilter(cf *ClusterFilter) error {
+	if err := rc.validateClusterFilter(cf); err != nil {
 		return err
 	}
-	for _, filter := range filtersByName {
-		if err := filter.validateDistinct(cf); err != nil {
+	for _, filter := range rc.filtersByName {
+		if err := rc.validateDistinct(filter, cf); err != nil {
 			return err
 		}
 	}
-	ClusterNames = append(ClusterNames, cf.spec.Name)
-	filtersByName[cf.spec.Name] = cf
+	rc.clusterNames = append(rc.clusterNames, cf.spec.Name)
+	rc.filtersByName[cf.spec.Name] = cf
 	lns := KeySet(cf.spec.Identifiers)
 	fp := fingerprint(lns)
 	var qlf *queryLabelFilter
 	var found bool
-	if qlf, found = labelFilters[fp]; !found {
+	if qlf, found = rc.labelFilters[fp]; !found {
 		qlf = &queryLabelFilter{labelNames: lns, filter: &labelFilter{}}
-		labelFilters[fp] = qlf
+		rc.labelFilters[fp] = qlf
 	}
 	qlf.clusterFilters = append(qlf.clusterFilters, cf)
 	return nil
@@ -105,23 +136,19 @@ type queryLabelFilter struct {
 }
 
 var queryPerCluster = true
-var filtersByName = make(map[string]*ClusterFilter)
-var ClusterNames []string
-var noIdentifiersFilter bool
-var labelFilters = make(map[model.Fingerprint]*queryLabelFilter)
 
-func (cf *ClusterFilter) validate() (err error) {
+func (rc *RunContext) validateClusterFilter(cf *ClusterFilter) (err error) {
 	if cf == nil || cf.spec == nil || cf.spec.Name == Empty {
 		err = fmt.Errorf("nil cluster or cluster with no name")
 	} else if len(cf.spec.Identifiers) == 0 {
 		// cf.Identifiers may be nil or Empty, but only if we have a single filter
-		noIdentifiersFilter = true
+		rc.noIdentifiersFilter = true
 	}
 	return
 }
 
-func (cf *ClusterFilter) validateDistinct(other *ClusterFilter) (err error) {
-	if noIdentifiersFilter {
+func (rc *RunContext) validateDistinct(cf, other *ClusterFilter) (err error) {
+	if rc.noIdentifiersFilter {
 		err = fmt.Errorf("a cluster filter with no identifiers is not distinct")
 	} else if cf.spec.Name == other.spec.Name {
 		err = fmt.Errorf("cluster filter with name %s already configured", cf.spec.Name)
@@ -266,7 +293,7 @@ func (qlf *queryLabelFilter) filterValue(cluster, query string, value model.Valu
 		e = fmt.Errorf("cannot filter model.Value of type %T by cluster", v)
 	}
 	if e == nil && mat.Len() == 0 {
-		e = fmt.Errorf("no data returned, model.Matrix is empty")
+		e = errNoData
 	}
 	// if passed original error, use it
 	if err != nil {
@@ -0,0 +1,113 @@
+package common
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"time"
+)
+
+const jsonlFileExt = ".jsonl"
+
+// jsonlSink writes the records of an output as JSON Lines, a JSON object per record keyed by the column names
+// (in column order). Unlike the CSV, the labels are written in full: a JSON object with the values of the
+// multi-valued labels as arrays.
+type jsonlSink struct {
+	spec *OutputSpec
+	file *atomicFile
+	buf  bytes.Buffer
+}
+
+func newJsonlSink(spec *OutputSpec) (Sink, error) {
+	file, _, err := spec.createFile(jsonlFileExt, true)
+	if err != nil {
+		return nil, err
+	}
+	return &jsonlSink{spec: spec, file: file}, nil
+}
+
+func (js *jsonlSink) Name() string {
+	return js.file.Name()
+}
+
+func (js *jsonlSink) WriteRecord(values ...any) error {
+	if l := len(values); l != len(js.spec.Columns) {
+		return fmt.Errorf("%s: %d values for %d columns", js.Name(), l, len(js.spec.Columns))
+	}
+	return js.writeRow(values)
+}
+
+func (js *jsonlSink) WriteSample(s *Sample) error {
+	values := make([]any, 0, len(js.spec.Columns))
+	for _, field := range s.Entity {
+		values = append(values, field)
+	}
+	values = append(values, s.Time.Time())
+	values = append(values, s.Values...)
+	if l := len(values); l != len(js.spec.Columns) {
+		return fmt.Errorf("%s: %d values for %d columns", js.Name(), l, len(js.spec.Columns))
+	}
+	return js.writeRow(values)
+}
+
+func (js *jsonlSink) writeRow(values []any) error {
+	js.buf.Reset()
+	js.buf.WriteByte('{')
+	for i, value := range values {
+		if i > 0 {
+			js.buf.WriteString(Comma)
+		}
+		key, _ := json.Marshal(js.spec.Columns[i])
+		js.buf.Write(key)
+		js.buf.WriteString(colon)
+		b, err := json.Marshal(jsonValue(value))
+		if err != nil {
+			return fmt.Errorf("%s: column %s: %v", js.Name(), js.spec.Columns[i], err)
+		}
+		js.buf.Write(b)
+	}
+	js.buf.WriteString("}" + lf)
+	_, err := js.file.Write(js.buf.Bytes())
+	return err
+}
+
+func (js *jsonlSink) Close() error {
+	return js.file.Close()
+}
+
+// jsonValue returns the JSON representation of a record value; JSON has no NaN or infinity, these are null
+func jsonValue(value any) any {
+	switch v := value.(type) {
+	case float64:
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return nil
+		}
+	case float32:
+		return jsonValue(float64(v))
+	case time.Time:
+		return Format(&v)
+	case LabelMap:
+		return jsonLabels(&v)
+	}
+	return value
+}
+
+// jsonLabels returns the labels as a map, with the values of a multi-valued label as an array
+func jsonLabels(lm *LabelMap) map[string]any {
+	if lm.Map == nil {
+		return nil
+	}
+	m := make(map[string]any, len(lm.Map))
+	for key, values := range lm.Map {
+		if lm.Reject[key] {
+			continue
+		}
+		if len(values) == 1 {
+			m[key] = values[0]
+		} else {
+			m[key] = values
+		}
+	}
+	return m
+}
@@ -0,0 +1,54 @@
+package common
+
+import (
+	"encoding/json"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/common/model"
+)
+
+func TestJsonlSinkWriteRecord(t *testing.T) {
+	rc := newTestOutputRunContext(t, nil)
+	sink, err := newJsonlSink(&OutputSpec{Cluster: "c1", EntityKind: NodeEntityKind, Name: "attributes", Columns: []string{"Name", "Unknown", "Cpu", "CreateTime", "Labels", "Runtimes"}, folder: rc.rootFolder, config: rc.config})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ct := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	long := strings.Repeat("v", 300)
+	labelMap := make(LabelValues)
+	for _, kv := range [][2]string{{"a", "x,y|z"}, {"m", "1"}, {"m", "2"}, {"m", "1"}, {"s", "a;b"}, {"l", long}, {"r", "z"}} {
+		AddToLabelMap(kv[0], kv[1], labelMap)
+	}
+	labels := LabelMap{Map: labelMap, Reject: map[string]bool{"r": true}}
+	if err = sink.WriteRecord("n1", nil, 4, ct, labels, json.RawMessage(`{"a":"b"}`)); err != nil {
+		t.Fatalf("WriteRecord() error = %v", err)
+	}
+	got := readSink(t, sink)
+	want := `{"Name":"n1","Unknown":null,"Cpu":4,"CreateTime":"2024-05-01T10:00:00Z",` +
+		`"Labels":{"a":"x,y|z","l":"` + long + `","m":["1","2"],"s":"a;b"},"Runtimes":{"a":"b"}}` + "\n"
+	if got != want {
+		t.Fatalf("JSONL = %q, want %q", got, want)
+	}
+}
+
+func TestJsonlSinkWriteSample(t *testing.T) {
+	rc := newTestOutputRunContext(t, nil)
+	sink, err := newJsonlSink(&OutputSpec{Cluster: "c1", EntityKind: NodeEntityKind, Name: "cpu", Columns: []string{"ClusterName", "NodeName", "MetricTime", "cpuUtilization"}, folder: rc.rootFolder, config: rc.config})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, v := range []float64{1.5, math.NaN()} {
+		if err = sink.WriteSample(&Sample{Entity: []string{"c1", "n1"}, Time: model.TimeFromUnix(0), Values: []any{v}}); err != nil {
+			t.Fatalf("WriteSample() error = %v", err)
+		}
+	}
+	got := readSink(t, sink)
+	prefix := `{"ClusterName":"c1","NodeName":"n1","MetricTime":"` + FormatTime(model.TimeFromUnix(0)) + `","cpuUtilization":`
+	want := prefix + "1.5}\n" + prefix + "null}\n"
+	if got != want {
+		t.Fatalf("JSONL = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,228 @@
+package common
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+
+	"go.yaml.in/yaml/v3"
+)
+
+// the label sources, told apart by the prefixes kube-state-metrics gives the label names
+const (
+	LabelSource      = "label"
+	AnnotationSource = "annotation"
+	// OtherSource are the other labels of the metrics, e.g. the node or the owner of a pod
+	OtherSource = "other"
+)
+
+// LabelRedactionKeyEnv is the environment variable holding the key of the redaction hashes
+const LabelRedactionKeyEnv = "LABEL_REDACTION_KEY"
+
+// redactedPrefix marks the redacted values, followed by the first 16 bytes of the hash (hex-encoded)
+const redactedPrefix = "hmac:"
+
+// LabelRule selects labels of the attributes outputs of some entity kinds (all if none) and of a source (all
+// if empty). The patterns are regular expressions matched against the whole label name without the source
+// prefix, e.g. app_kubernetes_io_name for label_app_kubernetes_io_name.
+type LabelRule struct {
+	EntityKinds []string `yaml:"entityKinds"`
+	Source      string   `yaml:"source"`
+	// Allow lists the labels exported, if set
+	Allow []string `yaml:"allow"`
+	// Deny lists the labels not exported
+	Deny []string `yaml:"deny"`
+	// Redact lists the labels whose values are replaced by keyed hashes
+	Redact []string `yaml:"redact"`
+	allow  []*regexp.Regexp
+	deny   []*regexp.Regexp
+	redact []*regexp.Regexp
+}
+
+// LabelPolicy is the policy of the labels exported in the attributes outputs, read from a YAML (or JSON) file:
+//
+//	rules:
+//	  - entityKinds: [container, hpa]
+//	    source: annotation
+//	    deny: [".*owner_email.*", ".*ticket.*"]
+//	  - source: label
+//	    redact: ["team"]
+//
+// A label is exported unless a rule applying to it denies it, or rules applying to it allow some labels and
+// none of them allows it; its value is redacted if a rule applying to it says so.
+type LabelPolicy struct {
+	Rules []*LabelRule `yaml:"rules"`
+	key   []byte
+	// decisions caches the decision of each entity kind and label
+	decisions sync.Map
+}
+
+type labelDecision struct {
+	export, redact bool
+}
+
+// SetLabelPolicy reads the label policy file; the redaction key is read from LABEL_REDACTION_KEY, it is
+// required if any labels are redacted
+func (cfg *RunConfig) SetLabelPolicy(fileName string) error {
+	if fileName == Empty {
+		return nil
+	}
+	b, err := os.ReadFile(fileName)
+	if err != nil {
+		return err
+	}
+	lp := &LabelPolicy{}
+	if err = yaml.Unmarshal(b, lp); err != nil {
+		return fmt.Errorf("%s: %v", fileName, err)
+	}
+	if err = lp.compile(); err != nil {
+		return fmt.Errorf("%s: %v", fileName, err)
+	}
+	if lp.redacts() {
+		if lp.key = []byte(os.Getenv(LabelRedactionKeyEnv)); len(lp.key) == 0 {
+			return fmt.Errorf("%s: labels are redacted, but %s is not set", fileName, LabelRedactionKeyEnv)
+		}
+	}
+	cfg.labelPolicy = lp
+	return nil
+}
+
+func (lp *LabelPolicy) compile() (err error) {
+	for i, rule := range lp.Rules {
+		switch rule.Source {
+		case Empty, LabelSource, AnnotationSource, OtherSource:
+		default:
+			return fmt.Errorf("rule %d: unknown source %s, supported: %s, %s, %s", i+1, rule.Source, LabelSource, AnnotationSource, OtherSource)
+		}
+		if rule.allow, err = compilePatterns(rule.Allow); err == nil {
+			if rule.deny, err = compilePatterns(rule.Deny); err == nil {
+				rule.redact, err = compilePatterns(rule.Redact)
+			}
+		}
+		if err != nil {
+			return fmt.Errorf("rule %d: %v", i+1, err)
+		}
+	}
+	return
+}
+
+func compilePatterns(patterns []string) (res []*regexp.Regexp, err error) {
+	res = make([]*regexp.Regexp, len(patterns))
+	for i, pattern := range patterns {
+		if res[i], err = regexp.Compile("^(?:" + pattern + ")$"); err != nil {
+			return
+		}
+	}
+	return
+}
+
+func (lp *LabelPolicy) redacts() bool {
+	return slices.ContainsFunc(lp.Rules, func(rule *LabelRule) bool { return len(rule.redact) > 0 })
+}
+
+// labelSource returns the source of a label and its name without the source prefix
+func labelSource(key string) (string, string) {
+	for _, source := range []string{LabelSource, AnnotationSource} {
+		if name, f := strings.CutPrefix(key, source+Underscore); f {
+			return source, name
+		}
+	}
+	return OtherSource, key
+}
+
+func (rule *LabelRule) applies(entityKind, source string) bool {
+	return (len(rule.EntityKinds) == 0 || slices.Contains(rule.EntityKinds, entityKind)) && (rule.Source == Empty || rule.Source == source)
+}
+
+func matchesAny(res []*regexp.Regexp, name string) bool {
+	return slices.ContainsFunc(res, func(re *regexp.Regexp) bool { return re.MatchString(name) })
+}
+
+func (lp *LabelPolicy) decide(entityKind, key string) *labelDecision {
+	cacheKey := entityKind + Slash + key
+	if d, f := lp.decisions.Load(cacheKey); f {
+		return d.(*labelDecision)
+	}
+	source, name := labelSource(key)
+	d := &labelDecision{export: true}
+	var allowRules, allowed bool
+	for _, rule := range lp.Rules {
+		if !rule.applies(entityKind, source) {
+			continue
+		}
+		if len(rule.allow) > 0 {
+			allowRules = true
+			allowed = allowed || matchesAny(rule.allow, name)
+		}
+		if matchesAny(rule.deny, name) {
+			d.export = false
+		}
+		if matchesAny(rule.redact, name) {
+			d.redact = true
+		}
+	}
+	if allowRules && !allowed {
+		d.export = false
+	}
+	lp.decisions.Store(cacheKey, d)
+	return d
+}
+
+// apply returns the labels of an entity kind output as per the policy; the values of a multi-valued label
+// are redacted one by one
+func (lp *LabelPolicy) apply(entityKind string, lm LabelMap) LabelMap {
+	if lm.Map == nil {
+		return lm
+	}
+	m := make(LabelValues, len(lm.Map))
+	for key, values := range lm.Map {
+		d := lp.decide(entityKind, key)
+		if !d.export {
+			continue
+		}
+		if d.redact {
+			redacted := make([]string, len(values))
+			for i, v := range values {
+				redacted[i] = lp.redactValue(v)
+			}
+			values = redacted
+		}
+		m[key] = values
+	}
+	return LabelMap{Map: m, Reject: lm.Reject}
+}
+
+// redactValue replaces a value by its HMAC-SHA256, the same for the same value and key in every output and run
+func (lp *LabelPolicy) redactValue(value string) string {
+	h := hmac.New(sha256.New, lp.key)
+	h.Write([]byte(value))
+	return redactedPrefix + hex.EncodeToString(h.Sum(nil)[:16])
+}
+
+// labelPolicySink applies the label policy to the labels of the records
+type labelPolicySink struct {
+	Sink
+	entityKind string
+	policy     *LabelPolicy
+}
+
+func (ls *labelPolicySink) WriteRecord(values ...any) error {
+	var cloned bool
+	for i, value := range values {
+		if lm, ok := value.(LabelMap); ok {
+			// the values of the caller are left as they are
+			if !cloned {
+				values = slices.Clone(values)
+				cloned = true
+			}
+			values[i] = ls.policy.apply(ls.entityKind, lm)
+		}
+	}
+	return ls.Sink.WriteRecord(values...)
+}
@@ -0,0 +1,94 @@
+package common
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func setTestLabelPolicy(t *testing.T, cfg *RunConfig, policy string) error {
+	t.Helper()
+	fileName := filepath.Join(t.TempDir(), "policy.yaml")
+	if err := os.WriteFile(fileName, []byte(policy), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return cfg.SetLabelPolicy(fileName)
+}
+
+const testLabelPolicy = `
+rules:
+  - entityKinds: [node]
+    source: annotation
+    deny: [".*owner_email.*"]
+  - entityKinds: [node]
+    source: label
+    allow: ["app", "team"]
+    redact: ["team"]
+`
+
+func TestLabelPolicy(t *testing.T) {
+	t.Setenv(LabelRedactionKeyEnv, "secret")
+	cfg := NewRunConfig()
+	if err := setTestLabelPolicy(t, cfg, testLabelPolicy); err != nil {
+		t.Fatal(err)
+	}
+	lm := LabelMap{Map: LabelValues{
+		"label_app":                 {"web"},
+		"label_team":                {"a", "b"},
+		"label_tier":                {"front"},
+		"annotation_owner_email":    {"x@example.com"},
+		"annotation_ticket":         {"T-1"},
+		"created_by_kind":           {"ReplicaSet"},
+		"annotation_kubectl_config": {"{}"},
+	}, Reject: map[string]bool{"annotation_kubectl_config": true}}
+	got := cfg.labelPolicy.apply(NodeEntityKind, lm)
+	for _, key := range []string{"label_tier", "annotation_owner_email"} {
+		if _, f := got.Map[key]; f {
+			t.Errorf("%s exported", key)
+		}
+	}
+	for _, key := range []string{"label_app", "annotation_ticket", "created_by_kind"} {
+		if !slices.Equal(got.Map[key], lm.Map[key]) {
+			t.Errorf("%s = %q, want %q", key, got.Map[key], lm.Map[key])
+		}
+	}
+	team := got.Map["label_team"]
+	if len(team) != 2 || !strings.HasPrefix(team[0], redactedPrefix) || team[0] == team[1] {
+		t.Errorf("label_team = %q, want two redacted values", got.Map["label_team"])
+	}
+	if again := cfg.labelPolicy.apply(ContainerEntityKind, LabelMap{Map: LabelValues{"label_team": {"a"}}}); !slices.Equal(again.Map["label_team"], []string{"a"}) {
+		t.Errorf("label_team of a container = %q, the node rules apply", again.Map["label_team"])
+	}
+	if again := cfg.labelPolicy.apply(NodeEntityKind, LabelMap{Map: LabelValues{"label_team": {"a"}}}); !slices.Equal(again.Map["label_team"], team[:1]) {
+		t.Errorf("label_team redacted as %q, then as %q", team[0], again.Map["label_team"])
+	}
+	if !got.Reject["annotation_kubectl_config"] {
+		t.Error("rejected keys lost")
+	}
+	if lm.Map["label_tier"][0] != "front" {
+		t.Error("labels of the record changed")
+	}
+}
+
+func TestLabelPolicySink(t *testing.T) {
+	t.Setenv(LabelRedactionKeyEnv, Empty)
+	cfg := NewRunConfig()
+	if err := setTestLabelPolicy(t, cfg, testLabelPolicy); err == nil || !strings.Contains(err.Error(), LabelRedactionKeyEnv) {
+		t.Fatalf("SetLabelPolicy() error = %v, want a missing key error", err)
+	}
+	if err := setTestLabelPolicy(t, cfg, `rules: [{source: annotation, deny: [".*"]}]`); err != nil {
+		t.Fatal(err)
+	}
+	sink := newTestSink(t, newTestOutputRunContext(t, cfg), "Name,Labels")
+	if err := sink.WriteRecord("n1", LabelMap{Map: LabelValues{"label_app": {"web"}, "annotation_owner": {"x"}}}); err != nil {
+		t.Fatal(err)
+	}
+	if got := readSink(t, sink); got != "Name,Labels\nn1,label_app : web|\n" {
+		t.Errorf("CSV = %q", got)
+	}
+	if err := setTestLabelPolicy(t, cfg, `rules: [{source: metric}]`); err == nil {
+		t.Error("SetLabelPolicy() with an unknown source: expected an error")
+	}
+}
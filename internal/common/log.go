@@ -1,12 +1,20 @@
 package common
 
 import (
+	"context"
+	"errors"
 	"fmt"
-	"log"
+	"io"
+	"log/slog"
 	"os"
 	"path/filepath"
+	"regexp"
 	"runtime"
+	"slices"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 )
 
 type LogLevel int
@@ -21,7 +29,7 @@ const (
 
 const (
 	ClusterFormat    = "cluster=%s"
-	DefaultLogFormat = ClusterFormat + Space + "entity=%s"
+	DefaultLogFormat = ClusterFormat + Space + EntityFormat
 )
 
 func (ll LogLevel) String() string {
@@ -41,116 +49,461 @@ func (ll LogLevel) String() string {
 	return "[" + l + "]"
 }
 
-type clusterLoggers map[LogLevel]*log.Logger
-type loggers map[string]clusterLoggers
+func (ll LogLevel) slogLevel() slog.Level {
+	switch ll {
+	case Debug:
+		return slog.LevelDebug
+	case Info:
+		return slog.LevelInfo
+	case Warn:
+		return slog.LevelWarn
+	}
+	return slog.LevelError
+}
+
+// the log formats
+const (
+	TextLogFormat = "text"
+	JsonLogFormat = "json"
+)
+
+const (
+	// DefaultLogMaxSize is the size (in MiB) at which a log file is rotated
+	DefaultLogMaxSize = 10
+	// DefaultLogMaxFiles is the number of rotated log files kept per cluster
+	DefaultLogMaxFiles = 5
+)
+
+type logConfig struct {
+	format   string
+	level    LogLevel
+	levelSet bool
+	maxSize  int64
+	maxFiles int
+	// out is where the messages shown on stdout are written, stdout by default
+	out io.Writer
+	// stdout is the handler of the messages shown on stdout, the ones logged before InitLogs included
+	stdout slog.Handler
+}
+
+func newLogConfig() *logConfig {
+	return &logConfig{format: TextLogFormat, level: Info, maxSize: DefaultLogMaxSize << 20, maxFiles: DefaultLogMaxFiles, out: os.Stdout, stdout: newLogHandler(os.Stdout, TextLogFormat)}
+}
 
-var noLogs = loggers{Empty: nil}
-var logs loggers
+// processLog is the logging of the messages of the process, outside of the runs
+var processLog = newLogConfig()
 
-func InitLogs() {
-	logs = make(loggers, NumClusters())
-	for _, cluster := range ClusterNames {
-		logFile, err := os.OpenFile(filepath.Join(rootFolder, cluster, logFileName), logFileFlag, logFilePerm)
+// SetLogging sets the format of the log messages (text or json), the minimum level logged (debug, info, warn
+// or error; if empty, debug if the debug parameter is set, else info), the size (in MiB) at which the log files
+// are rotated and the number of rotated files kept
+func (cfg *RunConfig) SetLogging(format, level string, maxSize, maxFiles int) error {
+	if format != TextLogFormat && format != JsonLogFormat {
+		return fmt.Errorf("unknown log format %s, supported: %s, %s", format, TextLogFormat, JsonLogFormat)
+	}
+	if maxSize <= 0 || maxFiles < 0 {
+		return fmt.Errorf("invalid log rotation: max size %d MiB, max files %d", maxSize, maxFiles)
+	}
+	lc := &logConfig{format: format, level: Info, maxSize: int64(maxSize) << 20, maxFiles: maxFiles, out: cfg.log.out, stdout: newLogHandler(cfg.log.out, format)}
+	if level != Empty {
+		var err error
+		if lc.level, err = parseLogLevel(level); err != nil {
+			return err
+		}
+		lc.levelSet = true
+	}
+	cfg.log = lc
+	return nil
+}
+
+// SetLogOutput sets where the messages shown on stdout are written instead, e.g. the log of an embedding process
+func (cfg *RunConfig) SetLogOutput(w io.Writer) {
+	cfg.log.out, cfg.log.stdout = w, newLogHandler(w, cfg.log.format)
+}
+
+// logging returns the logging of the run, that of the process if rc is nil
+func (rc *RunContext) logging() *logConfig {
+	if rc == nil {
+		return processLog
+	}
+	return rc.config.log
+}
+
+func parseLogLevel(level string) (LogLevel, error) {
+	for ll := Debug; ll < Unknown; ll++ {
+		if strings.EqualFold(level, strings.Trim(ll.String(), "[]")) {
+			return ll, nil
+		}
+	}
+	return Unknown, fmt.Errorf("unknown log level %s, supported: debug, info, warn, error", level)
+}
+
+func newLogHandler(w io.Writer, format string) slog.Handler {
+	// the levels are filtered by shouldLog
+	opts := &slog.HandlerOptions{AddSource: true, Level: slog.LevelDebug, ReplaceAttr: shortSource}
+	if format == JsonLogFormat {
+		return slog.NewJSONHandler(w, opts)
+	}
+	return slog.NewTextHandler(w, opts)
+}
+
+// shortSource keeps the file name and line of the source, as the short file flag of the log package did
+func shortSource(groups []string, a slog.Attr) slog.Attr {
+	if a.Key == slog.SourceKey && len(groups) == 0 {
+		if s, ok := a.Value.Any().(*slog.Source); ok {
+			a.Value = slog.StringValue(filepath.Base(s.File) + ":" + strconv.Itoa(s.Line))
+		}
+	}
+	return a
+}
+
+// InitLogs opens the log file of each cluster of the run
+func (rc *RunContext) InitLogs() error {
+	lc := rc.config.log
+	logs := make(map[string]slog.Handler, rc.NumClusters())
+	var logFiles []*rotatingFile
+	for _, cluster := range rc.clusterNames {
+		rf, err := openRotatingFile(filepath.Join(rc.rootFolder, rc.clusterFolder(cluster), logFileName), lc.maxSize, lc.maxFiles)
 		if err != nil {
-			log.Fatal(err)
+			for _, f := range logFiles {
+				_ = f.Close()
+			}
+			return err
 		}
-		m := make(clusterLoggers, Unknown)
-		for level := Debug; level < Unknown; level++ {
-			m[level] = log.New(logFile, fmt.Sprintf(prefixFormat, level), logFlag)
+		logFiles = append(logFiles, rf)
+		logs[cluster] = newLogHandler(rf, lc.format)
+	}
+	rc.logsMu.Lock()
+	defer rc.logsMu.Unlock()
+	rc.logs, rc.logFiles = logs, logFiles
+	return nil
+}
+
+// CloseLogs closes the log files of the run, its messages are then logged to stdout only
+func (rc *RunContext) CloseLogs() error {
+	rc.logsMu.Lock()
+	defer rc.logsMu.Unlock()
+	var errs []error
+	for _, rf := range rc.logFiles {
+		errs = append(errs, rf.Close())
+	}
+	rc.logs, rc.logFiles = nil, nil
+	return errors.Join(errs...)
+}
+
+// rotatingFile is a log file appended to and rotated when it reaches its maximum size: log.txt is renamed
+// log.txt.1, log.txt.1 log.txt.2 and so on, the oldest beyond the maximum number of files being dropped
+type rotatingFile struct {
+	mu       sync.Mutex
+	name     string
+	maxSize  int64
+	maxFiles int
+	f        *os.File
+	size     int64
+}
+
+func openRotatingFile(name string, maxSize int64, maxFiles int) (*rotatingFile, error) {
+	rf := &rotatingFile{name: name, maxSize: maxSize, maxFiles: maxFiles}
+	return rf, rf.open()
+}
+
+func (rf *rotatingFile) open() (err error) {
+	if rf.f, err = os.OpenFile(rf.name, logFileFlag, logFilePerm); err == nil {
+		var fi os.FileInfo
+		if fi, err = rf.f.Stat(); err == nil {
+			rf.size = fi.Size()
+		}
+	}
+	return
+}
+
+func (rf *rotatingFile) Write(p []byte) (n int, err error) {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+	if rf.size > 0 && rf.size+int64(len(p)) > rf.maxSize {
+		if err = rf.rotate(); err != nil {
+			return
 		}
-		logs[cluster] = m
 	}
+	n, err = rf.f.Write(p)
+	rf.size += int64(n)
+	return
+}
+
+func (rf *rotatingFile) rotate() (err error) {
+	if err = rf.f.Close(); err != nil {
+		return
+	}
+	if rf.maxFiles == 0 {
+		err = os.Remove(rf.name)
+	} else {
+		for i := rf.maxFiles - 1; i > 0; i-- {
+			if err = os.Rename(rotatedLogName(rf.name, i), rotatedLogName(rf.name, i+1)); err != nil && !os.IsNotExist(err) {
+				return
+			}
+		}
+		err = os.Rename(rf.name, rotatedLogName(rf.name, 1))
+	}
+	if err == nil {
+		err = rf.open()
+	}
+	return
+}
+
+func (rf *rotatingFile) Close() error {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+	return rf.f.Close()
 }
 
+func rotatedLogName(name string, i int) string {
+	return name + Dot + strconv.Itoa(i)
+}
+
+// isLogFile returns whether a file is a log file, rotated or not
+func isLogFile(path string) bool {
+	base := filepath.Base(path)
+	return base == logFileName || strings.HasPrefix(base, logFileName+Dot)
+}
+
+// The messages of a run are logged with the methods of its run context, to stdout and to the log files of its
+// clusters, the warnings and errors being kept for its summaries; the functions log the messages of the
+// process, outside of the runs, to stdout only.
+
 func LogError(err error, format string, v ...any) {
-	logError(2, err, format, v...)
+	logErrorWithLevel(nil, 2, Error, err, format, v...)
 }
 
-func logError(callDepth int, err error, format string, v ...any) {
-	LogErrorWithLevel(callDepth+1, Error, err, format, v...)
+func (rc *RunContext) LogError(err error, format string, v ...any) {
+	logErrorWithLevel(rc, 2, Error, err, format, v...)
 }
 
 func LogErrorWithLevel(callDepth int, level LogLevel, err error, format string, v ...any) {
-	nv := v
-	f := format
+	logErrorWithLevel(nil, callDepth+1, level, err, format, v...)
+}
+
+func (rc *RunContext) LogErrorWithLevel(callDepth int, level LogLevel, err error, format string, v ...any) {
+	logErrorWithLevel(rc, callDepth+1, level, err, format, v...)
+}
+
+func logErrorWithLevel(rc *RunContext, callDepth int, level LogLevel, err error, format string, v ...any) {
+	if !shouldLog(rc, level) {
+		return
+	}
+	msg, attrs := logRecord(format, v)
+	msg = strings.TrimSuffix(msg, ":")
 	if err != nil {
-		nv = append(nv, err)
-		f += errorFormat
+		attrs = append(attrs, slog.String(errorKey, err.Error()))
 	}
 	if strings.HasPrefix(format, ClusterFormat) && len(v) > 0 {
 		if cluster, ok := v[0].(string); ok {
-			LogCluster(callDepth+1, level, f, cluster, true, nv...)
+			logCluster(rc, callDepth+1, level, msg, cluster, true, attrs)
 		}
 	} else {
-		LogAll(callDepth+1, level, f, nv...)
+		logAll(rc, callDepth+1, level, msg, attrs)
 	}
 }
 
 func FatalError(err error, format string, v ...any) {
-	logError(2, err, format, v...)
-	log.Fatalf(fatalMsg)
+	fatalError(nil, ExitFailure, err, format, v...)
+}
+
+func (rc *RunContext) FatalError(err error, format string, v ...any) {
+	fatalError(rc, ExitFailure, err, format, v...)
 }
 
-func DebugLogObjectMemStats(obj string) {
-	DebugLogMemStats(2, fmt.Sprintf(objectMetricsFormat, obj))
+// FatalErrorExitCode is like FatalError, but exits with the exit code of the failure class
+func FatalErrorExitCode(code ExitCode, err error, format string, v ...any) {
+	fatalError(nil, code, err, format, v...)
 }
 
-func DebugLogMemStats(callDepth int, msg string) {
-	memStats := &runtime.MemStats{}
-	runtime.ReadMemStats(memStats)
-	LogAll(callDepth+1, Debug, memStatsFormat1, msg)
-	LogAll(callDepth+1, Debug, memStatsFormat2, MiB(memStats.Alloc), MiB(memStats.TotalAlloc), MiB(memStats.Sys), memStats.NumGC)
+// FatalErrorExitCode is like FatalError, but exits with the exit code of the failure class
+func (rc *RunContext) FatalErrorExitCode(code ExitCode, err error, format string, v ...any) {
+	fatalError(rc, code, err, format, v...)
 }
 
+func fatalError(rc *RunContext, code ExitCode, err error, format string, v ...any) {
+	logErrorWithLevel(rc, 3, Error, err, format, v...)
+	if rc != nil {
+		rc.config.metrics.countError(code)
+	}
+	if rc != nil && rc.embedded {
+		// the run ends, not the process
+		failRun(code, err, format, v...)
+	}
+	logAll(rc, 3, Error, fatalMsg, nil)
+	if rc != nil {
+		// the failure is published, so that it can be alerted on
+		if err = rc.config.publishSelfMetrics(); err != nil {
+			LogError(err, "Failed to publish self metrics:")
+		}
+		if err = rc.config.CloseTracing(); err != nil {
+			LogError(err, "Failed to export spans:")
+		}
+	}
+	os.Exit(int(code))
+}
+
+func (rc *RunContext) DebugLogObjectMemStats(obj string) {
+	rc.DebugLogMemStats(2, fmt.Sprintf(objectMetricsFormat, obj))
+}
+
+func (rc *RunContext) DebugLogMemStats(callDepth int, msg string) {
+	memStats := readMemStats()
+	if rc != nil {
+		rc.config.metrics.setMemStats(memStats)
+	}
+	rc.LogAll(callDepth+1, Debug, memStatsFormat, MiB(memStats.Alloc), MiB(memStats.TotalAlloc), MiB(memStats.Sys), memStats.NumGC, msg)
+}
+
+// LogAll logs a message to stdout; the key=value fields the format starts with (e.g. entity=%s) are logged as
+// fields, not as part of the message
 func LogAll(callDepth int, level LogLevel, format string, v ...any) {
-	if shouldLog(level) {
-		var ls loggers
-		if len(logs) == 0 {
-			// loggers not initialized yet, use noLogs with a nil map that will just make sure the log will go to stdout
-			ls = noLogs
-		} else {
-			ls = logs
+	logAllFormat(nil, callDepth+1, level, format, v)
+}
+
+// LogAll logs a message to stdout and to the log files of all clusters of the run
+func (rc *RunContext) LogAll(callDepth int, level LogLevel, format string, v ...any) {
+	logAllFormat(rc, callDepth+1, level, format, v)
+}
+
+func logAllFormat(rc *RunContext, callDepth int, level LogLevel, format string, v []any) {
+	if shouldLog(rc, level) {
+		msg, attrs := logRecord(format, v)
+		logAll(rc, callDepth+1, level, msg, attrs)
+	}
+}
+
+func logAll(rc *RunContext, callDepth int, level LogLevel, msg string, attrs []slog.Attr) {
+	handlers := []slog.Handler{rc.logging().stdout}
+	if rc != nil {
+		if level >= Warn {
+			rc.recordWarning(Empty, warningText(msg, attrs))
 		}
-		toStdOut := true
-		for cluster := range ls {
-			LogCluster(callDepth+1, level, format, cluster, toStdOut, v...)
-			if toStdOut {
-				toStdOut = false
-			}
+		rc.logsMu.RLock()
+		for _, h := range rc.logs {
+			handlers = append(handlers, h)
 		}
+		rc.logsMu.RUnlock()
+	}
+	emit(callDepth+1, level, msg, attrs, handlers...)
+}
+
+// LogCluster logs a message to the log file of a cluster of the run, and to stdout if toStdOut; the cluster
+// is a field of the message
+func (rc *RunContext) LogCluster(callDepth int, level LogLevel, format string, cluster string, toStdOut bool, v ...any) {
+	if shouldLog(rc, level) {
+		msg, attrs := logRecord(format, v)
+		logCluster(rc, callDepth+1, level, msg, cluster, toStdOut, attrs)
 	}
 }
 
-func LogCluster(callDepth int, level LogLevel, format string, cluster string, toStdOut bool, v ...any) {
-	if shouldLog(level) {
-		msg := fmt.Sprintf(format+lf, v...)
-		if l, found := logs[cluster][level]; found {
-			_ = l.Output(callDepth+1, msg)
+func logCluster(rc *RunContext, callDepth int, level LogLevel, msg string, cluster string, toStdOut bool, attrs []slog.Attr) {
+	if !slices.ContainsFunc(attrs, func(a slog.Attr) bool { return a.Key == clusterKey }) {
+		attrs = append([]slog.Attr{slog.String(clusterKey, cluster)}, attrs...)
+	}
+	var handlers []slog.Handler
+	if rc != nil {
+		if level >= Warn {
+			rc.recordWarning(cluster, warningText(msg, attrs))
 		}
-		if toStdOut {
-			_, _ = fmt.Printf(levelFormat, level, msg)
+		rc.logsMu.RLock()
+		if h, found := rc.logs[cluster]; found {
+			handlers = append(handlers, h)
 		}
+		rc.logsMu.RUnlock()
+	}
+	if toStdOut {
+		handlers = append(handlers, rc.logging().stdout)
+	}
+	emit(callDepth+1, level, msg, attrs, handlers...)
+}
+
+// emit writes a log record to the handlers, its source being the caller callDepth frames up
+func emit(callDepth int, level LogLevel, msg string, attrs []slog.Attr, handlers ...slog.Handler) {
+	var pcs [1]uintptr
+	runtime.Callers(callDepth+1, pcs[:])
+	r := slog.NewRecord(time.Now(), level.slogLevel(), msg, pcs[0])
+	r.AddAttrs(attrs...)
+	for _, h := range handlers {
+		_ = h.Handle(context.Background(), r.Clone())
 	}
 }
 
-func shouldLog(level LogLevel) bool {
-	return level < Unknown && (level > Debug || Params.Debug)
+// logFieldRe matches a key=value field at the start of a log format, e.g. cluster=%s
+var logFieldRe = regexp.MustCompile(`^([a-z_]+)=%[sv](?:\s+|$)`)
+
+// logRecord returns the message and the fields of a log format and its values: the key=value fields the
+// format starts with are fields (skipped if empty), the rest of the format is the message
+func logRecord(format string, v []any) (msg string, attrs []slog.Attr) {
+	i := 0
+	for ; i < len(v); i++ {
+		m := logFieldRe.FindStringSubmatch(format)
+		if m == nil {
+			break
+		}
+		if s := fmt.Sprint(v[i]); s != Empty {
+			attrs = append(attrs, slog.String(m[1], s))
+		}
+		format = format[len(m[0]):]
+	}
+	if i < len(v) {
+		msg = fmt.Sprintf(format, v[i:]...)
+	} else {
+		msg = format
+	}
+	return
+}
+
+// warningText returns the text of a warning kept for the run summary: the fields, the message and the error
+func warningText(msg string, attrs []slog.Attr) string {
+	parts := make([]string, 0, len(attrs)+1)
+	var errPart string
+	for _, a := range attrs {
+		if a.Key == errorKey {
+			errPart = a.String()
+		} else {
+			parts = append(parts, a.String())
+		}
+	}
+	parts = append(parts, msg, errPart)
+	return strings.Join(slices.DeleteFunc(parts, func(s string) bool { return s == Empty }), Space)
+}
+
+// shouldLog returns whether a message of a run (nil for the process) is logged at a level
+func shouldLog(rc *RunContext, level LogLevel) bool {
+	if rc != nil && rc.config.dryRun {
+		// dry runs report errors only, so as not to clutter the plan
+		return level >= Error && level < Unknown
+	}
+	return level < Unknown && level >= minLogLevel(rc)
+}
+
+func minLogLevel(rc *RunContext) LogLevel {
+	if lc := rc.logging(); lc.levelSet {
+		return lc.level
+	}
+	if rc != nil && rc.params != nil && rc.params.Debug {
+		return Debug
+	}
+	return Info
+}
+
+// debugEnabled returns whether the debug messages of the run are logged
+func (rc *RunContext) debugEnabled() bool {
+	return shouldLog(rc, Debug)
 }
 
 const (
-	logFileFlag         = os.O_WRONLY | os.O_CREATE
+	logFileFlag         = os.O_WRONLY | os.O_CREATE | os.O_APPEND
 	logFilePerm         = 0644
 	debugLevel          = "DEBUG"
 	warnLevel           = "WARN"
 	errorLevel          = "ERROR"
 	unknownLevel        = "UNKNOWN"
 	logFileName         = "log.txt"
-	prefixFormat        = "%v "
-	logFlag             = log.Ldate | log.Ltime | log.Lshortfile
-	levelFormat         = prefixFormat + "%s"
-	errorFormat         = " message=%v"
-	memStatsFormat1     = "mem stats before %s:"
-	memStatsFormat2     = "Alloc = %vMiB\tTotalAlloc = %vMiB\tSys = %vMiB\tNumGC = %v"
+	clusterKey          = "cluster"
+	errorKey            = "error"
+	memStatsFormat      = "alloc_mib=%v total_alloc_mib=%v sys_mib=%v num_gc=%v mem stats before %s"
 	objectMetricsFormat = "collecting %s metrics"
 	fatalMsg            = "cannot proceed, exiting..."
 )
@@ -161,6 +514,7 @@ var (
 
 // ClusterLeveledLogger implements rhttp.LeveledLogger to avoid clutter
 type ClusterLeveledLogger struct {
+	rc      *RunContext
 	cluster string
 }
 
@@ -181,14 +535,17 @@ func (cll *ClusterLeveledLogger) Debug(msg string, keysAndValues ...interface{})
 }
 
 func (cll *ClusterLeveledLogger) log(level LogLevel, msg string, keysAndValues ...interface{}) {
-	message := msg
+	if !shouldLog(cll.rc, level) {
+		return
+	}
 	n := len(keysAndValues) - 1
+	attrs := make([]slog.Attr, 0, len(keysAndValues)/2)
 	for i := 0; i < n; i += 2 {
-		message += fmt.Sprintf(", %v : %v", keysAndValues[i], keysAndValues[i+1])
+		attrs = append(attrs, slog.Any(fmt.Sprint(keysAndValues[i]), keysAndValues[i+1]))
 	}
 	if cll.cluster == Empty {
-		LogAll(3, level, message)
+		logAll(cll.rc, 3, level, msg, attrs)
 	} else {
-		LogCluster(3, level, message, cll.cluster, true)
+		logCluster(cll.rc, 3, level, msg, cll.cluster, true, attrs)
 	}
 }
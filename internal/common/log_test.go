@@ -0,0 +1,83 @@
+package common
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestLogRecord(t *testing.T) {
+	tests := []struct {
+		format    string
+		v         []any
+		wantMsg   string
+		wantAttrs string
+	}{
+		{format: DefaultLogFormat, v: []any{"c1", NodeEntityKind}, wantAttrs: "[cluster=c1 entity=node]"},
+		{format: ClusterQueryFormat, v: []any{"c1", Empty, "up"}, wantAttrs: "[cluster=c1 query=up]"},
+		{format: "stage=%s finished in %v", v: []any{"node", "1s"}, wantMsg: "finished in 1s", wantAttrs: "[stage=node]"},
+		{format: "Skipping %s stage", v: []any{"node"}, wantMsg: "Skipping node stage", wantAttrs: "[]"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			msg, attrs := logRecord(tt.format, tt.v)
+			if msg != tt.wantMsg {
+				t.Errorf("message = %q, want %q", msg, tt.wantMsg)
+			}
+			if got := slog.GroupValue(attrs...).String(); got != tt.wantAttrs {
+				t.Errorf("fields = %s, want %s", got, tt.wantAttrs)
+			}
+		})
+	}
+}
+
+func TestLogClusterJson(t *testing.T) {
+	var buf bytes.Buffer
+	rc := NewRunContext(context.Background(), nil)
+	defer rc.End()
+	rc.logs = map[string]slog.Handler{"c1": newLogHandler(&buf, JsonLogFormat)}
+	_, file, line, _ := runtime.Caller(0)
+	rc.LogError(os.ErrNotExist, ClusterFileFormat, "c1", "node/attributes.csv")
+	rc.LogCluster(1, Debug, ClusterFormat+" not logged", "c1", false, "c1")
+	var record map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &record); err != nil {
+		t.Fatalf("log = %s: %v", buf.String(), err)
+	}
+	want := map[string]any{"level": "ERROR", "cluster": "c1", "file": "node/attributes.csv", "error": os.ErrNotExist.Error(), "source": fmt.Sprintf("%s:%d", filepath.Base(file), line+1)}
+	for key, value := range want {
+		if record[key] != value {
+			t.Errorf("%s = %v, want %v", key, record[key], value)
+		}
+	}
+}
+
+func TestRotatingFile(t *testing.T) {
+	name := filepath.Join(t.TempDir(), logFileName)
+	rf, err := openRotatingFile(name, 10, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{"first\n", "second\n", "third\n", "fourth\n"} {
+		if _, err = rf.Write([]byte(line)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for file, want := range map[string]string{name: "fourth\n", name + ".1": "third\n", name + ".2": "second\n"} {
+		if b, _ := os.ReadFile(file); string(b) != want {
+			t.Errorf("%s = %q, want %q", filepath.Base(file), b, want)
+		}
+	}
+	if _, err = os.Stat(name + ".3"); err == nil {
+		t.Error("more rotated files than the maximum kept")
+	}
+	if !isLogFile(name+".2") || isLogFile(strings.TrimSuffix(name, ".txt")+".csv") {
+		t.Error("isLogFile() mismatch")
+	}
+}
@@ -0,0 +1,338 @@
+package common
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	colmetricpb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	metricpb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	resourcepb "go.opentelemetry.io/proto/otlp/resource/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	OtlpHttp = "http"
+	OtlpGrpc = "grpc"
+)
+
+// OtlpExport configures the export of the workloads as OTLP gauges
+type OtlpExport struct {
+	// Endpoint is the URL of the OTLP/HTTP receiver (e.g. http://localhost:4318, /v1/metrics is added if there is
+	// no path) or the host:port of the OTLP/gRPC one
+	Endpoint string
+	Protocol string
+	// Insecure disables TLS for gRPC
+	Insecure bool
+	Headers  map[string]string
+	Timeout  time.Duration
+	// exporter is the exporter of the otlp output format, shared by the sinks and created on first use
+	exporter   otlpExporter
+	exporterMu sync.Mutex
+}
+
+const (
+	DefaultOtlpTimeout = 30 * time.Second
+	otlpMetricsPath    = "/v1/metrics"
+	otlpScopeName      = "github.com/densify-dev/container-data-collection"
+	// otlpBatchSize is the number of data points a sink exports at once
+	otlpBatchSize = 8192
+	otlpPrefix    = "densify"
+)
+
+type otlpExporter interface {
+	export(ctx context.Context, req *colmetricpb.ExportMetricsServiceRequest) error
+	close() error
+}
+
+// SetOtlpExport configures the OTLP exporter of the otlp output format
+func (cfg *RunConfig) SetOtlpExport(oe *OtlpExport) error {
+	if err := oe.validate(); err != nil {
+		return err
+	}
+	cfg.otlpExport = oe
+	return nil
+}
+
+func (oe *OtlpExport) validate() error {
+	if oe.Endpoint == Empty {
+		return fmt.Errorf("no OTLP endpoint")
+	}
+	switch oe.Protocol {
+	case OtlpHttp:
+		if u, err := url.Parse(oe.Endpoint); err != nil || u.Scheme == Empty || u.Host == Empty {
+			return fmt.Errorf("invalid OTLP/HTTP endpoint %s, expecting a URL", oe.Endpoint)
+		}
+	case OtlpGrpc:
+	default:
+		return fmt.Errorf("unknown OTLP protocol %s, supported: %s, %s", oe.Protocol, OtlpHttp, OtlpGrpc)
+	}
+	if oe.Timeout <= 0 {
+		oe.Timeout = DefaultOtlpTimeout
+	}
+	return nil
+}
+
+// grpcConn returns a connection to the OTLP/gRPC receiver
+func (oe *OtlpExport) grpcConn() (*grpc.ClientConn, error) {
+	creds := credentials.NewTLS(&tls.Config{MinVersion: tls.VersionTLS12})
+	if oe.Insecure {
+		creds = insecure.NewCredentials()
+	}
+	return grpc.NewClient(oe.Endpoint, grpc.WithTransportCredentials(creds))
+}
+
+// httpExporter returns an exporter to the OTLP/HTTP receiver, posting to path if the endpoint has none
+func (oe *OtlpExport) httpExporter(path string) *otlpHttpExporter {
+	u, _ := url.Parse(oe.Endpoint)
+	if u.Path == Empty || u.Path == "/" {
+		u.Path = path
+	}
+	return &otlpHttpExporter{url: u.String(), headers: oe.Headers, client: &http.Client{Timeout: oe.Timeout}}
+}
+
+// getExporter returns the exporter shared by the sinks, created on first use
+func (oe *OtlpExport) getExporter() (otlpExporter, error) {
+	oe.exporterMu.Lock()
+	defer oe.exporterMu.Unlock()
+	if oe.exporter != nil {
+		return oe.exporter, nil
+	}
+	switch oe.Protocol {
+	case OtlpGrpc:
+		conn, err := oe.grpcConn()
+		if err != nil {
+			return nil, err
+		}
+		oe.exporter = &otlpGrpcExporter{conn: conn, client: colmetricpb.NewMetricsServiceClient(conn), config: oe}
+	default:
+		oe.exporter = oe.httpExporter(otlpMetricsPath)
+	}
+	return oe.exporter, nil
+}
+
+// CloseOtlpExporter closes the connection of the OTLP exporter, if any
+func (cfg *RunConfig) CloseOtlpExporter() error {
+	oe := cfg.otlpExport
+	if oe == nil {
+		return nil
+	}
+	oe.exporterMu.Lock()
+	defer oe.exporterMu.Unlock()
+	if oe.exporter == nil {
+		return nil
+	}
+	err := oe.exporter.close()
+	oe.exporter = nil
+	return err
+}
+
+type otlpHttpExporter struct {
+	url     string
+	headers map[string]string
+	client  *http.Client
+}
+
+func (he *otlpHttpExporter) export(ctx context.Context, req *colmetricpb.ExportMetricsServiceRequest) error {
+	return he.post(ctx, req)
+}
+
+// post sends an OTLP export request as protobuf
+func (he *otlpHttpExporter) post(ctx context.Context, req proto.Message) error {
+	b, err := proto.Marshal(req)
+	if err != nil {
+		return err
+	}
+	var hr *http.Request
+	if hr, err = http.NewRequestWithContext(ctx, http.MethodPost, he.url, bytes.NewReader(b)); err != nil {
+		return err
+	}
+	hr.Header.Set("Content-Type", "application/x-protobuf")
+	for k, v := range he.headers {
+		hr.Header.Set(k, v)
+	}
+	var resp *http.Response
+	if resp, err = he.client.Do(hr); err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("OTLP export to %s failed: %s %s", he.url, resp.Status, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
+
+func (he *otlpHttpExporter) close() error {
+	he.client.CloseIdleConnections()
+	return nil
+}
+
+type otlpGrpcExporter struct {
+	conn   *grpc.ClientConn
+	client colmetricpb.MetricsServiceClient
+	config *OtlpExport
+}
+
+func (ge *otlpGrpcExporter) export(ctx context.Context, req *colmetricpb.ExportMetricsServiceRequest) error {
+	ctx, cancel := context.WithTimeout(ctx, ge.config.Timeout)
+	defer cancel()
+	if len(ge.config.Headers) > 0 {
+		ctx = metadata.NewOutgoingContext(ctx, metadata.New(ge.config.Headers))
+	}
+	_, err := ge.client.Export(ctx, req)
+	return err
+}
+
+func (ge *otlpGrpcExporter) close() error {
+	return ge.conn.Close()
+}
+
+// newOtlpSink returns a sink exporting the workload samples as OTLP gauges, a metric per value column named
+// densify.<entity kind>.<column in snake case>, with the entity as the resource (k8s.cluster.name,
+// k8s.namespace.name, k8s.container.name etc.); the config and attributes records are not exported
+func newOtlpSink(spec *OutputSpec) (Sink, error) {
+	oe := spec.config.otlpExport
+	if oe == nil {
+		return nil, fmt.Errorf("OTLP export not configured")
+	}
+	exporter, err := oe.getExporter()
+	if err != nil {
+		return nil, err
+	}
+	bs := newBatchSink[metricpb.ResourceMetrics](spec, oe.Endpoint, otlpBatchSize)
+	bs.newEntity = func(entity []string) *metricpb.ResourceMetrics {
+		ne := len(entity)
+		rm := &metricpb.ResourceMetrics{
+			Resource:     &resourcepb.Resource{Attributes: otlpAttributes(spec.Columns[:ne], entity)},
+			ScopeMetrics: []*metricpb.ScopeMetrics{{Scope: &commonpb.InstrumentationScope{Name: otlpScopeName, Version: Version}}},
+		}
+		for _, column := range spec.Columns[ne+1:] {
+			rm.ScopeMetrics[0].Metrics = append(rm.ScopeMetrics[0].Metrics, &metricpb.Metric{
+				Name: JoinNoSep(otlpPrefix, Dot, strings.ToLower(spec.EntityKind), Dot, SnakeCase(column)),
+				Data: &metricpb.Metric_Gauge{Gauge: &metricpb.Gauge{}},
+			})
+		}
+		return rm
+	}
+	bs.add = func(rm *metricpb.ResourceMetrics, s *Sample) (n int) {
+		ts := uint64(s.Time.UnixNano())
+		for i, value := range s.Values {
+			if dp := otlpDataPoint(value, ts); dp != nil {
+				g := rm.ScopeMetrics[0].Metrics[i].GetGauge()
+				g.DataPoints = append(g.DataPoints, dp)
+				n++
+			}
+		}
+		return
+	}
+	bs.send = func(ctx context.Context, batch []*metricpb.ResourceMetrics) error {
+		req := &colmetricpb.ExportMetricsServiceRequest{}
+		for _, rm := range batch {
+			var metrics []*metricpb.Metric
+			for _, m := range rm.ScopeMetrics[0].Metrics {
+				if len(m.GetGauge().DataPoints) > 0 {
+					metrics = append(metrics, m)
+				}
+			}
+			if len(metrics) > 0 {
+				req.ResourceMetrics = append(req.ResourceMetrics, &metricpb.ResourceMetrics{
+					Resource:     rm.Resource,
+					ScopeMetrics: []*metricpb.ScopeMetrics{{Scope: rm.ScopeMetrics[0].Scope, Metrics: metrics}},
+				})
+			}
+		}
+		return exporter.export(ctx, req)
+	}
+	return bs, nil
+}
+
+// otlpDataPoint returns the data point of a value, nil for unknown values (JSON-like, NaN) and non-numbers
+func otlpDataPoint(value any, ts uint64) *metricpb.NumberDataPoint {
+	dp := &metricpb.NumberDataPoint{TimeUnixNano: ts}
+	switch v := value.(type) {
+	case float64:
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return nil
+		}
+		dp.Value = &metricpb.NumberDataPoint_AsDouble{AsDouble: v}
+	case float32:
+		return otlpDataPoint(float64(v), ts)
+	case int:
+		dp.Value = &metricpb.NumberDataPoint_AsInt{AsInt: int64(v)}
+	case int64:
+		dp.Value = &metricpb.NumberDataPoint_AsInt{AsInt: v}
+	case bool:
+		var i int64
+		if v {
+			i = 1
+		}
+		dp.Value = &metricpb.NumberDataPoint_AsInt{AsInt: i}
+	default:
+		return nil
+	}
+	return dp
+}
+
+// otlpColumnAttributes are the semconv resource attributes of the entity columns
+var otlpColumnAttributes = map[string]string{
+	CamelCase(ClusterEntityKind, Name):   otlpAttribute(K8sSnakeCase(ClusterEntityKind, Name)),
+	CamelCase(Namespace):                 otlpAttribute(SemconvNamespaceName),
+	CamelCase(NodeEntityKind, Name):      otlpAttribute(SemconvNodeName),
+	CamelCase(ContainerEntityKind, Name): otlpAttribute(SemconvContainerName),
+	CamelCase(Hpa, Name):                 otlpAttribute(K8sSnakeCase(Hpa, Name)),
+	CamelCase(RqEntityKind, Name):        "k8s.resourcequota.name",
+	CamelCase(CrqEntityKind, Name):       "openshift.clusterquota.name",
+	CamelCase(NodeGroupEntityKind, Name): JoinNoSep(otlpPrefix, Dot, SnakeCase(NodeGroupEntityKind), Dot, Name),
+}
+
+// otlpAttribute returns the OTLP name of a semconv label, e.g. k8s.namespace.name for k8s_namespace_name
+func otlpAttribute(label string) string {
+	return strings.ReplaceAll(label, Underscore, Dot)
+}
+
+func otlpAttributes(columns, entity []string) []*commonpb.KeyValue {
+	attrs := make([]*commonpb.KeyValue, 0, len(columns))
+	entityName := CamelCase(Entity, Name)
+	entityType := CamelCase(Entity, Type)
+	for i, column := range columns {
+		var key string
+		switch column {
+		case entityType:
+			continue
+		case entityName:
+			// the workload name, e.g. k8s.deployment.name
+			for j, c := range columns {
+				if c == entityType && entity[j] != Empty {
+					key = JoinNoSep(K8s, Dot, strings.ToLower(entity[j]), Dot, Name)
+				}
+			}
+			if key == Empty {
+				key = JoinNoSep(otlpPrefix, Dot, SnakeCase(column))
+			}
+		case CamelCase(Name):
+			// the name of the cluster entity kind is the cluster name
+			key = otlpColumnAttributes[CamelCase(ClusterEntityKind, Name)]
+		default:
+			var f bool
+			if key, f = otlpColumnAttributes[column]; !f {
+				key = JoinNoSep(otlpPrefix, Dot, SnakeCase(column))
+			}
+		}
+		attrs = append(attrs, &commonpb.KeyValue{Key: key, Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: entity[i]}}})
+	}
+	return attrs
+}
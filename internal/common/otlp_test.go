@@ -0,0 +1,109 @@
+package common
+
+import (
+	"context"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/prometheus/common/model"
+	colmetricpb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/proto"
+)
+
+// otlpReceiver is a local OTLP receiver, over HTTP and gRPC, keeping the requests received
+type otlpReceiver struct {
+	colmetricpb.UnimplementedMetricsServiceServer
+	mu   sync.Mutex
+	reqs []*colmetricpb.ExportMetricsServiceRequest
+}
+
+func (or *otlpReceiver) Export(_ context.Context, req *colmetricpb.ExportMetricsServiceRequest) (*colmetricpb.ExportMetricsServiceResponse, error) {
+	or.mu.Lock()
+	defer or.mu.Unlock()
+	or.reqs = append(or.reqs, req)
+	return &colmetricpb.ExportMetricsServiceResponse{}, nil
+}
+
+func (or *otlpReceiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	b, _ := io.ReadAll(r.Body)
+	req := &colmetricpb.ExportMetricsServiceRequest{}
+	if r.URL.Path != otlpMetricsPath || proto.Unmarshal(b, req) != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	_, _ = or.Export(r.Context(), req)
+}
+
+func startOtlpReceiver(t *testing.T, protocol string) (*otlpReceiver, string) {
+	t.Helper()
+	or := &otlpReceiver{}
+	if protocol == OtlpHttp {
+		srv := httptest.NewServer(or)
+		t.Cleanup(srv.Close)
+		return or, srv.URL
+	}
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := grpc.NewServer()
+	colmetricpb.RegisterMetricsServiceServer(srv, or)
+	go func() { _ = srv.Serve(lis) }()
+	t.Cleanup(srv.Stop)
+	return or, lis.Addr().String()
+}
+
+func TestOtlpSink(t *testing.T) {
+	for _, protocol := range []string{OtlpHttp, OtlpGrpc} {
+		t.Run(protocol, func(t *testing.T) {
+			or, endpoint := startOtlpReceiver(t, protocol)
+			cfg := NewRunConfig()
+			if err := cfg.SetOtlpExport(&OtlpExport{Endpoint: endpoint, Protocol: protocol, Insecure: true}); err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(func() { _ = cfg.CloseOtlpExporter() })
+			columns := []string{"ClusterName", "Namespace", "EntityName", "EntityType", "ContainerName", "MetricTime", "cpuUtilization"}
+			sink, err := newOtlpSink(&OutputSpec{Cluster: "c1", EntityKind: ContainerEntityKind, Name: "cpu", Columns: columns, config: cfg})
+			if err != nil {
+				t.Fatal(err)
+			}
+			entity := []string{"c1", "ns1", "web", "Deployment", "app"}
+			for i, v := range []float64{0.5, math.NaN(), 1.5} {
+				if err = sink.WriteSample(&Sample{Entity: entity, Time: model.TimeFromUnix(int64(60 * i)), Values: []any{v}}); err != nil {
+					t.Fatalf("WriteSample() error = %v", err)
+				}
+			}
+			if err = sink.Close(); err != nil {
+				t.Fatalf("Close() error = %v", err)
+			}
+			if l := len(or.reqs); l != 1 {
+				t.Fatalf("requests = %d, want 1", l)
+			}
+			rm := or.reqs[0].ResourceMetrics[0]
+			attrs := make(map[string]string)
+			for _, kv := range rm.Resource.Attributes {
+				attrs[kv.Key] = kv.Value.GetStringValue()
+			}
+			want := map[string]string{"k8s.cluster.name": "c1", "k8s.namespace.name": "ns1", "k8s.deployment.name": "web", "k8s.container.name": "app"}
+			for k, v := range want {
+				if attrs[k] != v {
+					t.Errorf("resource attribute %s = %q, want %q (attributes %v)", k, attrs[k], v, attrs)
+				}
+			}
+			m := rm.ScopeMetrics[0].Metrics[0]
+			if m.Name != "densify.container.cpu_utilization" {
+				t.Errorf("metric name = %s", m.Name)
+			}
+			dps := m.GetGauge().DataPoints
+			if len(dps) != 2 || dps[0].GetAsDouble() != 0.5 || dps[1].GetAsDouble() != 1.5 || dps[1].TimeUnixNano != 120e9 {
+				t.Errorf("data points = %v", dps)
+			}
+		})
+	}
+}
@@ -1,11 +1,9 @@
 package common
 
 import (
-	"fmt"
 	"github.com/prometheus/common/model"
 	"os"
 	"path/filepath"
-	"strconv"
 	"strings"
 	"time"
 )
@@ -28,19 +26,25 @@ func (ft FileType) String() (s string) {
 }
 
 const (
-	rootFolder         = "data"
+	defaultRootFolder  = "data"
 	fileExt            = ".csv"
 	configFileName     = "config"
 	attributesFileName = "attributes"
 	dirPerm            = 0755
 )
 
+// SetRootFolder overrides the folder under which all data files of the run are written
+func (rc *RunContext) SetRootFolder(folder string) {
+	rc.rootFolder = folder
+}
+
 var entityKinds = []string{ClusterEntityKind, NodeEntityKind, NodeGroupEntityKind, ContainerEntityKind, Hpa, RqEntityKind, CrqEntityKind}
 
-func MkdirAll() error {
-	for _, cluster := range ClusterNames {
+// MkdirAll creates the folders of the clusters of the run
+func (rc *RunContext) MkdirAll() error {
+	for _, cluster := range rc.clusterNames {
 		for _, entityKind := range entityKinds {
-			if err := os.MkdirAll(filepath.Join(rootFolder, cluster, entityKind), dirPerm); err != nil {
+			if err := os.MkdirAll(filepath.Join(rc.rootFolder, rc.clusterFolder(cluster), entityKind), dirPerm); err != nil {
 				return err
 			}
 		}
@@ -48,16 +52,16 @@ func MkdirAll() error {
 	return nil
 }
 
-func GetFileName(cluster, entityKind, fileName string) string {
-	return filepath.Join(rootFolder, cluster, entityKind, fileName+fileExt)
+func (rc *RunContext) GetFileName(cluster, entityKind, fileName string) string {
+	return filepath.Join(rc.rootFolder, rc.clusterFolder(cluster), entityKind, fileName+fileExt)
 }
 
-func GetFileNameByType(cluster, entityKind string, ft FileType) string {
-	return GetFileName(cluster, entityKind, ft.String())
+func (rc *RunContext) GetFileNameByType(cluster, entityKind string, ft FileType) string {
+	return rc.GetFileName(cluster, entityKind, ft.String())
 }
 
-func GetExtraFileNameByType(cluster, entityKind string, ft FileType) string {
-	return GetFileName(cluster, entityKind, SnakeCase(entityKind, Extra, ft.String()))
+func (rc *RunContext) GetExtraFileNameByType(cluster, entityKind string, ft FileType) string {
+	return rc.GetFileName(cluster, entityKind, SnakeCase(entityKind, Extra, ft.String()))
 }
 
 func FormatTime(mt model.Time) string {
@@ -70,26 +74,30 @@ func FormatTimeInSec(i int64) string {
 	return Format(&t)
 }
 
-func FormatCurrentTime() string {
-	return Format(&CurrentTime)
+func (rc *RunContext) FormatCurrentTime() string {
+	return Format(&rc.currentTime)
 }
 
 func Format(t *time.Time) string {
 	return t.Format(time.RFC3339Nano)
 }
 
-func ReplaceColons(s string) string {
+// ReplaceColons replaces the colons of an entity name by dots, in the legacy CSV encoding only
+func (rc *RunContext) ReplaceColons(s string) string {
+	if rc.config.csvVersion != CsvLegacy {
+		return s
+	}
 	return strings.ReplaceAll(s, colon, Dot)
 }
 
-func ReplaceSemiColons(s string) string {
+// ReplaceSemiColons replaces the semicolons of an entity name by dots, in the legacy CSV encoding only
+func (rc *RunContext) ReplaceSemiColons(s string) string {
+	if rc.config.csvVersion != CsvLegacy {
+		return s
+	}
 	return strings.ReplaceAll(s, semicolonStr, Dot)
 }
 
-func ReplaceSemiColonsPipes(s string) string {
-	return strings.ReplaceAll(s, semicolonStr, Or)
-}
-
 func GetCsvHeaderFormat(entityKind string, subject string) (format string, f bool) {
 	ek := strings.ToLower(entityKind)
 	format, f = csvHeaderFormats[subject][ek]
@@ -111,92 +119,6 @@ func PositiveValueFunc[T Number](n T) bool {
 	return n > 0
 }
 
-func PrintCSVNumberValue[T Number](file *os.File, value T, last bool) error {
-	return PrintCSVNumberValueConditional(file, value, last, KnownValueFunc)
-}
-
-func PrintCSVPositiveNumberValue[T Number](file *os.File, value T, last bool) error {
-	return PrintCSVNumberValueConditional(file, value, last, PositiveValueFunc)
-}
-
-func PrintCSVNumberValueConditional[T Number](file *os.File, value T, last bool, f ValueFunc[T]) error {
-	sVal := ""
-	if f(value) {
-		var frmt string
-		switch any(value).(type) {
-		case float32, float64:
-			frmt = "%f"
-		default:
-			frmt = "%d"
-		}
-		sVal = fmt.Sprintf(frmt, value)
-	}
-	return PrintCSVStringValue(file, sVal, last)
-}
-
-func PrintCSVTimeValue(file *os.File, value *time.Time, last bool) error {
-	sVal := ""
-	if !(value == nil || value.IsZero()) {
-		sVal = Format(value)
-	}
-	return PrintCSVStringValue(file, sVal, last)
-}
-
-func PrintCSVBoolValue(file *os.File, value bool, last bool) error {
-	sVal := strconv.FormatBool(value)
-	return PrintCSVStringValue(file, sVal, last)
-}
-
-func PrintCSVStringValue(file *os.File, value string, last bool) (err error) {
-	s := "," + value
-	if last {
-		s += lf
-	}
-	_, err = fmt.Fprintf(file, "%s", s)
-	return
-}
-
-func PrintCSVLabelMap(file *os.File, labelMap map[string]string, last bool) error {
-	return ConditionalPrintCSVLabelMap(file, labelMap, last, nil)
-}
-
-var (
-	safeLabelReplacements = map[string]string{
-		Comma:       Space,
-		DoubleQuote: Empty,
-		Or:          Space,
-	}
-)
-
-func ConditionalPrintCSVLabelMap(file *os.File, labelMap map[string]string, last bool, rejectKeys map[string]bool) (err error) {
-	keys := SortedKeySet(labelMap)
-	for _, key := range keys {
-		if reject := rejectKeys[key]; reject {
-			continue
-		}
-		var maxValueLen int
-		if lkey := len(key); lkey >= maxKeyLen {
-			continue
-		} else {
-			maxValueLen = maxKeyLen + 3 - lkey
-		}
-		value := labelMap[key]
-		for unsafe, safe := range safeLabelReplacements {
-			value = strings.ReplaceAll(value, unsafe, safe)
-		}
-		if len(value) > maxValueLen {
-			value = value[:maxValueLen]
-		}
-		if _, err = fmt.Fprintf(file, "%s : %s%s", key, value, Or); err != nil {
-			return
-		}
-	}
-	if last {
-		_, err = fmt.Fprintf(file, lf)
-	}
-	return
-}
-
 var (
 	containerEntityKindName    = JoinComma(CamelCase(Entity, Name), CamelCase(Entity, Type), CamelCase(ContainerEntityKind, Name))
 	containerHpaEntityKindName = JoinComma(containerEntityKindName, CamelCase(Hpa, Name))
@@ -0,0 +1,198 @@
+package common
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"text/template"
+)
+
+// QueryReplacement replaces all the occurrences of a string in a query
+type QueryReplacement struct {
+	From string `yaml:"from"`
+	To   string `yaml:"to"`
+}
+
+// QueryOverride changes the queries of a built-in workload output, identified by its entity kind and metric, the
+// name of its files without extension (e.g. avg_cpu_mcores_workload of container, cpu_utilization of node; the
+// HPA workloads by their container outputs), one of those registered by the collectors. The replacements are
+// applied to the built-in queries in turn, then the query template, if set, is executed with the result as
+// {{.Query}}, which it has to use: an output has several variants of its queries, which would otherwise all
+// become the same query. E.g. for relabeled cAdvisor series:
+//
+//	overrides:
+//	  - entityKind: container
+//	    metric: avg_cpu_mcores_workload
+//	    replace:
+//	      - from: container_cpu_usage_seconds_total
+//	        to: cadvisor_container_cpu_usage_seconds_total
+//	      - from: container!=
+//	        to: container_name!=
+//	    query: label_replace({{.Query}}, "container", "$1", "container_name", "(.*)")
+//
+// The workloads collected along with the configuration and attributes (e.g. the limits and requests) have no
+// queries of their own and cannot be overridden.
+type QueryOverride struct {
+	EntityKind string              `yaml:"entityKind"`
+	Metric     string              `yaml:"metric"`
+	Replace    []*QueryReplacement `yaml:"replace"`
+	Query      string              `yaml:"query"`
+	tmpl       *template.Template
+}
+
+type queryOverrideFields struct {
+	Query string
+}
+
+// overrideQueryProbe is the query executing the query template to check its use of {{.Query}}
+const overrideQueryProbe = "up"
+
+var (
+	overridableOutputs   = make(map[string][]string)
+	overridableOutputsMu sync.Mutex
+)
+
+// RegisterOverridableOutputs registers the workload outputs of an entity kind whose queries can be overridden,
+// declared next to the collector issuing the queries. It returns true, to be called in a package-level variable
+// declaration.
+func RegisterOverridableOutputs(entityKind string, wmhs ...*WorkloadMetricHolder) bool {
+	overridableOutputsMu.Lock()
+	defer overridableOutputsMu.Unlock()
+	for _, wmh := range wmhs {
+		if name := wmh.GetFileName(); !slices.Contains(overridableOutputs[entityKind], name) {
+			overridableOutputs[entityKind] = append(overridableOutputs[entityKind], name)
+		}
+	}
+	return true
+}
+
+// overridableMetrics returns the sorted metrics of the registered workload outputs of an entity kind
+func overridableMetrics(entityKind string) []string {
+	overridableOutputsMu.Lock()
+	defer overridableOutputsMu.Unlock()
+	metrics := slices.Clone(overridableOutputs[entityKind])
+	slices.Sort(metrics)
+	return metrics
+}
+
+// Id returns the identifier of the override, the entity kind and metric joined by a slash
+func (qo *QueryOverride) Id() string {
+	return Join(Slash, qo.EntityKind, qo.Metric)
+}
+
+func (qo *QueryOverride) compile() (err error) {
+	if !slices.Contains(customEntityKinds, qo.EntityKind) {
+		return fmt.Errorf("unknown entity kind %q, supported: %s", qo.EntityKind, strings.Join(customEntityKinds, ", "))
+	}
+	if metrics := overridableMetrics(qo.EntityKind); !slices.Contains(metrics, qo.Metric) {
+		return fmt.Errorf("unknown %s workload output %q, supported: %s", qo.EntityKind, qo.Metric, strings.Join(metrics, ", "))
+	}
+	if len(qo.Replace) == 0 && strings.TrimSpace(qo.Query) == Empty {
+		return fmt.Errorf("%s: no replacements and no query", qo.Id())
+	}
+	for i, qr := range qo.Replace {
+		if qr.From == Empty {
+			return fmt.Errorf("%s: replacement %d: nothing to replace", qo.Id(), i+1)
+		}
+	}
+	if qo.Query != Empty {
+		if qo.tmpl, err = template.New(qo.Id()).Option("missingkey=error").Parse(qo.Query); err != nil {
+			return fmt.Errorf("%s: %v", qo.Id(), err)
+		}
+		// check the template fields
+		var q1, q2 string
+		if q1, err = qo.apply(Empty); err != nil {
+			return fmt.Errorf("%s: %v", qo.Id(), err)
+		}
+		// the built-in queries of an output are variants (e.g. per pod label), a query ignoring them would map
+		// all the variants to the same query and drop all but one of them
+		if q2, _ = qo.apply(overrideQueryProbe); q1 == q2 {
+			return fmt.Errorf("%s: query does not use {{.Query}}, the built-in query", qo.Id())
+		}
+	}
+	return
+}
+
+func (qo *QueryOverride) apply(query string) (string, error) {
+	for _, qr := range qo.Replace {
+		query = strings.ReplaceAll(query, qr.From, qr.To)
+	}
+	if qo.tmpl == nil {
+		return query, nil
+	}
+	var sb strings.Builder
+	if err := qo.tmpl.Execute(&sb, &queryOverrideFields{Query: query}); err != nil {
+		return Empty, err
+	}
+	return sb.String(), nil
+}
+
+// QueryOverrides returns the identifiers of the query overrides
+func (rc *RunContext) QueryOverrides() (ids []string) {
+	for _, qo := range rc.config.custom.Overrides {
+		ids = append(ids, qo.Id())
+	}
+	return
+}
+
+func (rc *RunContext) queryOverride(entityKind, metric string) *QueryOverride {
+	for _, qo := range rc.config.custom.Overrides {
+		if qo.EntityKind == entityKind && qo.Metric == metric {
+			return qo
+		}
+	}
+	return nil
+}
+
+// overriddenQueries maps the queries resulting from the overrides of a run to the identifiers of the overrides
+type overriddenQueries struct {
+	queries map[string]string
+	mu      sync.Mutex
+}
+
+// OverrideQuery returns the query of a workload output as changed by its override, if any
+func (rc *RunContext) OverrideQuery(entityKind, metric, query string) string {
+	qo := rc.queryOverride(entityKind, metric)
+	if qo == nil {
+		return query
+	}
+	q, err := qo.apply(query)
+	if err != nil {
+		rc.LogErrorWithLevel(1, Warn, err, "Failed to override query %s of %s:", query, qo.Id())
+		return query
+	}
+	rc.overriddenQueries.mu.Lock()
+	defer rc.overriddenQueries.mu.Unlock()
+	if rc.overriddenQueries.queries == nil {
+		rc.overriddenQueries.queries = make(map[string]string)
+	}
+	rc.overriddenQueries.queries[q] = qo.Id()
+	return q
+}
+
+// overrideQueryProcessors returns the query processors of a workload output with the queries changed by its
+// override, if any
+func (rc *RunContext) overrideQueryProcessors(entityKind, metric string, qps map[string]*QueryProcessor) map[string]*QueryProcessor {
+	if rc.queryOverride(entityKind, metric) == nil {
+		return qps
+	}
+	oqps := make(map[string]*QueryProcessor, len(qps))
+	for query, qp := range qps {
+		q := rc.OverrideQuery(entityKind, metric, query)
+		if _, f := oqps[q]; f {
+			// the replacements removed what distinguishes the variants, keep them all with their built-in queries
+			rc.LogErrorWithLevel(1, Warn, fmt.Errorf("several queries overridden to %s", q), "Failed to override queries of %s:", Join(Slash, entityKind, metric))
+			return qps
+		}
+		oqps[q] = qp
+	}
+	return oqps
+}
+
+// queryOverrideId returns the identifier of the override a query results from, if any
+func (rc *RunContext) queryOverrideId(query string) string {
+	rc.overriddenQueries.mu.Lock()
+	defer rc.overriddenQueries.mu.Unlock()
+	return rc.overriddenQueries.queries[query]
+}
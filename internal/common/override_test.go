@@ -0,0 +1,114 @@
+package common
+
+import (
+	"strings"
+	"testing"
+)
+
+var _ = RegisterOverridableOutputs(ContainerEntityKind, NewWorkloadMetricHolder(Avg, Cpu, "mcores", Workload))
+var _ = RegisterOverridableOutputs(NodeEntityKind, CpuUtilization, MemoryUtilization)
+
+const testQueryOverrides = `
+overrides:
+  - entityKind: container
+    metric: avg_cpu_mcores_workload
+    replace:
+      - from: container_cpu_usage_seconds_total
+        to: cadvisor_container_cpu_usage_seconds_total
+      - from: container!=
+        to: container_name!=
+    query: label_replace({{.Query}}, "container", "$1", "container_name", "(.*)")
+  - entityKind: node
+    metric: cpu_utilization
+    replace:
+      - from: node_cpu_seconds_total
+        to: host_cpu_seconds_total
+`
+
+func TestQueryOverrides(t *testing.T) {
+	rc, err := setTestCustomConfig(t, testQueryOverrides)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ids := rc.QueryOverrides(); strings.Join(ids, ",") != "container/avg_cpu_mcores_workload,node/cpu_utilization" {
+		t.Errorf("overrides = %v", ids)
+	}
+	qp1, qp2 := &QueryProcessor{}, &QueryProcessor{}
+	qps := map[string]*QueryProcessor{
+		`avg(irate(container_cpu_usage_seconds_total{container!=""}[5m])) by (pod)`:      qp1,
+		`avg(irate(container_cpu_usage_seconds_total{container!=""}[5m])) by (pod_name)`: qp2,
+	}
+	got := rc.overrideQueryProcessors(ContainerEntityKind, "avg_cpu_mcores_workload", qps)
+	want := map[string]*QueryProcessor{
+		`label_replace(avg(irate(cadvisor_container_cpu_usage_seconds_total{container_name!=""}[5m])) by (pod), "container", "$1", "container_name", "(.*)")`:      qp1,
+		`label_replace(avg(irate(cadvisor_container_cpu_usage_seconds_total{container_name!=""}[5m])) by (pod_name), "container", "$1", "container_name", "(.*)")`: qp2,
+	}
+	if len(got) != len(want) {
+		t.Fatalf("queries = %v, want %v", got, want)
+	}
+	for query, qp := range want {
+		if got[query] != qp {
+			t.Errorf("query %s missing", query)
+		}
+		if id := rc.queryOverrideId(query); id != "container/avg_cpu_mcores_workload" {
+			t.Errorf("override of %s = %q", query, id)
+		}
+	}
+	if got = rc.overrideQueryProcessors(NodeEntityKind, "memory_utilization", qps); len(got) != len(qps) || got[`avg(irate(container_cpu_usage_seconds_total{container!=""}[5m])) by (pod)`] != qp1 {
+		t.Errorf("queries without override changed: %v", got)
+	}
+	query := `sum(irate(node_cpu_seconds_total{mode!="idle"}[5m])) by (node)`
+	if q := rc.OverrideQuery(NodeEntityKind, "cpu_utilization", query); q != `sum(irate(host_cpu_seconds_total{mode!="idle"}[5m])) by (node)` {
+		t.Errorf("replaced query = %s", q)
+	}
+	if id := rc.queryOverrideId(query); id != Empty {
+		t.Errorf("override of a built-in query = %q", id)
+	}
+}
+
+const testQueryOverridesCollision = `
+overrides:
+  - entityKind: node
+    metric: cpu_utilization
+    replace:
+      - from: pod_name
+        to: pod
+`
+
+func TestQueryOverridesCollision(t *testing.T) {
+	rc, err := setTestCustomConfig(t, testQueryOverridesCollision)
+	if err != nil {
+		t.Fatal(err)
+	}
+	qps := map[string]*QueryProcessor{
+		`avg(up) by (pod)`:      {},
+		`avg(up) by (pod_name)`: {},
+	}
+	// the variants cannot be told apart once overridden, they are all kept with their built-in queries
+	if got := rc.overrideQueryProcessors(NodeEntityKind, "cpu_utilization", qps); len(got) != len(qps) || got[`avg(up) by (pod_name)`] == nil {
+		t.Errorf("queries = %v, want %v", got, qps)
+	}
+}
+
+func TestQueryOverridesErrors(t *testing.T) {
+	tests := map[string]string{
+		"entity kind": "overrides:\n  - entityKind: hpa\n    metric: cpu_utilization\n    query: up\n",
+		"metric":      "overrides:\n  - entityKind: node\n    metric: cpu utilization\n    query: up\n",
+		"unknown":     "overrides:\n  - entityKind: node\n    metric: avg_cpu_mcores_workload\n    query: \"{{.Query}}\"\n",
+		"nothing":     "overrides:\n  - entityKind: node\n    metric: cpu_utilization\n",
+		"from":        "overrides:\n  - entityKind: node\n    metric: cpu_utilization\n    replace:\n      - to: b\n",
+		"template":    "overrides:\n  - entityKind: node\n    metric: cpu_utilization\n    query: \"{{.Query\"\n",
+		"field":       "overrides:\n  - entityKind: node\n    metric: cpu_utilization\n    query: \"{{.Metric}}\"\n",
+		"no query":    "overrides:\n  - entityKind: node\n    metric: cpu_utilization\n    query: avg(node_cpu_busy_ratio{}) by (node)\n",
+		"duplicate":   "overrides:\n  - entityKind: node\n    metric: cpu_utilization\n    query: \"{{.Query}}\"\n  - entityKind: node\n    metric: cpu_utilization\n    query: \"{{.Query}} * 1\"\n",
+	}
+	for name, config := range tests {
+		rc, err := setTestCustomConfig(t, config)
+		if err == nil || !strings.Contains(err.Error(), "override ") {
+			t.Errorf("%s: error %v, want one naming the override", name, err)
+		}
+		if len(rc.QueryOverrides()) > 0 {
+			t.Errorf("%s: invalid config set", name)
+		}
+	}
+}
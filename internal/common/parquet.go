@@ -0,0 +1,207 @@
+package common
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/xitongsys/parquet-go-source/local"
+	"github.com/xitongsys/parquet-go/reader"
+	"github.com/xitongsys/parquet-go/writer"
+)
+
+const parquetFileExt = ".parquet"
+
+// parquetField returns the Parquet schema field of a column
+func parquetField(column *Column) string {
+	repetition := "REQUIRED"
+	if column.Nullable {
+		repetition = "OPTIONAL"
+	}
+	var tag string
+	switch column.Type {
+	case IntColumn:
+		tag = "type=INT64"
+	case FloatColumn:
+		tag = "type=DOUBLE"
+	case BoolColumn:
+		tag = "type=BOOLEAN"
+	case TimeColumn:
+		tag = "type=INT64, convertedtype=TIMESTAMP_MILLIS"
+	case LabelsColumn:
+		return fmt.Sprintf(`{"Tag": "name=%s, type=MAP, repetitiontype=OPTIONAL", "Fields": [`+
+			`{"Tag": "name=key, type=BYTE_ARRAY, convertedtype=UTF8, repetitiontype=REQUIRED"}, `+
+			`{"Tag": "name=value, type=LIST, repetitiontype=OPTIONAL", "Fields": [`+
+			`{"Tag": "name=element, type=BYTE_ARRAY, convertedtype=UTF8, repetitiontype=REQUIRED"}]}]}`, column.Name)
+	case JsonColumn:
+		tag = "type=BYTE_ARRAY, convertedtype=JSON"
+	default:
+		tag = "type=BYTE_ARRAY, convertedtype=UTF8"
+	}
+	return fmt.Sprintf(`{"Tag": "name=%s, %s, repetitiontype=%s"}`, column.Name, tag, repetition)
+}
+
+// parquetSink writes the records of an output to a Parquet file, with a typed column per CSV column and the
+// labels as a native map column. The column types are those of the schema of the output; without a schema,
+// they are those of the values: the config and attributes records are kept until the sink is closed, so that
+// the type of every column is known (a column with no value at all is a string), while the workload samples
+// are written as they come, with the types of the first one.
+type parquetSink struct {
+	spec    *OutputSpec
+	file    *atomicFile
+	pw      *writer.JSONWriter
+	columns []*Column
+	records [][]any
+}
+
+func newParquetSink(spec *OutputSpec) (Sink, error) {
+	// a Parquet file has its footer at the end, it cannot be appended to
+	file, _, err := spec.createFile(parquetFileExt, false)
+	if err != nil {
+		return nil, err
+	}
+	ps := &parquetSink{spec: spec, file: file}
+	if spec.Schema != nil {
+		if err = ps.start(); err != nil {
+			file.discard()
+			return nil, err
+		}
+	}
+	return ps, nil
+}
+
+func (ps *parquetSink) Name() string {
+	return ps.file.Name()
+}
+
+func (ps *parquetSink) WriteRecord(values ...any) error {
+	if l := len(values); l != len(ps.spec.Columns) {
+		return fmt.Errorf("%s: %d values for %d columns", ps.Name(), l, len(ps.spec.Columns))
+	}
+	if ps.pw != nil {
+		return ps.write(values)
+	}
+	ps.records = append(ps.records, values)
+	return nil
+}
+
+func (ps *parquetSink) WriteSample(s *Sample) (err error) {
+	values := make([]any, 0, len(ps.spec.Columns))
+	for _, field := range s.Entity {
+		values = append(values, field)
+	}
+	values = append(values, s.Time.Time())
+	values = append(values, s.Values...)
+	if l := len(values); l != len(ps.spec.Columns) {
+		return fmt.Errorf("%s: %d values for %d columns", ps.Name(), l, len(ps.spec.Columns))
+	}
+	if ps.pw == nil {
+		if err = ps.start(values); err != nil {
+			return
+		}
+	}
+	return ps.write(values)
+}
+
+// start creates the Parquet writer, with the columns of the schema or else the column types of the first
+// non-nil values in the rows
+func (ps *parquetSink) start(rows ...[]any) (err error) {
+	if ps.spec.Schema != nil {
+		ps.columns = ps.spec.Schema.Columns
+	} else {
+		ps.columns = make([]*Column, len(ps.spec.Columns))
+		for i, name := range ps.spec.Columns {
+			ps.columns[i] = &Column{Name: name, Type: StringColumn, Nullable: true}
+			for _, row := range rows {
+				if row[i] != nil {
+					if ct := columnTypeOf(row[i]); ct != Empty {
+						ps.columns[i].Type = ct
+					}
+					break
+				}
+			}
+		}
+	}
+	fields := make([]string, len(ps.columns))
+	for i, column := range ps.columns {
+		fields[i] = parquetField(column)
+	}
+	schema := `{"Tag": "name=parquet_go_root, repetitiontype=REQUIRED", "Fields": [` + strings.Join(fields, ", ") + `]}`
+	ps.pw, err = writer.NewJSONWriterFromWriter(schema, ps.file, 1)
+	return
+}
+
+func (ps *parquetSink) write(values []any) error {
+	row := make(map[string]any, len(values))
+	for i, value := range values {
+		if value == nil {
+			continue
+		}
+		if ct := columnTypeOf(value); ct != ps.columns[i].Type {
+			if ps.columns[i].Type != StringColumn {
+				return fmt.Errorf("%s: column %s: %T value in a column of another type", ps.Name(), ps.spec.Columns[i], value)
+			}
+			value = fmt.Sprint(value)
+		}
+		switch v := value.(type) {
+		case time.Time:
+			row[ps.spec.Columns[i]] = v.UnixMilli()
+		case LabelMap:
+			m := make(map[string][]string, len(v.Map))
+			for key, lv := range v.Map {
+				if !v.Reject[key] {
+					m[key] = lv
+				}
+			}
+			row[ps.spec.Columns[i]] = m
+		case json.RawMessage:
+			row[ps.spec.Columns[i]] = string(v)
+		default:
+			row[ps.spec.Columns[i]] = v
+		}
+	}
+	b, err := json.Marshal(row)
+	if err == nil {
+		err = ps.pw.Write(string(b))
+	}
+	return err
+}
+
+func (ps *parquetSink) Close() (err error) {
+	defer func() {
+		if err == nil {
+			err = ps.file.Close()
+		} else {
+			// not a valid Parquet file
+			ps.file.discard()
+		}
+	}()
+	if ps.pw == nil {
+		if err = ps.start(ps.records...); err != nil {
+			return
+		}
+	}
+	for _, record := range ps.records {
+		if err = ps.write(record); err != nil {
+			return
+		}
+	}
+	ps.records = nil
+	return ps.pw.WriteStop()
+}
+
+// parquetRows returns the number of rows of a Parquet file, read from its footer
+func parquetRows(path string) (int, error) {
+	fr, err := local.NewLocalFileReader(path)
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = fr.Close() }()
+	pr, err := reader.NewParquetReader(fr, nil, 1)
+	if err != nil {
+		return 0, err
+	}
+	defer pr.ReadStop()
+	return int(pr.GetNumRows()), nil
+}
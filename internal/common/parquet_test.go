@@ -0,0 +1,81 @@
+package common
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/prometheus/common/model"
+	"github.com/xitongsys/parquet-go-source/local"
+	"github.com/xitongsys/parquet-go/reader"
+)
+
+func readParquet(t *testing.T, name string) string {
+	t.Helper()
+	fr, err := local.NewLocalFileReader(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = fr.Close() }()
+	pr, err := reader.NewParquetReader(fr, nil, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pr.ReadStop()
+	rows, err := pr.ReadByNumber(int(pr.GetNumRows()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := json.Marshal(rows)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func TestParquetSinkWriteRecord(t *testing.T) {
+	rc := newTestOutputRunContext(t, nil)
+	sink, err := newParquetSink(&OutputSpec{Cluster: "c1", EntityKind: NodeEntityKind, Name: "attributes", Columns: []string{"Name", "Unknown", "Cpu", "Ready", "CreateTime", "Labels"}, folder: rc.rootFolder, config: rc.config})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ct := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	labels := LabelMap{Map: LabelValues{"a": {"x,y"}, "m": {"1;2", "3"}, "r": {"z"}}, Reject: map[string]bool{"r": true}}
+	if err = sink.WriteRecord("n1", nil, 4, true, ct, labels); err != nil {
+		t.Fatalf("WriteRecord() error = %v", err)
+	}
+	if err = sink.WriteRecord("n2", nil, 8, nil, nil, nil); err != nil {
+		t.Fatalf("WriteRecord() error = %v", err)
+	}
+	if err = sink.Close(); err != nil {
+		t.Fatal(err)
+	}
+	got := readParquet(t, sink.Name())
+	want := `[{"Name":"n1","Unknown":null,"Cpu":4,"Ready":true,"CreateTime":1714557600000,"Labels":{"a":["x,y"],"m":["1;2","3"]}},` +
+		`{"Name":"n2","Unknown":null,"Cpu":8,"Ready":null,"CreateTime":null,"Labels":null}]`
+	if got != want {
+		t.Fatalf("Parquet = %s, want %s", got, want)
+	}
+}
+
+func TestParquetSinkWriteSample(t *testing.T) {
+	rc := newTestOutputRunContext(t, nil)
+	sink, err := newParquetSink(&OutputSpec{Cluster: "c1", EntityKind: NodeEntityKind, Name: "cpu", Columns: []string{"ClusterName", "NodeName", "MetricTime", "cpuUtilization"}, folder: rc.rootFolder, config: rc.config})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = sink.WriteSample(&Sample{Entity: []string{"c1", "n1"}, Time: model.TimeFromUnix(60), Values: []any{1.5}}); err != nil {
+		t.Fatalf("WriteSample() error = %v", err)
+	}
+	if err = sink.WriteSample(&Sample{Entity: []string{"c1", "n1"}, Time: model.TimeFromUnix(120), Values: []any{"x"}}); err == nil {
+		t.Error("WriteSample() with a value of another type: expected an error")
+	}
+	if err = sink.Close(); err != nil {
+		t.Fatal(err)
+	}
+	got := readParquet(t, sink.Name())
+	want := `[{"ClusterName":"c1","NodeName":"n1","MetricTime":60000,"CpuUtilization":1.5}]`
+	if got != want {
+		t.Fatalf("Parquet = %s, want %s", got, want)
+	}
+}
@@ -0,0 +1,47 @@
+package common
+
+import (
+	"time"
+
+	v1 "github.com/prometheus/client_golang/api/prometheus/v1"
+)
+
+type PlannedQuery struct {
+	Cluster string        `json:"cluster"`
+	Api     string        `json:"api"`
+	Query   string        `json:"query"`
+	Start   *time.Time    `json:"start,omitempty"`
+	End     *time.Time    `json:"end,omitempty"`
+	Step    time.Duration `json:"step,omitempty"`
+	// Override is the identifier of the query override the query results from, if any
+	Override string `json:"override,omitempty"`
+}
+
+// SetDryRun sets whether CollectMetric records the queries it would have issued (see PlannedQueries) and returns
+// empty results instead of querying Prometheus
+func (cfg *RunConfig) SetDryRun(dryRun bool) {
+	cfg.dryRun = dryRun
+}
+
+func (rc *RunContext) planQuery(cluster string, query string, pac PrometheusApiCall, promRange *v1.Range, override string) {
+	pq := &PlannedQuery{Cluster: cluster, Api: pac.String(), Query: query, Override: override}
+	if promRange != nil {
+		if !promRange.Start.IsZero() {
+			start := promRange.Start
+			pq.Start = &start
+		}
+		end := promRange.End
+		pq.End = &end
+		pq.Step = promRange.Step
+	}
+	rc.plannedQueriesMu.Lock()
+	rc.plannedQueries = append(rc.plannedQueries, pq)
+	rc.plannedQueriesMu.Unlock()
+}
+
+// PlannedQueries returns the queries recorded during a dry run, in the order they would have been issued
+func (rc *RunContext) PlannedQueries() []*PlannedQuery {
+	rc.plannedQueriesMu.Lock()
+	defer rc.plannedQueriesMu.Unlock()
+	return rc.plannedQueries
+}
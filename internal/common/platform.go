@@ -4,7 +4,8 @@ import (
 	"fmt"
 	"regexp"
 	"strings"
-	"sync"
+
+	cconf "github.com/densify-dev/container-config/config"
 )
 
 type ObservabilityPlatform string
@@ -24,26 +25,31 @@ const (
 	fqdnGrafanaCloud    = "grafana.net"
 )
 
-var op ObservabilityPlatform
-var opqa QueryAdjuster
-var onceOp sync.Once
-
-func GetObservabilityPlatform() ObservabilityPlatform {
-	onceOp.Do(func() {
-		op = getObservabilityPlatform()
-		opqa = platformQueryAdjusters[op]
+// GetObservabilityPlatform returns the observability platform of the run, detected from its parameters
+func (rc *RunContext) GetObservabilityPlatform() ObservabilityPlatform {
+	rc.oncePlatform.Do(func() {
+		rc.platform = getObservabilityPlatform(rc.params)
+		rc.platformQa = platformQueryAdjusters[rc.platform]
 	})
-	return op
+	return rc.platform
+}
+
+// PlatformName returns the observability platform, or "Prometheus-compatible" if not a known one
+func (rc *RunContext) PlatformName() string {
+	if p := rc.GetObservabilityPlatform(); p != UnknownPlatform {
+		return string(p)
+	}
+	return "Prometheus-compatible"
 }
 
-func GetObservabilityPlatformQueryAdjuster() QueryAdjuster {
-	_ = GetObservabilityPlatform()
-	return opqa
+func (rc *RunContext) GetObservabilityPlatformQueryAdjuster() QueryAdjuster {
+	_ = rc.GetObservabilityPlatform()
+	return rc.platformQa
 }
 
-func getObservabilityPlatform() ObservabilityPlatform {
-	host := strings.ToLower(Params.Prometheus.UrlConfig.Host)
-	if Params.Prometheus.SigV4Config != nil || strings.HasPrefix(host, workspaceAMPPattern) {
+func getObservabilityPlatform(params *cconf.Parameters) ObservabilityPlatform {
+	host := strings.ToLower(params.Prometheus.UrlConfig.Host)
+	if params.Prometheus.SigV4Config != nil || strings.HasPrefix(host, workspaceAMPPattern) {
 		return AWSManagedPrometheus
 	}
 	if strings.HasSuffix(host, fqdnAzMP) {
@@ -52,7 +58,7 @@ func getObservabilityPlatform() ObservabilityPlatform {
 	if strings.HasPrefix(host, domainGMP) {
 		return GoogleManagedPrometheus
 	}
-	if strings.Contains(host, fqdnGrafanaCloud) && Params.Prometheus.UrlConfig.Password != Empty {
+	if strings.Contains(host, fqdnGrafanaCloud) && params.Prometheus.UrlConfig.Password != Empty {
 		return GrafanaCloud
 	}
 	return UnknownPlatform
@@ -65,7 +71,7 @@ const (
 
 var (
 	platformQueryAdjusters = map[ObservabilityPlatform]QueryAdjuster{GoogleManagedPrometheus: gmpQueryAdjuster}
-	metricPrefixes         = []string{exporters[ksm].getPrefix(), exporters[Dcgm].getPrefix()}
+	metricPrefixes         = []string{exporters[Ksm].getPrefix(), exporters[Dcgm].getPrefix()}
 	gmpRe                  = buildGmpRegex()
 )
 
@@ -9,7 +9,6 @@ import (
 	"sort"
 	"strconv"
 	"strings"
-	"sync"
 	"time"
 
 	cconf "github.com/densify-dev/container-config/config"
@@ -18,12 +17,13 @@ import (
 	"github.com/prometheus/common/config"
 	"github.com/prometheus/common/model"
 	"github.com/prometheus/sigv4"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
 )
 
 // CollectMetric is used to query Prometheus to get data for specific query and return the results to be processed
-func CollectMetric(callDepth int, query string, promRange *v1.Range) (crm ClusterResultMap, n int, err error) {
+func (rc *RunContext) CollectMetric(callDepth int, query string, promRange *v1.Range) (crm ClusterResultMap, n int, err error) {
 	var qry string
-	if pqa := GetObservabilityPlatformQueryAdjuster(); pqa == nil {
+	if pqa := rc.GetObservabilityPlatformQueryAdjuster(); pqa == nil {
 		qry = query
 	} else {
 		qry = pqa(query)
@@ -33,21 +33,39 @@ func CollectMetric(callDepth int, query string, promRange *v1.Range) (crm Cluste
 		return
 	}
 	pac := getApiCall(promRange)
-	for _, qlf := range labelFilters {
+	entity := rc.entity
+	sp := startSpan(contextSpan(rc.ctx), "CollectMetric", tracepb.Span_SPAN_KIND_INTERNAL).setString(entityAttr, entity).setString(apiAttr, pac.String()).setQuery(query)
+	defer func() { sp.setInt(seriesAttr, int64(n)).end(err) }()
+filters:
+	for _, qlf := range rc.labelFilters {
 		queries := qlf.adjustQuery(qry)
 		for cluster, qr := range queries {
-			if excludeQueryForCluster(cluster, qr) {
-				logQuery(callDepth+1, cluster, qr+" - excluded for the cluster", pac)
+			if rc.Interrupted() {
+				err = context.Cause(rc.ctx)
+				break filters
+			}
+			if rc.excludeQueryForCluster(cluster, qr) {
+				rc.logQuery(callDepth+1, cluster, qr+" - excluded for the cluster", pac)
+				continue
+			}
+			q, si := rc.adjustIntervalToScrapeInterval(cluster, qr)
+			rc.logQuery(callDepth+1, cluster, q, pac)
+			if rc.config.dryRun {
+				rc.planQuery(cluster, q, pac, adjustTimeRange(promRange, si), rc.queryOverrideId(query))
+				if crm, err = Merge(crm, split(&Result{Query: q}, cluster, qlf.clusterFilters), Fail); err != nil {
+					break
+				}
 				continue
 			}
-			q, si := adjustIntervalToScrapeInterval(cluster, qr)
-			logQuery(callDepth+1, cluster, q, pac)
 			var pa v1.API
-			if pa, err = promApi(cluster); err == nil {
-				ctx, cancel := context.WithCancel(context.Background())
+			if pa, err = rc.promApi(cluster); err == nil {
+				ctx, cancel := context.WithCancel(rc.ctx)
 				_ = time.AfterFunc(2*time.Minute, func() { cancel() })
+				var qs *span
+				ctx, qs = rc.startQuerySpan(ctx, sp, cluster, q, pac, adjustTimeRange(promRange, si))
 				var value model.Value
 				var e error
+				start := time.Now()
 				switch pac {
 				case ApiQuery:
 					value, _, e = pa.Query(ctx, q, promRange.End)
@@ -58,16 +76,19 @@ func CollectMetric(callDepth int, query string, promRange *v1.Range) (crm Cluste
 					// no use for exemplars yet, just for completeness
 					_, e = pa.QueryExemplars(ctx, q, promRange.Start, promRange.End)
 				}
-				failOnConnectionError(e)
+				rc.config.metrics.observeQuery(entity, pac, rc.PlatformName(), time.Since(start))
+				qs.setInt(seriesAttr, int64(seriesCount(value))).end(e)
+				rc.failOnConnectionError(e)
 				m := qlf.filterValue(cluster, q, value, e)
 				if crm, err = Merge(crm, m, Fail); err != nil {
 					break
 				}
 			} else {
-				failOnConnectionError(err)
+				rc.failOnConnectionError(err)
 			}
 		}
 	}
+	rc.countResults(entity, crm, err)
 	for _, result := range crm {
 		if result != nil && result.Matrix.Len() > 0 {
 			n++
@@ -76,22 +97,22 @@ func CollectMetric(callDepth int, query string, promRange *v1.Range) (crm Cluste
 	return
 }
 
-func logQuery(callDepth int, cluster string, query string, pac PrometheusApiCall) {
+func (rc *RunContext) logQuery(callDepth int, cluster string, query string, pac PrometheusApiCall) {
 	if cluster == Empty {
-		LogAll(callDepth+1, Debug, queryLogFormat, pac, query)
+		rc.LogAll(callDepth+1, Debug, queryLogFormat, pac, query)
 	} else {
-		LogCluster(callDepth+1, Debug, clusterQueryLogFormat, cluster, true, pac, cluster, query)
+		rc.LogCluster(callDepth+1, Debug, clusterQueryLogFormat, cluster, true, cluster, pac, query)
 	}
 }
 
-func CheckPrometheusUp() (n int) {
+func (rc *RunContext) CheckPrometheusUp() (n int) {
 	var err error
 	var pa v1.API
-	ctx, cancel := context.WithCancel(context.Background())
+	ctx, cancel := context.WithCancel(rc.ctx)
 	_ = time.AfterFunc(2*time.Minute, func() { cancel() })
-	if pa, err = promApi(Empty); err == nil {
+	if pa, err = rc.promApi(Empty); err == nil {
 		var value model.Value
-		tr := TimeRange()
+		tr := rc.TimeRange()
 		if value, _, err = pa.QueryRange(ctx, "max(up)", *tr); err == nil {
 			if mat, ok := value.(model.Matrix); ok {
 				for _, ss := range mat {
@@ -104,63 +125,63 @@ func CheckPrometheusUp() (n int) {
 			}
 		}
 	}
-	failOnConnectionError(err)
+	rc.failOnConnectionError(err)
 	return
 }
 
-func GetPrometheusVersion() (version string, found bool) {
-	if supported, forWhat := buildInfoSupported(); !supported {
+func (rc *RunContext) GetPrometheusVersion() (version string, found bool) {
+	// kept for the run summary
+	defer func() { rc.prometheusVersion = version }()
+	if supported, forWhat := buildInfoSupported(rc.GetObservabilityPlatform()); !supported {
 		version = fmt.Sprintf(verNotDetected, forWhat)
 		return
 	}
 	var err error
 	var pa v1.API
-	ctx, cancel := context.WithCancel(context.Background())
+	ctx, cancel := context.WithCancel(rc.ctx)
 	_ = time.AfterFunc(1*time.Minute, func() { cancel() })
-	if pa, err = promApi(Empty); err == nil {
+	if pa, err = rc.promApi(Empty); err == nil {
 		var bir v1.BuildinfoResult
 		if bir, err = pa.Buildinfo(ctx); err == nil {
 			version = bir.Version
 			found = true
 		}
 	}
-	failOnConnectionError(err)
+	rc.failOnConnectionError(err)
 	return
 }
 
-func LogPrometheusTsdbStatus() (err error) {
-	if !Params.Debug || GetObservabilityPlatform() != UnknownPlatform {
+func (rc *RunContext) LogPrometheusTsdbStatus() (err error) {
+	if !rc.debugEnabled() || rc.GetObservabilityPlatform() != UnknownPlatform {
 		return
 	}
 	var pa v1.API
-	if pa, err = promApi(Empty); err == nil {
-		ctx, cancel := context.WithCancel(context.Background())
+	if pa, err = rc.promApi(Empty); err == nil {
+		ctx, cancel := context.WithCancel(rc.ctx)
 		_ = time.AfterFunc(1*time.Minute, func() { cancel() })
 		var tsdbResult v1.TSDBResult
 		if tsdbResult, err = pa.TSDB(ctx); err == nil {
 			var b []byte
 			if b, err = json.Marshal(&tsdbResult); err == nil {
-				LogAll(1, Debug, "Prometheus TSDB status: %s", string(b))
+				rc.LogAll(1, Debug, "Prometheus TSDB status: %s", string(b))
 			}
 		}
 	}
 	return
 }
 
-var onceConn sync.Once
-
-func failOnConnectionError(err error) {
+func (rc *RunContext) failOnConnectionError(err error) {
 	// if the very first attempt to connect to Prometheus fails, bail out as most probably
 	// the configuration is wrong
-	onceConn.Do(func() {
-		if err != nil {
-			FatalError(err, "Failed to connect to Prometheus:")
+	rc.onceConn.Do(func() {
+		if err != nil && !rc.Interrupted() {
+			rc.FatalErrorExitCode(ExitConnection, err, "Failed to connect to Prometheus:")
 		}
 	})
 }
 
-func buildInfoSupported() (bool, string) {
-	switch observabilityPlatform := GetObservabilityPlatform(); observabilityPlatform {
+func buildInfoSupported(observabilityPlatform ObservabilityPlatform) (bool, string) {
+	switch observabilityPlatform {
 	case AWSManagedPrometheus, AzureMonitorManagedPrometheus, GoogleManagedPrometheus:
 		// AMP, AzMP and GMP don't support Buildinfo() (all return 404):
 		// * https://docs.aws.amazon.com/prometheus/latest/userguide/AMP-APIReference-Prometheus-Compatible-Apis.html
@@ -179,18 +200,28 @@ const (
 	labelPrefix        = Label + Underscore
 )
 
-func promApi(cluster string) (v1.API, error) {
+// SetPrometheusApi sets the Prometheus API client of all the queries of the run, used as is instead of the one
+// built from the prometheus parameters
+func (rc *RunContext) SetPrometheusApi(api v1.API) {
+	rc.prometheusApi = api
+}
+
+func (rc *RunContext) promApi(cluster string) (v1.API, error) {
+	if rc.prometheusApi != nil {
+		return rc.prometheusApi, nil
+	}
+	prom := rc.params.Prometheus
 	hcc := &config.HTTPClientConfig{}
-	vop, err := cconf.NewValueOrPath(Params.Prometheus.CaCertPath, true, false)
+	vop, err := cconf.NewValueOrPath(prom.CaCertPath, true, false)
 	if err == nil {
 		hcc.TLSConfig.CAFile = vop.Path()
 	} else {
-		FatalError(err, "failed to generate TLS config")
+		rc.FatalErrorExitCode(ExitConfig, err, "failed to generate TLS config")
 	}
-	vop, _ = cconf.NewValueOrPath(Params.Prometheus.UrlConfig.Username, false, false)
-	vop2, _ := cconf.NewValueOrPath(Params.Prometheus.UrlConfig.Password, false, false)
+	vop, _ = cconf.NewValueOrPath(prom.UrlConfig.Username, false, false)
+	vop2, _ := cconf.NewValueOrPath(prom.UrlConfig.Password, false, false)
 	if vop.IsEmpty() != vop2.IsEmpty() {
-		FatalError(fmt.Errorf("basic auth requires both username and password"), "inconsistent configuration")
+		rc.FatalErrorExitCode(ExitConfig, fmt.Errorf("basic auth requires both username and password"), "inconsistent configuration")
 	}
 	if !vop.IsEmpty() {
 		hcc.BasicAuth = &config.BasicAuth{
@@ -208,7 +239,7 @@ func promApi(cluster string) (v1.API, error) {
 	// Another one is Openshift Monitoring Stack - see:
 	// https://docs.openshift.com/container-platform/4.15/monitoring/configuring-the-monitoring-stack.html
 	// The bearer token can be passed as a string or as a path to a file.
-	vop, err = cconf.NewValueOrPath(Params.Prometheus.BearerToken, false, false)
+	vop, err = cconf.NewValueOrPath(prom.BearerToken, false, false)
 	if !vop.IsEmpty() {
 		if vop.IsFile() {
 			hcc.BearerTokenFile = vop.Path()
@@ -218,19 +249,20 @@ func promApi(cluster string) (v1.API, error) {
 	}
 	var rt http.RoundTripper
 	if rt, err = config.NewRoundTripperFromConfig(*hcc, promClient); err != nil {
-		FatalError(err, "failed to create HTTP round tripper")
+		rc.FatalErrorExitCode(ExitConfig, err, "failed to create HTTP round tripper")
 	}
-	if Params.Prometheus.SigV4Config != nil {
-		if rt, err = sigv4.NewSigV4RoundTripper(Params.Prometheus.SigV4Config, rt); err != nil {
-			FatalError(err, "failed to create AWS SigV4 round tripper")
+	if prom.SigV4Config != nil {
+		if rt, err = sigv4.NewSigV4RoundTripper(prom.SigV4Config, rt); err != nil {
+			rc.FatalErrorExitCode(ExitConfig, err, "failed to create AWS SigV4 round tripper")
 		}
 	}
+	rt = &traceRoundTripper{rt: &countingRoundTripper{rt: rt, bytes: rc.config.metrics.bytesRead}}
 	var hc *http.Client
-	if hc, err = Params.Prometheus.RetryConfig.NewClient(rt, &ClusterLeveledLogger{cluster: cluster}); err != nil {
+	if hc, err = prom.RetryConfig.NewClient(rt, &ClusterLeveledLogger{rc: rc, cluster: cluster}); err != nil {
 		return nil, err
 	}
 	var client api.Client
-	if client, err = api.NewClient(api.Config{Address: Params.Prometheus.UrlConfig.Url, Client: hc}); err == nil {
+	if client, err = api.NewClient(api.Config{Address: prom.UrlConfig.Url, Client: hc}); err == nil {
 		return v1.NewAPI(client), nil
 	} else {
 		return nil, err
@@ -238,22 +270,22 @@ func promApi(cluster string) (v1.API, error) {
 }
 
 // TimeRange allows you to define the start and end values of the range will pass to the Prometheus for the query
-func TimeRange() (promRange *v1.Range) {
-	return TimeRangeForInterval(0)
+func (rc *RunContext) TimeRange() (promRange *v1.Range) {
+	return rc.TimeRangeForInterval(0)
 }
 
-func TimeRangeForInterval(historyInterval time.Duration) (promRange *v1.Range) {
-	return TimeRangeForIntervals(historyInterval, 0, ApiQueryRange)
+func (rc *RunContext) TimeRangeForInterval(historyInterval time.Duration) (promRange *v1.Range) {
+	return rc.TimeRangeForIntervals(historyInterval, 0, ApiQueryRange)
 }
 
-func TimeRangeEndTimeOnly() (promRange *v1.Range) {
-	return TimeRangeForIntervals(0, 0, ApiQuery)
+func (rc *RunContext) TimeRangeEndTimeOnly() (promRange *v1.Range) {
+	return rc.TimeRangeForIntervals(0, 0, ApiQuery)
 }
 
-func TimeRangeForIntervals(historyInterval, absoluteStep time.Duration, target PrometheusApiCall) (promRange *v1.Range) {
+func (rc *RunContext) TimeRangeForIntervals(historyInterval, absoluteStep time.Duration, target PrometheusApiCall) (promRange *v1.Range) {
 	// for workload metrics the historyInterval will be set depending on how far back in history we are querying currently
 	// note it will be 0 for all queries that are not workload related.
-	end := CurrentTime.Add(-Interval * historyInterval)
+	end := rc.currentTime.Add(-rc.interval * historyInterval)
 	var start time.Time
 	var step time.Duration
 	switch target {
@@ -263,11 +295,11 @@ func TimeRangeForIntervals(historyInterval, absoluteStep time.Duration, target P
 		if absoluteStep > 0 {
 			step = absoluteStep
 		} else {
-			step = Step
+			step = rc.step
 		}
 		fallthrough
 	case ApiQueryExemplars:
-		start = end.Add(-Interval)
+		start = end.Add(-rc.interval)
 	}
 	return &v1.Range{Start: start, End: end, Step: step}
 }
@@ -347,24 +379,24 @@ func ToPrometheusLabelNameList(list string) string {
 	return JoinComma(names...)
 }
 
-func CalculateScrapeIntervals() (err error) {
-	et := TimeRangeEndTimeOnly()
+func (rc *RunContext) CalculateScrapeIntervals() (err error) {
+	et := rc.TimeRangeEndTimeOnly()
 	var query string
 	for _, exp := range exporters {
 		var labelSelector string
 		if len(exp.repLabels) > 0 {
 			labelSelector = Join(nonEmptyLabel+Comma, exp.repLabels...) + nonEmptyLabel
 		}
-		query = fmt.Sprintf(`max(count_over_time(%s{%s}[%v])) by (job)`, exp.repMetric, labelSelector, Interval)
-		_, err = CollectAndProcessMetric(query, et, exp.scrapeIntervalFromRepQuery)
+		query = fmt.Sprintf(`max(count_over_time(%s{%s}[%v])) by (job)`, exp.repMetric, labelSelector, rc.interval)
+		_, err = rc.CollectAndProcessMetric(query, et, rc.scrapeIntervalFromRepQuery(exp))
 	}
-	query = fmt.Sprintf(`max(sum_over_time(up{}[%v])) by (job)`, Interval)
-	if _, e := CollectAndProcessMetric(query, et, scrapeIntervalFromUp); err == nil && e != nil {
+	query = fmt.Sprintf(`max(sum_over_time(up{}[%v])) by (job)`, rc.interval)
+	if _, e := rc.CollectAndProcessMetric(query, et, rc.scrapeIntervalFromUp); err == nil && e != nil {
 		err = e
 	}
-	for cluster, m := range clusterExporters {
+	for cluster, m := range rc.clusterExporters {
 		for _, ce := range m {
-			LogCluster(1, Debug, ClusterFormat+" Prometheus exporter: %+v", cluster, true, cluster, ce)
+			rc.LogCluster(1, Debug, ClusterFormat+" Prometheus exporter: %+v", cluster, true, cluster, ce)
 		}
 	}
 	return
@@ -377,30 +409,30 @@ const (
 	allMetricsFmt        = `group by (%s) (%s)`
 )
 
-func LogAllMetrics() (err error) {
-	et := TimeRangeEndTimeOnly()
+func (rc *RunContext) LogAllMetrics() (err error) {
+	et := rc.TimeRangeEndTimeOnly()
 	var query string
 	for _, exp := range exporters {
-		if exp.logAllMetrics || Params.Debug {
+		if exp.logAllMetrics || rc.debugEnabled() {
 			query = fmt.Sprintf(allMetricsQueryFmt, prometheusMetricName, exp.metricsPrefix, Always.String())
-			query = aggOverTimeQuery(query, Last, Interval, UnknownValue)
+			query = aggOverTimeQuery(query, Last, rc.interval, UnknownValue)
 			query = LabelReplace(query, metricName, prometheusMetricName, HasValue)
 			query = fmt.Sprintf(allMetricsFmt, metricName, query)
-			_, err = CollectAndProcessMetric(query, et, exp.logAllClusterMetrics)
+			_, err = rc.CollectAndProcessMetric(query, et, rc.logAllClusterMetrics(exp))
 		}
 	}
 	return
 }
 
 const (
-	cadvisor         = "cadvisor"
-	nodeExporter     = "node-exporter"
-	ksm              = "kube-state-metrics"
-	ossm             = "openshift-state-metrics"
-	Dcgm             = "dcgm-exporter"
-	ephemeralStorage = "k8s-ephemeral-storage-metrics"
-	KubexGpu         = "kubex-gpu-process-exporter"
-	Beyla            = "beyla"
+	Cadvisor                 = "cadvisor"
+	NodeExporter             = "node-exporter"
+	Ksm                      = "kube-state-metrics"
+	Ossm                     = "openshift-state-metrics"
+	Dcgm                     = "dcgm-exporter"
+	EphemeralStorageExporter = "k8s-ephemeral-storage-metrics"
+	KubexGpu                 = "kubex-gpu-process-exporter"
+	Beyla                    = "beyla"
 )
 
 type exporter struct {
@@ -422,54 +454,58 @@ func (e *exporter) getPrefix() string {
 	return e.metricsPrefix + Underscore
 }
 
-func (e *exporter) logAllClusterMetrics(cluster string, result model.Matrix) {
-	s := make([]string, 0, result.Len())
-	for _, ss := range result {
-		if mn, f := GetLabelValue(ss, metricName); f {
-			s = append(s, mn)
+func (rc *RunContext) logAllClusterMetrics(e *exporter) ClusterMatrixFunc {
+	return func(cluster string, result model.Matrix) {
+		s := make([]string, 0, result.Len())
+		for _, ss := range result {
+			if mn, f := GetLabelValue(ss, metricName); f {
+				s = append(s, mn)
+			}
 		}
+		sort.Strings(s)
+		var level LogLevel
+		if e.logAllMetrics {
+			level = Info
+		}
+		rc.LogCluster(1, level, ClusterFormat+" exporter=%s detected metrics=%v", cluster, true, cluster, e.name, s)
 	}
-	sort.Strings(s)
-	var level LogLevel
-	if e.logAllMetrics {
-		level = Info
-	}
-	LogCluster(1, level, ClusterFormat+" exporter=%s detected metrics=%v", cluster, true, cluster, e.name, s)
 }
 
-func (e *exporter) scrapeIntervalFromRepQuery(cluster string, result model.Matrix) {
-	l := len(exporters)
-	if len(clusterExporters[cluster]) == 0 {
-		clusterExporters[cluster] = make(map[string]*clusterExporter, l)
-	}
-	if len(clusterExportersByJob[cluster]) == 0 {
-		clusterExportersByJob[cluster] = make(map[string][]*clusterExporter, l)
-	}
-	for _, ss := range result {
-		if jobName := GetValue(ss, Job); jobName != Empty {
-			ce := &clusterExporter{exporter: *e, promJob: jobName}
-			setScrapeInterval(&ce.ActualScrapeInterval, ss)
-			clusterExporters[cluster][e.metricsPrefix] = ce
-			clusterExportersByJob[cluster][jobName] = append(clusterExportersByJob[cluster][jobName], ce)
+func (rc *RunContext) scrapeIntervalFromRepQuery(e *exporter) ClusterMatrixFunc {
+	return func(cluster string, result model.Matrix) {
+		l := len(exporters)
+		if len(rc.clusterExporters[cluster]) == 0 {
+			rc.clusterExporters[cluster] = make(map[string]*clusterExporter, l)
+		}
+		if len(rc.clusterExportersByJob[cluster]) == 0 {
+			rc.clusterExportersByJob[cluster] = make(map[string][]*clusterExporter, l)
+		}
+		for _, ss := range result {
+			if jobName := GetValue(ss, Job); jobName != Empty {
+				ce := &clusterExporter{exporter: *e, promJob: jobName}
+				rc.setScrapeInterval(&ce.ActualScrapeInterval, ss)
+				rc.clusterExporters[cluster][e.metricsPrefix] = ce
+				rc.clusterExportersByJob[cluster][jobName] = append(rc.clusterExportersByJob[cluster][jobName], ce)
+			}
 		}
 	}
 }
 
-func scrapeIntervalFromUp(cluster string, result model.Matrix) {
+func (rc *RunContext) scrapeIntervalFromUp(cluster string, result model.Matrix) {
 	for _, ss := range result {
 		if jobName := GetValue(ss, Job); jobName != Empty {
-			for _, ce := range clusterExportersByJob[cluster][jobName] {
+			for _, ce := range rc.clusterExportersByJob[cluster][jobName] {
 				if ce != nil {
-					setScrapeInterval(&ce.UpScrapeInterval, ss)
+					rc.setScrapeInterval(&ce.UpScrapeInterval, ss)
 				}
 			}
 		}
 	}
 }
 
-func setScrapeInterval(target *time.Duration, ss *model.SampleStream) {
+func (rc *RunContext) setScrapeInterval(target *time.Duration, ss *model.SampleStream) {
 	if len(ss.Values) > 0 {
-		*target = (Interval / time.Duration(ss.Values[0].Value)).Round(time.Second)
+		*target = (rc.interval / time.Duration(ss.Values[0].Value)).Round(time.Second)
 	}
 }
 
@@ -477,12 +513,12 @@ var exporters = makeExporters()
 
 func makeExporters() map[string]*exporter {
 	exps := make(map[string]*exporter, 7)
-	addExporter(exps, cadvisor, "container_cpu_usage_seconds_total", []string{Container}, false)
-	addExporter(exps, nodeExporter, "node_cpu_seconds_total", nil, false)
-	addExporter(exps, ksm, "kube_pod_info", nil, false)
-	addExporter(exps, ossm, "openshift_clusterresourcequota_usage", nil, false)
+	addExporter(exps, Cadvisor, "container_cpu_usage_seconds_total", []string{Container}, false)
+	addExporter(exps, NodeExporter, "node_cpu_seconds_total", nil, false)
+	addExporter(exps, Ksm, "kube_pod_info", nil, false)
+	addExporter(exps, Ossm, "openshift_clusterresourcequota_usage", nil, false)
 	addExporter(exps, Dcgm, "DCGM_FI_DEV_GPU_UTIL", nil, true)
-	addExporter(exps, ephemeralStorage, "ephemeral_storage_node_available", nil, true)
+	addExporter(exps, EphemeralStorageExporter, "ephemeral_storage_node_available", nil, true)
 	addExporter(exps, KubexGpu, "kubex_gpu_container_requests", nil, true)
 	addExporter(exps, Beyla, SurveyInfo, nil, true)
 	return exps
@@ -492,8 +528,34 @@ func addExporter(exps map[string]*exporter, name, repMetric string, repLabels []
 	exps[name] = &exporter{name: name, metricsPrefix: getExporterPrefix(repMetric), repMetric: repMetric, repLabels: repLabels, logAllMetrics: logAllMetrics}
 }
 
-var clusterExporters = make(map[string]map[string]*clusterExporter)
-var clusterExportersByJob = make(map[string]map[string][]*clusterExporter)
+var requiredExporters = map[string]bool{Cadvisor: true, Ksm: true}
+
+// ExporterInfo describes an exporter as detected (or not) for a cluster
+type ExporterInfo struct {
+	Name           string        `json:"name"`
+	Required       bool          `json:"required"`
+	Detected       bool          `json:"detected"`
+	Job            string        `json:"job,omitempty"`
+	ScrapeInterval time.Duration `json:"scrapeInterval,omitempty"`
+}
+
+// GetClusterExporters returns all known exporters, sorted by name, with their detection status for the cluster;
+// valid only after CalculateScrapeIntervals
+func (rc *RunContext) GetClusterExporters(cluster string) []*ExporterInfo {
+	names := SortedKeySet(exporters)
+	eis := make([]*ExporterInfo, len(names))
+	for i, name := range names {
+		e := exporters[name]
+		ei := &ExporterInfo{Name: name, Required: requiredExporters[name]}
+		if ce, f := rc.clusterExporters[cluster][e.metricsPrefix]; f && ce != nil {
+			ei.Detected = true
+			ei.Job = ce.promJob
+			ei.ScrapeInterval = rc.getScrapeInterval(cluster, e.repMetric)
+		}
+		eis[i] = ei
+	}
+	return eis
+}
 
 type intervalFunction string
 
@@ -524,14 +586,14 @@ func scrapeIntervalMultiplication(scrapeInterval time.Duration, dur string) (d t
 	return
 }
 
-func adjustIntervalToScrapeInterval(cluster string, query string) (q string, si time.Duration) {
+func (rc *RunContext) adjustIntervalToScrapeInterval(cluster string, query string) (q string, si time.Duration) {
 	q = query
 	if cluster == Empty {
 		return
 	}
 	for _, ifn := range intervalFunctions {
 		var scrapeInterval time.Duration
-		q, scrapeInterval = adjustIntervalsForFunction(cluster, q, ifn)
+		q, scrapeInterval = rc.adjustIntervalsForFunction(cluster, q, ifn)
 		if scrapeInterval > 0 && (si == 0 || scrapeInterval < si) {
 			si = scrapeInterval
 		}
@@ -539,7 +601,7 @@ func adjustIntervalToScrapeInterval(cluster string, query string) (q string, si
 	return
 }
 
-func adjustIntervalsForFunction(cluster string, query string, ifn intervalFunction) (q string, si time.Duration) {
+func (rc *RunContext) adjustIntervalsForFunction(cluster string, query string, ifn intervalFunction) (q string, si time.Duration) {
 	var b strings.Builder
 	for i := 0; i < len(query); {
 		bodyStart, bodyEnd, ok := intervalFunctionCall(query, i, ifn)
@@ -556,7 +618,7 @@ func adjustIntervalsForFunction(cluster string, query string, ifn intervalFuncti
 			if mName == Empty {
 				mName = metricNameBeforeRange(body, j)
 			}
-			scrapeInterval := getScrapeInterval(cluster, mName)
+			scrapeInterval := rc.getScrapeInterval(cluster, mName)
 			if interval, changed := adjustedInterval(ifn, scrapeInterval, body[j+1:k]); changed {
 				b.WriteString(body[:j+1])
 				b.WriteString(interval)
@@ -749,8 +811,8 @@ func isPromFunctionNameChar(c byte) bool {
 	return c == '_' || c == ':' || c >= '0' && c <= '9' || c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z'
 }
 
-func getScrapeInterval(cluster string, metricName string) (si time.Duration) {
-	if e, f := clusterExporters[cluster][getExporterPrefix(metricName)]; f && e != nil {
+func (rc *RunContext) getScrapeInterval(cluster string, metricName string) (si time.Duration) {
+	if e, f := rc.clusterExporters[cluster][getExporterPrefix(metricName)]; f && e != nil {
 		if e.ActualScrapeInterval > 0 {
 			si = e.ActualScrapeInterval
 		} else {
@@ -766,18 +828,22 @@ func getExporterPrefix(metricName string) string {
 
 type ClusterQueryExclusion func(cluster string, query string) bool
 
-func RegisterClusterQueryExclusion(name string, ce ClusterQueryExclusion) {
-	clusterQueryExclusions[name] = ce
+func (rc *RunContext) RegisterClusterQueryExclusion(name string, ce ClusterQueryExclusion) {
+	rc.clusterQueryExclusionsMu.Lock()
+	defer rc.clusterQueryExclusionsMu.Unlock()
+	rc.clusterQueryExclusions[name] = ce
 }
 
-func UnregisterClusterQueryExclusion(name string) {
-	delete(clusterQueryExclusions, name)
+func (rc *RunContext) UnregisterClusterQueryExclusion(name string) {
+	rc.clusterQueryExclusionsMu.Lock()
+	defer rc.clusterQueryExclusionsMu.Unlock()
+	delete(rc.clusterQueryExclusions, name)
 }
 
-var clusterQueryExclusions = make(map[string]ClusterQueryExclusion)
-
-func excludeQueryForCluster(cluster string, query string) bool {
-	for _, ce := range clusterQueryExclusions {
+func (rc *RunContext) excludeQueryForCluster(cluster string, query string) bool {
+	rc.clusterQueryExclusionsMu.RLock()
+	defer rc.clusterQueryExclusionsMu.RUnlock()
+	for _, ce := range rc.clusterQueryExclusions {
 		if ce(cluster, query) {
 			return true
 		}
@@ -788,26 +854,27 @@ func excludeQueryForCluster(cluster string, query string) bool {
 type ResolveMetricFunc func(cluster string, metricName string)
 type ResolveMetricMap map[string]ResolveMetricFunc
 
-var presentMetrics = make(map[string]map[string]bool)
-
-func ResolveMetrics(m ResolveMetricMap) (err error) {
-	et := TimeRangeEndTimeOnly()
+func (rc *RunContext) ResolveMetrics(m ResolveMetricMap) (err error) {
+	et := rc.TimeRangeEndTimeOnly()
 	for mName, f := range m {
-		mr := &metricResolver{metricName: mName, f: f}
-		query := aggOverTimeQuery(mName+Braces, Present, Interval, UnknownValue)
+		mr := &metricResolver{rc: rc, metricName: mName, f: f}
+		query := aggOverTimeQuery(mName+Braces, Present, rc.interval, UnknownValue)
 		query = fmt.Sprintf(`max(%s)`, query)
-		if _, err = CollectAndProcessMetric(query, et, mr.resolve); err != nil {
+		if _, err = rc.CollectAndProcessMetric(query, et, mr.resolve); err != nil {
 			break
 		}
 	}
 	return
 }
 
-func IsMetricPresent(cluster, metricName string) bool {
-	return presentMetrics[cluster][metricName]
+func (rc *RunContext) IsMetricPresent(cluster, metricName string) bool {
+	rc.presentMetricsMu.RLock()
+	defer rc.presentMetricsMu.RUnlock()
+	return rc.presentMetrics[cluster][metricName]
 }
 
 type metricResolver struct {
+	rc         *RunContext
 	metricName string
 	f          ResolveMetricFunc
 }
@@ -815,12 +882,17 @@ type metricResolver struct {
 func (mr *metricResolver) resolve(cluster string, result model.Matrix) {
 	var clusterPresentMetrics map[string]bool
 	var f bool
-	if clusterPresentMetrics, f = presentMetrics[cluster]; !f {
+	mr.rc.presentMetricsMu.Lock()
+	if clusterPresentMetrics, f = mr.rc.presentMetrics[cluster]; !f {
 		clusterPresentMetrics = make(map[string]bool)
-		presentMetrics[cluster] = clusterPresentMetrics
+		mr.rc.presentMetrics[cluster] = clusterPresentMetrics
 	}
-	if result.Len() > 0 {
+	present := result.Len() > 0
+	if present {
 		clusterPresentMetrics[mr.metricName] = true
+	}
+	mr.rc.presentMetricsMu.Unlock()
+	if present {
 		if mr.f != nil {
 			mr.f(cluster, mr.metricName)
 		}
@@ -7,13 +7,13 @@ import (
 
 func TestAdjustIntervalToScrapeIntervalNestedOverTime(t *testing.T) {
 	cluster := "test-cluster"
-	clusterExporters[cluster] = map[string]*clusterExporter{
+	rc := newTestRunContext(t, nil)
+	rc.clusterExporters[cluster] = map[string]*clusterExporter{
 		"container": {ActualScrapeInterval: 30 * time.Second},
 	}
-	t.Cleanup(func() { delete(clusterExporters, cluster) })
 
 	query := `max_over_time(irate(container_cpu_usage_seconds_total[1m])[5m:*1])`
-	got, si := adjustIntervalToScrapeInterval(cluster, query)
+	got, si := rc.adjustIntervalToScrapeInterval(cluster, query)
 	want := `max_over_time(irate(container_cpu_usage_seconds_total[1m])[5m:30s])`
 
 	if got != want {
@@ -26,13 +26,13 @@ func TestAdjustIntervalToScrapeIntervalNestedOverTime(t *testing.T) {
 
 func TestAdjustIntervalToScrapeIntervalNestedOverTimeWithIrateMultiplier(t *testing.T) {
 	cluster := "test-cluster"
-	clusterExporters[cluster] = map[string]*clusterExporter{
+	rc := newTestRunContext(t, nil)
+	rc.clusterExporters[cluster] = map[string]*clusterExporter{
 		"container": {ActualScrapeInterval: 30 * time.Second},
 	}
-	t.Cleanup(func() { delete(clusterExporters, cluster) })
 
 	query := `max_over_time(irate(container_cpu_usage_seconds_total{name!~"k8s_POD_.*"}[*3])[5m:*1])`
-	got, si := adjustIntervalToScrapeInterval(cluster, query)
+	got, si := rc.adjustIntervalToScrapeInterval(cluster, query)
 	want := `max_over_time(irate(container_cpu_usage_seconds_total{name!~"k8s_POD_.*"}[1m30s])[5m:30s])`
 
 	if got != want {
@@ -45,13 +45,13 @@ func TestAdjustIntervalToScrapeIntervalNestedOverTimeWithIrateMultiplier(t *test
 
 func TestAdjustIntervalToScrapeIntervalMultipliesIrateRange(t *testing.T) {
 	cluster := "test-cluster"
-	clusterExporters[cluster] = map[string]*clusterExporter{
+	rc := newTestRunContext(t, nil)
+	rc.clusterExporters[cluster] = map[string]*clusterExporter{
 		"container": {ActualScrapeInterval: 30 * time.Second},
 	}
-	t.Cleanup(func() { delete(clusterExporters, cluster) })
 
 	query := `irate(container_cpu_usage_seconds_total[*3])`
-	got, si := adjustIntervalToScrapeInterval(cluster, query)
+	got, si := rc.adjustIntervalToScrapeInterval(cluster, query)
 	want := `irate(container_cpu_usage_seconds_total[1m30s])`
 
 	if got != want {
@@ -64,13 +64,13 @@ func TestAdjustIntervalToScrapeIntervalMultipliesIrateRange(t *testing.T) {
 
 func TestAdjustIntervalToScrapeIntervalLeavesSimpleOverTimeRange(t *testing.T) {
 	cluster := "test-cluster"
-	clusterExporters[cluster] = map[string]*clusterExporter{
+	rc := newTestRunContext(t, nil)
+	rc.clusterExporters[cluster] = map[string]*clusterExporter{
 		"container": {ActualScrapeInterval: 30 * time.Second},
 	}
-	t.Cleanup(func() { delete(clusterExporters, cluster) })
 
 	query := `max_over_time(container_cpu_usage_seconds_total[5m])`
-	got, si := adjustIntervalToScrapeInterval(cluster, query)
+	got, si := rc.adjustIntervalToScrapeInterval(cluster, query)
 
 	if got != query {
 		t.Fatalf("adjustIntervalToScrapeInterval() query = %q, want %q", got, query)
@@ -82,13 +82,13 @@ func TestAdjustIntervalToScrapeIntervalLeavesSimpleOverTimeRange(t *testing.T) {
 
 func TestAdjustIntervalToScrapeIntervalNoIntervals(t *testing.T) {
 	cluster := "test-cluster"
-	clusterExporters[cluster] = map[string]*clusterExporter{
+	rc := newTestRunContext(t, nil)
+	rc.clusterExporters[cluster] = map[string]*clusterExporter{
 		"container": {ActualScrapeInterval: 30 * time.Second},
 	}
-	t.Cleanup(func() { delete(clusterExporters, cluster) })
 
 	query := `sum(container_cpu_usage_seconds_total)`
-	got, si := adjustIntervalToScrapeInterval(cluster, query)
+	got, si := rc.adjustIntervalToScrapeInterval(cluster, query)
 
 	if got != query {
 		t.Fatalf("adjustIntervalToScrapeInterval() query = %q, want %q", got, query)
@@ -100,13 +100,13 @@ func TestAdjustIntervalToScrapeIntervalNoIntervals(t *testing.T) {
 
 func TestAdjustIntervalToScrapeIntervalIgnoresUnknownRangeFunction(t *testing.T) {
 	cluster := "test-cluster"
-	clusterExporters[cluster] = map[string]*clusterExporter{
+	rc := newTestRunContext(t, nil)
+	rc.clusterExporters[cluster] = map[string]*clusterExporter{
 		"container": {ActualScrapeInterval: 30 * time.Second},
 	}
-	t.Cleanup(func() { delete(clusterExporters, cluster) })
 
 	query := `fake(container_cpu_usage_seconds_total[*3])`
-	got, si := adjustIntervalToScrapeInterval(cluster, query)
+	got, si := rc.adjustIntervalToScrapeInterval(cluster, query)
 
 	if got != query {
 		t.Fatalf("adjustIntervalToScrapeInterval() query = %q, want %q", got, query)
@@ -118,13 +118,13 @@ func TestAdjustIntervalToScrapeIntervalIgnoresUnknownRangeFunction(t *testing.T)
 
 func TestAdjustIntervalToScrapeIntervalOverTimeResolution(t *testing.T) {
 	cluster := "test-cluster"
-	clusterExporters[cluster] = map[string]*clusterExporter{
+	rc := newTestRunContext(t, nil)
+	rc.clusterExporters[cluster] = map[string]*clusterExporter{
 		"container": {ActualScrapeInterval: 30 * time.Second},
 	}
-	t.Cleanup(func() { delete(clusterExporters, cluster) })
 
 	query := `max_over_time(container_cpu_usage_seconds_total[5m:*2])`
-	got, si := adjustIntervalToScrapeInterval(cluster, query)
+	got, si := rc.adjustIntervalToScrapeInterval(cluster, query)
 	want := `max_over_time(container_cpu_usage_seconds_total[5m:1m0s])`
 
 	if got != want {
@@ -0,0 +1,290 @@
+package common
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+)
+
+const (
+	// PseudonymKeyEnv is the environment variable holding the key of the pseudonyms
+	PseudonymKeyEnv = "PSEUDONYM_KEY"
+	// PseudonymMappingKeyEnv is the environment variable holding the key the reverse mapping is encrypted with
+	PseudonymMappingKeyEnv = "PSEUDONYM_MAPPING_KEY"
+	// DefaultPseudonymMapping is the reverse mapping file, kept out of data/ so that it is neither bundled
+	// nor uploaded
+	DefaultPseudonymMapping = "pseudonyms.enc"
+)
+
+// the kinds of the identifiers pseudonymized, the prefixes of their pseudonyms
+const (
+	clusterId   = "cl"
+	namespaceId = "ns"
+	ownerId     = "ow"
+	containerId = "co"
+	nodeId      = "no"
+	nodeGroupId = "ng"
+	hpaId       = "hpa"
+	rqId        = "rq"
+	crqId       = "crq"
+)
+
+// pseudonymColumns are the identifier columns of the outputs of all entity kinds, the columns listing
+// several identifiers (separated by pipes) included
+var pseudonymColumns = map[string]string{
+	CamelCase(ClusterEntityKind, Name):   clusterId,
+	"VirtualDomain":                      clusterId,
+	CamelCase(Namespace):                 namespaceId,
+	"Namespaces":                         namespaceId,
+	CamelCase(Entity, Name):              ownerId,
+	"CreatedByName":                      ownerId,
+	CamelCase(ContainerEntityKind, Name): containerId,
+	CamelCase(NodeEntityKind, Name):      nodeId,
+	"CurrentNodes":                       nodeId,
+	CamelCase(NodeGroupEntityKind, Name): nodeGroupId,
+	CamelCase(Hpa, Name):                 hpaId,
+	CamelCase(RqEntityKind, Name):        rqId,
+	CamelCase(CrqEntityKind, Name):       crqId,
+}
+
+// pseudonymEntityKindColumns are the identifier columns of the outputs of an entity kind only
+var pseudonymEntityKindColumns = map[string]map[string]string{
+	ClusterEntityKind:   {CamelCase(Name): clusterId},
+	ContainerEntityKind: {"VirtualDatacenter": namespaceId, "VirtualCluster": ownerId},
+	RqEntityKind:        {"VirtualDatacenter": namespaceId},
+}
+
+// pseudonymLabels are the labels holding identifiers
+var pseudonymLabels = map[string]string{
+	"cluster":                 clusterId,
+	"namespace":               namespaceId,
+	"pod":                     ownerId,
+	"owner_name":              ownerId,
+	"created_by_name":         ownerId,
+	"container":               containerId,
+	"node":                    nodeId,
+	"horizontalpodautoscaler": hpaId,
+	"resourcequota":           rqId,
+}
+
+type pseudonymizer struct {
+	key, mappingKey []byte
+	mappingFile     string
+	mu              sync.Mutex
+	// mapping maps the pseudonyms of each identifier kind to the identifiers
+	mapping map[string]map[string]string
+}
+
+// SetPseudonymization enables the replacement of the entity identifiers by keyed pseudonyms in all outputs;
+// the reverse mapping is written, encrypted, to the mapping file. The keys are read from PSEUDONYM_KEY and
+// PSEUDONYM_MAPPING_KEY.
+func (cfg *RunConfig) SetPseudonymization(mappingFile string) error {
+	p := &pseudonymizer{mappingFile: mappingFile, mapping: make(map[string]map[string]string)}
+	p.key = []byte(os.Getenv(PseudonymKeyEnv))
+	p.mappingKey = []byte(os.Getenv(PseudonymMappingKeyEnv))
+	for env, key := range map[string][]byte{PseudonymKeyEnv: p.key, PseudonymMappingKeyEnv: p.mappingKey} {
+		if len(key) == 0 {
+			return fmt.Errorf("pseudonymization requires %s", env)
+		}
+	}
+	if mappingFile == Empty {
+		return fmt.Errorf("pseudonymization requires a mapping file")
+	}
+	cfg.pseudonyms = p
+	return nil
+}
+
+// pseudonym returns the pseudonym of an identifier: the prefix of its kind and the first 8 bytes of its
+// HMAC-SHA256, hex-encoded; the same identifier has the same pseudonym in every output and run
+func (p *pseudonymizer) pseudonym(kind, id string) string {
+	if id == Empty {
+		return id
+	}
+	h := hmac.New(sha256.New, p.key)
+	h.Write([]byte(kind))
+	h.Write([]byte{0})
+	h.Write([]byte(id))
+	ps := kind + "-" + hex.EncodeToString(h.Sum(nil)[:8])
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	m, f := p.mapping[kind]
+	if !f {
+		m = make(map[string]string)
+		p.mapping[kind] = m
+	}
+	m[ps] = id
+	return ps
+}
+
+// pseudonyms returns the pseudonyms of the identifiers separated by sep
+func (p *pseudonymizer) pseudonyms(kind, ids, sep string) string {
+	s := strings.Split(ids, sep)
+	for i, id := range s {
+		s[i] = p.pseudonym(kind, id)
+	}
+	return strings.Join(s, sep)
+}
+
+func (p *pseudonymizer) column(entityKind, column string) (kind string, f bool) {
+	if kind, f = pseudonymEntityKindColumns[entityKind][column]; !f {
+		kind, f = pseudonymColumns[column]
+	}
+	return
+}
+
+// clusterFolder returns the folder of the outputs of a cluster, named after its pseudonym if pseudonymized;
+// it is also the cluster name in the manifests and summaries
+func (cfg *RunConfig) clusterFolder(cluster string) string {
+	if cfg.pseudonyms == nil || cluster == Empty {
+		return cluster
+	}
+	return cfg.pseudonyms.pseudonym(clusterId, cluster)
+}
+
+func (rc *RunContext) clusterFolder(cluster string) string {
+	return rc.config.clusterFolder(cluster)
+}
+
+// isLocalOnly returns whether an output is kept out of the bundles and uploads: the log files, whose messages
+// name the entities, if pseudonymized
+func (cfg *RunConfig) isLocalOnly(path string) bool {
+	return cfg.pseudonyms != nil && isLogFile(path)
+}
+
+// pseudonymSink replaces the identifiers of the records by their pseudonyms
+type pseudonymSink struct {
+	Sink
+	spec       *OutputSpec
+	pseudonyms *pseudonymizer
+}
+
+func (ps *pseudonymSink) WriteRecord(values ...any) error {
+	values = slices.Clone(values)
+	for i, value := range values {
+		switch v := value.(type) {
+		case string:
+			if i < len(ps.spec.Columns) {
+				if kind, f := ps.pseudonyms.column(ps.spec.EntityKind, ps.spec.Columns[i]); f {
+					values[i] = ps.pseudonyms.pseudonyms(kind, v, Or)
+				}
+			}
+		case LabelMap:
+			values[i] = ps.pseudonyms.labels(v)
+		}
+	}
+	return ps.Sink.WriteRecord(values...)
+}
+
+func (ps *pseudonymSink) WriteSample(s *Sample) error {
+	ss := *s
+	ss.Entity = slices.Clone(s.Entity)
+	for i, field := range ss.Entity {
+		if kind, f := ps.pseudonyms.column(ps.spec.EntityKind, ps.spec.Columns[i]); f {
+			ss.Entity[i] = ps.pseudonyms.pseudonym(kind, field)
+		}
+	}
+	return ps.Sink.WriteSample(&ss)
+}
+
+// labels returns the labels with the values of the identifier labels replaced by their pseudonyms
+func (p *pseudonymizer) labels(lm LabelMap) LabelMap {
+	if lm.Map == nil {
+		return lm
+	}
+	m := make(LabelValues, len(lm.Map))
+	for key, values := range lm.Map {
+		if kind, f := pseudonymLabels[key]; f {
+			pvs := make([]string, len(values))
+			for i, v := range values {
+				pvs[i] = p.pseudonym(kind, v)
+			}
+			values = pvs
+		}
+		m[key] = values
+	}
+	return LabelMap{Map: m, Reject: lm.Reject}
+}
+
+// WritePseudonymMapping writes the reverse mapping of the pseudonyms of the run, merged with the one of the
+// earlier runs if any, encrypted with AES-256-GCM (the key being the SHA-256 of PSEUDONYM_MAPPING_KEY)
+func (rc *RunContext) WritePseudonymMapping() error {
+	p := rc.config.pseudonyms
+	if p == nil {
+		return nil
+	}
+	mapping, err := ReadPseudonymMapping(p.mappingFile)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	if mapping == nil {
+		mapping = make(map[string]map[string]string)
+	}
+	p.mu.Lock()
+	for kind, m := range p.mapping {
+		if mapping[kind] == nil {
+			mapping[kind] = make(map[string]string, len(m))
+		}
+		for ps, id := range m {
+			mapping[kind][ps] = id
+		}
+	}
+	p.mu.Unlock()
+	var b []byte
+	if b, err = json.Marshal(mapping); err != nil {
+		return err
+	}
+	var gcm cipher.AEAD
+	if gcm, err = newMappingCipher(p.mappingKey); err != nil {
+		return err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err = rand.Read(nonce); err != nil {
+		return err
+	}
+	return writeFileAtomic(p.mappingFile, gcm.Seal(nonce, nonce, b, nil))
+}
+
+// ReadPseudonymMapping decrypts a reverse mapping file, with the key in PSEUDONYM_MAPPING_KEY: the
+// identifiers by pseudonym, per identifier kind
+func ReadPseudonymMapping(fileName string) (map[string]map[string]string, error) {
+	b, err := os.ReadFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+	key := []byte(os.Getenv(PseudonymMappingKeyEnv))
+	if len(key) == 0 {
+		return nil, fmt.Errorf("decrypting %s requires %s", fileName, PseudonymMappingKeyEnv)
+	}
+	var gcm cipher.AEAD
+	if gcm, err = newMappingCipher(key); err != nil {
+		return nil, err
+	}
+	if len(b) < gcm.NonceSize() {
+		return nil, fmt.Errorf("%s: not a mapping file", fileName)
+	}
+	if b, err = gcm.Open(nil, b[:gcm.NonceSize()], b[gcm.NonceSize():], nil); err != nil {
+		return nil, fmt.Errorf("%s: %v (wrong key?)", fileName, err)
+	}
+	var mapping map[string]map[string]string
+	err = json.Unmarshal(b, &mapping)
+	return mapping, err
+}
+
+func newMappingCipher(key []byte) (cipher.AEAD, error) {
+	sum := sha256.Sum256(key)
+	block, err := aes.NewCipher(sum[:])
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,86 @@
+package common
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func setTestPseudonymization(t *testing.T, cfg *RunConfig) string {
+	t.Helper()
+	t.Setenv(PseudonymKeyEnv, "secret")
+	t.Setenv(PseudonymMappingKeyEnv, "mapping secret")
+	mappingFile := filepath.Join(t.TempDir(), DefaultPseudonymMapping)
+	if err := cfg.SetPseudonymization(mappingFile); err != nil {
+		t.Fatal(err)
+	}
+	return mappingFile
+}
+
+func TestPseudonymSink(t *testing.T) {
+	cfg := NewRunConfig()
+	mappingFile := setTestPseudonymization(t, cfg)
+	rc := newTestOutputRunContext(t, cfg)
+	folder := rc.clusterFolder("c1")
+	if !strings.HasPrefix(folder, clusterId+"-") || folder != rc.clusterFolder("c1") {
+		t.Fatalf("clusterFolder() = %q, want a stable cluster pseudonym", folder)
+	}
+	if err := os.MkdirAll(filepath.Join(rc.rootFolder, folder, NodeEntityKind), dirPerm); err != nil {
+		t.Fatal(err)
+	}
+	sink, err := rc.NewSink(&OutputSpec{Cluster: "c1", EntityKind: NodeEntityKind, Name: Attributes.String(), Columns: []string{"NodeName", "Namespaces", "Cpu", "Labels"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dir := filepath.Base(filepath.Dir(filepath.Dir(sink.Name()))); dir != folder {
+		t.Errorf("cluster folder = %s, want %s", dir, folder)
+	}
+	if err = sink.WriteRecord("n1", "a|b", 4, LabelMap{Map: LabelValues{"namespace": {"a"}, "label_app": {"web"}}}); err != nil {
+		t.Fatal(err)
+	}
+	ns := cfg.pseudonyms.pseudonym(namespaceId, "a")
+	fields := strings.Split(strings.Split(readSink(t, sink), lf)[1], Comma)
+	if want := cfg.pseudonyms.pseudonym(nodeId, "n1"); fields[0] != want {
+		t.Errorf("NodeName = %s, want %s", fields[0], want)
+	}
+	if want := ns + Or + cfg.pseudonyms.pseudonym(namespaceId, "b"); fields[1] != want {
+		t.Errorf("Namespaces = %s, want %s", fields[1], want)
+	}
+	if !strings.Contains(fields[3], "namespace : "+ns) || !strings.Contains(fields[3], "label_app : web") {
+		t.Errorf("Labels = %s, want the namespace label pseudonymized only", fields[3])
+	}
+	if err = rc.WritePseudonymMapping(); err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.ReadFile(mappingFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(b), "n1") {
+		t.Error("mapping file not encrypted")
+	}
+	mapping, err := ReadPseudonymMapping(mappingFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mapping[nodeId][cfg.pseudonyms.pseudonym(nodeId, "n1")] != "n1" || mapping[namespaceId][ns] != "a" || mapping[clusterId][folder] != "c1" {
+		t.Errorf("mapping = %v", mapping)
+	}
+	t.Setenv(PseudonymMappingKeyEnv, "wrong")
+	if _, err = ReadPseudonymMapping(mappingFile); err == nil {
+		t.Error("ReadPseudonymMapping() with a wrong key: expected an error")
+	}
+}
+
+func TestSetPseudonymization(t *testing.T) {
+	t.Setenv(PseudonymKeyEnv, "secret")
+	t.Setenv(PseudonymMappingKeyEnv, Empty)
+	cfg := NewRunConfig()
+	if err := cfg.SetPseudonymization(DefaultPseudonymMapping); err == nil || !strings.Contains(err.Error(), PseudonymMappingKeyEnv) {
+		t.Errorf("SetPseudonymization() error = %v, want a missing key error", err)
+	}
+	if cfg.isLocalOnly(filepath.Join("c1", logFileName)) {
+		t.Error("log file local only while not pseudonymized")
+	}
+}
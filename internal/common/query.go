@@ -27,8 +27,6 @@ const (
 	labeled
 )
 
-var cles = make(map[queryType]map[int]clusterLabelsEmbedder)
-
 func createRange(n int) (r []int) {
 	r = make([]int, n)
 	for i := range r {
@@ -50,26 +48,16 @@ func getClusterLabelsEmbedder(query string) (cle clusterLabelsEmbedder) {
 	return getLabelsEmbedder(qt, n)
 }
 
-func getLabelsEmbedder(qt queryType, n int) clusterLabelsEmbedder {
-	var m map[int]clusterLabelsEmbedder
-	var f bool
-	if m, f = cles[qt]; !f {
-		m = make(map[int]clusterLabelsEmbedder)
-		cles[qt] = m
-	}
-	var cle clusterLabelsEmbedder
-	if cle, f = m[n]; !f {
-		switch qt {
-		case plain:
-			cle = &plainQuery{}
-		case aggregator:
-			cle = aggregatorQuery(createRange(n)...)
-		case labeled:
-			cle = queryWithLabels(createRange(n)...)
-		}
-		m[n] = cle
+func getLabelsEmbedder(qt queryType, n int) (cle clusterLabelsEmbedder) {
+	switch qt {
+	case plain:
+		cle = &plainQuery{}
+	case aggregator:
+		cle = aggregatorQuery(createRange(n)...)
+	case labeled:
+		cle = queryWithLabels(createRange(n)...)
 	}
-	return cle
+	return
 }
 
 type plainQuery struct {
@@ -190,8 +178,9 @@ func EphemeralExporterLabelReplace(query string) string {
 	return LabelReplace(query, Node, NodeName, Always)
 }
 
-func AggOverTimeQuery(q string, agg string) string {
-	return aggOverTimeQuery(q, agg, Step, UnknownValue)
+// AggOverTimeQuery aggregates a query over the step of the run
+func (rc *RunContext) AggOverTimeQuery(q string, agg string) string {
+	return aggOverTimeQuery(q, agg, rc.step, UnknownValue)
 }
 
 func aggOverTimeQuery(q string, agg string, interval time.Duration, scrapeMultiplier int) string {
@@ -211,14 +200,14 @@ type GpuQueryGenerator struct {
 	DcgmLabelReplace bool
 }
 
-func (dqg *GpuQueryGenerator) GpuAggOverTimeQuery(q string, agg string) (qry string) {
+func (dqg *GpuQueryGenerator) GpuAggOverTimeQuery(q string, agg string, step time.Duration) (qry string) {
 	var sm int
 	if dqg.UseSubquery {
 		sm = 1
 	} else {
 		sm = UnknownValue
 	}
-	qry = generateOrOrigin(aggOverTimeQuery(q, agg, Step, sm), dqg.F)
+	qry = generateOrOrigin(aggOverTimeQuery(q, agg, step, sm), dqg.F)
 	if dqg.DcgmLabelReplace {
 		qry = DcgmExporterLabelReplace(qry)
 	}
@@ -251,13 +240,12 @@ func DcgmPercentQuerySuffix(metric string, onWhat ...string) string {
 	return PercentQuerySuffix(metric, []string{Resource, NvidiaGpuResource}, onWhat...)
 }
 
-var clusterCommentQueryAdjusters map[string]QueryAdjuster
+var clusterCommentPrefix = strings.TrimSuffix(ClusterCommentFmt, "%s")
 
-func GetClusterCommentQueryAdapters() map[string]QueryAdjuster {
-	if clusterCommentQueryAdjusters == nil {
-		clusterCommentQueryAdjusters = make(map[string]QueryAdjuster, len(ClusterNames))
-	}
-	for _, cluster := range ClusterNames {
+// GetClusterCommentQueryAdapters returns, per cluster, the query adjuster adding the cluster comment to a query
+func (rc *RunContext) GetClusterCommentQueryAdapters() map[string]QueryAdjuster {
+	clusterCommentQueryAdjusters := make(map[string]QueryAdjuster, rc.NumClusters())
+	for _, cluster := range rc.clusterNames {
 		clusterCommentQueryAdjusters[cluster] = func(query string) string {
 			return query + fmt.Sprintf(ClusterCommentFmt, cluster)
 		}
@@ -265,8 +253,11 @@ func GetClusterCommentQueryAdapters() map[string]QueryAdjuster {
 	return clusterCommentQueryAdjusters
 }
 
+// ExcludeQueryByClusterComment excludes a query carrying a cluster comment from all other clusters;
+// queries without a cluster comment (e.g. of other stages running concurrently) are not affected
 func ExcludeQueryByClusterComment(cluster string, query string) bool {
-	return !strings.HasSuffix(query, fmt.Sprintf(ClusterCommentFmt, cluster))
+	_, comment := SplitQuery(query)
+	return strings.HasPrefix(comment, clusterCommentPrefix) && comment != fmt.Sprintf(ClusterCommentFmt, cluster)
 }
 
 // SplitQuery separates a query into a trimmed netQuery and a comment.
@@ -0,0 +1,44 @@
+package common
+
+import (
+	"context"
+	"fmt"
+	"testing"
+)
+
+func TestExcludeQueryByClusterComment(t *testing.T) {
+	for _, tc := range []struct {
+		query string
+		want  bool
+	}{
+		{query: "up" + fmt.Sprintf(ClusterCommentFmt, "c1"), want: false},
+		{query: "up" + fmt.Sprintf(ClusterCommentFmt, "c2"), want: true},
+		// since the stages run concurrently, the queries of the other stages carry no cluster comment and are
+		// not excluded; they used to be while the exclusion was registered, the stages running one at a time
+		{query: "up", want: false},
+		{query: "up # other comment", want: false},
+	} {
+		if got := ExcludeQueryByClusterComment("c1", tc.query); got != tc.want {
+			t.Errorf("ExcludeQueryByClusterComment(c1, %q) = %v, want %v", tc.query, got, tc.want)
+		}
+	}
+}
+
+func TestGetClusterCommentQueryAdapters(t *testing.T) {
+	rc := NewRunContext(context.Background(), nil)
+	defer rc.End()
+	rc.clusterNames = []string{"c1", "c2"}
+	// each call builds its own adjusters, so stages may call it concurrently
+	done := make(chan map[string]QueryAdjuster)
+	for range 2 {
+		go func() { done <- rc.GetClusterCommentQueryAdapters() }()
+	}
+	for range 2 {
+		ccqas := <-done
+		for _, cluster := range rc.ClusterNames() {
+			if q := ccqas[cluster]("up"); ExcludeQueryByClusterComment(cluster, q) {
+				t.Errorf("query %q of cluster %s excluded from it", q, cluster)
+			}
+		}
+	}
+}
@@ -0,0 +1,233 @@
+package common
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/klauspost/compress/snappy"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// RemoteWrite configures the Prometheus remote-write output format, which writes the workload series back to
+// a remote-write endpoint (Prometheus with --web.enable-remote-write-receiver, Mimir, Thanos etc.). The samples
+// are as old as the collection window, the endpoint has to accept out-of-order samples of that age.
+type RemoteWrite struct {
+	Url string
+	// Prefix is prepended to the metric names: <prefix><entity kind>_<metric>
+	Prefix string
+	// Match selects the workload outputs (by name, e.g. cpu_utilization) written, all if nil
+	Match   *regexp.Regexp
+	Headers map[string]string
+	Timeout time.Duration
+	client  *http.Client
+}
+
+const (
+	DefaultRemoteWritePrefix  = "densify_"
+	DefaultRemoteWriteTimeout = 30 * time.Second
+	// remoteWriteBatchSize is the number of samples a sink writes at once
+	remoteWriteBatchSize = 8192
+	remoteWriteAttempts  = 3
+	metricNameLabel      = "__name__"
+)
+
+// SetRemoteWrite configures the remote-write output format
+func (cfg *RunConfig) SetRemoteWrite(rw *RemoteWrite) error {
+	if u, err := url.Parse(rw.Url); err != nil || u.Scheme == Empty || u.Host == Empty {
+		return fmt.Errorf("invalid remote-write URL %s", rw.Url)
+	}
+	if rw.Timeout <= 0 {
+		rw.Timeout = DefaultRemoteWriteTimeout
+	}
+	rw.client = &http.Client{Timeout: rw.Timeout}
+	cfg.remoteWrite = rw
+	return nil
+}
+
+// remoteWriteLabels are the identity labels of the entity columns, named as in kube-state-metrics where it has them
+var remoteWriteLabels = map[string]string{
+	CamelCase(ClusterEntityKind, Name):   ClusterEntityKind,
+	CamelCase(Name):                      ClusterEntityKind,
+	CamelCase(Namespace):                 Namespace,
+	CamelCase(Entity, Name):              SnakeCase(Owner, Name),
+	CamelCase(Entity, Type):              SnakeCase(Owner, Kind),
+	CamelCase(ContainerEntityKind, Name): ContainerEntityKind,
+	CamelCase(NodeEntityKind, Name):      NodeEntityKind,
+	CamelCase(NodeGroupEntityKind, Name): NodeGroupEntityKind,
+	CamelCase(Hpa, Name):                 Hpa,
+	CamelCase(RqEntityKind, Name):        "resourcequota",
+	CamelCase(CrqEntityKind, Name):       "clusterresourcequota",
+}
+
+type rwLabel struct {
+	name, value string
+}
+
+type rwSample struct {
+	value float64
+	ts    int64
+}
+
+type rwSeries struct {
+	labels  []rwLabel
+	samples []rwSample
+}
+
+// rwEntity is the series of an entity, one per value column
+type rwEntity struct {
+	series []*rwSeries
+}
+
+// newRemoteWriteSink returns a sink writing the workload samples as series, a series per entity and value column;
+// the config and attributes records, and the workload outputs not matched, are not written
+func newRemoteWriteSink(spec *OutputSpec) (Sink, error) {
+	rw := spec.config.remoteWrite
+	if rw == nil {
+		return nil, fmt.Errorf("remote write not configured")
+	}
+	skip := rw.Match != nil && !rw.Match.MatchString(spec.Name)
+	bs := newBatchSink[rwEntity](spec, rw.Url, remoteWriteBatchSize)
+	bs.newEntity = func(entity []string) *rwEntity {
+		e := &rwEntity{}
+		for _, column := range spec.Columns[len(entity)+1:] {
+			e.series = append(e.series, &rwSeries{labels: rw.seriesLabels(spec, entity, column)})
+		}
+		return e
+	}
+	bs.add = func(e *rwEntity, s *Sample) (n int) {
+		if skip {
+			return
+		}
+		ts := int64(s.Time)
+		for i, value := range s.Values {
+			if v, ok := remoteWriteValue(value); ok {
+				e.series[i].samples = append(e.series[i].samples, rwSample{value: v, ts: ts})
+				n++
+			}
+		}
+		return
+	}
+	bs.send = func(ctx context.Context, batch []*rwEntity) error {
+		var b []byte
+		for _, e := range batch {
+			for _, s := range e.series {
+				if len(s.samples) > 0 {
+					b = protowire.AppendTag(b, 1, protowire.BytesType)
+					b = protowire.AppendBytes(b, s.marshal())
+				}
+			}
+		}
+		return rw.post(ctx, snappy.Encode(nil, b))
+	}
+	return bs, nil
+}
+
+// seriesLabels returns the labels of a series, sorted by name as remote write requires
+func (rw *RemoteWrite) seriesLabels(spec *OutputSpec, entity []string, column string) []rwLabel {
+	name := JoinNoSep(rw.Prefix, strings.ToLower(spec.EntityKind), Underscore, SnakeCase(column))
+	labels := []rwLabel{{name: metricNameLabel, value: name}}
+	for i, value := range entity {
+		ln, f := remoteWriteLabels[spec.Columns[i]]
+		if !f {
+			ln = SnakeCase(spec.Columns[i])
+		}
+		if value != Empty {
+			labels = append(labels, rwLabel{name: ln, value: value})
+		}
+	}
+	slices.SortFunc(labels, func(a, b rwLabel) int { return strings.Compare(a.name, b.name) })
+	return labels
+}
+
+func remoteWriteValue(value any) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, !math.IsNaN(v)
+	case float32:
+		return remoteWriteValue(float64(v))
+	case int:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case bool:
+		if v {
+			return 1, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
+
+// marshal encodes the series as a prometheus.TimeSeries protobuf message
+func (s *rwSeries) marshal() []byte {
+	var b []byte
+	for _, l := range s.labels {
+		var lb []byte
+		lb = protowire.AppendTag(lb, 1, protowire.BytesType)
+		lb = protowire.AppendString(lb, l.name)
+		lb = protowire.AppendTag(lb, 2, protowire.BytesType)
+		lb = protowire.AppendString(lb, l.value)
+		b = protowire.AppendTag(b, 1, protowire.BytesType)
+		b = protowire.AppendBytes(b, lb)
+	}
+	for _, smp := range s.samples {
+		var sb []byte
+		sb = protowire.AppendTag(sb, 1, protowire.Fixed64Type)
+		sb = protowire.AppendFixed64(sb, math.Float64bits(smp.value))
+		sb = protowire.AppendTag(sb, 2, protowire.VarintType)
+		sb = protowire.AppendVarint(sb, uint64(smp.ts))
+		b = protowire.AppendTag(b, 2, protowire.BytesType)
+		b = protowire.AppendBytes(b, sb)
+	}
+	return b
+}
+
+// post sends a snappy-compressed prometheus.WriteRequest, retrying on server errors and throttling
+func (rw *RemoteWrite) post(ctx context.Context, body []byte) (err error) {
+	for attempt := 1; attempt <= remoteWriteAttempts; attempt++ {
+		var retry bool
+		if retry, err = rw.try(ctx, body); err == nil || !retry {
+			return
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Duration(attempt) * time.Second):
+		}
+	}
+	return
+}
+
+func (rw *RemoteWrite) try(ctx context.Context, body []byte) (retry bool, err error) {
+	var req *http.Request
+	if req, err = http.NewRequestWithContext(ctx, http.MethodPost, rw.Url, bytes.NewReader(body)); err != nil {
+		return
+	}
+	req.Header.Set("Content-Encoding", "snappy")
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	req.Header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+	for k, v := range rw.Headers {
+		req.Header.Set(k, v)
+	}
+	var resp *http.Response
+	if resp, err = rw.client.Do(req); err != nil {
+		return true, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode/100 == 2 {
+		return
+	}
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	err = fmt.Errorf("remote write to %s failed: %s %s", rw.Url, resp.Status, strings.TrimSpace(string(msg)))
+	retry = resp.StatusCode/100 == 5 || resp.StatusCode == http.StatusTooManyRequests
+	return
+}
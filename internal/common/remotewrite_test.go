@@ -0,0 +1,107 @@
+package common
+
+import (
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+
+	"github.com/klauspost/compress/snappy"
+	"github.com/prometheus/common/model"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// decodeFields returns the length-delimited fields of a protobuf message by number, and the fixed64/varint ones
+func decodeFields(t *testing.T, b []byte) map[protowire.Number][]any {
+	t.Helper()
+	fields := make(map[protowire.Number][]any)
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			t.Fatal(protowire.ParseError(n))
+		}
+		b = b[n:]
+		var v any
+		switch typ {
+		case protowire.BytesType:
+			v, n = protowire.ConsumeBytes(b)
+		case protowire.Fixed64Type:
+			var u uint64
+			u, n = protowire.ConsumeFixed64(b)
+			v = math.Float64frombits(u)
+		case protowire.VarintType:
+			var u uint64
+			u, n = protowire.ConsumeVarint(b)
+			v = int64(u)
+		}
+		if n < 0 {
+			t.Fatal(protowire.ParseError(n))
+		}
+		b = b[n:]
+		fields[num] = append(fields[num], v)
+	}
+	return fields
+}
+
+func TestRemoteWriteSink(t *testing.T) {
+	var bodies [][]byte
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Content-Encoding") != "snappy" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		b, _ := io.ReadAll(r.Body)
+		body, err := snappy.Decode(nil, b)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		bodies = append(bodies, body)
+	}))
+	t.Cleanup(srv.Close)
+	cfg := NewRunConfig()
+	if err := cfg.SetRemoteWrite(&RemoteWrite{Url: srv.URL, Prefix: DefaultRemoteWritePrefix, Match: regexp.MustCompile("^cpu")}); err != nil {
+		t.Fatal(err)
+	}
+	columns := []string{"ClusterName", "NodeName", "MetricTime", "cpuUtilization"}
+	for _, name := range []string{"cpu_utilization", "memory_utilization"} {
+		sink, err := newRemoteWriteSink(&OutputSpec{Cluster: "c1", EntityKind: NodeEntityKind, Name: name, Columns: columns, config: cfg})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i, v := range []float64{0.5, math.NaN(), 1.5} {
+			if err = sink.WriteSample(&Sample{Entity: []string{"c1", "n1"}, Time: model.TimeFromUnix(int64(60 * i)), Values: []any{v}}); err != nil {
+				t.Fatalf("WriteSample() error = %v", err)
+			}
+		}
+		if err = sink.Close(); err != nil {
+			t.Fatalf("Close() error = %v", err)
+		}
+	}
+	if l := len(bodies); l != 1 {
+		t.Fatalf("requests = %d, want 1 (memory_utilization not matched)", l)
+	}
+	series := decodeFields(t, bodies[0])[1]
+	if l := len(series); l != 1 {
+		t.Fatalf("series = %d, want 1", l)
+	}
+	ts := decodeFields(t, series[0].([]byte))
+	var labels []string
+	for _, l := range ts[1] {
+		lf := decodeFields(t, l.([]byte))
+		labels = append(labels, string(lf[1][0].([]byte))+"="+string(lf[2][0].([]byte)))
+	}
+	want := []string{"__name__=densify_node_cpu_utilization", "cluster=c1", "node=n1"}
+	if len(labels) != len(want) || labels[0] != want[0] || labels[1] != want[1] || labels[2] != want[2] {
+		t.Errorf("labels = %v, want %v", labels, want)
+	}
+	if l := len(ts[2]); l != 2 {
+		t.Fatalf("samples = %d, want 2", l)
+	}
+	last := decodeFields(t, ts[2][1].([]byte))
+	if last[1][0].(float64) != 1.5 || last[2][0].(int64) != 120000 {
+		t.Errorf("last sample = %v", last)
+	}
+}
@@ -12,26 +12,26 @@ const (
 	ClusterQueryFormat = ClusterFormat + Space + QueryFormat
 )
 
-func CollectAndProcessMetric(query string, promRange *v1.Range, matrixFunc ClusterMatrixFunc) (n int, err error) {
-	n, err = CollectAndProcessMetricErrorLogLevel(2, query, promRange, matrixFunc, Warn)
+func (rc *RunContext) CollectAndProcessMetric(query string, promRange *v1.Range, matrixFunc ClusterMatrixFunc) (n int, err error) {
+	n, err = rc.CollectAndProcessMetricErrorLogLevel(2, query, promRange, matrixFunc, Warn)
 	return
 }
 
-func CollectAndProcessMetricErrorLogLevel(callDepth int, query string, promRange *v1.Range, matrixFunc ClusterMatrixFunc, level LogLevel) (n int, err error) {
+func (rc *RunContext) CollectAndProcessMetricErrorLogLevel(callDepth int, query string, promRange *v1.Range, matrixFunc ClusterMatrixFunc, level LogLevel) (n int, err error) {
 	callDepth++
 	var resultMap ClusterResultMap
-	resultMap, n, err = CollectMetric(callDepth, query, promRange)
-	ProcessResultsErrorLogLevel(callDepth, resultMap, err, query, matrixFunc, level)
+	resultMap, n, err = rc.CollectMetric(callDepth, query, promRange)
+	rc.ProcessResultsErrorLogLevel(callDepth, resultMap, err, query, matrixFunc, level)
 	return
 }
 
-func ProcessResults(callDepth int, resultMap ClusterResultMap, err error, query string, matrixFunc ClusterMatrixFunc) {
-	ProcessResultsErrorLogLevel(callDepth+1, resultMap, err, query, matrixFunc, Warn)
+func (rc *RunContext) ProcessResults(callDepth int, resultMap ClusterResultMap, err error, query string, matrixFunc ClusterMatrixFunc) {
+	rc.ProcessResultsErrorLogLevel(callDepth+1, resultMap, err, query, matrixFunc, Warn)
 }
 
-func ProcessResultsErrorLogLevel(callDepth int, resultMap ClusterResultMap, err error, query string, matrixFunc ClusterMatrixFunc, level LogLevel) {
+func (rc *RunContext) ProcessResultsErrorLogLevel(callDepth int, resultMap ClusterResultMap, err error, query string, matrixFunc ClusterMatrixFunc, level LogLevel) {
 	if err != nil {
-		LogErrorWithLevel(callDepth+1, level, err, QueryFormat, query)
+		rc.LogErrorWithLevel(callDepth+1, level, err, QueryFormat, query)
 	} else {
 		for cluster, result := range resultMap {
 			if result.Error == nil {
@@ -39,7 +39,7 @@ func ProcessResultsErrorLogLevel(callDepth int, resultMap ClusterResultMap, err
 					matrixFunc(cluster, result.Matrix)
 				}
 			} else {
-				LogErrorWithLevel(callDepth+1, level, result.Error, ClusterQueryFormat, cluster, Empty, result.Query)
+				rc.LogErrorWithLevel(callDepth+1, level, result.Error, ClusterQueryFormat, cluster, Empty, result.Query)
 			}
 		}
 	}
@@ -0,0 +1,236 @@
+package common
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	cconf "github.com/densify-dev/container-config/config"
+	v1 "github.com/prometheus/client_golang/api/prometheus/v1"
+	"github.com/prometheus/common/model"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+)
+
+// RunContext is a collection run: its cancellation and all the state the run builds up - the exporters and
+// metrics detected, the query exclusions, the files written, the stages, the query counts and warnings, and
+// the schemas of the outputs - along with the state of the collectors (see CollectorState) and the log files
+// of its clusters. The configuration of the run (its RunConfig, the parameters, the clock, the collection window,
+// the cluster filters, the Prometheus API client, the sinks and the output folder) is set before the run starts,
+// so that runs with different configurations may run concurrently.
+// The run context of a stage (see RunStages) shares the state of the run, the queries issued with it being
+// attributed to the stage.
+type RunContext struct {
+	*runState
+	ctx context.Context
+	// entity is the stage the queries are attributed to, runEntity outside of the stages
+	entity string
+}
+
+// runState is the state of a run, shared by the run contexts of its stages
+type runState struct {
+	cancel context.CancelCauseFunc
+	start  time.Time
+	// span is the span of the run, the root of its trace; ctx of the run context carries the span of its scope
+	span *span
+
+	// the configuration of the run, set before the run starts (see pipeline.Configure)
+	config              *RunConfig
+	params              *cconf.Parameters
+	clock               func() time.Time
+	embedded            bool
+	rootFolder          string
+	sinkFactories       []SinkFactory
+	currentTime         time.Time
+	interval            time.Duration
+	step                time.Duration
+	clusterNames        []string
+	filtersByName       map[string]*ClusterFilter
+	labelFilters        map[model.Fingerprint]*queryLabelFilter
+	noIdentifiersFilter bool
+	prometheusApi       v1.API
+	platform            ObservabilityPlatform
+	platformQa          QueryAdjuster
+	oncePlatform        sync.Once
+
+	// logs holds the handler of the log file of each cluster, opened by InitLogs
+	logs     map[string]slog.Handler
+	logFiles []*rotatingFile
+	logsMu   sync.RWMutex
+
+	clusterExporters       map[string]map[string]*clusterExporter
+	clusterExportersByJob  map[string]map[string][]*clusterExporter
+	coveragePresentMetrics map[string]map[string]bool
+	prometheusVersion      string
+	onceConn               sync.Once
+
+	// stages run concurrently, so the maps which are written during collection are guarded
+	presentMetrics           map[string]map[string]bool
+	presentMetricsMu         sync.RWMutex
+	clusterQueryExclusions   map[string]ClusterQueryExclusion
+	clusterQueryExclusionsMu sync.RWMutex
+
+	openFiles   map[Sink]*TrackedFile
+	closedFiles []*TrackedFile
+	filesMu     sync.Mutex
+
+	stageStates   []*StageState
+	stageStatesMu sync.Mutex
+
+	stats   map[string]*runStats
+	statsMu sync.Mutex
+
+	plannedQueries    []*PlannedQuery
+	plannedQueriesMu  sync.Mutex
+	overriddenQueries overriddenQueries
+
+	schemas   map[string]*Schema
+	schemasMu sync.Mutex
+
+	onceManifest, onceSummaries sync.Once
+
+	onceFinish sync.Once
+	exitCode   ExitCode
+
+	collectors   map[any]any
+	collectorsMu sync.Mutex
+}
+
+// errRunEnded is the cause of the cancellation of a run context by End
+var errRunEnded = errors.New("run ended")
+
+// NewRunContext starts a run configured with cfg (the default configuration if nil), which is interrupted when
+// ctx is done; End must be called once it is finished
+func NewRunContext(ctx context.Context, cfg *RunConfig) *RunContext {
+	if cfg == nil {
+		cfg = NewRunConfig()
+	}
+	rs := &runState{
+		config:                 cfg,
+		start:                  time.Now(),
+		clock:                  time.Now,
+		rootFolder:             defaultRootFolder,
+		clusterExporters:       make(map[string]map[string]*clusterExporter),
+		clusterExportersByJob:  make(map[string]map[string][]*clusterExporter),
+		coveragePresentMetrics: make(map[string]map[string]bool),
+		presentMetrics:         make(map[string]map[string]bool),
+		clusterQueryExclusions: make(map[string]ClusterQueryExclusion),
+		openFiles:              make(map[Sink]*TrackedFile),
+		stats:                  make(map[string]*runStats),
+		schemas:                make(map[string]*Schema),
+		collectors:             make(map[any]any),
+	}
+	rc := &RunContext{runState: rs, entity: runEntity}
+	rc.ctx, rs.cancel = context.WithCancelCause(ctx)
+	rs.span = cfg.tracing.startTrace("run", cfg.pseudonyms != nil)
+	rc.ctx = withSpan(rc.ctx, rs.span)
+	cfg.metrics.runStart.Set(float64(rs.start.Unix()))
+	return rc
+}
+
+// stageContext returns the run context of a stage, with the span of the stage started
+func (rc *RunContext) stageContext(name string) (*RunContext, *span) {
+	sp := startSpan(rc.span, name, tracepb.Span_SPAN_KIND_INTERNAL).setString(stageAttr, name)
+	return &RunContext{runState: rc.runState, ctx: withSpan(rc.ctx, sp), entity: name}, sp
+}
+
+// End releases the run
+func (rc *RunContext) End() {
+	rc.cancel(errRunEnded)
+}
+
+// Context is the parent context of all the calls of the run to Prometheus and to the outputs
+func (rc *RunContext) Context() context.Context {
+	return rc.ctx
+}
+
+// RunId identifies the run, by its start time
+func (rc *RunContext) RunId() string {
+	return rc.start.UTC().Format("20060102T150405Z")
+}
+
+// Interrupt cancels the in-flight queries; the following queries fail fast, so the stages drain quickly
+// and close their files on their usual paths
+func (rc *RunContext) Interrupt(reason string) {
+	rc.cancel(fmt.Errorf("%w: %s", ErrInterrupted, reason))
+}
+
+func (rc *RunContext) Interrupted() bool {
+	err := context.Cause(rc.ctx)
+	return err != nil && err != errRunEnded
+}
+
+// CollectorState returns the state of a collector for the run, created by newState on first use; key is a
+// value of a type of the collector package, so that the state of other collectors cannot be reached by mistake
+func CollectorState[T any](rc *RunContext, key any, newState func(rc *RunContext) T) T {
+	rc.collectorsMu.Lock()
+	defer rc.collectorsMu.Unlock()
+	if state, f := rc.collectors[key]; f {
+		return state.(T)
+	}
+	state := newState(rc)
+	rc.collectors[key] = state
+	return state
+}
+
+// A run embedded in another process does not exit the process on a fatal failure: the failure unwinds the
+// stage (or the run step) it occurred in as a RunError, and the run is cancelled with it and returns it.
+
+// RunError is the fatal failure of an embedded run, with the exit code of its class
+type RunError struct {
+	Code ExitCode
+	Err  error
+}
+
+func (re *RunError) Error() string {
+	return fmt.Sprintf("%v failure: %v", re.Code, re.Err)
+}
+
+func (re *RunError) Unwrap() error {
+	return re.Err
+}
+
+// SetEmbedded makes the fatal failures end the run instead of exiting the process
+func (rc *RunContext) SetEmbedded() {
+	rc.embedded = true
+}
+
+func failRun(code ExitCode, err error, format string, v ...any) {
+	msg := strings.TrimSuffix(fmt.Sprintf(format, v...), ":")
+	re := &RunError{Code: code, Err: errors.New(msg)}
+	if err != nil {
+		re.Err = fmt.Errorf("%s: %w", msg, err)
+	}
+	panic(re)
+}
+
+// RecoverRunError recovers the fatal failure of an embedded run into err and cancels the run with it, to be
+// deferred; other panics go on
+func (rc *RunContext) RecoverRunError(err *error) {
+	if r := recover(); r != nil {
+		re, ok := r.(*RunError)
+		if !ok {
+			panic(r)
+		}
+		rc.cancel(re)
+		*err = re
+	}
+}
+
+func (rc *RunContext) recoverRun(f func(rc *RunContext)) (err error) {
+	defer rc.RecoverRunError(&err)
+	f(rc)
+	return
+}
+
+// Failure returns the fatal failure the run ended with, nil if none
+func (rc *RunContext) Failure() error {
+	var re *RunError
+	if errors.As(context.Cause(rc.ctx), &re) {
+		return re
+	}
+	return nil
+}
@@ -0,0 +1,81 @@
+package common
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+)
+
+// newTestRunContext returns a run of the given configuration (nil for the default one) ended when the test is done
+func newTestRunContext(t *testing.T, cfg *RunConfig) *RunContext {
+	t.Helper()
+	rc := NewRunContext(context.Background(), cfg)
+	t.Cleanup(rc.End)
+	return rc
+}
+
+type testCollectorKey struct{}
+
+func TestRunContextIsolation(t *testing.T) {
+	rc1, rc2 := newTestRunContext(t, nil), newTestRunContext(t, nil)
+	newState := func(*RunContext) map[string]int { return make(map[string]int) }
+	CollectorState(rc1, testCollectorKey{}, newState)["n1"]++
+	CollectorState(rc1, testCollectorKey{}, newState)["n1"]++
+	if n := CollectorState(rc1, testCollectorKey{}, newState)["n1"]; n != 2 {
+		t.Errorf("collector state of the run = %d, want 2", n)
+	}
+	if n := len(CollectorState(rc2, testCollectorKey{}, newState)); n != 0 {
+		t.Errorf("collector state of another run has %d entries, want none", n)
+	}
+	rc1.RegisterClusterQueryExclusion("all", func(string, string) bool { return true })
+	if !rc1.excludeQueryForCluster("c1", "up") || rc2.excludeQueryForCluster("c1", "up") {
+		t.Error("query exclusion not limited to the run it was registered for")
+	}
+	rc1.Interrupt("test")
+	if !rc1.Interrupted() || rc2.Interrupted() {
+		t.Error("interruption not limited to the run")
+	}
+}
+
+func TestRunContextWarnings(t *testing.T) {
+	rc1, rc2 := newTestRunContext(t, nil), newTestRunContext(t, nil)
+	rc1.LogCluster(1, Warn, "first", "c1", false)
+	LogAll(1, Warn, "process warning")
+	if got := rc1.getRunStats("c1").warnings; len(got) != 1 || got[0] != "cluster=c1 first" {
+		t.Errorf("warnings = %v, want [cluster=c1 first]", got)
+	}
+	if got := rc2.getRunStats("c1").warnings; len(got) != 0 {
+		t.Errorf("warnings of another run = %v, want none", got)
+	}
+	rc1.End()
+	if rc1.Interrupted() {
+		t.Error("an ended run is not interrupted")
+	}
+}
+
+func TestRunContextFailure(t *testing.T) {
+	rc := newTestRunContext(t, nil)
+	err := rc.recoverRun(func(*RunContext) {
+		failRun(ExitConfig, errors.New("bad"), "Invalid configuration:")
+	})
+	var re *RunError
+	if !errors.As(err, &re) || re.Code != ExitConfig || re.Error() != "configuration failure: Invalid configuration: bad" {
+		t.Fatalf("recoverRun() = %v, want a config RunError", err)
+	}
+	if rc.Failure() != re || !rc.Interrupted() {
+		t.Errorf("Failure() = %v, Interrupted() = %v", rc.Failure(), rc.Interrupted())
+	}
+}
+
+func TestIndicators(t *testing.T) {
+	in := NewIndicators()
+	var wg sync.WaitGroup
+	for range 10 {
+		wg.Go(func() { in.Inc(Limits) })
+	}
+	wg.Wait()
+	if n := in.Get(Limits); n != 10 {
+		t.Errorf("Get() = %d, want 10", n)
+	}
+}
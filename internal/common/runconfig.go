@@ -0,0 +1,46 @@
+package common
+
+// RunConfig is the configuration of what a run writes and exports, given to NewRunContext: the output formats
+// and their settings (CSV version, existing files, bundles, label policy, pseudonymization, remote write, OTLP
+// and S3), the custom metrics, attributes and query overrides, the tracing, the self metrics (and the registry
+// they are counted in), the logging and whether the queries are only planned (see SetDryRun). It is set up
+// before the runs given it start, and the exporters it opens (OTLP connections, spans, /metrics) are shared by
+// these runs until it is closed; runs with different configurations may run concurrently.
+type RunConfig struct {
+	outputFormats     []string
+	csvVersion        int
+	existingPolicy    string
+	bundleScope       string
+	bundleCompression string
+	labelPolicy       *LabelPolicy
+	custom            *CustomConfig
+	pseudonyms        *pseudonymizer
+	remoteWrite       *RemoteWrite
+	otlpExport        *OtlpExport
+	s3Upload          *S3Upload
+	selfMetrics       *SelfMetrics
+	metrics           *selfMetricSet
+	tracing           *tracer
+	log               *logConfig
+	dryRun            bool
+}
+
+// NewRunConfig returns the default configuration: the outputs are written as CSV files in the legacy encoding,
+// replacing those of an earlier run, with nothing else exported, and logged as text at the info level
+func NewRunConfig() *RunConfig {
+	return &RunConfig{
+		outputFormats:     []string{CsvFormat},
+		csvVersion:        CsvLegacy,
+		existingPolicy:    ExistingOverwrite,
+		bundleScope:       BundleNone,
+		bundleCompression: Gzip,
+		custom:            &CustomConfig{},
+		metrics:           newSelfMetricSet(),
+		log:               newLogConfig(),
+	}
+}
+
+// Config returns the configuration of the run
+func (rc *RunContext) Config() *RunConfig {
+	return rc.config
+}
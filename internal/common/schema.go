@@ -0,0 +1,218 @@
+package common
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// ColumnType is the type of the values of a column
+type ColumnType string
+
+const (
+	StringColumn ColumnType = "string"
+	IntColumn    ColumnType = "int"
+	FloatColumn  ColumnType = "float"
+	BoolColumn   ColumnType = "bool"
+	TimeColumn   ColumnType = "time"
+	LabelsColumn ColumnType = "labels"
+	JsonColumn   ColumnType = "json"
+)
+
+// columnTypeOf returns the column type of a record value, empty if the value has none
+func columnTypeOf(value any) (ct ColumnType) {
+	switch value.(type) {
+	case string:
+		ct = StringColumn
+	case int, int32, int64, uint, uint32, uint64:
+		ct = IntColumn
+	case float32, float64:
+		ct = FloatColumn
+	case bool:
+		ct = BoolColumn
+	case time.Time:
+		ct = TimeColumn
+	case LabelMap:
+		ct = LabelsColumn
+	case json.RawMessage:
+		ct = JsonColumn
+	}
+	return
+}
+
+type Column struct {
+	Name     string     `json:"name"`
+	Type     ColumnType `json:"type"`
+	Nullable bool       `json:"nullable"`
+}
+
+// Schema describes an output: its columns, in order, and its version. The version of a schema is bumped
+// whenever its columns change (added, removed, reordered, retyped or made nullable), so that the consumers
+// know which layout a file has.
+type Schema struct {
+	EntityKind string    `json:"entityKind"`
+	Name       string    `json:"name"`
+	Version    int       `json:"version"`
+	Columns    []*Column `json:"columns"`
+}
+
+// NewSchema creates the schema of the config or attributes output of an entity kind, the columns are added
+// with Add; the schema is published once complete, i.e. when a sink of it is created
+func NewSchema(entityKind string, ft FileType, version int) *Schema {
+	return &Schema{EntityKind: entityKind, Name: ft.String(), Version: version}
+}
+
+// NewExtraSchema creates the schema of an extra config or attributes output of an entity kind
+func NewExtraSchema(entityKind string, ft FileType, version int) *Schema {
+	return &Schema{EntityKind: entityKind, Name: SnakeCase(entityKind, Extra, ft.String()), Version: version}
+}
+
+// Add appends columns of a type to the schema
+func (s *Schema) Add(ct ColumnType, nullable bool, names ...string) *Schema {
+	for _, name := range names {
+		s.Columns = append(s.Columns, &Column{Name: name, Type: ct, Nullable: nullable})
+	}
+	return s
+}
+
+// ColumnNames returns the names of the columns, in order
+func (s *Schema) ColumnNames() []string {
+	names := make([]string, len(s.Columns))
+	for i, column := range s.Columns {
+		names[i] = column.Name
+	}
+	return names
+}
+
+// Validate checks that the values of a row match the columns: one value per column, of the column type,
+// nil only in a nullable column
+func (s *Schema) Validate(values []any) error {
+	if l := len(values); l != len(s.Columns) {
+		return fmt.Errorf("%d values for %d columns", l, len(s.Columns))
+	}
+	for i, value := range values {
+		column := s.Columns[i]
+		if value == nil {
+			if !column.Nullable {
+				return fmt.Errorf("column %s: no value", column.Name)
+			}
+		} else if ct := columnTypeOf(value); ct != column.Type {
+			return fmt.Errorf("column %s: %T value in a %s column", column.Name, value, column.Type)
+		}
+	}
+	return nil
+}
+
+func (s *Schema) key() string {
+	return path.Join(s.EntityKind, s.Name)
+}
+
+// workloadValueTypes holds the types of the value columns of the workload outputs whose values are not a float
+var workloadValueTypes = make(map[string][]ColumnType)
+
+// SetWorkloadValueTypes sets the types of the value columns of a workload metric (comma-separated if several)
+func SetWorkloadValueTypes(metricName string, types ...ColumnType) {
+	workloadValueTypes[metricName] = types
+}
+
+// newWorkloadSchema creates the schema of a workload output from its CSV header format: the entity columns
+// are strings, followed by the sample time and the value column(s) of the metric
+func newWorkloadSchema(entityKind, name, csvHeaderFormat, metricName string) *Schema {
+	header := strings.TrimSuffix(fmt.Sprintf(csvHeaderFormat, metricName), lf)
+	columns := strings.Split(header, Comma)
+	values := strings.Split(metricName, Comma)
+	ne := len(columns) - len(values) - 1
+	s := &Schema{EntityKind: entityKind, Name: name, Version: workloadSchemaVersion}
+	s.Add(StringColumn, false, columns[:ne]...)
+	s.Add(TimeColumn, false, columns[ne])
+	types := workloadValueTypes[metricName]
+	for i, value := range values {
+		ct := FloatColumn
+		if i < len(types) {
+			ct = types[i]
+		}
+		s.Add(ct, false, value)
+	}
+	return s
+}
+
+// workloadSchemaVersion is the version of the schemas of the workload outputs
+const workloadSchemaVersion = 1
+
+const schemasFileName = "schemas.json"
+
+// Schemas is the document of the schemas of the outputs of a run, data/schemas.json
+type Schemas struct {
+	Version string `json:"collectorVersion"`
+	// CsvVersion is the encoding of the CSV files, see SetCsvVersion
+	CsvVersion int       `json:"csvVersion"`
+	Schemas    []*Schema `json:"schemas"`
+}
+
+// publishSchema records the schema of an output created by the run; the outputs of the same entity kind and
+// name (of different clusters) have the same schema
+func (rc *RunContext) publishSchema(s *Schema) error {
+	rc.schemasMu.Lock()
+	defer rc.schemasMu.Unlock()
+	if published, f := rc.schemas[s.key()]; f && published != s && (published.Version != s.Version || !slices.EqualFunc(published.Columns, s.Columns, func(a, b *Column) bool { return *a == *b })) {
+		return fmt.Errorf("%s: conflicting schemas", s.key())
+	}
+	rc.schemas[s.key()] = s
+	return nil
+}
+
+// schemaVersion returns the schema version of an output file (relative to the root folder), 0 if it has no schema
+func (rc *RunContext) schemaVersion(rel string) int {
+	elements := strings.Split(filepath.ToSlash(rel), "/")
+	if l := len(elements); l >= 3 {
+		name := elements[l-1]
+		name = strings.TrimSuffix(name, path.Ext(name))
+		rc.schemasMu.Lock()
+		defer rc.schemasMu.Unlock()
+		if s, f := rc.schemas[path.Join(elements[l-2], name)]; f {
+			return s.Version
+		}
+	}
+	return 0
+}
+
+// WriteSchemas writes data/schemas.json, the schemas of the outputs created by the run
+func (rc *RunContext) WriteSchemas() error {
+	rc.schemasMu.Lock()
+	doc := &Schemas{Version: Version, CsvVersion: rc.config.csvVersion, Schemas: make([]*Schema, 0, len(rc.schemas))}
+	for _, key := range SortedKeySet(rc.schemas) {
+		doc.Schemas = append(doc.Schemas, rc.schemas[key])
+	}
+	rc.schemasMu.Unlock()
+	return writeJson(filepath.Join(rc.rootFolder, schemasFileName), doc)
+}
+
+// schemaSink validates the rows against the schema before writing them
+type schemaSink struct {
+	Sink
+	schema *Schema
+}
+
+func (ss *schemaSink) WriteRecord(values ...any) error {
+	if err := ss.schema.Validate(values); err != nil {
+		return fmt.Errorf("%s: %v", ss.Name(), err)
+	}
+	return ss.Sink.WriteRecord(values...)
+}
+
+func (ss *schemaSink) WriteSample(s *Sample) error {
+	values := make([]any, 0, len(s.Entity)+1+len(s.Values))
+	for _, field := range s.Entity {
+		values = append(values, field)
+	}
+	values = append(values, s.Time.Time())
+	values = append(values, s.Values...)
+	if err := ss.schema.Validate(values); err != nil {
+		return fmt.Errorf("%s: %v", ss.Name(), err)
+	}
+	return ss.Sink.WriteSample(s)
+}
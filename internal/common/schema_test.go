@@ -0,0 +1,135 @@
+package common
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestSchema() *Schema {
+	return NewSchema(NodeEntityKind, Attributes, 2).
+		Add(StringColumn, false, "Name").
+		Add(IntColumn, true, "Cpu").
+		Add(TimeColumn, true, "CreateTime").
+		Add(LabelsColumn, false, "Labels")
+}
+
+func TestSchemaValidate(t *testing.T) {
+	s := newTestSchema()
+	ct := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name    string
+		values  []any
+		wantErr string
+	}{
+		{name: "valid", values: []any{"n1", 4, ct, LabelMap{}}},
+		{name: "nulls", values: []any{"n1", nil, nil, LabelMap{}}},
+		{name: "count", values: []any{"n1", 4, ct}, wantErr: "3 values for 4 columns"},
+		{name: "null", values: []any{nil, 4, ct, LabelMap{}}, wantErr: "column Name: no value"},
+		{name: "type", values: []any{"n1", 0.5, ct, LabelMap{}}, wantErr: "column Cpu: float64 value in a int column"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := s.Validate(tt.values)
+			if tt.wantErr == Empty {
+				if err != nil {
+					t.Errorf("Validate() error = %v", err)
+				}
+			} else if err == nil || err.Error() != tt.wantErr {
+				t.Errorf("Validate() error = %v, want %s", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestNewWorkloadSchema(t *testing.T) {
+	format, _ := GetCsvHeaderFormat(NodeEntityKind, Metric)
+	s := newWorkloadSchema(NodeEntityKind, "cpu_utilization", format, "CpuUtilization")
+	want := []*Column{{"ClusterName", StringColumn, false}, {"NodeName", StringColumn, false}, {"MetricTime", TimeColumn, false}, {"CpuUtilization", FloatColumn, false}}
+	if b, w := jsonString(t, s.Columns), jsonString(t, want); b != w {
+		t.Errorf("columns = %s, want %s", b, w)
+	}
+	SetWorkloadValueTypes("ExitCode,IsPid1", IntColumn, BoolColumn)
+	t.Cleanup(func() { delete(workloadValueTypes, "ExitCode,IsPid1") })
+	format, _ = GetCsvHeaderFormat(ContainerEntityKind, Event)
+	s = newWorkloadSchema(ContainerEntityKind, "restarts", format, "ExitCode,IsPid1")
+	if err := s.Validate([]any{"c1", "ns", "e", "Deployment", "c", time.Now(), 137, false}); err != nil {
+		t.Errorf("Validate() error = %v", err)
+	}
+}
+
+func jsonString(t *testing.T, v any) string {
+	t.Helper()
+	b, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func TestSchemaSink(t *testing.T) {
+	rc := newTestOutputRunContext(t, nil)
+	sink, err := rc.NewSchemaSink("c1", newTestSchema())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = sink.WriteRecord("n1", 4, nil, LabelMap{}); err != nil {
+		t.Errorf("WriteRecord() error = %v", err)
+	}
+	if err = sink.WriteRecord("n2", "4", nil, LabelMap{}); err == nil || !strings.Contains(err.Error(), "column Cpu") {
+		t.Errorf("WriteRecord() error = %v, want a column Cpu error", err)
+	}
+	if got := readSink(t, sink); got != "Name,Cpu,CreateTime,Labels\nn1,4,,\n" {
+		t.Errorf("CSV = %q", got)
+	}
+	if v := rc.schemaVersion(filepath.Join("c1", NodeEntityKind, "attributes.csv")); v != 2 {
+		t.Errorf("schemaVersion() = %d, want 2", v)
+	}
+	if v := rc.schemaVersion(filepath.Join("c1", NodeEntityKind, "cpu_utilization.csv")); v != 0 {
+		t.Errorf("schemaVersion() of an output without schema = %d, want 0", v)
+	}
+	if _, err = rc.NewSchemaSink("c2", NewSchema(NodeEntityKind, Attributes, 3).Add(StringColumn, false, "Name")); err == nil {
+		t.Error("NewSchemaSink() with a conflicting schema: expected an error")
+	}
+	if err = rc.WriteSchemas(); err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.ReadFile(filepath.Join(rc.rootFolder, schemasFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var doc Schemas
+	if err = json.Unmarshal(b, &doc); err != nil {
+		t.Fatal(err)
+	}
+	if l := len(doc.Schemas); l != 1 || doc.Schemas[0].Version != 2 || len(doc.Schemas[0].Columns) != 4 {
+		t.Errorf("schemas = %s", b)
+	}
+}
+
+func TestParquetSinkSchema(t *testing.T) {
+	rc := newTestOutputRunContext(t, nil)
+	s := NewSchema(NodeEntityKind, Attributes, 1).
+		Add(StringColumn, false, "Name").
+		Add(IntColumn, true, "Cpu")
+	sink, err := newParquetSink(&OutputSpec{Cluster: "c1", EntityKind: NodeEntityKind, Name: s.Name, Columns: s.ColumnNames(), Schema: s, folder: rc.rootFolder, config: rc.config})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the column types are those of the schema, not of the first values
+	if err = sink.WriteRecord("n1", nil); err != nil {
+		t.Fatal(err)
+	}
+	if err = sink.WriteRecord("n2", 4); err != nil {
+		t.Fatal(err)
+	}
+	if err = sink.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := readParquet(t, sink.Name()), `[{"Name":"n1","Cpu":null},{"Name":"n2","Cpu":4}]`; got != want {
+		t.Errorf("Parquet = %s, want %s", got, want)
+	}
+}
@@ -0,0 +1,252 @@
+package common
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"runtime"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/prometheus/client_golang/prometheus/push"
+)
+
+// selfMetricsNamespace prefixes the names of the metrics of the collector itself
+const selfMetricsNamespace = "densify_collector"
+
+// DefaultSelfMetricsJob is the job the self metrics are pushed as
+const DefaultSelfMetricsJob = "densify_collector"
+
+// the outcomes of the queries
+const (
+	querySucceeded = "succeeded"
+	queryEmpty     = "empty"
+	queryFailed    = "failed"
+)
+
+// SelfMetrics configures the publication of the metrics of the collector itself: written as a node-exporter
+// textfile at the end of the run, served on /metrics while the collection runs, pushed to a Pushgateway (or a
+// stand-in accepting its API) at the end of the run
+type SelfMetrics struct {
+	Textfile string
+	Listen   string
+	PushUrl  string
+	PushJob  string
+	server   *http.Server
+}
+
+// selfMetricSet is the registry of the self metrics of a configuration, the runs given the same configuration
+// counting to the same metrics
+type selfMetricSet struct {
+	registry      *prometheus.Registry
+	queryDuration *prometheus.HistogramVec
+	queryResults  *prometheus.CounterVec
+	errors        *prometheus.CounterVec
+	rowsWritten   *prometheus.CounterVec
+	bytesRead     prometheus.Counter
+	stageTime     *prometheus.GaugeVec
+	runTime       prometheus.Gauge
+	runStart      prometheus.Gauge
+	memAlloc      prometheus.Gauge
+	memTotal      prometheus.Gauge
+	memSys        prometheus.Gauge
+	memGc         prometheus.Gauge
+}
+
+func newSelfMetricSet() *selfMetricSet {
+	r := prometheus.NewRegistry()
+	return &selfMetricSet{
+		registry: r,
+		queryDuration: newSelfHistogramVec(r, "query_duration_seconds", "Duration of the Prometheus queries.",
+			[]float64{.05, .1, .25, .5, 1, 2.5, 5, 10, 30, 60, 120}, "entity", "api", "platform"),
+		queryResults: newSelfCounterVec(r, "query_results_total", "Per-cluster results of the Prometheus queries, by outcome.",
+			"entity", "outcome"),
+		errors: newSelfCounterVec(r, "errors_total", "Errors, by class (the exit code classes: prometheus, connection, output etc.).",
+			"class"),
+		rowsWritten: newSelfCounterVec(r, "rows_written_total", "Rows written per output file.", "cluster", "entity", "file"),
+		bytesRead:   newSelfCounter(r, "prometheus_response_bytes_total", "Bytes received from Prometheus."),
+		stageTime:   newSelfGaugeVec(r, "stage_duration_seconds", "Duration of the collection stages.", "stage"),
+		runTime:     newSelfGauge(r, "run_duration_seconds", "Duration of the run, until the metrics were published."),
+		runStart:    newSelfGauge(r, "run_start_timestamp_seconds", "Start time of the run."),
+		memAlloc:    newSelfGauge(r, "memory_alloc_bytes", "Bytes of allocated heap objects, at the last memory reading."),
+		memTotal:    newSelfGauge(r, "memory_total_alloc_bytes", "Cumulative bytes allocated for heap objects, at the last memory reading."),
+		memSys:      newSelfGauge(r, "memory_sys_bytes", "Bytes of memory obtained from the OS, at the last memory reading."),
+		memGc:       newSelfGauge(r, "gc_cycles", "Completed GC cycles, at the last memory reading."),
+	}
+}
+
+func newSelfCounter(r *prometheus.Registry, name, help string) prometheus.Counter {
+	c := prometheus.NewCounter(prometheus.CounterOpts{Namespace: selfMetricsNamespace, Name: name, Help: help})
+	r.MustRegister(c)
+	return c
+}
+
+func newSelfCounterVec(r *prometheus.Registry, name, help string, labels ...string) *prometheus.CounterVec {
+	c := prometheus.NewCounterVec(prometheus.CounterOpts{Namespace: selfMetricsNamespace, Name: name, Help: help}, labels)
+	r.MustRegister(c)
+	return c
+}
+
+func newSelfGauge(r *prometheus.Registry, name, help string) prometheus.Gauge {
+	g := prometheus.NewGauge(prometheus.GaugeOpts{Namespace: selfMetricsNamespace, Name: name, Help: help})
+	r.MustRegister(g)
+	return g
+}
+
+func newSelfGaugeVec(r *prometheus.Registry, name, help string, labels ...string) *prometheus.GaugeVec {
+	g := prometheus.NewGaugeVec(prometheus.GaugeOpts{Namespace: selfMetricsNamespace, Name: name, Help: help}, labels)
+	r.MustRegister(g)
+	return g
+}
+
+func newSelfHistogramVec(r *prometheus.Registry, name, help string, buckets []float64, labels ...string) *prometheus.HistogramVec {
+	h := prometheus.NewHistogramVec(prometheus.HistogramOpts{Namespace: selfMetricsNamespace, Name: name, Help: help, Buckets: buckets}, labels)
+	r.MustRegister(h)
+	return h
+}
+
+// SelfMetricsGatherer returns the self metrics of the runs of the configuration, e.g. to serve them along with
+// the metrics of an embedding process
+func (cfg *RunConfig) SelfMetricsGatherer() prometheus.Gatherer {
+	return cfg.metrics.registry
+}
+
+// SetSelfMetrics sets the publication of the self metrics and, if listening, starts serving /metrics
+func (cfg *RunConfig) SetSelfMetrics(sm *SelfMetrics) error {
+	if sm == nil || (sm.Textfile == Empty && sm.Listen == Empty && sm.PushUrl == Empty) {
+		return nil
+	}
+	if sm.PushJob == Empty {
+		sm.PushJob = DefaultSelfMetricsJob
+	}
+	if sm.Listen != Empty {
+		l, err := net.Listen("tcp", sm.Listen)
+		if err != nil {
+			return err
+		}
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", promhttp.HandlerFor(cfg.metrics.registry, promhttp.HandlerOpts{}))
+		server := &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+		go func() {
+			if err := server.Serve(l); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				LogError(err, "Failed to serve self metrics:")
+			}
+		}()
+		sm.server = server
+	}
+	cfg.selfMetrics = sm
+	return nil
+}
+
+// PublishSelfMetrics writes the textfile of the self metrics of the run and pushes them, as configured
+func (rc *RunContext) PublishSelfMetrics() error {
+	rc.config.metrics.runTime.Set(time.Since(rc.start).Seconds())
+	return rc.config.publishSelfMetrics()
+}
+
+func (cfg *RunConfig) publishSelfMetrics() error {
+	sm := cfg.selfMetrics
+	if sm == nil {
+		return nil
+	}
+	cfg.metrics.setMemStats(readMemStats())
+	var errs []error
+	if sm.Textfile != Empty {
+		errs = append(errs, prometheus.WriteToTextfile(sm.Textfile, cfg.metrics.registry))
+	}
+	if sm.PushUrl != Empty {
+		errs = append(errs, push.New(sm.PushUrl, sm.PushJob).Gatherer(cfg.metrics.registry).Push())
+	}
+	return errors.Join(errs...)
+}
+
+// CloseSelfMetrics stops serving /metrics
+func (cfg *RunConfig) CloseSelfMetrics() error {
+	if cfg.selfMetrics == nil || cfg.selfMetrics.server == nil {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return cfg.selfMetrics.server.Shutdown(ctx)
+}
+
+func (m *selfMetricSet) observeQuery(entity string, pac PrometheusApiCall, platform string, d time.Duration) {
+	m.queryDuration.WithLabelValues(entity, pac.String(), platform).Observe(d.Seconds())
+}
+
+func (m *selfMetricSet) countError(ec ExitCode) {
+	m.errors.WithLabelValues(ec.String()).Inc()
+}
+
+func (m *selfMetricSet) setMemStats(memStats *runtime.MemStats) {
+	m.memAlloc.Set(float64(memStats.Alloc))
+	m.memTotal.Set(float64(memStats.TotalAlloc))
+	m.memSys.Set(float64(memStats.Sys))
+	m.memGc.Set(float64(memStats.NumGC))
+}
+
+func readMemStats() *runtime.MemStats {
+	memStats := &runtime.MemStats{}
+	runtime.ReadMemStats(memStats)
+	return memStats
+}
+
+// runEntity is the entity of the queries issued by the steps of the run (e.g. the exporter detection)
+const runEntity = "run"
+
+// countingRoundTripper counts the bytes of the response bodies
+type countingRoundTripper struct {
+	rt    http.RoundTripper
+	bytes prometheus.Counter
+}
+
+func (crt *countingRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := crt.rt.RoundTrip(req)
+	if err == nil && resp.Body != nil {
+		resp.Body = &countingReader{ReadCloser: resp.Body, bytes: crt.bytes}
+	}
+	return resp, err
+}
+
+type countingReader struct {
+	io.ReadCloser
+	bytes prometheus.Counter
+}
+
+func (cr *countingReader) Read(p []byte) (n int, err error) {
+	n, err = cr.ReadCloser.Read(p)
+	cr.bytes.Add(float64(n))
+	return
+}
+
+// selfMetricsSink counts the rows written and the write errors
+type selfMetricsSink struct {
+	Sink
+	metrics *selfMetricSet
+	rows    prometheus.Counter
+}
+
+func newSelfMetricsSink(sink Sink, spec *OutputSpec) Sink {
+	m := spec.config.metrics
+	return &selfMetricsSink{Sink: sink, metrics: m, rows: m.rowsWritten.WithLabelValues(spec.config.clusterFolder(spec.Cluster), spec.EntityKind, spec.Name)}
+}
+
+func (sms *selfMetricsSink) count(err error) error {
+	if err == nil {
+		sms.rows.Inc()
+	} else {
+		sms.metrics.countError(ExitOutput)
+	}
+	return err
+}
+
+func (sms *selfMetricsSink) WriteRecord(values ...any) error {
+	return sms.count(sms.Sink.WriteRecord(values...))
+}
+
+func (sms *selfMetricsSink) WriteSample(s *Sample) error {
+	return sms.count(sms.Sink.WriteSample(s))
+}
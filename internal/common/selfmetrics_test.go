@@ -0,0 +1,84 @@
+package common
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestSelfMetricsSink(t *testing.T) {
+	rc, other := newTestOutputRunContext(t, nil), newTestOutputRunContext(t, nil)
+	sink := newTestSink(t, rc, "Name,Cpu")
+	m := rc.config.metrics
+	if err := sink.WriteRecord("n1", 4); err != nil {
+		t.Fatal(err)
+	}
+	if err := sink.WriteRecord("n2"); err == nil {
+		t.Fatal("WriteRecord() with a missing value: expected an error")
+	}
+	_ = readSink(t, sink)
+	if got := testutil.ToFloat64(m.rowsWritten.WithLabelValues("c1", NodeEntityKind, Attributes.String())); got != 1 {
+		t.Errorf("rows written = %v, want 1", got)
+	}
+	if got := testutil.ToFloat64(m.errors.WithLabelValues(ExitOutput.String())); got != 1 {
+		t.Errorf("output errors = %v, want 1", got)
+	}
+	// the runs of another configuration count to their own metrics
+	if n, err := testutil.GatherAndCount(other.config.SelfMetricsGatherer(), selfMetricsNamespace+"_rows_written_total"); err != nil || n != 0 {
+		t.Errorf("rows written of another configuration: %d series, error %v", n, err)
+	}
+}
+
+func TestCountingRoundTripper(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, "0123456789")
+	}))
+	defer srv.Close()
+	m := newSelfMetricSet()
+	client := &http.Client{Transport: &countingRoundTripper{rt: http.DefaultTransport, bytes: m.bytesRead}}
+	resp, err := client.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	_ = resp.Body.Close()
+	if got := testutil.ToFloat64(m.bytesRead); got != 10 {
+		t.Errorf("bytes read = %v, want 10", got)
+	}
+}
+
+func TestPublishSelfMetrics(t *testing.T) {
+	var pushed string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		pushed = r.Method + " " + r.URL.Path + " " + string(b)
+	}))
+	defer srv.Close()
+	textfile := filepath.Join(t.TempDir(), "densify.prom")
+	cfg := NewRunConfig()
+	if err := cfg.SetSelfMetrics(&SelfMetrics{Textfile: textfile, PushUrl: srv.URL}); err != nil {
+		t.Fatal(err)
+	}
+	cfg.metrics.queryDuration.WithLabelValues(NodeEntityKind, ApiQueryRange.String(), "test").Observe(0)
+	if err := newTestOutputRunContext(t, cfg).PublishSelfMetrics(); err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.ReadFile(textfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"densify_collector_query_duration_seconds_count{api=", `entity="node"`, "densify_collector_memory_alloc_bytes ", "densify_collector_run_duration_seconds "} {
+		if !strings.Contains(string(b), want) {
+			t.Errorf("textfile has no %s", want)
+		}
+	}
+	if !strings.HasPrefix(pushed, "PUT /metrics/job/"+DefaultSelfMetricsJob+" ") {
+		t.Errorf("pushed %.40q, want a PUT of the job %s", pushed, DefaultSelfMetricsJob)
+	}
+}
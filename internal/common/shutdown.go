@@ -0,0 +1,176 @@
+package common
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// ErrInterrupted is the cause of the run context cancellation on shutdown
+var ErrInterrupted = errors.New("collection interrupted")
+
+// TrackedFile is a workload file which is kept open across the history loop
+type TrackedFile struct {
+	Cluster    string `json:"cluster"`
+	EntityKind string `json:"entityKind"`
+	Metric     string `json:"metric"`
+	File       string `json:"file"`
+	// Complete - the file was closed on its usual path before the run was interrupted
+	Complete bool `json:"complete"`
+	// Abandoned - the file was still being written when the run was shut down; the output has not been written,
+	// what had been written is left in its temporary file until the next run removes it
+	Abandoned bool `json:"abandoned,omitempty"`
+	Rows      int  `json:"rows"`
+	sink      Sink
+	entities  map[string]bool
+}
+
+func (rc *RunContext) trackFile(sink Sink, cluster, entityKind, metric string) {
+	tf := &TrackedFile{Cluster: rc.clusterFolder(cluster), EntityKind: entityKind, Metric: metric, File: sink.Name(), sink: sink, entities: make(map[string]bool)}
+	if rel, err := filepath.Rel(rc.rootFolder, sink.Name()); err == nil {
+		tf.File = rel
+	}
+	rc.filesMu.Lock()
+	defer rc.filesMu.Unlock()
+	rc.openFiles[sink] = tf
+}
+
+// isTrackedFile returns whether a workload output (relative to the root folder, without extension) has been
+// created by this run
+func (rc *RunContext) isTrackedFile(name string) bool {
+	rc.filesMu.Lock()
+	defer rc.filesMu.Unlock()
+	tracked := func(tf *TrackedFile) bool {
+		return strings.TrimSuffix(tf.File, filepath.Ext(tf.File)) == name
+	}
+	for _, tf := range rc.openFiles {
+		if tracked(tf) {
+			return true
+		}
+	}
+	return slices.ContainsFunc(rc.closedFiles, tracked)
+}
+
+// countRows adds rows of an entity written to a workload file; sinks other than tracked ones are ignored
+func (rc *RunContext) countRows(sink Sink, entity string, rows int) {
+	if rows == 0 {
+		return
+	}
+	rc.filesMu.Lock()
+	defer rc.filesMu.Unlock()
+	if tf, f := rc.openFiles[sink]; f {
+		tf.Rows += rows
+		tf.entities[entity] = true
+	}
+}
+
+// CloseWorkloadFile closes a workload file created by InitWorkloadFile
+func (rc *RunContext) CloseWorkloadFile(sink Sink) error {
+	rc.filesMu.Lock()
+	tf, f := rc.openFiles[sink]
+	if f {
+		delete(rc.openFiles, sink)
+		tf.Complete = !rc.Interrupted()
+		rc.closedFiles = append(rc.closedFiles, tf)
+	}
+	rc.filesMu.Unlock()
+	if !f {
+		// abandoned by AbandonOpenFiles
+		return nil
+	}
+	return sink.Close()
+}
+
+// AbandonOpenFiles marks all the workload files which are still open as abandoned; called on shutdown if the
+// stages do not drain in time. The sinks are left to the stages still writing them: their temporary files are
+// not renamed into the outputs, and closing them later is a no-op.
+func (rc *RunContext) AbandonOpenFiles() {
+	rc.filesMu.Lock()
+	defer rc.filesMu.Unlock()
+	for _, tf := range rc.openFiles {
+		tf.Abandoned = true
+		rc.closedFiles = append(rc.closedFiles, tf)
+	}
+	clear(rc.openFiles)
+}
+
+// RemoveStaleTempFiles removes the temporary files under the root folder left by earlier runs which were shut down
+// before they could finish them; those of the files being written since this run started are kept
+func (rc *RunContext) RemoveStaleTempFiles() (removed int, err error) {
+	err = filepath.WalkDir(rc.rootFolder, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if d.IsDir() || !d.Type().IsRegular() || !strings.HasPrefix(d.Name(), ".") || !strings.HasSuffix(d.Name(), tmpExt) {
+			return nil
+		}
+		if fi, err := d.Info(); err != nil || !fi.ModTime().Before(rc.start) {
+			return nil
+		}
+		if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+		removed++
+		return nil
+	})
+	return
+}
+
+// FinishOnce runs the finish sequence of the run - writing its outputs and shutting its exporters down - only
+// once: the signal handler and the main path may both get to it, the later caller waits for the first one and
+// gets its exit code
+func (rc *RunContext) FinishOnce(finish func() ExitCode) ExitCode {
+	rc.onceFinish.Do(func() { rc.exitCode = finish() })
+	return rc.exitCode
+}
+
+const (
+	RunComplete = "complete"
+	RunPartial  = "partial"
+)
+
+type RunManifest struct {
+	Version   string         `json:"collectorVersion"`
+	Status    string         `json:"status"`
+	Reason    string         `json:"reason,omitempty"`
+	StartTime time.Time      `json:"startTime"`
+	EndTime   time.Time      `json:"endTime"`
+	Stages    []*StageState  `json:"stages"`
+	Files     []*TrackedFile `json:"files"`
+}
+
+const runManifestFileName = "run-manifest.json"
+
+// WriteRunManifest writes data/run-manifest.json, listing the stages and workload files and whether each has completed;
+// the run is partial if it has been interrupted. Only the first call writes the manifest.
+func (rc *RunContext) WriteRunManifest() (err error) {
+	rc.onceManifest.Do(func() {
+		rm := &RunManifest{Version: Version, Status: RunComplete, StartTime: rc.start, EndTime: time.Now(), Stages: rc.StageStates()}
+		if rc.Interrupted() {
+			rm.Status = RunPartial
+			rm.Reason = context.Cause(rc.ctx).Error()
+		}
+		rc.filesMu.Lock()
+		rm.Files = append([]*TrackedFile{}, rc.closedFiles...)
+		for _, tf := range rc.openFiles {
+			rm.Files = append(rm.Files, tf)
+		}
+		slices.SortFunc(rm.Files, func(a, b *TrackedFile) int { return strings.Compare(a.File, b.File) })
+		var b []byte
+		b, err = json.MarshalIndent(rm, Empty, "  ")
+		rc.filesMu.Unlock()
+		if err == nil {
+			err = writeFileAtomic(filepath.Join(rc.rootFolder, runManifestFileName), b)
+		}
+	})
+	return
+}
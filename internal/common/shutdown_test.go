@@ -0,0 +1,198 @@
+package common
+
+import (
+	"encoding/json"
+	"maps"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/common/model"
+)
+
+// newTestWorkloadFile creates a workload file of cluster c1 nodes with one row
+func newTestWorkloadFile(t *testing.T, rc *RunContext, name string) Sink {
+	t.Helper()
+	csvHeaderFormat, _ := GetCsvHeaderFormat(NodeEntityKind, Metric)
+	sink := rc.InitWorkloadFile("c1", name, NodeEntityKind, csvHeaderFormat, name)
+	if sink == nil {
+		t.Fatalf("InitWorkloadFile(%s) failed", name)
+	}
+	if err := rc.WriteValues(sink, "c1", name, []string{"n1"}, []model.SamplePair{{Timestamp: 1, Value: 1}}, nil); err != nil {
+		t.Fatal(err)
+	}
+	return sink
+}
+
+func readRunManifest(t *testing.T, rc *RunContext) *RunManifest {
+	t.Helper()
+	b, err := os.ReadFile(filepath.Join(rc.rootFolder, runManifestFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rm := &RunManifest{}
+	if err = json.Unmarshal(b, rm); err != nil {
+		t.Fatal(err)
+	}
+	return rm
+}
+
+func TestRunManifestComplete(t *testing.T) {
+	rc := newTestOutputRunContext(t, nil)
+	sink := newTestWorkloadFile(t, rc, "a")
+	if err := rc.CloseWorkloadFile(sink); err != nil {
+		t.Fatal(err)
+	}
+	if err := rc.WriteRunManifest(); err != nil {
+		t.Fatal(err)
+	}
+	rm := readRunManifest(t, rc)
+	if rm.Status != RunComplete || rm.Reason != Empty {
+		t.Errorf("status = %s (%s), want %s", rm.Status, rm.Reason, RunComplete)
+	}
+	if len(rm.Files) != 1 || rm.Files[0].File != filepath.Join("c1", NodeEntityKind, "a.csv") || !rm.Files[0].Complete || rm.Files[0].Rows != 1 {
+		t.Errorf("files = %+v, want a.csv complete with 1 row", rm.Files)
+	}
+	// only the first call writes the manifest
+	rc.Interrupt("test")
+	if err := rc.WriteRunManifest(); err != nil {
+		t.Fatal(err)
+	}
+	if rm = readRunManifest(t, rc); rm.Status != RunComplete {
+		t.Errorf("manifest rewritten with status %s", rm.Status)
+	}
+}
+
+func TestRunManifestPartial(t *testing.T) {
+	rc := newTestOutputRunContext(t, nil)
+	done := newTestWorkloadFile(t, rc, "a")
+	if err := rc.CloseWorkloadFile(done); err != nil {
+		t.Fatal(err)
+	}
+	closedLate := newTestWorkloadFile(t, rc, "b")
+	newTestWorkloadFile(t, rc, "c")
+	rc.Interrupt("test")
+	// closed on its usual path after the interruption
+	if err := rc.CloseWorkloadFile(closedLate); err != nil {
+		t.Fatal(err)
+	}
+	// the stages did not drain in time
+	rc.AbandonOpenFiles()
+	if err := rc.WriteRunManifest(); err != nil {
+		t.Fatal(err)
+	}
+	rm := readRunManifest(t, rc)
+	if rm.Status != RunPartial || rm.Reason != "collection interrupted: test" {
+		t.Errorf("status = %s (%s), want %s", rm.Status, rm.Reason, RunPartial)
+	}
+	complete, abandoned := make(map[string]bool), make(map[string]bool)
+	for _, tf := range rm.Files {
+		complete[filepath.Base(tf.File)] = tf.Complete
+		abandoned[filepath.Base(tf.File)] = tf.Abandoned
+	}
+	if want := map[string]bool{"a.csv": true, "b.csv": false, "c.csv": false}; !maps.Equal(complete, want) {
+		t.Errorf("files complete = %v, want %v", complete, want)
+	}
+	if want := map[string]bool{"a.csv": false, "b.csv": false, "c.csv": true}; !maps.Equal(abandoned, want) {
+		t.Errorf("files abandoned = %v, want %v", abandoned, want)
+	}
+}
+
+func TestAbandonOpenFiles(t *testing.T) {
+	rc := newTestOutputRunContext(t, nil)
+	sink := newTestWorkloadFile(t, rc, "a")
+	rc.Interrupt("test")
+	// the stage is still writing the file
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := range 100 {
+			_ = rc.WriteValues(sink, "c1", "a", []string{"n1"}, []model.SamplePair{{Timestamp: model.Time(i), Value: 1}}, nil)
+		}
+	}()
+	rc.AbandonOpenFiles()
+	wg.Wait()
+	// the collector closing it later is a no-op
+	if err := rc.CloseWorkloadFile(sink); err != nil {
+		t.Errorf("CloseWorkloadFile() after AbandonOpenFiles() error = %v", err)
+	}
+	if !rc.isTrackedFile(filepath.Join("c1", NodeEntityKind, "a")) {
+		t.Error("file abandoned on shutdown no longer tracked")
+	}
+	dir := filepath.Join(rc.rootFolder, "c1", NodeEntityKind)
+	if _, err := os.Stat(filepath.Join(dir, "a.csv")); !os.IsNotExist(err) {
+		t.Errorf("abandoned output written, stat error = %v", err)
+	}
+	if tmps, _ := filepath.Glob(filepath.Join(dir, ".a.csv.*"+tmpExt)); len(tmps) != 1 {
+		t.Errorf("temporary files = %v, want 1", tmps)
+	}
+}
+
+func TestRemoveStaleTempFiles(t *testing.T) {
+	rc := newTestOutputRunContext(t, nil)
+	dir := filepath.Join(rc.rootFolder, "c1", NodeEntityKind)
+	stale := filepath.Join(dir, ".a.csv.123"+tmpExt)
+	if err := os.WriteFile(stale, []byte("x"), logFilePerm); err != nil {
+		t.Fatal(err)
+	}
+	before := rc.start.Add(-time.Minute)
+	if err := os.Chtimes(stale, before, before); err != nil {
+		t.Fatal(err)
+	}
+	// a file of this run being written, and outputs, are kept
+	sink := newTestWorkloadFile(t, rc, "b")
+	defer func() { _ = rc.CloseWorkloadFile(sink) }()
+	kept := filepath.Join(dir, "a.csv")
+	if err := os.WriteFile(kept, []byte("x"), logFilePerm); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(kept, before, before); err != nil {
+		t.Fatal(err)
+	}
+	if removed, err := rc.RemoveStaleTempFiles(); err != nil || removed != 1 {
+		t.Fatalf("RemoveStaleTempFiles() = %d, %v, want 1", removed, err)
+	}
+	if _, err := os.Stat(stale); !os.IsNotExist(err) {
+		t.Errorf("stale temporary file kept, stat error = %v", err)
+	}
+	if _, err := os.Stat(kept); err != nil {
+		t.Errorf("output removed: %v", err)
+	}
+	if tmps, _ := filepath.Glob(filepath.Join(dir, ".b.csv.*"+tmpExt)); len(tmps) != 1 {
+		t.Errorf("temporary files of the run = %v, want 1", tmps)
+	}
+}
+
+func TestFinishOnce(t *testing.T) {
+	rc := newTestRunContext(t, nil)
+	var calls atomic.Int32
+	release := make(chan struct{})
+	finish := func() ExitCode {
+		calls.Add(1)
+		<-release
+		return ExitInterrupted
+	}
+	var wg sync.WaitGroup
+	codes := make([]ExitCode, 2)
+	for i := range codes {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			codes[i] = rc.FinishOnce(finish)
+		}()
+	}
+	close(release)
+	wg.Wait()
+	if n := calls.Load(); n != 1 {
+		t.Errorf("finish called %d times, want 1", n)
+	}
+	for _, code := range codes {
+		if code != ExitInterrupted {
+			t.Errorf("FinishOnce() = %v, want %v", code, ExitInterrupted)
+		}
+	}
+}
@@ -0,0 +1,239 @@
+package common
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/prometheus/common/model"
+)
+
+// Sink receives the structured records of an output - the config, attributes or a workload metric of an
+// entity kind of a cluster. The collectors only produce records; the sink owns the encoding and the
+// destination (the CSV files being one implementation).
+type Sink interface {
+	// Name is the destination of the output, e.g. the file name
+	Name() string
+	// WriteRecord writes a config or attributes record, with a value per column
+	WriteRecord(values ...any) error
+	// WriteSample writes a workload record
+	WriteSample(s *Sample) error
+	Close() error
+}
+
+// OutputSpec identifies an output and its columns
+type OutputSpec struct {
+	Cluster    string
+	EntityKind string
+	// Name is the output name, without any extension
+	Name    string
+	Columns []string
+	// Schema describes the columns, the rows are validated against it if set
+	Schema *Schema
+	ctx    context.Context
+	// folder is the root folder of the run the output is written by
+	folder string
+	// config is the configuration of the run the output is written by
+	config *RunConfig
+}
+
+// Context is the context of the run the output is written by, to be used for any call made by its sink
+func (spec *OutputSpec) Context() context.Context {
+	if spec.ctx == nil {
+		return context.Background()
+	}
+	return spec.ctx
+}
+
+// createFile creates the file of the output, with its extension, under the folder of its cluster and entity kind
+func (spec *OutputSpec) createFile(ext string, appendable bool) (*atomicFile, bool, error) {
+	fileName := filepath.Join(spec.folder, spec.config.clusterFolder(spec.Cluster), spec.EntityKind, spec.Name+ext)
+	return createAtomicFile(fileName, spec.config.existingPolicy, appendable)
+}
+
+// Sample is a workload record: the identity of the entity (the values of the entity columns, starting
+// with the cluster name), the time of the sample and the value(s) of the metric
+type Sample struct {
+	Entity []string
+	Time   model.Time
+	Metric string
+	Values []any
+}
+
+// LabelMap is a record value holding the labels of an entity; the keys in Reject are left out
+type LabelMap struct {
+	Map    LabelValues
+	Reject map[string]bool
+}
+
+// Record values are strings, numbers, bools, time.Time, LabelMap, json.RawMessage or nil for an unknown value
+
+type SinkFactory func(spec *OutputSpec) (Sink, error)
+
+const (
+	CsvFormat         = "csv"
+	ParquetFormat     = "parquet"
+	JsonlFormat       = "jsonl"
+	OtlpFormat        = "otlp"
+	RemoteWriteFormat = "remote-write"
+)
+
+var sinkFactories = map[string]SinkFactory{
+	CsvFormat:         newCsvSink,
+	ParquetFormat:     newParquetSink,
+	JsonlFormat:       newJsonlSink,
+	OtlpFormat:        newOtlpSink,
+	RemoteWriteFormat: newRemoteWriteSink,
+}
+
+// SetOutputFormats sets the formats each output is written in, CSV by default
+func (cfg *RunConfig) SetOutputFormats(formats ...string) error {
+	if len(formats) == 0 {
+		return fmt.Errorf("no output format")
+	}
+	for _, format := range formats {
+		if _, f := sinkFactories[format]; !f {
+			return fmt.Errorf("unknown output format %s, supported: %s", format, strings.Join(SortedKeySet(sinkFactories), Comma))
+		}
+	}
+	cfg.outputFormats = formats
+	return nil
+}
+
+// SetSinkFactories sets the factories of the sinks each output of the run is written to, instead of the output
+// formats; none restores the output formats
+func (rc *RunContext) SetSinkFactories(factories ...SinkFactory) {
+	rc.sinkFactories = factories
+}
+
+// NewSink creates the sink of an output of the run, writing to all the output formats
+func (rc *RunContext) NewSink(spec *OutputSpec) (sink Sink, err error) {
+	spec.ctx, spec.folder, spec.config = rc.ctx, rc.rootFolder, rc.config
+	if spec.Schema != nil {
+		if err = rc.publishSchema(spec.Schema); err != nil {
+			return
+		}
+	}
+	if sink, err = rc.newFormatSinks(spec); err != nil {
+		return
+	}
+	if p := rc.config.pseudonyms; p != nil {
+		sink = &pseudonymSink{Sink: sink, spec: spec, pseudonyms: p}
+	}
+	if lp := rc.config.labelPolicy; lp != nil {
+		sink = &labelPolicySink{Sink: sink, entityKind: spec.EntityKind, policy: lp}
+	}
+	if spec.Schema != nil {
+		sink = &schemaSink{Sink: sink, schema: spec.Schema}
+	}
+	if rc.config.tracing != nil {
+		sink = newTraceSink(sink, spec)
+	}
+	sink = newSelfMetricsSink(sink, spec)
+	return
+}
+
+func (rc *RunContext) newFormatSinks(spec *OutputSpec) (Sink, error) {
+	factories := rc.sinkFactories
+	if len(factories) == 0 {
+		for _, format := range rc.config.outputFormats {
+			factories = append(factories, sinkFactories[format])
+		}
+	}
+	if len(factories) == 1 {
+		return factories[0](spec)
+	}
+	ms := &multiSink{sinks: make([]Sink, 0, len(factories))}
+	for _, factory := range factories {
+		sink, err := factory(spec)
+		if err != nil {
+			_ = ms.Close()
+			return nil, err
+		}
+		ms.sinks = append(ms.sinks, sink)
+	}
+	return ms, nil
+}
+
+// multiSink writes the records to several sinks, it is named after the first one; it is used by pointer, as the
+// sinks of a run are tracked by their identity
+type multiSink struct {
+	sinks []Sink
+}
+
+func (ms *multiSink) Name() string {
+	return ms.sinks[0].Name()
+}
+
+func (ms *multiSink) WriteRecord(values ...any) error {
+	for _, sink := range ms.sinks {
+		if err := sink.WriteRecord(values...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (ms *multiSink) WriteSample(s *Sample) error {
+	for _, sink := range ms.sinks {
+		if err := sink.WriteSample(s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (ms *multiSink) Close() error {
+	var errs []error
+	for _, sink := range ms.sinks {
+		errs = append(errs, sink.Close())
+	}
+	return errors.Join(errs...)
+}
+
+// NewSchemaSink creates the sink of an output of a cluster described by the schema
+func (rc *RunContext) NewSchemaSink(cluster string, s *Schema) (Sink, error) {
+	return rc.NewSink(&OutputSpec{Cluster: cluster, EntityKind: s.EntityKind, Name: s.Name, Columns: s.ColumnNames(), Schema: s})
+}
+
+// newWorkloadSink creates the sink of a workload output, with the columns of the CSV header format
+func (rc *RunContext) newWorkloadSink(cluster, entityKind, name, csvHeaderFormat, metricName string) (Sink, error) {
+	return rc.NewSchemaSink(cluster, newWorkloadSchema(entityKind, name, csvHeaderFormat, metricName))
+}
+
+// KnownValue returns the value as a record value, nil if unknown
+func KnownValue[T Number](n T) any {
+	return ConditionalValue(n, KnownValueFunc)
+}
+
+// PositiveValue returns the value as a record value, nil if not positive
+func PositiveValue[T Number](n T) any {
+	return ConditionalValue(n, PositiveValueFunc)
+}
+
+func ConditionalValue[T Number](n T, f ValueFunc[T]) (v any) {
+	if f(n) {
+		v = n
+	}
+	return
+}
+
+// KnownValues returns the values as record values, nil for the unknown ones
+func KnownValues[T Number](ns ...T) []any {
+	vs := make([]any, len(ns))
+	for i, n := range ns {
+		vs[i] = KnownValue(n)
+	}
+	return vs
+}
+
+// TimeValue returns the time as a record value, nil if not set
+func TimeValue(t *time.Time) (v any) {
+	if !(t == nil || t.IsZero()) {
+		v = *t
+	}
+	return
+}
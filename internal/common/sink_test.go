@@ -0,0 +1,53 @@
+package common
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestMultiFormatWorkloadFile checks a workload file written in several formats is tracked and closed like one
+func TestMultiFormatWorkloadFile(t *testing.T) {
+	cfg := NewRunConfig()
+	if err := cfg.SetOutputFormats(CsvFormat, JsonlFormat); err != nil {
+		t.Fatal(err)
+	}
+	rc := newTestOutputRunContext(t, cfg)
+	sink := newTestWorkloadFile(t, rc, "a")
+	if !rc.isTrackedFile(filepath.Join("c1", NodeEntityKind, "a")) {
+		t.Error("workload file not tracked")
+	}
+	if err := rc.CloseWorkloadFile(sink); err != nil {
+		t.Fatal(err)
+	}
+	for _, ext := range []string{fileExt, ".jsonl"} {
+		b, err := os.ReadFile(filepath.Join(rc.rootFolder, "c1", NodeEntityKind, "a"+ext))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(string(b), "n1") {
+			t.Errorf("a%s = %q, want the row of n1", ext, b)
+		}
+	}
+	if files := rc.trackedCsvSummaries(); files[filepath.Join("c1", NodeEntityKind, "a.csv")].Rows != 1 {
+		t.Errorf("tracked files = %v, want a.csv with 1 row", files)
+	}
+}
+
+func TestMultiSinkComparable(t *testing.T) {
+	cfg := NewRunConfig()
+	if err := cfg.SetOutputFormats(CsvFormat, JsonlFormat); err != nil {
+		t.Fatal(err)
+	}
+	rc := newTestOutputRunContext(t, cfg)
+	sink, err := rc.newFormatSinks(&OutputSpec{Cluster: "c1", EntityKind: NodeEntityKind, Name: "a", Columns: []string{"Name"}, folder: rc.rootFolder, config: rc.config})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = sink.Close() }()
+	// the sinks are tracked by identity, undecorated ones included
+	if tracked := map[Sink]bool{sink: true}; !tracked[sink] {
+		t.Error("multi-format sink not found by identity")
+	}
+}
@@ -0,0 +1,174 @@
+package common
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Stage is a collector with explicit dependencies on other stages; a stage starts only once all
+// the stages it depends on have finished (or have been skipped)
+type Stage struct {
+	Name      string
+	DependsOn []string
+	// Skip - the stage does not run, but still satisfies the stages depending on it
+	Skip bool
+	Run  func(rc *RunContext)
+}
+
+type StageStatus string
+
+const (
+	StagePending     StageStatus = "pending"
+	StageRunning     StageStatus = "running"
+	StageCompleted   StageStatus = "completed"
+	StageSkipped     StageStatus = "skipped"
+	StageInterrupted StageStatus = "interrupted"
+)
+
+type StageState struct {
+	Name   string      `json:"name"`
+	Status StageStatus `json:"status"`
+}
+
+func (rc *RunContext) setStageStatus(ss *StageState, status StageStatus) {
+	rc.stageStatesMu.Lock()
+	defer rc.stageStatesMu.Unlock()
+	ss.Status = status
+}
+
+// StageStates returns a snapshot of the status of the stages of the run, in topological order
+func (rc *RunContext) StageStates() []*StageState {
+	rc.stageStatesMu.Lock()
+	defer rc.stageStatesMu.Unlock()
+	states := make([]*StageState, len(rc.stageStates))
+	for i, ss := range rc.stageStates {
+		states[i] = &StageState{Name: ss.Name, Status: ss.Status}
+	}
+	return states
+}
+
+func (s *Stage) run(rc *RunContext, ss *StageState) {
+	if s.Skip {
+		rc.setStageStatus(ss, StageSkipped)
+		rc.LogAll(1, Info, "Skipping %s stage", s.Name)
+		return
+	}
+	if rc.Interrupted() {
+		// leave it pending
+		return
+	}
+	rc.setStageStatus(ss, StageRunning)
+	rc.LogAll(1, Info, "stage=%s started", s.Name)
+	start := time.Now()
+	src, sp := rc.stageContext(s.Name)
+	// a fatal failure of an embedded run ends the stage and interrupts the run
+	err := src.recoverRun(s.Run)
+	sp.end(err)
+	rc.config.metrics.stageTime.WithLabelValues(s.Name).Set(time.Since(start).Seconds())
+	if rc.Interrupted() {
+		rc.setStageStatus(ss, StageInterrupted)
+		rc.LogAll(1, Warn, "stage=%s interrupted after %v", s.Name, time.Since(start).Round(time.Millisecond))
+	} else {
+		rc.setStageStatus(ss, StageCompleted)
+		rc.LogAll(1, Info, "stage=%s finished in %v", s.Name, time.Since(start).Round(time.Millisecond))
+	}
+}
+
+// OrderStages validates the dependency graph and returns the stages in a topological order,
+// keeping the declaration order among independent stages
+func OrderStages(stages []*Stage) ([]*Stage, error) {
+	byName := make(map[string]*Stage, len(stages))
+	for _, s := range stages {
+		if _, f := byName[s.Name]; f {
+			return nil, fmt.Errorf("duplicate stage %s", s.Name)
+		}
+		byName[s.Name] = s
+	}
+	for _, s := range stages {
+		for _, dep := range s.DependsOn {
+			if _, f := byName[dep]; !f {
+				return nil, fmt.Errorf("stage %s depends on unknown stage %s", s.Name, dep)
+			}
+		}
+	}
+	ordered := make([]*Stage, 0, len(stages))
+	done := make(map[string]bool, len(stages))
+	for len(ordered) < len(stages) {
+		progress := false
+		// the first stage, in declaration order, whose dependencies are all done
+		for _, s := range stages {
+			if !done[s.Name] && allDone(s.DependsOn, done) {
+				ordered = append(ordered, s)
+				done[s.Name] = true
+				progress = true
+				break
+			}
+		}
+		if !progress {
+			var pending []string
+			for _, s := range stages {
+				if !done[s.Name] {
+					pending = append(pending, s.Name)
+				}
+			}
+			return nil, fmt.Errorf("dependency cycle between stages %s", JoinComma(pending...))
+		}
+	}
+	return ordered, nil
+}
+
+func allDone(names []string, done map[string]bool) bool {
+	for _, name := range names {
+		if !done[name] {
+			return false
+		}
+	}
+	return true
+}
+
+// RunStages runs the stages respecting their dependencies; independent stages run concurrently,
+// at most parallelism at a time (no limit if parallelism is not positive). With parallelism 1 the
+// stages run one after the other in a deterministic order.
+func (rc *RunContext) RunStages(stages []*Stage, parallelism int) error {
+	ordered, err := OrderStages(stages)
+	if err != nil {
+		return err
+	}
+	states := make(map[string]*StageState, len(ordered))
+	rc.stageStatesMu.Lock()
+	rc.stageStates = make([]*StageState, len(ordered))
+	for i, s := range ordered {
+		rc.stageStates[i] = &StageState{Name: s.Name, Status: StagePending}
+		states[s.Name] = rc.stageStates[i]
+	}
+	rc.stageStatesMu.Unlock()
+	if parallelism == 1 {
+		for _, s := range ordered {
+			s.run(rc, states[s.Name])
+		}
+		return nil
+	}
+	if parallelism <= 0 {
+		parallelism = len(ordered)
+	}
+	sem := make(chan struct{}, parallelism)
+	done := make(map[string]chan struct{}, len(ordered))
+	for _, s := range ordered {
+		done[s.Name] = make(chan struct{})
+	}
+	var wg sync.WaitGroup
+	for _, s := range ordered {
+		wg.Go(func() {
+			defer close(done[s.Name])
+			for _, dep := range s.DependsOn {
+				<-done[dep]
+			}
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			s.run(rc, states[s.Name])
+		})
+	}
+	wg.Wait()
+	return nil
+}
@@ -0,0 +1,95 @@
+package common
+
+import (
+	"maps"
+	"sync"
+	"testing"
+)
+
+func TestOrderStages(t *testing.T) {
+	stages := []*Stage{
+		{Name: "c", DependsOn: []string{"b"}},
+		{Name: "a"},
+		{Name: "b", DependsOn: []string{"a"}},
+		{Name: "d"},
+	}
+	ordered, err := OrderStages(stages)
+	if err != nil {
+		t.Fatalf("OrderStages() error = %v", err)
+	}
+	var got []string
+	for _, s := range ordered {
+		got = append(got, s.Name)
+	}
+	if want := "a,b,c,d"; JoinComma(got...) != want {
+		t.Fatalf("OrderStages() = %v, want %s", got, want)
+	}
+}
+
+func TestOrderStagesInvalid(t *testing.T) {
+	for name, stages := range map[string][]*Stage{
+		"unknown":   {{Name: "a", DependsOn: []string{"b"}}},
+		"duplicate": {{Name: "a"}, {Name: "a"}},
+		"cycle":     {{Name: "a", DependsOn: []string{"b"}}, {Name: "b", DependsOn: []string{"a"}}},
+	} {
+		if _, err := OrderStages(stages); err == nil {
+			t.Errorf("OrderStages() %s: expected an error", name)
+		}
+	}
+}
+
+func TestRunStagesDependencies(t *testing.T) {
+	var mu sync.Mutex
+	finished := make(map[string]bool)
+	stage := func(name string, skip bool, deps ...string) *Stage {
+		return &Stage{Name: name, DependsOn: deps, Skip: skip, Run: func(*RunContext) {
+			mu.Lock()
+			defer mu.Unlock()
+			for _, dep := range deps {
+				if !finished[dep] {
+					t.Errorf("stage %s started before %s finished", name, dep)
+				}
+			}
+			finished[name] = true
+		}}
+	}
+	stages := []*Stage{
+		stage("kubernetes", false),
+		stage("node", true, "kubernetes"),
+		stage("node_group", false, "node"),
+		stage("container", false, "kubernetes", "node"),
+		stage("container_events", false, "container"),
+		stage("rq", false),
+	}
+	for _, parallelism := range []int{0, 1, 2} {
+		clear(finished)
+		// a skipped stage still satisfies its dependents
+		finished["node"] = true
+		if err := newTestRunContext(t, nil).RunStages(stages, parallelism); err != nil {
+			t.Fatalf("RunStages() error = %v", err)
+		}
+		if len(finished) != len(stages) {
+			t.Errorf("RunStages(%d) ran %d stages, want %d", parallelism, len(finished), len(stages))
+		}
+	}
+}
+
+func TestStageContext(t *testing.T) {
+	rc := newTestRunContext(t, nil)
+	if rc.entity != runEntity {
+		t.Errorf("run entity = %s, want %s", rc.entity, runEntity)
+	}
+	newState := func(*RunContext) map[string]string { return make(map[string]string) }
+	stage := func(name string) *Stage {
+		return &Stage{Name: name, Run: func(src *RunContext) {
+			CollectorState(src, testCollectorKey{}, newState)[name] = src.entity
+		}}
+	}
+	if err := rc.RunStages([]*Stage{stage("node"), stage("container")}, 1); err != nil {
+		t.Fatalf("RunStages() error = %v", err)
+	}
+	// the stages share the state of the run, their queries are attributed to them
+	if got, want := CollectorState(rc, testCollectorKey{}, newState), map[string]string{"node": "node", "container": "container"}; !maps.Equal(got, want) {
+		t.Errorf("stage entities = %v, want %v", got, want)
+	}
+}
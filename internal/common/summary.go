@@ -0,0 +1,287 @@
+package common
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// errNoData is the result error of a query which returned no data; such queries are counted as empty, not failed
+var errNoData = errors.New("no data returned, model.Matrix is empty")
+
+type QueryCounts struct {
+	Issued    int `json:"issued"`
+	Succeeded int `json:"succeeded"`
+	Empty     int `json:"empty"`
+	Failed    int `json:"failed"`
+}
+
+func (qc *QueryCounts) add(other *QueryCounts) {
+	qc.Issued += other.Issued
+	qc.Succeeded += other.Succeeded
+	qc.Empty += other.Empty
+	qc.Failed += other.Failed
+}
+
+type CsvSummary struct {
+	File     string `json:"file"`
+	Rows     int    `json:"rows"`
+	Entities int    `json:"entities"`
+}
+
+type ClusterSummary struct {
+	Cluster         string        `json:"cluster"`
+	Queries         QueryCounts   `json:"queries"`
+	Files           []*CsvSummary `json:"files"`
+	Warnings        []string      `json:"warnings"`
+	WarningsDropped int           `json:"warningsDropped,omitempty"`
+}
+
+// RunInfo is common to the run summary and the cluster summaries
+type RunInfo struct {
+	Version           string    `json:"collectorVersion"`
+	Status            string    `json:"status"`
+	StartTime         time.Time `json:"startTime"`
+	EndTime           time.Time `json:"endTime"`
+	WindowStart       time.Time `json:"windowStart"`
+	WindowEnd         time.Time `json:"windowEnd"`
+	PrometheusVersion string    `json:"prometheusVersion"`
+	Platform          string    `json:"platform"`
+}
+
+type RunSummary struct {
+	RunInfo
+	Queries         QueryCounts       `json:"queries"`
+	Warnings        []string          `json:"warnings"`
+	WarningsDropped int               `json:"warningsDropped,omitempty"`
+	Clusters        []*ClusterSummary `json:"clusters"`
+}
+
+type clusterRunSummary struct {
+	RunInfo
+	*ClusterSummary
+}
+
+// maxWarnings caps the warnings kept per cluster (and for the run), the rest are only counted
+const maxWarnings = 200
+
+type runStats struct {
+	queries         QueryCounts
+	warnings        []string
+	warningsDropped int
+}
+
+func (rc *RunContext) getRunStats(cluster string) *runStats {
+	rs, f := rc.stats[cluster]
+	if !f {
+		rs = &runStats{}
+		rc.stats[cluster] = rs
+	}
+	return rs
+}
+
+// countResults counts the queries issued per cluster by their outcome, for the run summaries and the self
+// metrics of the entity; a query which failed before returning any per-cluster result is counted for the run only
+func (rc *RunContext) countResults(entity string, crm ClusterResultMap, err error) {
+	if rc.config.dryRun {
+		return
+	}
+	rc.statsMu.Lock()
+	defer rc.statsMu.Unlock()
+	if err != nil && len(crm) == 0 {
+		qc := &rc.getRunStats(Empty).queries
+		qc.Issued++
+		qc.Failed++
+		rc.config.metrics.queryResults.WithLabelValues(entity, queryFailed).Inc()
+		rc.config.metrics.countError(ExitPrometheus)
+		return
+	}
+	for cluster, result := range crm {
+		qc := &rc.getRunStats(cluster).queries
+		qc.Issued++
+		switch {
+		case err != nil || (result != nil && result.Error != nil && !errors.Is(result.Error, errNoData)):
+			qc.Failed++
+			rc.config.metrics.queryResults.WithLabelValues(entity, queryFailed).Inc()
+			rc.config.metrics.countError(ExitPrometheus)
+		case result == nil || result.Matrix.Len() == 0:
+			qc.Empty++
+			rc.config.metrics.queryResults.WithLabelValues(entity, queryEmpty).Inc()
+		default:
+			qc.Succeeded++
+			rc.config.metrics.queryResults.WithLabelValues(entity, querySucceeded).Inc()
+		}
+	}
+}
+
+// recordWarning keeps a warning or error logged by the run for its summaries; cluster is empty for run-wide
+// warnings. If pseudonymized, the messages (which name the entities) are only counted.
+func (rc *RunContext) recordWarning(cluster, msg string) {
+	rc.statsMu.Lock()
+	defer rc.statsMu.Unlock()
+	rs := rc.getRunStats(cluster)
+	if len(rs.warnings) < maxWarnings && rc.config.pseudonyms == nil {
+		rs.warnings = append(rs.warnings, msg)
+	} else {
+		rs.warningsDropped++
+	}
+}
+
+const runSummaryFileName = "run-summary.json"
+
+// WriteRunSummaries writes data/run-summary.json and data/<cluster>/run-summary.json, with the query
+// outcomes, warnings and CSV row counts of the run and of each cluster. Only the first call writes the summaries.
+func (rc *RunContext) WriteRunSummaries() (err error) {
+	rc.onceSummaries.Do(func() { err = rc.writeRunSummaries() })
+	return
+}
+
+func (rc *RunContext) writeRunSummaries() error {
+	rs := &RunSummary{RunInfo: RunInfo{
+		Version:           Version,
+		Status:            RunComplete,
+		StartTime:         rc.start,
+		EndTime:           time.Now(),
+		WindowStart:       rc.windowStart(),
+		WindowEnd:         rc.currentTime,
+		PrometheusVersion: rc.prometheusVersion,
+		Platform:          rc.PlatformName(),
+	}}
+	if rc.Interrupted() {
+		rs.Status = RunPartial
+	}
+	files := rc.trackedCsvSummaries()
+	rc.statsMu.Lock()
+	global := rc.getRunStats(Empty)
+	rs.Queries = global.queries
+	rs.Warnings = slices.Clone(global.warnings)
+	rs.WarningsDropped = global.warningsDropped
+	for _, cluster := range rc.clusterNames {
+		crs := rc.getRunStats(cluster)
+		cs := &ClusterSummary{Cluster: rc.clusterFolder(cluster), Queries: crs.queries, Warnings: slices.Clone(crs.warnings), WarningsDropped: crs.warningsDropped}
+		rs.Queries.add(&cs.Queries)
+		rs.Clusters = append(rs.Clusters, cs)
+	}
+	rc.statsMu.Unlock()
+	var errs []error
+	for _, cs := range rs.Clusters {
+		cs.Files = rc.clusterCsvSummaries(cs.Cluster, files)
+		if cs.Warnings == nil {
+			cs.Warnings = []string{}
+		}
+		errs = append(errs, writeJson(filepath.Join(rc.rootFolder, cs.Cluster, runSummaryFileName), &clusterRunSummary{RunInfo: rs.RunInfo, ClusterSummary: cs}))
+	}
+	if rs.Warnings == nil {
+		rs.Warnings = []string{}
+	}
+	errs = append(errs, writeJson(filepath.Join(rc.rootFolder, runSummaryFileName), rs))
+	return errors.Join(errs...)
+}
+
+func writeJson(fileName string, v any) error {
+	b, err := json.MarshalIndent(v, Empty, "  ")
+	if err == nil {
+		err = writeFileAtomic(fileName, b)
+	}
+	return err
+}
+
+// trackedCsvSummaries returns the row and entity counts of the workload files, counted while writing them
+func (rc *RunContext) trackedCsvSummaries() map[string]*CsvSummary {
+	rc.filesMu.Lock()
+	defer rc.filesMu.Unlock()
+	m := make(map[string]*CsvSummary, len(rc.closedFiles)+len(rc.openFiles))
+	add := func(tf *TrackedFile) {
+		m[tf.File] = &CsvSummary{File: tf.File, Rows: tf.Rows, Entities: len(tf.entities)}
+	}
+	for _, tf := range rc.closedFiles {
+		add(tf)
+	}
+	for _, tf := range rc.openFiles {
+		add(tf)
+	}
+	return m
+}
+
+// clusterCsvSummaries returns the summaries of all the CSV files of the cluster; files other than
+// the workload files (config, attributes) are small and are read back to count their rows
+func (rc *RunContext) clusterCsvSummaries(cluster string, tracked map[string]*CsvSummary) []*CsvSummary {
+	summaries := []*CsvSummary{}
+	_ = filepath.WalkDir(filepath.Join(rc.rootFolder, rc.clusterFolder(cluster)), func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || filepath.Ext(path) != fileExt {
+			return nil
+		}
+		rel, _ := filepath.Rel(rc.rootFolder, path)
+		cs, f := tracked[rel]
+		if !f {
+			if cs, err = summarizeCsv(path); err != nil {
+				rc.LogError(err, ClusterFileFormat, cluster, rel)
+				return nil
+			}
+			cs.File = rel
+		}
+		summaries = append(summaries, cs)
+		return nil
+	})
+	return summaries
+}
+
+// entityColumns are the header columns which identify an entity
+var entityColumns = []string{
+	CamelCase(ClusterEntityKind, Name), CamelCase(Name), CamelCase(Namespace), CamelCase(Entity, Name), CamelCase(Entity, Type),
+	CamelCase(ContainerEntityKind, Name), CamelCase(NodeEntityKind, Name), CamelCase(NodeGroupEntityKind, Name),
+	CamelCase(RqEntityKind, Name), CamelCase(CrqEntityKind, Name), CamelCase(Hpa, Name),
+}
+
+func summarizeCsv(path string) (cs *CsvSummary, err error) {
+	var file *os.File
+	if file, err = os.Open(path); err != nil {
+		return
+	}
+	defer func() { _ = file.Close() }()
+	r := csv.NewReader(file)
+	r.FieldsPerRecord = -1
+	r.LazyQuotes = true
+	r.ReuseRecord = true
+	cs = &CsvSummary{}
+	var header []string
+	if header, err = r.Read(); err != nil {
+		if err == io.EOF {
+			err = nil
+		}
+		return
+	}
+	var idx []int
+	for i, column := range header {
+		if slices.Contains(entityColumns, column) {
+			idx = append(idx, i)
+		}
+	}
+	entities := make(map[string]bool)
+	key := make([]string, len(idx))
+	for {
+		var record []string
+		if record, err = r.Read(); err != nil {
+			if err == io.EOF {
+				err = nil
+			}
+			break
+		}
+		cs.Rows++
+		for i, j := range idx {
+			if j < len(record) {
+				key[i] = record[j]
+			}
+		}
+		entities[strings.Join(key, Comma)] = true
+	}
+	cs.Entities = len(entities)
+	return
+}
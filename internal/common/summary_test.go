@@ -0,0 +1,92 @@
+package common
+
+import (
+	"encoding/json"
+	"errors"
+	"maps"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/prometheus/common/model"
+)
+
+func readJson[T any](t *testing.T, rc *RunContext, name string) *T {
+	t.Helper()
+	b, err := os.ReadFile(filepath.Join(rc.rootFolder, name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	v := new(T)
+	if err = json.Unmarshal(b, v); err != nil {
+		t.Fatal(err)
+	}
+	return v
+}
+
+func TestWriteRunSummaries(t *testing.T) {
+	rc := newTestOutputRunContext(t, nil)
+	rc.params, rc.clusterNames, rc.currentTime = validTestParams(), []string{"c1"}, time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+
+	matrix := model.Matrix{{Metric: model.Metric{"node": "n1"}, Values: []model.SamplePair{{Timestamp: 1, Value: 1}}}}
+	rc.countResults(NodeEntityKind, ClusterResultMap{"c1": {Matrix: matrix}}, nil)
+	rc.countResults(NodeEntityKind, ClusterResultMap{"c1": {Error: errNoData}}, nil)
+	rc.countResults(NodeEntityKind, ClusterResultMap{"c1": {Error: errors.New("bad query")}}, nil)
+	rc.countResults(NodeEntityKind, nil, errors.New("connection refused"))
+	rc.recordWarning("c1", "cluster warning")
+	rc.recordWarning(Empty, "run warning")
+
+	// a workload file, counted while written: 2 rows of 1 entity
+	sink := newTestWorkloadFile(t, rc, "a")
+	if err := rc.WriteValues(sink, "c1", "a", []string{"n1"}, []model.SamplePair{{Timestamp: 2, Value: 2}}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := rc.CloseWorkloadFile(sink); err != nil {
+		t.Fatal(err)
+	}
+	// a file read back: 3 rows of 2 entities
+	attributes := filepath.Join("c1", NodeEntityKind, "attributes.csv")
+	if err := os.WriteFile(filepath.Join(rc.rootFolder, attributes), []byte("ClusterName,NodeName,X\nc1,n1,1\nc1,n1,2\nc1,n2,3\n"), logFilePerm); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := rc.WriteRunSummaries(); err != nil {
+		t.Fatal(err)
+	}
+	rs := readJson[RunSummary](t, rc, runSummaryFileName)
+	if want := (QueryCounts{Issued: 4, Succeeded: 1, Empty: 1, Failed: 2}); rs.Queries != want {
+		t.Errorf("run queries = %+v, want %+v", rs.Queries, want)
+	}
+	if rs.Status != RunComplete || len(rs.Warnings) != 1 || rs.Warnings[0] != "run warning" || len(rs.Clusters) != 1 {
+		t.Errorf("run summary = %+v, want complete with the run warning and one cluster", rs)
+	}
+	cs := readJson[clusterRunSummary](t, rc, filepath.Join("c1", runSummaryFileName))
+	if want := (QueryCounts{Issued: 3, Succeeded: 1, Empty: 1, Failed: 1}); cs.Queries != want {
+		t.Errorf("cluster queries = %+v, want %+v", cs.Queries, want)
+	}
+	if len(cs.Warnings) != 1 || cs.Warnings[0] != "cluster warning" {
+		t.Errorf("cluster warnings = %v, want [cluster warning]", cs.Warnings)
+	}
+	files := make(map[string]CsvSummary)
+	for _, f := range cs.Files {
+		files[f.File] = *f
+	}
+	workload := filepath.Join("c1", NodeEntityKind, "a.csv")
+	if want := map[string]CsvSummary{
+		workload:   {File: workload, Rows: 2, Entities: 1},
+		attributes: {File: attributes, Rows: 3, Entities: 2},
+	}; !maps.Equal(files, want) {
+		t.Errorf("cluster files = %v, want %v", files, want)
+	}
+}
+
+func TestRecordWarningCap(t *testing.T) {
+	rc := newTestRunContext(t, nil)
+	for range maxWarnings + 3 {
+		rc.recordWarning("c1", "w")
+	}
+	if rs := rc.getRunStats("c1"); len(rs.warnings) != maxWarnings || rs.warningsDropped != 3 {
+		t.Errorf("%d warnings kept and %d dropped, want %d and 3", len(rs.warnings), rs.warningsDropped, maxWarnings)
+	}
+}
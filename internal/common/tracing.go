@@ -0,0 +1,341 @@
+package common
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	v1 "github.com/prometheus/client_golang/api/prometheus/v1"
+	"github.com/prometheus/common/model"
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	resourcepb "go.opentelemetry.io/proto/otlp/resource/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+const (
+	otlpTracesPath = "/v1/traces"
+	// traceBatchSize is the number of spans exported at once
+	traceBatchSize = 512
+	traceService   = "densify-container-data-collection"
+	// traceparentHeader carries the trace context (W3C Trace Context) to Prometheus
+	traceparentHeader = "traceparent"
+)
+
+// the span attributes
+const (
+	clusterAttr     = "k8s.cluster.name"
+	entityAttr      = "densify.entity"
+	stageAttr       = "densify.stage"
+	fileAttr        = "densify.file"
+	rowsAttr        = "densify.rows"
+	queryAttr       = "db.query.text"
+	dbSystemAttr    = "db.system"
+	apiAttr         = "prometheus.api"
+	rangeStartAttr  = "prometheus.range.start"
+	rangeEndAttr    = "prometheus.range.end"
+	rangeStepAttr   = "prometheus.range.step"
+	seriesAttr      = "prometheus.series"
+	prometheusValue = "prometheus"
+)
+
+type traceExporter interface {
+	export(ctx context.Context, req *coltracepb.ExportTraceServiceRequest) error
+	close() error
+}
+
+// tracer records the spans of the runs, a trace per run, and exports them in batches
+type tracer struct {
+	config   *OtlpExport
+	exporter traceExporter
+	mu       sync.Mutex
+	spans    []*tracepb.Span
+}
+
+// SetTraceExport enables the tracing of the runs (the collection stages, the queries and the outputs written), the
+// spans being exported over OTLP; the trace context is propagated to Prometheus in the traceparent header
+func (cfg *RunConfig) SetTraceExport(oe *OtlpExport) error {
+	if err := oe.validate(); err != nil {
+		return err
+	}
+	t := &tracer{config: oe}
+	switch oe.Protocol {
+	case OtlpGrpc:
+		conn, err := oe.grpcConn()
+		if err != nil {
+			return err
+		}
+		t.exporter = &otlpGrpcTraceExporter{conn: conn, client: coltracepb.NewTraceServiceClient(conn), config: oe}
+	default:
+		t.exporter = &otlpHttpTraceExporter{oe.httpExporter(otlpTracesPath)}
+	}
+	cfg.tracing = t
+	return nil
+}
+
+// CloseTracing exports the remaining spans and closes the exporter
+func (cfg *RunConfig) CloseTracing() error {
+	t := cfg.tracing
+	if t == nil {
+		return nil
+	}
+	err := t.flush()
+	if cerr := t.exporter.close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// TracePhase runs a phase of the run (e.g. writing the bundles) in a span
+func (rc *RunContext) TracePhase(name string, phase func() error) error {
+	sp := startSpan(contextSpan(rc.ctx), name, tracepb.Span_SPAN_KIND_INTERNAL)
+	err := phase()
+	sp.end(err)
+	return err
+}
+
+// EndTrace ends the span of the run, its spans being exported by CloseTracing of its configuration at the latest
+func (rc *RunContext) EndTrace() {
+	rc.span.end(nil)
+}
+
+func randomId(n int) []byte {
+	b := make([]byte, n)
+	_, _ = rand.Read(b)
+	return b
+}
+
+// span is a span being recorded; the methods of a nil span (tracing disabled) do nothing
+type span struct {
+	tracer *tracer
+	// hideQueries - the query texts are not recorded, as they name the clusters of a pseudonymized run
+	hideQueries bool
+	traceId     []byte
+	id          []byte
+	parent      []byte
+	name        string
+	kind        tracepb.Span_SpanKind
+	start       time.Time
+	attrs       []*commonpb.KeyValue
+}
+
+// startTrace starts the root span of a new trace; nil if tracing is disabled
+func (t *tracer) startTrace(name string, hideQueries bool) *span {
+	if t == nil {
+		return nil
+	}
+	return &span{tracer: t, hideQueries: hideQueries, traceId: randomId(16), id: randomId(8), name: name, kind: tracepb.Span_SPAN_KIND_INTERNAL, start: time.Now()}
+}
+
+// startSpan starts a span, a child of parent; nil if parent is (tracing disabled)
+func startSpan(parent *span, name string, kind tracepb.Span_SpanKind) *span {
+	if parent == nil {
+		return nil
+	}
+	return &span{tracer: parent.tracer, hideQueries: parent.hideQueries, traceId: parent.traceId, id: randomId(8), parent: parent.id, name: name, kind: kind, start: time.Now()}
+}
+
+type spanKey struct{}
+
+// withSpan returns a context carrying a span, ctx if the span is nil
+func withSpan(ctx context.Context, sp *span) context.Context {
+	if sp == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, spanKey{}, sp)
+}
+
+// contextSpan returns the span carried by a context, nil if none
+func contextSpan(ctx context.Context) *span {
+	sp, _ := ctx.Value(spanKey{}).(*span)
+	return sp
+}
+
+func (sp *span) setString(key, value string) *span {
+	if sp != nil {
+		sp.attrs = append(sp.attrs, &commonpb.KeyValue{Key: key, Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: value}}})
+	}
+	return sp
+}
+
+func (sp *span) setInt(key string, value int64) *span {
+	if sp != nil {
+		sp.attrs = append(sp.attrs, &commonpb.KeyValue{Key: key, Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_IntValue{IntValue: value}}})
+	}
+	return sp
+}
+
+// setQuery records the query text, unless pseudonymized: the queries name the clusters
+func (sp *span) setQuery(query string) *span {
+	if sp != nil && !sp.hideQueries {
+		sp.setString(queryAttr, query)
+	}
+	return sp
+}
+
+// traceparent returns the W3C trace context of the span, sampled
+func (sp *span) traceparent() string {
+	return "00-" + hex.EncodeToString(sp.traceId) + "-" + hex.EncodeToString(sp.id) + "-01"
+}
+
+// end ends the span, with an error status if err is not nil, and queues it for export
+func (sp *span) end(err error) {
+	if sp == nil {
+		return
+	}
+	ps := &tracepb.Span{
+		TraceId:           sp.traceId,
+		SpanId:            sp.id,
+		ParentSpanId:      sp.parent,
+		Name:              sp.name,
+		Kind:              sp.kind,
+		StartTimeUnixNano: uint64(sp.start.UnixNano()),
+		EndTimeUnixNano:   uint64(time.Now().UnixNano()),
+		Attributes:        sp.attrs,
+	}
+	if err != nil {
+		ps.Status = &tracepb.Status{Code: tracepb.Status_STATUS_CODE_ERROR, Message: err.Error()}
+	}
+	t := sp.tracer
+	t.mu.Lock()
+	t.spans = append(t.spans, ps)
+	full := len(t.spans) >= traceBatchSize
+	t.mu.Unlock()
+	if full {
+		if err = t.flush(); err != nil {
+			LogErrorWithLevel(1, Warn, err, "Failed to export spans:")
+		}
+	}
+}
+
+func (t *tracer) flush() error {
+	t.mu.Lock()
+	spans := t.spans
+	t.spans = nil
+	t.mu.Unlock()
+	if len(spans) == 0 {
+		return nil
+	}
+	req := &coltracepb.ExportTraceServiceRequest{ResourceSpans: []*tracepb.ResourceSpans{{
+		Resource: &resourcepb.Resource{Attributes: []*commonpb.KeyValue{
+			{Key: "service.name", Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: traceService}}},
+			{Key: "service.version", Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: Version}}},
+		}},
+		ScopeSpans: []*tracepb.ScopeSpans{{Scope: &commonpb.InstrumentationScope{Name: otlpScopeName, Version: Version}, Spans: spans}},
+	}}}
+	ctx, cancel := context.WithTimeout(context.Background(), t.config.Timeout)
+	defer cancel()
+	return t.exporter.export(ctx, req)
+}
+
+// startQuerySpan starts the span of a per-cluster query, the trace context of the returned context being
+// propagated to Prometheus
+func (rc *RunContext) startQuerySpan(ctx context.Context, parent *span, cluster, query string, pac PrometheusApiCall, promRange *v1.Range) (context.Context, *span) {
+	sp := startSpan(parent, "Prometheus "+pac.String(), tracepb.Span_SPAN_KIND_CLIENT)
+	if sp == nil {
+		return ctx, nil
+	}
+	sp.setString(dbSystemAttr, prometheusValue).setString(clusterAttr, rc.clusterFolder(cluster)).setQuery(query).setString(apiAttr, pac.String())
+	if promRange != nil {
+		sp.setString(rangeEndAttr, promRange.End.UTC().Format(time.RFC3339))
+		if pac == ApiQueryRange {
+			sp.setString(rangeStartAttr, promRange.Start.UTC().Format(time.RFC3339)).setString(rangeStepAttr, promRange.Step.String())
+		}
+	}
+	return withSpan(ctx, sp), sp
+}
+
+// seriesCount returns the number of series of a query result
+func seriesCount(value model.Value) (n int) {
+	switch v := value.(type) {
+	case model.Matrix:
+		n = len(v)
+	case model.Vector:
+		n = len(v)
+	case *model.Scalar, *model.String:
+		n = 1
+	}
+	return
+}
+
+// traceRoundTripper sets the traceparent header of the requests made in a span
+type traceRoundTripper struct {
+	rt http.RoundTripper
+}
+
+func (trt *traceRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	if sp := contextSpan(req.Context()); sp != nil {
+		req = req.Clone(req.Context())
+		req.Header.Set(traceparentHeader, sp.traceparent())
+	}
+	return trt.rt.RoundTrip(req)
+}
+
+type otlpHttpTraceExporter struct {
+	*otlpHttpExporter
+}
+
+func (he *otlpHttpTraceExporter) export(ctx context.Context, req *coltracepb.ExportTraceServiceRequest) error {
+	return he.post(ctx, req)
+}
+
+type otlpGrpcTraceExporter struct {
+	conn   *grpc.ClientConn
+	client coltracepb.TraceServiceClient
+	config *OtlpExport
+}
+
+func (ge *otlpGrpcTraceExporter) export(ctx context.Context, req *coltracepb.ExportTraceServiceRequest) error {
+	if len(ge.config.Headers) > 0 {
+		ctx = metadata.NewOutgoingContext(ctx, metadata.New(ge.config.Headers))
+	}
+	_, err := ge.client.Export(ctx, req)
+	return err
+}
+
+func (ge *otlpGrpcTraceExporter) close() error {
+	return ge.conn.Close()
+}
+
+// traceSink records the writing of an output file as a span, from its creation to its closing
+type traceSink struct {
+	Sink
+	sp   *span
+	rows int64
+}
+
+func newTraceSink(sink Sink, spec *OutputSpec) Sink {
+	sp := startSpan(contextSpan(spec.Context()), "write "+spec.Name, tracepb.Span_SPAN_KIND_INTERNAL).
+		setString(clusterAttr, spec.config.clusterFolder(spec.Cluster)).setString(entityAttr, spec.EntityKind).
+		setString(fileAttr, strings.TrimPrefix(sink.Name(), spec.folder+string(filepath.Separator)))
+	return &traceSink{Sink: sink, sp: sp}
+}
+
+func (ts *traceSink) WriteRecord(values ...any) error {
+	err := ts.Sink.WriteRecord(values...)
+	if err == nil {
+		ts.rows++
+	}
+	return err
+}
+
+func (ts *traceSink) WriteSample(s *Sample) error {
+	err := ts.Sink.WriteSample(s)
+	if err == nil {
+		ts.rows++
+	}
+	return err
+}
+
+func (ts *traceSink) Close() error {
+	err := ts.Sink.Close()
+	ts.sp.setInt(rowsAttr, ts.rows).end(err)
+	return err
+}
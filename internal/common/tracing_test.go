@@ -0,0 +1,133 @@
+package common
+
+import (
+	"context"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+// newTestTraceReceiver returns an OTLP/HTTP receiver collecting the spans exported to it
+func newTestTraceReceiver(t *testing.T) (*httptest.Server, func() map[string]*tracepb.Span) {
+	t.Helper()
+	var mu sync.Mutex
+	spans := make(map[string]*tracepb.Span)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != otlpTracesPath {
+			http.NotFound(w, r)
+			return
+		}
+		b, _ := io.ReadAll(r.Body)
+		req := &coltracepb.ExportTraceServiceRequest{}
+		if err := proto.Unmarshal(b, req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		for _, rs := range req.ResourceSpans {
+			for _, ss := range rs.ScopeSpans {
+				for _, sp := range ss.Spans {
+					spans[sp.Name] = sp
+				}
+			}
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv, func() map[string]*tracepb.Span {
+		mu.Lock()
+		defer mu.Unlock()
+		return spans
+	}
+}
+
+func TestTracing(t *testing.T) {
+	srv, received := newTestTraceReceiver(t)
+	cfg := NewRunConfig()
+	if err := cfg.SetTraceExport(&OtlpExport{Endpoint: srv.URL, Protocol: OtlpHttp}); err != nil {
+		t.Fatal(err)
+	}
+	rc := newTestOutputRunContext(t, cfg)
+	var traceparent string
+	stages := []*Stage{{Name: "node", Run: func(src *RunContext) {
+		_ = src.TracePhase("phase", func() error {
+			ctx, qs := src.startQuerySpan(context.Background(), contextSpan(src.Context()), "c1", "up", ApiQuery, nil)
+			req, _ := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL, nil)
+			rt := &traceRoundTripper{rt: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+				traceparent = r.Header.Get(traceparentHeader)
+				return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody}, nil
+			})}
+			_, _ = rt.RoundTrip(req)
+			qs.setInt(seriesAttr, 1).end(nil)
+			return nil
+		})
+		sink, err := src.NewSink(&OutputSpec{Cluster: "c1", EntityKind: NodeEntityKind, Name: Attributes.String(), Columns: []string{"Name", "Cpu"}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = sink.WriteRecord("n1", 4); err != nil {
+			t.Fatal(err)
+		}
+		_ = readSink(t, sink)
+	}}}
+	if err := rc.RunStages(stages, 1); err != nil {
+		t.Fatal(err)
+	}
+	rc.EndTrace()
+	// another run is another trace
+	other := newTestRunContext(t, cfg)
+	other.EndTrace()
+	if err := cfg.CloseTracing(); err != nil {
+		t.Fatal(err)
+	}
+	spans := received()
+	if sp := spans["node"]; sp == nil || string(sp.ParentSpanId) != string(rc.span.id) {
+		t.Error("span node: not a child of the run span")
+	}
+	parents := map[string]string{"phase": "node", "Prometheus Query": "node", "write attributes": "node"}
+	for name, parent := range parents {
+		sp, f := spans[name]
+		if !f {
+			t.Errorf("no span %s, got %v", name, spans)
+			continue
+		}
+		if p := spans[parent]; p == nil || string(sp.ParentSpanId) != string(p.SpanId) {
+			t.Errorf("span %s: not a child of %s", name, parent)
+		}
+		if string(sp.TraceId) != string(rc.span.traceId) {
+			t.Errorf("span %s: not in the trace of the run", name)
+		}
+	}
+	if string(other.span.traceId) == string(rc.span.traceId) {
+		t.Error("runs share a trace")
+	}
+	if qs := spans["Prometheus Query"]; qs != nil && !strings.HasSuffix(traceparent, "-"+hex.EncodeToString(qs.SpanId)+"-01") {
+		t.Errorf("traceparent = %s, want the query span", traceparent)
+	}
+	if ws := spans["write attributes"]; ws != nil && !hasIntAttr(ws, rowsAttr, 1) {
+		t.Errorf("write span attributes = %v, want 1 row", ws.Attributes)
+	}
+}
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
+
+func hasIntAttr(sp *tracepb.Span, key string, value int64) bool {
+	for _, kv := range sp.Attributes {
+		if kv.Key == key {
+			return kv.Value.GetIntValue() == value
+		}
+	}
+	return false
+}
@@ -0,0 +1,237 @@
+package common
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/feature/s3/transfermanager"
+	tmtypes "github.com/aws/aws-sdk-go-v2/feature/s3/transfermanager/types"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// S3Upload configures the upload of the outputs (or the bundles) to an S3-compatible object storage after
+// the collection; the credentials are taken from the default AWS chain (environment, shared files, IAM role)
+type S3Upload struct {
+	Bucket string
+	// Prefix is the template of the key prefix, with the fields Cluster (empty for the run files), Date and RunId
+	Prefix   string
+	Endpoint string
+	Region   string
+	// PathStyle addresses the bucket in the path (as required by most S3-compatible stores), not in the host name
+	PathStyle bool
+	// Sse is the server-side encryption: AES256, aws:kms or aws:kms:dsse (none by default)
+	Sse         string
+	SseKmsKeyId string
+	// PartSizeMiB is the part size of the multipart uploads, done for files larger than twice the part size
+	PartSizeMiB int
+	MaxAttempts int
+	prefix      *template.Template
+}
+
+const (
+	DefaultS3Prefix   = "{{.Cluster}}/{{.Date}}/{{.RunId}}"
+	DefaultS3Region   = "us-east-1"
+	DefaultS3PartSize = 8
+	DefaultS3Attempts = 5
+	minS3PartSize     = 5
+	sha256MetadataKey = "sha256"
+	mib               = 1024 * 1024
+)
+
+var sses = []string{string(tmtypes.ServerSideEncryptionAes256), string(tmtypes.ServerSideEncryptionAwsKms), string(tmtypes.ServerSideEncryptionAwsKmsDsse)}
+
+// SetS3Upload enables the upload, if the bucket is set
+func (cfg *RunConfig) SetS3Upload(u *S3Upload) (err error) {
+	if u.Bucket == Empty {
+		return
+	}
+	if u.Sse != Empty && !slices.Contains(sses, u.Sse) {
+		return fmt.Errorf("unknown server-side encryption %s, supported: %s", u.Sse, strings.Join(sses, Comma))
+	}
+	if u.PartSizeMiB < minS3PartSize {
+		return fmt.Errorf("part size %d MiB is below the S3 minimum of %d MiB", u.PartSizeMiB, minS3PartSize)
+	}
+	if u.prefix, err = template.New("prefix").Option("missingkey=error").Parse(u.Prefix); err != nil {
+		return
+	}
+	// check the template fields
+	if _, err = u.keyPrefix(Empty, time.Time{}, Empty); err == nil {
+		cfg.s3Upload = u
+	}
+	return
+}
+
+type s3PrefixFields struct {
+	Cluster string
+	Date    string
+	RunId   string
+}
+
+// keyPrefix returns the key prefix of the files of a cluster, by its folder (empty for the run files)
+func (u *S3Upload) keyPrefix(clusterFolder string, date time.Time, runId string) (string, error) {
+	var sb strings.Builder
+	if err := u.prefix.Execute(&sb, &s3PrefixFields{Cluster: clusterFolder, Date: date.UTC().Format(time.DateOnly), RunId: runId}); err != nil {
+		return Empty, err
+	}
+	// no empty path elements (e.g. the cluster of the run files)
+	return strings.Trim(path.Clean("/"+sb.String()), "/"), nil
+}
+
+// s3Object is a file to upload and its key
+type s3Object struct {
+	file string
+	key  string
+	// sha256 of a bundle, kept in the object metadata
+	sha256 string
+}
+
+// UploadToS3 uploads the bundles, or else the output trees of the clusters and the run files
+func (rc *RunContext) UploadToS3() error {
+	u := rc.config.s3Upload
+	if u == nil {
+		return nil
+	}
+	if rc.Interrupted() {
+		rc.LogAll(1, Warn, "Collection interrupted, partial data not uploaded")
+		return nil
+	}
+	objects, err := rc.s3Objects(u)
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+	var client *s3.Client
+	if client, err = u.newClient(ctx); err != nil {
+		return err
+	}
+	tm := transfermanager.New(client, func(o *transfermanager.Options) {
+		o.PartSizeBytes = int64(u.PartSizeMiB) * mib
+		o.MultipartUploadThreshold = 2 * o.PartSizeBytes
+		o.RequestChecksumCalculation = aws.RequestChecksumCalculationWhenRequired
+	})
+	var errs []error
+	var n int
+	for _, obj := range objects {
+		if err = u.upload(ctx, tm, obj); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", obj.file, err))
+			rc.config.metrics.countError(ExitOutput)
+		} else {
+			n++
+		}
+	}
+	rc.LogAll(1, Info, "Uploaded %d of %d files to bucket %s", n, len(objects), u.Bucket)
+	return errors.Join(errs...)
+}
+
+func (u *S3Upload) newClient(ctx context.Context) (*s3.Client, error) {
+	region := u.Region
+	if region == Empty {
+		region = DefaultS3Region
+	}
+	cfg, err := config.LoadDefaultConfig(ctx, config.WithRegion(region), config.WithRetryMaxAttempts(u.MaxAttempts),
+		config.WithRequestChecksumCalculation(aws.RequestChecksumCalculationWhenRequired))
+	if err != nil {
+		return nil, err
+	}
+	return s3.NewFromConfig(cfg, func(o *s3.Options) {
+		if u.Endpoint != Empty {
+			o.BaseEndpoint = aws.String(u.Endpoint)
+		}
+		o.UsePathStyle = u.PathStyle
+	}), nil
+}
+
+// upload uploads the file
+func (u *S3Upload) upload(ctx context.Context, tm *transfermanager.Client, obj *s3Object) error {
+	file, err := os.Open(obj.file)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = file.Close() }()
+	input := &transfermanager.UploadObjectInput{Bucket: aws.String(u.Bucket), Key: aws.String(obj.key), Body: file}
+	if obj.sha256 != Empty {
+		input.Metadata = map[string]string{sha256MetadataKey: obj.sha256}
+	}
+	if u.Sse != Empty {
+		input.ServerSideEncryption = tmtypes.ServerSideEncryption(u.Sse)
+		if u.SseKmsKeyId != Empty {
+			input.SSEKMSKeyID = aws.String(u.SseKmsKeyId)
+		}
+	}
+	_, err = tm.UploadObject(ctx, input)
+	return err
+}
+
+// s3Objects lists the files to upload: the bundles (with their checksums) if any, or else the files under
+// data/<cluster> keyed by their path in the cluster folder, and the run files
+func (rc *RunContext) s3Objects(u *S3Upload) (objects []*s3Object, err error) {
+	switch rc.config.bundleScope {
+	case BundleCluster:
+		for _, cluster := range rc.clusterNames {
+			folder := rc.clusterFolder(cluster)
+			if objects, err = rc.appendBundleObjects(u, objects, folder, folder); err != nil {
+				return
+			}
+		}
+		return
+	case BundleRun:
+		return rc.appendBundleObjects(u, objects, runBundleName, Empty)
+	}
+	for _, cluster := range rc.clusterNames {
+		folder := rc.clusterFolder(cluster)
+		var prefix string
+		if prefix, err = u.keyPrefix(folder, rc.currentTime, rc.RunId()); err != nil {
+			return
+		}
+		dir := filepath.Join(rc.rootFolder, folder)
+		if err = filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() || strings.HasSuffix(p, tmpExt) || rc.config.isLocalOnly(p) {
+				return err
+			}
+			rel, _ := filepath.Rel(dir, p)
+			objects = append(objects, &s3Object{file: p, key: path.Join(prefix, filepath.ToSlash(rel))})
+			return nil
+		}); err != nil {
+			return
+		}
+	}
+	var prefix string
+	if prefix, err = u.keyPrefix(Empty, rc.currentTime, rc.RunId()); err != nil {
+		return
+	}
+	for _, name := range []string{runManifestFileName, runSummaryFileName, schemasFileName} {
+		p := filepath.Join(rc.rootFolder, name)
+		if _, e := os.Stat(p); e == nil {
+			objects = append(objects, &s3Object{file: p, key: path.Join(prefix, name)})
+		}
+	}
+	return
+}
+
+func (rc *RunContext) appendBundleObjects(u *S3Upload, objects []*s3Object, name, clusterFolder string) ([]*s3Object, error) {
+	prefix, err := u.keyPrefix(clusterFolder, rc.currentTime, rc.RunId())
+	if err != nil {
+		return objects, err
+	}
+	fileName := rc.bundleFileName(name)
+	var sum []byte
+	if sum, err = os.ReadFile(fileName + checksumExt); err != nil {
+		return objects, err
+	}
+	sha256, _, _ := strings.Cut(string(sum), Space)
+	return append(objects,
+		&s3Object{file: fileName, key: path.Join(prefix, filepath.Base(fileName)), sha256: sha256},
+		&s3Object{file: fileName + checksumExt, key: path.Join(prefix, filepath.Base(fileName)+checksumExt)},
+	), nil
+}
@@ -0,0 +1,102 @@
+package common
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeS3 is a minimal S3-compatible stand-in, keeping the objects put (path-style) in memory
+type fakeS3 struct {
+	mu       sync.Mutex
+	objects  map[string]string
+	metadata map[string]string
+	puts     int
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	switch r.Method {
+	case http.MethodPut:
+		b, _ := io.ReadAll(r.Body)
+		f.objects[r.URL.Path] = string(b)
+		f.metadata[r.URL.Path] = r.Header.Get("X-Amz-Meta-" + sha256MetadataKey)
+		f.puts++
+		w.Header().Set("ETag", `"etag"`)
+	default:
+		w.WriteHeader(http.StatusNotImplemented)
+	}
+}
+
+// setTestS3Upload uploads to a fake S3 the data of the run, of cluster c1 and ending 2024-05-01 10:00
+func setTestS3Upload(t *testing.T, rc *RunContext) *fakeS3 {
+	t.Helper()
+	f := &fakeS3{objects: make(map[string]string), metadata: make(map[string]string)}
+	srv := httptest.NewServer(f)
+	t.Cleanup(srv.Close)
+	for k, v := range map[string]string{
+		"AWS_ACCESS_KEY_ID": "key", "AWS_SECRET_ACCESS_KEY": "secret", "AWS_EC2_METADATA_DISABLED": "true",
+		"AWS_CONFIG_FILE": filepath.Join(t.TempDir(), "none"), "AWS_SHARED_CREDENTIALS_FILE": filepath.Join(t.TempDir(), "none"),
+	} {
+		t.Setenv(k, v)
+	}
+	rc.clusterNames, rc.currentTime = []string{"c1"}, time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	u := &S3Upload{Bucket: "b", Prefix: DefaultS3Prefix, Endpoint: srv.URL, PathStyle: true, PartSizeMiB: DefaultS3PartSize, MaxAttempts: 1}
+	if err := rc.config.SetS3Upload(u); err != nil {
+		t.Fatal(err)
+	}
+	return f
+}
+
+func TestUploadToS3(t *testing.T) {
+	rc := newTestOutputRunContext(t, nil)
+	f := setTestS3Upload(t, rc)
+	for name, content := range map[string]string{
+		filepath.Join("c1", NodeEntityKind, "attributes.csv"): "Name\nn1\n",
+		runSummaryFileName: "{}",
+	} {
+		if err := os.WriteFile(filepath.Join(rc.rootFolder, name), []byte(content), logFilePerm); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := rc.UploadToS3(); err != nil {
+		t.Fatalf("UploadToS3() error = %v", err)
+	}
+	prefix := "/b/c1/2024-05-01/" + rc.RunId() + "/"
+	if got := f.objects[prefix+"node/attributes.csv"]; got != "Name\nn1\n" {
+		t.Errorf("attributes object = %q, objects: %v", got, f.objects)
+	}
+	if got := f.objects["/b/2024-05-01/"+rc.RunId()+"/"+runSummaryFileName]; got != "{}" {
+		t.Errorf("run summary object = %q, objects: %v", got, f.objects)
+	}
+}
+
+func TestUploadBundleToS3(t *testing.T) {
+	cfg := NewRunConfig()
+	if err := cfg.SetBundle(BundleCluster, Gzip); err != nil {
+		t.Fatal(err)
+	}
+	rc := newTestOutputRunContext(t, cfg)
+	f := setTestS3Upload(t, rc)
+	if err := rc.writeBundle("c1", &BundleManifest{Version: Version, Status: RunComplete, Cluster: "c1"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := rc.UploadToS3(); err != nil {
+		t.Fatalf("UploadToS3() error = %v", err)
+	}
+	// the bundle, with its checksum in the metadata, and the checksum file
+	if f.puts != 2 {
+		t.Errorf("puts = %d, want 2", f.puts)
+	}
+	sum, _ := os.ReadFile(filepath.Join(rc.rootFolder, "c1.tar.gz"+checksumExt))
+	if got := f.objects["/b/c1/2024-05-01/"+rc.RunId()+"/c1.tar.gz"+checksumExt]; got != string(sum) || !strings.HasPrefix(got, f.metadata["/b/c1/2024-05-01/"+rc.RunId()+"/c1.tar.gz"]) {
+		t.Errorf("checksum object = %q, metadata %v", got, f.metadata)
+	}
+}
@@ -0,0 +1,56 @@
+package common
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"slices"
+	"strconv"
+
+	cconf "github.com/densify-dev/container-config/config"
+)
+
+// IncludeEntityKinds are the valid keys of the collection include map
+var IncludeEntityKinds = []string{ClusterEntityKind, NodeEntityKind, NodeGroupInclude, ContainerEntityKind, Quota}
+
+// ValidateParams checks the parameters for mistakes which would otherwise surface only in the middle
+// of a run; it does not contact Prometheus
+func ValidateParams(params *cconf.Parameters) error {
+	if params == nil {
+		return fmt.Errorf("no configuration")
+	}
+	var errs []error
+	if c := params.Collection; c == nil {
+		errs = append(errs, fmt.Errorf("no collection configuration"))
+	} else {
+		if c.IntervalSize <= 0 {
+			errs = append(errs, fmt.Errorf("collection interval size must be positive, got %d", c.IntervalSize))
+		}
+		if c.HistoryInt <= 0 {
+			errs = append(errs, fmt.Errorf("collection history must be positive, got %d", c.HistoryInt))
+		}
+		if c.OffsetInt < 0 {
+			errs = append(errs, fmt.Errorf("collection offset must not be negative, got %d", c.OffsetInt))
+		}
+		if c.SampleRate <= 0 {
+			errs = append(errs, fmt.Errorf("collection sample rate must be positive"))
+		} else if c.SampleRateSt != Empty {
+			if n, err := strconv.Atoi(c.SampleRateSt); err != nil || n <= 0 {
+				errs = append(errs, fmt.Errorf("collection sample rate must be positive, got %q", c.SampleRateSt))
+			}
+		}
+		for k := range c.Include {
+			if !slices.Contains(IncludeEntityKinds, k) {
+				errs = append(errs, fmt.Errorf("unknown include %q, valid values are %v", k, IncludeEntityKinds))
+			}
+		}
+	}
+	if p := params.Prometheus; p == nil || p.UrlConfig == nil {
+		errs = append(errs, fmt.Errorf("no prometheus configuration"))
+	} else if u, err := url.Parse(p.UrlConfig.Url); err != nil {
+		errs = append(errs, fmt.Errorf("invalid prometheus URL: %v", err))
+	} else if u.Scheme == Empty || u.Host == Empty {
+		errs = append(errs, fmt.Errorf("invalid prometheus URL %q: scheme and host are required", p.UrlConfig.Url))
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,61 @@
+package common
+
+import (
+	"strings"
+	"testing"
+
+	cconf "github.com/densify-dev/container-config/config"
+)
+
+func validTestParams() *cconf.Parameters {
+	return &cconf.Parameters{
+		Prometheus: &cconf.PrometheusParameters{UrlConfig: &cconf.UrlConfig{Url: "http://prometheus:9090"}},
+		Collection: &cconf.CollectionParameters{Interval: Hours, IntervalSize: 1, HistoryInt: 1, SampleRate: 5},
+	}
+}
+
+func TestValidateParams(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(p *cconf.Parameters)
+		errs   []string
+	}{
+		{name: "valid", modify: func(*cconf.Parameters) {}},
+		{name: "no collection", modify: func(p *cconf.Parameters) { p.Collection = nil }, errs: []string{"no collection configuration"}},
+		{name: "interval size", modify: func(p *cconf.Parameters) { p.Collection.IntervalSize = 0 }, errs: []string{"interval size must be positive"}},
+		{name: "history", modify: func(p *cconf.Parameters) { p.Collection.HistoryInt = -1 }, errs: []string{"history must be positive"}},
+		{name: "offset", modify: func(p *cconf.Parameters) { p.Collection.OffsetInt = -1 }, errs: []string{"offset must not be negative"}},
+		{name: "sample rate", modify: func(p *cconf.Parameters) { p.Collection.SampleRate = 0 }, errs: []string{"sample rate must be positive"}},
+		{name: "negative sample rate", modify: func(p *cconf.Parameters) { p.Collection.SampleRateSt = "-1" }, errs: []string{"sample rate must be positive"}},
+		{name: "include", modify: func(p *cconf.Parameters) { p.Collection.Include = map[string]bool{"pods": true} }, errs: []string{`unknown include "pods"`}},
+		{name: "no prometheus", modify: func(p *cconf.Parameters) { p.Prometheus = nil }, errs: []string{"no prometheus configuration"}},
+		{name: "url", modify: func(p *cconf.Parameters) { p.Prometheus.UrlConfig.Url = "prometheus:9090/x" }, errs: []string{"scheme and host are required"}},
+		{name: "several", modify: func(p *cconf.Parameters) {
+			p.Collection.IntervalSize = 0
+			p.Prometheus.UrlConfig.Url = "::"
+		}, errs: []string{"interval size must be positive", "invalid prometheus URL"}},
+	}
+	for _, test := range tests {
+		params := validTestParams()
+		test.modify(params)
+		err := ValidateParams(params)
+		if len(test.errs) == 0 {
+			if err != nil {
+				t.Errorf("%s: %v", test.name, err)
+			}
+			continue
+		}
+		if err == nil {
+			t.Errorf("%s: no error", test.name)
+			continue
+		}
+		for _, s := range test.errs {
+			if !strings.Contains(err.Error(), s) {
+				t.Errorf("%s: error %q does not contain %q", test.name, err, s)
+			}
+		}
+	}
+	if err := ValidateParams(nil); err == nil {
+		t.Error("no error without configuration")
+	}
+}
@@ -100,7 +100,8 @@ func setValue[V any](cluster string, target *V, key, value string) {
 			*t = v
 		}
 	default:
-		LogCluster(1, Error, ClusterFormat+" unknown type %T for key %s and value %s in labels", cluster, true, cluster, t, key, value)
+		// a programming error rather than a problem of the run
+		LogErrorWithLevel(1, Error, nil, ClusterFormat+" unknown type %T for key %s and value %s in labels", cluster, t, key, value)
 	}
 }
 
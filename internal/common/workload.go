@@ -2,9 +2,10 @@ package common
 
 import (
 	"fmt"
-	"io"
 	"math"
 	"os"
+	"path/filepath"
+	"slices"
 	"strings"
 	"time"
 
@@ -57,22 +58,22 @@ func (wmh *WorkloadMetricHolder) GetName(nt NameType, singular bool) (name strin
 	return
 }
 
-func (wmh *WorkloadMetricHolder) GetWorkload(query string, metricField []model.LabelName, entityKind string) {
-	wmh.GetWorkloadFieldsFunc(query, metricField, nil, entityKind)
+func (wmh *WorkloadMetricHolder) GetWorkload(rc *RunContext, query string, metricField []model.LabelName, entityKind string) {
+	wmh.GetWorkloadFieldsFunc(rc, query, metricField, nil, entityKind)
 }
 
 // GetWorkloadFieldsFunc - call this function directly ONLY if you need to provide the FieldsFunc;
 // otherwise use GetWorkload
-func (wmh *WorkloadMetricHolder) GetWorkloadFieldsFunc(query string, metricField []model.LabelName, ff FieldsFunc, entityKind string) {
+func (wmh *WorkloadMetricHolder) GetWorkloadFieldsFunc(rc *RunContext, query string, metricField []model.LabelName, ff FieldsFunc, entityKind string) {
 	callDepth := 2
 	if ff == nil {
 		callDepth++
 	}
-	GetWorkload(callDepth, wmh.fileName, wmh.metricName, query, metricField, ff, entityKind, Metric, nil)
+	rc.GetWorkload(callDepth, wmh.fileName, wmh.metricName, query, metricField, ff, entityKind, Metric, nil)
 }
 
-func (wmh *WorkloadMetricHolder) GetWorkloadQueryVariants(callDepth int, qps map[string]*QueryProcessor, entityKind string) {
-	GetWorkloadQueryVariantsFieldConversion(callDepth+1, wmh.fileName, wmh.metricName, qps, entityKind, Metric, nil)
+func (wmh *WorkloadMetricHolder) GetWorkloadQueryVariants(rc *RunContext, callDepth int, qps map[string]*QueryProcessor, entityKind string) {
+	rc.GetWorkloadQueryVariantsFieldConversion(callDepth+1, wmh.fileName, wmh.metricName, qps, entityKind, Metric, nil)
 }
 
 // common WorkloadMetricHolder structs
@@ -198,8 +199,13 @@ var conditionalMetricHolders = []*WorkloadMetricHolder{
 	GpuReservationPercent,
 }
 
-func GetConditionalMetricsWorkload(indicators map[string]int, indicator string, querySubToMetricFields map[string][]model.LabelName, entityKind string, subject string) {
-	for _, f := range FoundIndicatorCounter(indicators, indicator) {
+// ConditionalMetricHolders returns the workload metric holders of GetConditionalMetricsWorkload
+func ConditionalMetricHolders() []*WorkloadMetricHolder {
+	return slices.Clone(conditionalMetricHolders)
+}
+
+func (rc *RunContext) GetConditionalMetricsWorkload(indicators *Indicators, indicator string, querySubToMetricFields map[string][]model.LabelName, entityKind string, subject string) {
+	for _, f := range rc.FoundIndicatorCounter(indicators, indicator) {
 		for i, q := range conditionalQueries[f] {
 			if q == Empty {
 				continue
@@ -217,7 +223,7 @@ func GetConditionalMetricsWorkload(indicators map[string]int, indicator string,
 				qps[query] = &QueryProcessor{MetricFields: metricFields}
 			}
 			cmh := conditionalMetricHolders[i]
-			GetWorkloadQueryVariants(2, cmh.fileName, cmh.metricName, qps, entityKind, subject, nil)
+			rc.GetWorkloadQueryVariants(2, cmh.fileName, cmh.metricName, qps, entityKind, subject, nil)
 		}
 	}
 }
@@ -228,45 +234,46 @@ type QueryProcessor struct {
 }
 
 // GetWorkload used to query for the workload data and then calls write workload
-func GetWorkload(callDepth int, fileName, metricName, query string, metricFields []model.LabelName, ff FieldsFunc, entityKind string, subject string, tvp QueryProvider) {
+func (rc *RunContext) GetWorkload(callDepth int, fileName, metricName, query string, metricFields []model.LabelName, ff FieldsFunc, entityKind string, subject string, tvp QueryProvider) {
 	qps := map[string]*QueryProcessor{query: {MetricFields: metricFields, FF: ff}}
-	GetWorkloadQueryVariants(callDepth+1, fileName, metricName, qps, entityKind, subject, tvp)
+	rc.GetWorkloadQueryVariants(callDepth+1, fileName, metricName, qps, entityKind, subject, tvp)
 }
 
-func GetWorkloadQueryVariants(callDepth int, fileName, metricName string, queryProcessors map[string]*QueryProcessor, entityKind string, subject string, tvp QueryProvider) {
-	GetWorkloadQueryVariantsFieldConversion(callDepth+1, fileName, metricName, queryProcessors, entityKind, subject, tvp)
+func (rc *RunContext) GetWorkloadQueryVariants(callDepth int, fileName, metricName string, queryProcessors map[string]*QueryProcessor, entityKind string, subject string, tvp QueryProvider) {
+	rc.GetWorkloadQueryVariantsFieldConversion(callDepth+1, fileName, metricName, queryProcessors, entityKind, subject, tvp)
 }
 
-func GetWorkloadQueryVariantsFieldConversion(callDepth int, fileName, metricName string, queryProcessors map[string]*QueryProcessor, entityKind string, subject string, qp QueryProvider) {
+func (rc *RunContext) GetWorkloadQueryVariantsFieldConversion(callDepth int, fileName, metricName string, queryProcessors map[string]*QueryProcessor, entityKind string, subject string, qp QueryProvider) {
 	prov := queryProviderOrDefault(qp)
 	csvHeaderFormat, f := GetCsvHeaderFormat(entityKind, subject)
 	if !f {
-		LogError(fmt.Errorf("no CSV header format found"), EntityFormat)
+		rc.LogError(fmt.Errorf("no CSV header format found"), EntityFormat)
 		return
 	}
-	clusterFiles := make(map[string]*os.File)
+	queryProcessors = rc.overrideQueryProcessors(entityKind, fileName, queryProcessors)
+	clusterFiles := make(map[string]Sink)
 	//If the History parameter is set to anything but default 1 then will loop through the calls starting with the current day\hour\minute interval and work backwards.
 	//This is done as the farther you go back in time the slower prometheus querying becomes and we have seen cases where will not run from timeouts on Prometheus.
 	//As a result if we do hit an issue with timing out on Prometheus side we still can send the current data and data going back to that point vs losing it all.
-	for historyInterval := 0; historyInterval < Params.Collection.HistoryInt; historyInterval++ {
-		rng := prov.CalculateRange(historyInterval)
+	for historyInterval := 0; historyInterval < rc.params.Collection.HistoryInt; historyInterval++ {
+		rng := prov.CalculateRange(rc, historyInterval)
 		for query, qp := range queryProcessors {
-			if crm, _, err := CollectMetric(callDepth+1, query, rng); err != nil {
-				LogErrorWithLevel(1, Warn, err, QueryFormat, metricName, query)
+			if crm, _, err := rc.CollectMetric(callDepth+1, query, rng); err != nil {
+				rc.LogErrorWithLevel(1, Warn, err, QueryFormat, metricName, query)
 			} else {
 				for cluster, result := range crm {
 					if result == nil || result.Matrix.Len() == 0 {
 						continue
 					}
-					file, initialized := clusterFiles[cluster]
+					sink, initialized := clusterFiles[cluster]
 					if !initialized {
-						file = InitWorkloadFile(cluster, fileName, entityKind, csvHeaderFormat, metricName)
-						clusterFiles[cluster] = file
+						sink = rc.InitWorkloadFile(cluster, fileName, entityKind, csvHeaderFormat, metricName)
+						clusterFiles[cluster] = sink
 					}
-					if file != nil {
+					if sink != nil {
 						fp := &FieldProvider{Cluster: cluster, MetricFields: qp.MetricFields, ConvF: qp.FF, QProv: prov}
-						if err = writeWorkload(file, cluster, result.Matrix, fp); err != nil {
-							LogError(err, ClusterFileFormat, cluster, fileName)
+						if err = rc.writeWorkload(sink, cluster, metricName, result.Matrix, fp); err != nil {
+							rc.LogError(err, ClusterFileFormat, cluster, fileName)
 						}
 					}
 				}
@@ -274,40 +281,37 @@ func GetWorkloadQueryVariantsFieldConversion(callDepth int, fileName, metricName
 		}
 	}
 	// close the workload files
-	for cluster, file := range clusterFiles {
-		if file != nil {
-			if err := file.Close(); err != nil {
-				LogError(err, ClusterFileFormat, cluster, fileName)
+	for cluster, sink := range clusterFiles {
+		if sink != nil {
+			if err := rc.CloseWorkloadFile(sink); err != nil {
+				rc.LogError(err, ClusterFileFormat, cluster, fileName)
 			}
 		}
 	}
 }
 
-func InitWorkloadFile(cluster, fileName, entityKind, csvHeaderFormat, metricName string) *os.File {
+// InitWorkloadFile creates the sink of a workload output; a file left by an earlier run is handled as per
+// the existing files policy, while a file already written by this run is an error
+func (rc *RunContext) InitWorkloadFile(cluster, fileName, entityKind, csvHeaderFormat, metricName string) Sink {
 	var err error
-	if _, err = os.Stat(fileName); err == nil {
+	if rc.isTrackedFile(filepath.Join(cluster, entityKind, fileName)) {
 		err = fmt.Errorf("%s %v", fileName, os.ErrExist)
-		LogError(err, DefaultLogFormat, cluster, entityKind)
-		return nil
-	}
-	var workloadWrite *os.File
-	if workloadWrite, err = os.Create(GetFileName(cluster, entityKind, fileName)); err != nil {
-		LogError(err, DefaultLogFormat, cluster, entityKind)
+		rc.LogError(err, DefaultLogFormat, cluster, entityKind)
 		return nil
 	}
-	_, err = fmt.Fprintf(workloadWrite, csvHeaderFormat, metricName)
-	if err != nil {
-		LogError(err, DefaultLogFormat, cluster, entityKind)
-		_ = workloadWrite.Close()
+	var sink Sink
+	if sink, err = rc.newWorkloadSink(cluster, entityKind, fileName, csvHeaderFormat, metricName); err != nil {
+		rc.LogError(err, DefaultLogFormat, cluster, entityKind)
 		return nil
 	}
-	return workloadWrite
+	rc.trackFile(sink, cluster, entityKind, metricName)
+	return sink
 }
 
-func writeWorkload(file io.Writer, clusterName string, result model.Matrix, fp *FieldProvider) error {
+func (rc *RunContext) writeWorkload(sink Sink, clusterName, metric string, result model.Matrix, fp *FieldProvider) error {
 	for _, ss := range result {
 		if f, ok := fp.Fields(ss.Metric); ok {
-			if err := WriteValues(file, clusterName, f, ss.Values, fp.QProv); err != nil {
+			if err := rc.WriteValues(sink, clusterName, metric, f, ss.Values, fp.QProv); err != nil {
 				return err
 			}
 		}
@@ -324,8 +328,7 @@ type FieldProvider struct {
 	QProv        QueryProvider
 }
 
-func (fp *FieldProvider) Fields(metric model.Metric) (string, bool) {
-	var f string
+func (fp *FieldProvider) Fields(metric model.Metric) ([]string, bool) {
 	var fields []string
 	ok := true
 	for _, mf := range fp.MetricFields {
@@ -339,47 +342,45 @@ func (fp *FieldProvider) Fields(metric model.Metric) (string, bool) {
 	if ok && fp.ConvF != nil {
 		fields, ok = fp.ConvF(fp.Cluster, fields)
 	}
-	if ok {
-		f = JoinComma(fields...)
-	}
-	return f, ok
+	return fields, ok
 }
 
-func WriteValues(file io.Writer, clusterName, fields string, values []model.SamplePair, qp QueryProvider) error {
+// WriteValues writes the samples of a metric of an entity, identified by the cluster name and its fields
+func (rc *RunContext) WriteValues(sink Sink, clusterName, metric string, fields []string, values []model.SamplePair, qp QueryProvider) (err error) {
+	entity := make([]string, 0, len(fields)+1)
+	entity = append(entity, clusterName)
+	for _, field := range fields {
+		entity = append(entity, rc.ReplaceSemiColons(field))
+	}
+	var rows int
+	defer func() { rc.countRows(sink, JoinComma(entity...), rows) }()
+	prov := queryProviderOrDefault(qp)
 	for _, value := range values {
 		if !IsValidValue(&value) {
 			continue
 		}
-		prov := queryProviderOrDefault(qp)
 		if tv := prov.TimeAndValues(&value); tv != nil {
+			s := &Sample{Entity: entity, Time: tv.Time, Metric: metric, Values: tv.Values}
 			for i := 0; i < tv.Count; i++ {
-				var err error
-				if _, err = fmt.Fprintf(file, "%s,", clusterName); err != nil {
-					return err
-				}
-				if fields != Empty {
-					if _, err = fmt.Fprintf(file, "%s,", ReplaceSemiColons(fields)); err != nil {
-						return err
-					}
-				}
-				if _, err = fmt.Fprintf(file, "%s,%s\n", FormatTime(tv.Time), tv.Values); err != nil {
-					return err
+				if err = sink.WriteSample(s); err != nil {
+					return
 				}
+				rows++
 			}
 		}
 	}
-	return nil
+	return
 }
 
 type TimeAndValues struct {
 	Time   model.Time
-	Values string
+	Values []any
 	Count  int
 }
 
 type QueryProvider interface {
 	TimeAndValues(value *model.SamplePair) *TimeAndValues
-	CalculateRange(historyInterval int) *v1.Range
+	CalculateRange(rc *RunContext, historyInterval int) *v1.Range
 }
 
 func IsValidValue(value *model.SamplePair) bool {
@@ -393,13 +394,13 @@ type MetricTimeAndValuesProvider struct {
 func (mtvp *MetricTimeAndValuesProvider) TimeAndValues(value *model.SamplePair) *TimeAndValues {
 	return &TimeAndValues{
 		Time:   value.Timestamp,
-		Values: fmt.Sprintf("%f", value.Value),
+		Values: []any{float64(value.Value)},
 		Count:  1,
 	}
 }
 
-func (mtvp *MetricTimeAndValuesProvider) CalculateRange(historyInterval int) *v1.Range {
-	return TimeRangeForInterval(time.Duration(historyInterval))
+func (mtvp *MetricTimeAndValuesProvider) CalculateRange(rc *RunContext, historyInterval int) *v1.Range {
+	return rc.TimeRangeForInterval(time.Duration(historyInterval))
 }
 
 var metricTimeAndValuesProvider = &MetricTimeAndValuesProvider{}
@@ -412,80 +413,83 @@ func queryProviderOrDefault(qp QueryProvider) QueryProvider {
 	}
 }
 
-type ClusterWorkloadWriters map[string]*os.File
-type WorkloadWriters map[string]ClusterWorkloadWriters
+type ClusterWorkloadWriters map[string]Sink
 
-func NewWorkloadWriters() WorkloadWriters {
-	return make(WorkloadWriters)
+// WorkloadWriters are the sinks of the workload outputs of a run written by WriteWorkload, per metric and cluster
+type WorkloadWriters struct {
+	rc      *RunContext
+	writers map[string]ClusterWorkloadWriters
 }
 
-func (wws WorkloadWriters) AddMetricWorkloadWriters(wmhs ...*WorkloadMetricHolder) {
+func (rc *RunContext) NewWorkloadWriters() *WorkloadWriters {
+	return &WorkloadWriters{rc: rc, writers: make(map[string]ClusterWorkloadWriters)}
+}
+
+func (wws *WorkloadWriters) AddMetricWorkloadWriters(wmhs ...*WorkloadMetricHolder) {
 	for _, wmh := range wmhs {
 		metric := wmh.GetName(MetricName, true)
-		wws[metric] = make(ClusterWorkloadWriters)
+		wws.writers[metric] = make(ClusterWorkloadWriters)
 	}
 }
 
-func (wws WorkloadWriters) CloseAndClearWorkloadWriters(entityKind string) {
-	for _, cws := range wws {
-		for cluster, file := range cws {
-			if err := file.Close(); err != nil {
-				LogError(err, DefaultLogFormat, cluster, entityKind)
+func (wws *WorkloadWriters) CloseAndClearWorkloadWriters(entityKind string) {
+	for _, cws := range wws.writers {
+		for cluster, sink := range cws {
+			if err := wws.rc.CloseWorkloadFile(sink); err != nil {
+				wws.rc.LogError(err, DefaultLogFormat, cluster, entityKind)
 			}
 		}
 		clear(cws)
 	}
-	clear(wws)
+	clear(wws.writers)
 }
 
 type WorkloadProducer interface {
 	GetCluster() string
 	GetEntityKind() string
-	GetRowPrefixes() []string
+	// GetEntities returns the identities of the entities the workload is written for, see Sample.Entity
+	GetEntities() [][]string
 	ShouldWrite(metric string) bool
 }
 
-func WriteWorkload(wp WorkloadProducer, wws WorkloadWriters, wmh *WorkloadMetricHolder, ss *model.SampleStream, f ConvFunc[float64]) {
+func WriteWorkload(wp WorkloadProducer, wws *WorkloadWriters, wmh *WorkloadMetricHolder, ss *model.SampleStream, f ConvFunc[float64]) {
 	metric := wmh.GetName(MetricName, true)
 	if !wp.ShouldWrite(metric) {
 		return
 	}
 	cluster := wp.GetCluster()
 	ek := wp.GetEntityKind()
-	var file *os.File
+	var sink Sink
 	var err error
-	if file = wws[metric][cluster]; file == nil {
-		if file, err = os.Create(GetFileName(cluster, ek, wmh.GetName(FileName, true))); err == nil {
-			hf, _ := GetCsvHeaderFormat(ek, Metric)
-			if _, err = fmt.Fprintf(file, hf, metric); err == nil {
-				wws[metric][cluster] = file
-			} else {
-				LogError(err, DefaultLogFormat, cluster, ek)
-				_ = file.Close()
-			}
+	if sink = wws.writers[metric][cluster]; sink == nil {
+		hf, _ := GetCsvHeaderFormat(ek, Metric)
+		if sink, err = wws.rc.newWorkloadSink(cluster, ek, wmh.GetName(FileName, true), hf, metric); err == nil {
+			wws.writers[metric][cluster] = sink
+			wws.rc.trackFile(sink, cluster, ek, metric)
 		} else {
-			LogError(err, DefaultLogFormat, cluster, ek)
+			wws.rc.LogError(err, DefaultLogFormat, cluster, ek)
 		}
 	}
-	if err == nil && file != nil {
-		vals := make([]float64, len(ss.Values))
-		times := make([]string, len(ss.Values))
+	if err == nil && sink != nil {
+		samples := make([]Sample, len(ss.Values))
 		for i, value := range ss.Values {
 			val := float64(value.Value)
 			if f != nil {
 				val = f(val)
 			}
-			vals[i] = val
-			times[i] = FormatTime(value.Timestamp)
+			samples[i] = Sample{Time: value.Timestamp, Metric: metric, Values: []any{val}}
 		}
 	outer:
-		for _, rowPrefix := range wp.GetRowPrefixes() {
-			for i, t := range times {
-				if _, err = fmt.Fprintf(file, "%s,%s,%f\n", rowPrefix, t, vals[i]); err != nil {
-					LogError(err, DefaultLogFormat, cluster, ek)
+		for _, entity := range wp.GetEntities() {
+			for i := range samples {
+				samples[i].Entity = entity
+				if err = sink.WriteSample(&samples[i]); err != nil {
+					wws.rc.LogError(err, DefaultLogFormat, cluster, ek)
+					wws.rc.countRows(sink, JoinComma(entity...), i)
 					break outer
 				}
 			}
+			wws.rc.countRows(sink, JoinComma(entity...), len(samples))
 		}
 	}
 }
@@ -2,7 +2,6 @@ package container
 
 import (
 	"fmt"
-	"os"
 	"sort"
 	"strconv"
 	"strings"
@@ -25,9 +24,8 @@ const (
 )
 
 type labelHolder struct {
-	detected bool
-	names    []string
-	wqws     map[int]*common.WorkloadQueryWrapper
+	names []string
+	wqws  map[int]*common.WorkloadQueryWrapper
 }
 
 func labelPlaceholder(s string) string {
@@ -52,7 +50,7 @@ type labelNamesType int
 
 type queryProcessorBuilder struct {
 	lnt labelNamesType
-	th  *typeHolder
+	oh  *objectMetricHolder
 }
 
 const (
@@ -78,8 +76,8 @@ func (lh *labelHolder) getQueryProcessor(qpb *queryProcessorBuilder) (qp *common
 	}
 	names := append(nms, model.LabelName(lh.names[containerIdx]))
 	var ff common.FieldsFunc
-	if qpb.th != nil {
-		ff = qpb.th.containerFields
+	if qpb.oh != nil {
+		ff = qpb.oh.containerFields
 	}
 	qp = &common.QueryProcessor{
 		MetricFields: names,
@@ -106,19 +104,18 @@ func makeLabelHolders() []*labelHolder {
 	return []*labelHolder{stdLabelHolder, nameLabelHolder}
 }
 
-var clusterLabelHolders = make(map[string]*labelHolder)
-
 type metricHolder struct {
+	st           *state
 	metric       string
 	isOTelMetric bool
 }
 
 var metricRequireSameObject = map[string]bool{createTime: true, common.CurrentSizeName: true}
 
-func getOwnerId(cluster, nsName string, objId *objectId) (ownerId *objectId, ok bool) {
+func (st *state) getOwnerId(cluster, nsName string, objId *objectId) (ownerId *objectId, ok bool) {
 	if objId != nil {
 		var o *ownership
-		if o, ok = ownerships[cluster][objId.Key(nsName)]; ok {
+		if o, ok = st.ownerships[cluster][objId.Key(nsName)]; ok {
 			ownerId = o.getTopLevelOwner()
 		} else {
 			ownerId, ok = objId, true
@@ -127,37 +124,37 @@ func getOwnerId(cluster, nsName string, objId *objectId) (ownerId *objectId, ok
 	return
 }
 
-func getOwner(cluster, nsName string, ns *namespace, objId *objectId) (obj *k8sObject, ok bool) {
+func (st *state) getOwner(cluster, nsName string, ns *namespace, objId *objectId) (obj *k8sObject, ok bool) {
 	if ns != nil {
 		var ownerId *objectId
-		if ownerId, ok = getOwnerId(cluster, nsName, objId); ok {
+		if ownerId, ok = st.getOwnerId(cluster, nsName, objId); ok {
 			obj, ok = ns.objects[ownerId.Key(nsName)]
 		}
 	}
 	return
 }
 
-func getContainer(cluster string, ss *model.SampleStream) (c *container, cwp *containerWorkloadProducer, ok bool) {
+func (st *state) getContainer(cluster string, ss *model.SampleStream) (c *container, cwp *containerWorkloadProducer, ok bool) {
 	var nsName, podName, containerName string
-	if clh, f := clusterLabelHolders[cluster]; f {
+	if clh, f := st.clusterLabelHolders[cluster]; f {
 		nsName, podName, containerName, ok = clh.values(ss)
 	} else {
 		for _, lh := range labelHolders {
 			if nsName, podName, containerName, ok = lh.values(ss); ok {
-				lh.detected = true
-				clusterLabelHolders[cluster] = lh
+				st.detectedLabelHolders[lh] = true
+				st.clusterLabelHolders[cluster] = lh
 				break
 			}
 		}
 	}
 	if ok {
 		var ns *namespace
-		if ns, ok = namespaces[cluster][nsName]; ok {
+		if ns, ok = st.namespaces[cluster][nsName]; ok {
 			podId := &objectId{kind: common.Pod, name: podName}
 			var owner *k8sObject
-			if owner, ok = getOwner(cluster, nsName, ns, podId); ok {
+			if owner, ok = st.getOwner(cluster, nsName, ns, podId); ok {
 				if c, ok = owner.containers[containerName]; ok {
-					cwp = &containerWorkloadProducer{cluster: cluster, nsName: nsName, obj: owner, c: c}
+					cwp = &containerWorkloadProducer{st: st, cluster: cluster, nsName: nsName, obj: owner, c: c}
 				}
 			}
 		}
@@ -165,12 +162,12 @@ func getContainer(cluster string, ss *model.SampleStream) (c *container, cwp *co
 	return
 }
 
-func getOTelContainer(cluster string, ss *model.SampleStream) (c *container, ok bool) {
+func (st *state) getOTelContainer(cluster string, ss *model.SampleStream) (c *container, ok bool) {
 	var vals map[string]string
 	if vals, ok = common.GetLabelsValues(ss, []string{common.SemconvNamespaceName, common.SemconvKind, common.SemconvOwnerName, common.SemconvContainerName}); ok {
 		var ns *namespace
 		nsName := vals[common.SemconvNamespaceName]
-		if ns, ok = namespaces[cluster][nsName]; ok {
+		if ns, ok = st.namespaces[cluster][nsName]; ok {
 			var obj *k8sObject
 			objId := &objectId{kind: vals[common.SemconvKind], name: vals[common.SemconvOwnerName]}
 			if obj, ok = ns.objects[strings.ToLower(objId.Key(nsName))]; ok {
@@ -187,9 +184,9 @@ func (mh *metricHolder) getContainerMetric(cluster string, result model.Matrix)
 		var cwp *containerWorkloadProducer
 		var ok bool
 		if mh.isOTelMetric {
-			c, ok = getOTelContainer(cluster, ss)
+			c, ok = mh.st.getOTelContainer(cluster, ss)
 		} else {
-			c, cwp, ok = getContainer(cluster, ss)
+			c, cwp, ok = mh.st.getContainer(cluster, ss)
 		}
 		if !ok {
 			continue
@@ -201,51 +198,51 @@ func (mh *metricHolder) getContainerMetric(cluster string, result model.Matrix)
 			switch resource {
 			case common.Memory:
 				c.memLimit = common.IntMiB(value)
-				common.WriteWorkload(cwp, containerWorkloadWriters, common.MemoryLimits, ss, common.MiB[float64])
+				common.WriteWorkload(cwp, mh.st.containerWorkloadWriters, common.MemoryLimits, ss, common.MiB[float64])
 			case common.Cpu:
 				c.cpuLimit = common.IntMCores(value)
-				common.WriteWorkload(cwp, containerWorkloadWriters, common.CpuLimits, ss, common.MCores[float64])
+				common.WriteWorkload(cwp, mh.st.containerWorkloadWriters, common.CpuLimits, ss, common.MCores[float64])
 			case common.NvidiaGpuResource:
-				if node.GetGpuExporterType(range5Min, cluster) == common.Dcgm {
+				if node.GetGpuExporterType(mh.st.rc, mh.st.range5Min, cluster) == common.Dcgm {
 					c.gpuLimit = int(value)
 					c.gpuLimitFloat = value
-					common.WriteWorkload(cwp, containerWorkloadWriters, common.GpuLimits, ss, nil)
+					common.WriteWorkload(cwp, mh.st.containerWorkloadWriters, common.GpuLimits, ss, nil)
 				}
 			case common.EphemeralStorage:
 				c.ephemeralStorageLimit = common.IntMiB(value)
-				common.WriteWorkload(cwp, containerWorkloadWriters, common.EphemeralStorageLimits, ss, nil)
+				common.WriteWorkload(cwp, mh.st.containerWorkloadWriters, common.EphemeralStorageLimits, ss, nil)
 			}
 		case common.Requests:
 			switch resource {
 			case common.Memory:
 				c.memRequest = common.IntMiB(value)
-				common.WriteWorkload(cwp, containerWorkloadWriters, common.MemoryRequests, ss, common.MiB[float64])
+				common.WriteWorkload(cwp, mh.st.containerWorkloadWriters, common.MemoryRequests, ss, common.MiB[float64])
 			case common.Cpu:
 				c.cpuRequest = common.IntMCores(value)
-				common.WriteWorkload(cwp, containerWorkloadWriters, common.CpuRequests, ss, common.MCores[float64])
+				common.WriteWorkload(cwp, mh.st.containerWorkloadWriters, common.CpuRequests, ss, common.MCores[float64])
 			case common.NvidiaGpuResource:
-				if node.GetGpuExporterType(range5Min, cluster) == common.Dcgm {
+				if node.GetGpuExporterType(mh.st.rc, mh.st.range5Min, cluster) == common.Dcgm {
 					c.gpuRequest = int(value)
 					c.gpuRequestFloat = value
-					common.WriteWorkload(cwp, containerWorkloadWriters, common.GpuRequests, ss, nil)
+					common.WriteWorkload(cwp, mh.st.containerWorkloadWriters, common.GpuRequests, ss, nil)
 				}
 			case common.EphemeralStorage:
 				c.ephemeralStorageRequest = common.IntMiB(value)
-				common.WriteWorkload(cwp, containerWorkloadWriters, common.EphemeralStorageRequests, ss, nil)
+				common.WriteWorkload(cwp, mh.st.containerWorkloadWriters, common.EphemeralStorageRequests, ss, nil)
 			}
 		case common.GpuRequest:
-			if node.GetGpuExporterType(range5Min, cluster) == common.KubexGpu {
+			if node.GetGpuExporterType(mh.st.rc, mh.st.range5Min, cluster) == common.KubexGpu {
 				c.gpuRequest = int(value)
 				c.gpuRequestFloat = value
-				getKubexGpuSharingStrategy(ss, cluster, c)
-				common.WriteWorkload(cwp, containerWorkloadWriters, common.GpuRequests, ss, nil)
+				mh.st.getKubexGpuSharingStrategy(ss, cluster, c)
+				common.WriteWorkload(cwp, mh.st.containerWorkloadWriters, common.GpuRequests, ss, nil)
 			}
 		case common.GpuLimit:
-			if node.GetGpuExporterType(range5Min, cluster) == common.KubexGpu {
+			if node.GetGpuExporterType(mh.st.rc, mh.st.range5Min, cluster) == common.KubexGpu {
 				c.gpuLimit = int(value)
 				c.gpuLimitFloat = value
-				getKubexGpuSharingStrategy(ss, cluster, c)
-				common.WriteWorkload(cwp, containerWorkloadWriters, common.GpuLimits, ss, nil)
+				mh.st.getKubexGpuSharingStrategy(ss, cluster, c)
+				common.WriteWorkload(cwp, mh.st.containerWorkloadWriters, common.GpuLimits, ss, nil)
 			}
 		case common.Memory:
 			c.memory = common.IntMiB(value)
@@ -260,26 +257,26 @@ func (mh *metricHolder) getContainerMetric(cluster string, result model.Matrix)
 			c.gpuMemCount++
 			c.gpuMemTotal += int(value)
 			// also get the GPU model name && sharing strategy
-			switch node.GetGpuExporterType(range5Min, cluster) {
+			switch node.GetGpuExporterType(mh.st.rc, mh.st.range5Min, cluster) {
 			case common.Dcgm:
 				concatenateValue(ss, common.ModelName, &c.gpuModel, nil, nil)
-				np := &nodeProvider{cluster: cluster}
+				np := &nodeProvider{rc: mh.st.rc, cluster: cluster}
 				concatenateValue(ss, common.Node, &c.gpuSharingStrategy, np.getGpuSharingStrategy, nil)
 			case common.KubexGpu:
 				concatenateValue(ss, common.GpuModel, &c.gpuModel, nil, nil)
 			}
 		case common.CpuLimit:
 			c.cpuLimit = common.IntMCores(value)
-			common.WriteWorkload(cwp, containerWorkloadWriters, common.CpuLimits, ss, common.MCores[float64])
+			common.WriteWorkload(cwp, mh.st.containerWorkloadWriters, common.CpuLimits, ss, common.MCores[float64])
 		case common.CpuRequest:
 			c.cpuRequest = common.IntMCores(value)
-			common.WriteWorkload(cwp, containerWorkloadWriters, common.CpuRequests, ss, common.MCores[float64])
+			common.WriteWorkload(cwp, mh.st.containerWorkloadWriters, common.CpuRequests, ss, common.MCores[float64])
 		case common.MemLimit:
 			c.memLimit = common.IntMiB(value)
-			common.WriteWorkload(cwp, containerWorkloadWriters, common.MemoryLimits, ss, common.MiB[float64])
+			common.WriteWorkload(cwp, mh.st.containerWorkloadWriters, common.MemoryLimits, ss, common.MiB[float64])
 		case common.MemRequest:
 			c.memRequest = common.IntMiB(value)
-			common.WriteWorkload(cwp, containerWorkloadWriters, common.CpuRequests, ss, common.MCores[float64])
+			common.WriteWorkload(cwp, mh.st.containerWorkloadWriters, common.CpuRequests, ss, common.MCores[float64])
 		case restarts:
 			c.restarts += int(value)
 		case powerSt:
@@ -294,11 +291,11 @@ func (mh *metricHolder) getContainerMetric(cluster string, result model.Matrix)
 	}
 }
 
-func getKubexGpuSharingStrategy(ss *model.SampleStream, cluster string, c *container) {
+func (st *state) getKubexGpuSharingStrategy(ss *model.SampleStream, cluster string, c *container) {
 	if gat, f := ss.Metric["gpu_allocation_type"]; f && gat == "KaiScheduler" {
 		c.gpuSharingStrategy = kaiScheduler
 	} else {
-		np := &nodeProvider{cluster: cluster}
+		np := &nodeProvider{rc: st.rc, cluster: cluster}
 		concatenateValue(ss, common.Node, &c.gpuSharingStrategy, np.getGpuSharingStrategy, nil)
 	}
 }
@@ -307,11 +304,12 @@ type valueFunc func(string) string
 type equalFunc includeFunc
 
 type nodeProvider struct {
+	rc      *common.RunContext
 	cluster string
 }
 
 func (np *nodeProvider) getGpuSharingStrategy(name string) string {
-	return node.GetNodeGpuSharingStrategy(np.cluster, name)
+	return node.GetNodeGpuSharingStrategy(np.rc, np.cluster, name)
 }
 
 func concatenateValue(ss *model.SampleStream, labelName string, value *string, vf valueFunc, ef equalFunc) {
@@ -343,15 +341,15 @@ func concatenateValue(ss *model.SampleStream, labelName string, value *string, v
 	}
 }
 
-func getContainerMetricString(cluster string, result model.Matrix) {
+func (st *state) getContainerMetricString(cluster string, result model.Matrix) {
 	for _, ss := range result {
-		if c, _, ok := getContainer(cluster, ss); ok {
+		if c, _, ok := st.getContainer(cluster, ss); ok {
 			addToLabelMap(ss.Metric, c.labelMap, excludeNodeLabel)
 		}
 	}
 }
 
-func getNamespaceAndValue(th *typeHolder, cluster string, ss *model.SampleStream) (nsName string, ns *namespace, value string, ok bool) {
+func (st *state) getNamespaceAndValue(th *typeHolder, cluster string, ss *model.SampleStream) (nsName string, ns *namespace, value string, ok bool) {
 	var ln string
 	if th != nil {
 		ln = th.getTypeLabelName()
@@ -362,47 +360,48 @@ func getNamespaceAndValue(th *typeHolder, cluster string, ss *model.SampleStream
 		lns = []string{ln}
 	}
 	var values map[string]string
-	nsName, ns, values, ok = getNamespaceAndValues(lns, cluster, ss)
+	nsName, ns, values, ok = st.getNamespaceAndValues(lns, cluster, ss)
 	if ok && hasLabel {
 		value = values[ln]
 	}
 	return
 }
 
-func getNamespaceAndValues(lns []string, cluster string, ss *model.SampleStream) (nsName string, ns *namespace, values map[string]string, ok bool) {
-	names := append([]string{common.Namespace}, lns...)
-	if values, ok = common.GetLabelsValues(ss, names); !ok {
-		return
+func (st *state) getNamespaceAndValues(lns []string, cluster string, ss *model.SampleStream) (nsName string, ns *namespace, values map[string]string, ok bool) {
+	if nsName, values, ok = getNamespaceNameAndValues(lns, ss); ok {
+		ns, ok = st.namespaces[cluster][nsName]
 	}
-	nsName = values[common.Namespace]
-	if cluster != common.Empty {
-		if ns, ok = namespaces[cluster][nsName]; !ok {
-			return
-		}
+	return
+}
+
+func getNamespaceNameAndValues(lns []string, ss *model.SampleStream) (nsName string, values map[string]string, ok bool) {
+	names := append([]string{common.Namespace}, lns...)
+	if values, ok = common.GetLabelsValues(ss, names); ok {
+		nsName = values[common.Namespace]
 	}
 	return
 }
 
-func isRelevant(cluster, nsName string, oid *objectId) (b bool) {
+func (st *state) isRelevant(cluster, nsName string, oid *objectId) (b bool) {
 	if oid != nil {
-		b = oid.kind == common.Pod || detectedOwners[cluster][oid.Key(nsName)]
+		b = oid.kind == common.Pod || st.detectedOwners[cluster][oid.Key(nsName)]
 	}
 	return
 }
 
-func (th *typeHolder) getObject(cluster string, ss *model.SampleStream, requiresSameObject bool) (nsName string, obj *k8sObject, ok bool) {
+func (omh *objectMetricHolder) getObject(cluster string, ss *model.SampleStream, requiresSameObject bool) (nsName string, obj *k8sObject, ok bool) {
 	var ns *namespace
 	var value string
-	if nsName, ns, value, ok = getNamespaceAndValue(th, cluster, ss); ok {
-		obj, ok = getObject(cluster, nsName, th.typeName, value, ns, requiresSameObject)
+	if nsName, ns, value, ok = omh.st.getNamespaceAndValue(omh.typeHolder, cluster, ss); ok {
+		obj, ok = omh.st.getObject(cluster, nsName, omh.typeName, value, ns, requiresSameObject)
 	}
 	return
 }
 
-func getObject(cluster, nsName, kind, name string, ns *namespace, requiresSameObject bool) (obj *k8sObject, ok bool) {
+func (st *state) getObject(cluster, nsName, kind, name string, ns *namespace, requiresSameObject bool) (obj *k8sObject, ok bool) {
 	oid := &objectId{kind: kind, name: name}
-	if ok = isRelevant(cluster, nsName, oid); ok {
-		if obj, ok = getOwner(cluster, nsName, ns, oid); ok && requiresSameObject {
+	if ok = st.isRelevant(cluster, nsName, oid); ok {
+		if obj, ok = st.getOwner(cluster, nsName, ns, oid); ok && requiresSameObject {
 			ok = obj.kind == oid.kind && obj.name == oid.name
 		}
 	}
@@ -426,8 +425,8 @@ func (omh *objectMetricHolder) getObjectMetric(cluster string, result model.Matr
 		case common.CurrentSizeName:
 			// need to set the maximum value
 			obj.currentSize = int(int64Value)
-			cwp := &containerWorkloadProducer{cluster: cluster, nsName: nsName, obj: obj}
-			common.WriteWorkload(cwp, containerWorkloadWriters, common.CurrentSize, ss, nil)
+			cwp := &containerWorkloadProducer{st: omh.st, cluster: cluster, nsName: nsName, obj: obj}
+			common.WriteWorkload(cwp, omh.st.containerWorkloadWriters, common.CurrentSize, ss, nil)
 		case createTime:
 			obj.createTime = time.Unix(int64Value, 0)
 		case qosClass:
@@ -453,7 +452,7 @@ func (oomh *ownedObjectMetricHolder) getObjectMetric(cluster string, result mode
 }
 
 func (oomh *ownedObjectMetricHolder) getOwnerObjectMetricHolders(cluster string) (omhs []*objectMetricHolder) {
-	for ownerType := range detectedOwnershipTypes[oomh.typeName][cluster] {
+	for ownerType := range oomh.st.detectedOwnershipTypes[oomh.typeName][cluster] {
 		omhs = append(omhs, &objectMetricHolder{oomh.metricHolder, &typeHolder{typeName: ownerType, typeLabel: ownerName}})
 	}
 	return
@@ -467,19 +466,19 @@ func (hmh *hpaMetricHolder) query(suffix ...string) string {
 	return common.SnakeCase(append([]string{kube, hmh.getTypeLabelName()}, suffix...)...)
 }
 
-func (th *typeHolder) getObjectMetricStringIncludeAll(cluster string, result model.Matrix) {
-	th.getObjectMetricStringInclude(cluster, result, nil)
+func (omh *objectMetricHolder) getObjectMetricStringIncludeAll(cluster string, result model.Matrix) {
+	omh.getObjectMetricStringInclude(cluster, result, nil)
 }
 
-func (th *typeHolder) getObjectMetricString(cluster string, result model.Matrix) {
+func (omh *objectMetricHolder) getObjectMetricString(cluster string, result model.Matrix) {
 	// https://github.com/kubernetes/kube-state-metrics/issues/1927
 	// only in kube_pod_info node label is overridden with the true value
-	th.getObjectMetricStringInclude(cluster, result, excludeNodeLabel)
+	omh.getObjectMetricStringInclude(cluster, result, excludeNodeLabel)
 }
 
-func (th *typeHolder) getObjectMetricStringInclude(cluster string, result model.Matrix, f includeFunc) {
+func (omh *objectMetricHolder) getObjectMetricStringInclude(cluster string, result model.Matrix, f includeFunc) {
 	for _, ss := range result {
-		_, obj, ok := th.getObject(cluster, ss, false)
+		_, obj, ok := omh.getObject(cluster, ss, false)
 		if !ok {
 			continue
 		}
@@ -487,7 +486,7 @@ func (th *typeHolder) getObjectMetricStringInclude(cluster string, result model.
 	}
 }
 
-func addToLabelMap(m model.Metric, labelMap map[string]string, f includeFunc) {
+func addToLabelMap(m model.Metric, labelMap common.LabelValues, f includeFunc) {
 	for ln, lv := range m {
 		k := string(ln)
 		v := string(lv)
@@ -510,8 +509,8 @@ var (
 	hpaTargets     = []string{common.Deployment, common.StatefulSet, common.ReplicaSet, common.ReplicationController, common.Rollout}
 )
 
-func makeHpaWorkload() [][]model.SamplePair {
-	return make([][]model.SamplePair, common.Params.Collection.HistoryInt)
+func makeHpaWorkload(historyInt int) [][]model.SamplePair {
+	return make([][]model.SamplePair, historyInt)
 }
 
 func newHpa(obj *k8sObject, name, metricName, metricTargetType string, metricTargetValue float64) *hpa {
@@ -522,7 +521,7 @@ func newHpa(obj *k8sObject, name, metricName, metricTargetType string, metricTar
 		metricTargetType:  metricTargetType,
 		metricTargetValue: metricTargetValue,
 		targetMetrics:     []*hpaTargetMetric{{Name: metricName, Type: metricTargetType, Value: metricTargetValue}},
-		labels:            make(map[string]string),
+		labels:            make(common.LabelValues),
 	}
 	if obj != nil {
 		obj.hpa = h
@@ -538,12 +537,8 @@ func (h *hpa) addToLabelMap(ss *model.SampleStream) {
 	addToLabelMap(ss.Metric, h.labels, excludeNodeLabel)
 }
 
-func (h *hpa) getGlobalMap() hpaMap {
-	return hpaMaps[h.isClassified()]
-}
-
-func (h *hpa) addHpa(cluster, nsName, hpaValue string) {
-	m := h.getGlobalMap()
+func (st *state) addHpa(h *hpa, cluster, nsName, hpaValue string) {
+	m := st.hpaMaps[h.isClassified()]
 	if m[cluster] == nil {
 		m[cluster] = make(map[string]map[string]*hpa)
 	}
@@ -570,8 +565,8 @@ func (h *hpa) merge(metricName, metricTargetType string, metricTargetValue float
 	}
 }
 
-func findHpa(cluster, nsName, hpaName string) (h *hpa, ok bool) {
-	for _, m := range hpaMaps {
+func (st *state) findHpa(cluster, nsName, hpaName string) (h *hpa, ok bool) {
+	for _, m := range st.hpaMaps {
 		if h, ok = m[cluster][nsName][hpaName]; ok {
 			break
 		}
@@ -579,10 +574,10 @@ func findHpa(cluster, nsName, hpaName string) (h *hpa, ok bool) {
 	return
 }
 
-func (th *typeHolder) getHpa(cluster string, result model.Matrix) {
+func (omh *objectMetricHolder) getHpa(cluster string, result model.Matrix) {
 	for _, ss := range result {
-		hpaLabel := th.getTypeLabelName()
-		nsName, ns, values, ok := getNamespaceAndValues([]string{strKind, strName, hpaLabel, metricNameLabel, metricTargetTypeLabel}, cluster, ss)
+		hpaLabel := omh.getTypeLabelName()
+		nsName, ns, values, ok := omh.st.getNamespaceAndValues([]string{strKind, strName, hpaLabel, metricNameLabel, metricTargetTypeLabel}, cluster, ss)
 		if !ok {
 			continue
 		}
@@ -591,7 +586,7 @@ func (th *typeHolder) getHpa(cluster string, result model.Matrix) {
 		oid := &objectId{kind: kind, name: name}
 		var obj *k8sObject
 		if obj, ok = ns.objects[oid.Key(nsName)]; !ok {
-			common.LogCluster(1, common.Warn, common.ClusterFormat+" failed to find HPA scale target reference of kind %s and name %s in namespace %s", cluster, true, cluster, kind, name, nsName)
+			omh.st.rc.LogCluster(1, common.Warn, common.ClusterFormat+" failed to find HPA scale target reference of kind %s and name %s in namespace %s", cluster, true, cluster, kind, name, nsName)
 			continue
 		}
 		metricTargetValue := common.LastValue(ss)
@@ -599,24 +594,24 @@ func (th *typeHolder) getHpa(cluster string, result model.Matrix) {
 		metricName := strings.ReplaceAll(strings.ReplaceAll(values[metricNameLabel], common.Comma, common.Underscore), common.DoubleQuote, common.Empty)
 		metricTargetType := strings.ReplaceAll(strings.ReplaceAll(values[metricTargetTypeLabel], common.Comma, common.Underscore), common.DoubleQuote, common.Empty)
 		var h *hpa
-		if h, ok = findHpa(cluster, nsName, values[hpaLabel]); ok {
+		if h, ok = omh.st.findHpa(cluster, nsName, values[hpaLabel]); ok {
 			h.merge(metricName, metricTargetType, metricTargetValue)
 		} else {
 			h = newHpa(obj, values[hpaLabel], metricName, metricTargetType, metricTargetValue)
-			h.addHpa(cluster, nsName, values[hpaLabel])
+			omh.st.addHpa(h, cluster, nsName, values[hpaLabel])
 		}
 		h.addToLabelMap(ss)
 	}
 }
 
-func (th *typeHolder) getHpaMetricString(cluster string, result model.Matrix) {
+func (omh *objectMetricHolder) getHpaMetricString(cluster string, result model.Matrix) {
 	for _, ss := range result {
-		nsName, ns, hpaValue, ok := getNamespaceAndValue(th, cluster, ss)
+		nsName, ns, hpaValue, ok := omh.st.getNamespaceAndValue(omh.typeHolder, cluster, ss)
 		if !ok {
 			continue
 		}
 		var h *hpa
-		h, ok = findHpa(cluster, nsName, hpaValue)
+		h, ok = omh.st.findHpa(cluster, nsName, hpaValue)
 		if !ok {
 			// try to guess the HPA target, assuming the HPA will have the same name as the target
 			oid := &objectId{name: hpaValue}
@@ -632,7 +627,7 @@ func (th *typeHolder) getHpaMetricString(cluster string, result model.Matrix) {
 				// no luck finding target
 				h = newHpa(nil, hpaValue, common.Empty, common.Empty, common.UnknownValueFloat)
 			}
-			h.addHpa(cluster, nsName, hpaValue)
+			omh.st.addHpa(h, cluster, nsName, hpaValue)
 		}
 		h.addToLabelMap(ss)
 	}
@@ -640,9 +635,9 @@ func (th *typeHolder) getHpaMetricString(cluster string, result model.Matrix) {
 
 var resourceHolder = &typeHolder{typeName: common.Resource}
 
-func getNamespaceLimits(cluster string, result model.Matrix) {
+func (st *state) getNamespaceLimits(cluster string, result model.Matrix) {
 	for _, ss := range result {
-		_, ns, resource, ok := getNamespaceAndValue(resourceHolder, cluster, ss)
+		_, ns, resource, ok := st.getNamespaceAndValue(resourceHolder, cluster, ss)
 		if !ok {
 			continue
 		}
@@ -663,9 +658,9 @@ func getNamespaceLimits(cluster string, result model.Matrix) {
 	}
 }
 
-func getNamespaceMetricString(cluster string, result model.Matrix) {
+func (st *state) getNamespaceMetricString(cluster string, result model.Matrix) {
 	for _, ss := range result {
-		_, ns, _, ok := getNamespaceAndValue(nil, cluster, ss)
+		_, ns, _, ok := st.getNamespaceAndValue(nil, cluster, ss)
 		if !ok {
 			continue
 		}
@@ -705,9 +700,9 @@ type workloadQuery struct {
 	groupClauses       map[string]*queryProcessorBuilder
 }
 
-func (th *typeHolder) containerFields(cluster string, fields []string) (cf []string, ok bool) {
+func (omh *objectMetricHolder) containerFields(cluster string, fields []string) (cf []string, ok bool) {
 	ctrIdx := containerIdx
-	hasOwnerKind := th != nil && th.typeName != common.Empty
+	hasOwnerKind := omh.typeHolder != nil && omh.typeName != common.Empty
 	if !hasOwnerKind {
 		ctrIdx++
 	}
@@ -721,17 +716,17 @@ func (th *typeHolder) containerFields(cluster string, fields []string) (cf []str
 	}
 	nsName := fields[nsIdx]
 	var ns *namespace
-	if ns, ok = namespaces[cluster][nsName]; !ok {
+	if ns, ok = omh.st.namespaces[cluster][nsName]; !ok {
 		return
 	}
 	var objKind string
 	if hasOwnerKind {
-		objKind = th.typeName
+		objKind = omh.typeName
 	} else {
 		objKind = strings.ToLower(fields[ctrIdx-1])
 	}
 	var owner *k8sObject
-	if owner, ok = getObject(cluster, nsName, objKind, fields[podIdx], ns, !hasOwnerKind); ok {
+	if owner, ok = omh.st.getObject(cluster, nsName, objKind, fields[podIdx], ns, !hasOwnerKind); ok {
 		if _, ok = owner.containers[fields[ctrIdx]]; ok {
 			cf = append([]string{nsName, owner.name, getOwnerKindValue(owner.kind)}, fields[ctrIdx:]...)
 		}
@@ -739,7 +734,7 @@ func (th *typeHolder) containerFields(cluster string, fields []string) (cf []str
 	return
 }
 
-func getWorkload(wq *workloadQuery) {
+func (st *state) getWorkload(wq *workloadQuery) {
 	for aggregator, aggSuffix := range wq.aggregators {
 		var agg string
 		if agg, _ = wq.aggregatorNames[aggregator]; agg == common.Empty {
@@ -748,7 +743,7 @@ func getWorkload(wq *workloadQuery) {
 		wmh := newAggregatorWorkloadMetricHolder(agg, wq.aggregatorAsSuffix, wq.hasSuffix, wq.metricName)
 		for _, lh := range labelHolders {
 			queries := make(map[string]*common.QueryProcessor, len(wq.groupClauses))
-			if lh.detected {
+			if st.detectedLabelHolders[lh] {
 				q := wq.baseQuery + aggSuffix
 				if wqw := lh.wqws[wq.wqwIdx]; wqw != nil {
 					q = wqw.Wrap(q)
@@ -762,7 +757,7 @@ func getWorkload(wq *workloadQuery) {
 					}
 					queries[query] = lh.getQueryProcessor(qpb)
 				}
-				wmh.GetWorkloadQueryVariants(1, queries, common.ContainerEntityKind)
+				wmh.GetWorkloadQueryVariants(st.rc, 1, queries, common.ContainerEntityKind)
 			}
 		}
 	}
@@ -797,48 +792,54 @@ var (
 
 var targetMetricSubject = [2]string{target, common.Metric}
 
+// metricHolders returns the workload metric holders of the container and HPA outputs of the query
+func (hwq *hpaWorkloadQuery) metricHolders() (swmh, xwmh *common.WorkloadMetricHolder) {
+	mn := hpaPrefix
+	xfn := hpaExtraPrefix
+	if len(hwq.querySubject) != 2 || targetMetricSubject != ([2]string)(hwq.querySubject) {
+		mn = append(mn, hwq.querySubject...)
+		xfn = append(xfn, hwq.querySubject...)
+	}
+	mn = append(mn, hwq.metricNameSuffixes...)
+	xfn = append(xfn, hwq.metricNameSuffixes...)
+	swmh = common.NewWorkloadMetricHolder(mn...)
+	xwmh = common.NewWorkloadMetricHolder(mn...).OverrideFileName(xfn...)
+	return
+}
+
 func (hwq *hpaWorkloadQuery) getWorkload(hmh *hpaMetricHolder, labelFilter string) {
+	rc := hmh.st.rc
 	csvHeaderFormat, f := common.GetCsvHeaderFormat(common.HpaEntityKind, common.Metric)
 	if !f {
-		common.LogError(fmt.Errorf("no CSV header format found"), common.EntityFormat)
+		rc.LogError(fmt.Errorf("no CSV header format found"), common.EntityFormat)
 		return
 	}
 	// reset the workload for ALL HPAs
-	for _, hMap := range hpaMaps {
+	for _, hMap := range hmh.st.hpaMaps {
 		for _, cluster := range hMap {
 			for _, ns := range cluster {
 				for _, h := range ns {
-					h.workload = makeHpaWorkload()
+					h.workload = makeHpaWorkload(rc.Params().Collection.HistoryInt)
 				}
 			}
 		}
 	}
-	mn := hpaPrefix
-	xfn := hpaExtraPrefix
-	if len(hwq.querySubject) != 2 || targetMetricSubject != ([2]string)(hwq.querySubject) {
-		mn = append(mn, hwq.querySubject...)
-		xfn = append(xfn, hwq.querySubject...)
-	}
-	mn = append(mn, hwq.metricNameSuffixes...)
-	xfn = append(xfn, hwq.metricNameSuffixes...)
-	swmh := common.NewWorkloadMetricHolder(mn...)
-	xwmh := common.NewWorkloadMetricHolder(mn...).OverrideFileName(xfn...)
+	swmh, xwmh := hwq.metricHolders()
 	wmhs := map[bool]*common.WorkloadMetricHolder{true: swmh, false: xwmh}
-	l := len(wmhs)
 	q := append([]string{hwq.queryContext}, hwq.querySubject...)
-	query := hmh.query(q...) + labelFilter
+	query := rc.OverrideQuery(common.ContainerEntityKind, swmh.GetFileName(), hmh.query(q...)+labelFilter)
 	var foundValues map[string]bool
-	for historyInterval := 0; historyInterval < common.Params.Collection.HistoryInt; historyInterval++ {
-		range5Min := common.TimeRangeForInterval(time.Duration(historyInterval))
-		if crm, _, err := common.CollectMetric(2, query, range5Min); err != nil {
-			common.LogErrorWithLevel(1, common.Warn, err, common.QueryFormat, swmh.GetMetricName(), query)
+	for historyInterval := 0; historyInterval < rc.Params().Collection.HistoryInt; historyInterval++ {
+		range5Min := rc.TimeRangeForInterval(time.Duration(historyInterval))
+		if crm, _, err := rc.CollectMetric(2, query, range5Min); err != nil {
+			rc.LogErrorWithLevel(1, common.Warn, err, common.QueryFormat, swmh.GetMetricName(), query)
 		} else {
 			foundValues = make(map[string]bool)
 			for cluster, result := range crm {
 				for _, ss := range result.Matrix {
-					if nsName, _, hpaValue, ok := getNamespaceAndValue(hmh.typeHolder, cluster, ss); ok {
+					if nsName, _, hpaValue, ok := hmh.st.getNamespaceAndValue(hmh.typeHolder, cluster, ss); ok {
 						var h *hpa
-						if h, ok = findHpa(cluster, nsName, hpaValue); ok {
+						if h, ok = hmh.st.findHpa(cluster, nsName, hpaValue); ok {
 							h.workload[historyInterval] = append(h.workload[historyInterval], ss.Values...)
 							if len(ss.Values) > 0 {
 								foundValues[cluster] = true
@@ -852,18 +853,15 @@ func (hwq *hpaWorkloadQuery) getWorkload(hmh *hpaMetricHolder, labelFilter strin
 	if len(foundValues) == 0 {
 		return
 	}
-	clusterFiles := make(map[string]map[bool]*os.File)
-	for historyInterval := 0; historyInterval < common.Params.Collection.HistoryInt; historyInterval++ {
-		for isClassified, hMap := range hpaMaps {
+	clusterFiles := make(hpaWorkloadFiles)
+	for historyInterval := 0; historyInterval < rc.Params().Collection.HistoryInt; historyInterval++ {
+		for isClassified, hMap := range hmh.st.hpaMaps {
 			for clName, cluster := range hMap {
 				if !foundValues[clName] {
 					continue
 				}
-				if clusterFiles[clName] == nil {
-					clusterFiles[clName] = make(map[bool]*os.File, l)
-				}
 				wmh := wmhs[isClassified]
-				clusterFiles[clName][isClassified] = common.InitWorkloadFile(clName, wmh.GetFileName(), hpaWorkloadEntityTypes[isClassified], csvHeaderFormat, wmh.GetMetricName())
+				sink := clusterFiles.get(rc, clName, isClassified, wmh, csvHeaderFormat)
 				for nsName, ns := range cluster {
 					for hpaName, h := range ns {
 						var fieldSet [][]string
@@ -875,8 +873,8 @@ func (hwq *hpaWorkloadQuery) getWorkload(hmh *hpaMetricHolder, labelFilter strin
 							fieldSet = append(fieldSet, []string{nsName, common.Empty, common.Empty, common.Empty, hpaName})
 						}
 						for _, fields := range fieldSet {
-							if err := common.WriteValues(clusterFiles[clName][isClassified], clName, common.JoinComma(fields...), h.workload[historyInterval], nil); err != nil {
-								common.LogError(err, common.ClusterFileFormat, clName, wmhs[isClassified].GetFileName())
+							if err := rc.WriteValues(sink, clName, wmh.GetMetricName(), fields, h.workload[historyInterval], nil); err != nil {
+								rc.LogError(err, common.ClusterFileFormat, clName, wmhs[isClassified].GetFileName())
 							}
 						}
 					}
@@ -885,18 +883,37 @@ func (hwq *hpaWorkloadQuery) getWorkload(hmh *hpaMetricHolder, labelFilter strin
 		}
 	}
 	// close the workload files
-	for cluster, files := range clusterFiles {
-		for isClassified, file := range files {
-			if file != nil {
-				if err := file.Close(); err != nil {
-					common.LogError(err, common.ClusterFileFormat, cluster, wmhs[isClassified].GetFileName())
+	for cluster, sinks := range clusterFiles {
+		for isClassified, sink := range sinks {
+			if sink != nil {
+				if err := rc.CloseWorkloadFile(sink); err != nil {
+					rc.LogError(err, common.ClusterFileFormat, cluster, wmhs[isClassified].GetFileName())
 				}
 			}
 		}
 	}
 }
 
+// hpaWorkloadFiles holds the workload files of an HPA metric per cluster and classification, each created once
+// and written for all history intervals
+type hpaWorkloadFiles map[string]map[bool]common.Sink
+
+// get returns the workload file of a cluster and classification, creating it on first use; a file which failed
+// to be created is nil and not retried
+func (hwf hpaWorkloadFiles) get(rc *common.RunContext, cluster string, isClassified bool, wmh *common.WorkloadMetricHolder, csvHeaderFormat string) common.Sink {
+	if hwf[cluster] == nil {
+		hwf[cluster] = make(map[bool]common.Sink, 2)
+	}
+	sink, f := hwf[cluster][isClassified]
+	if !f {
+		sink = rc.InitWorkloadFile(cluster, wmh.GetFileName(), hpaWorkloadEntityTypes[isClassified], csvHeaderFormat, wmh.GetMetricName())
+		hwf[cluster][isClassified] = sink
+	}
+	return sink
+}
+
 type containerWorkloadProducer struct {
+	st      *state
 	cluster string
 	nsName  string
 	obj     *k8sObject
@@ -911,13 +928,13 @@ func (cwp *containerWorkloadProducer) GetEntityKind() string {
 	return common.ContainerEntityKind
 }
 
-func (cwp *containerWorkloadProducer) GetRowPrefixes() (rps []string) {
+func (cwp *containerWorkloadProducer) GetEntities() (entities [][]string) {
 	if cwp.c == nil {
 		for cName := range cwp.obj.containers {
-			rps = append(rps, cwp.getRowPrefix(cName))
+			entities = append(entities, cwp.getEntity(cName))
 		}
 	} else {
-		rps = append(rps, cwp.getRowPrefix(cwp.c.name))
+		entities = append(entities, cwp.getEntity(cwp.c.name))
 	}
 	return
 }
@@ -928,16 +945,16 @@ func (cwp *containerWorkloadProducer) ShouldWrite(metric string) bool {
 	}
 	var f bool
 	var w map[*container]bool
-	if w, f = written[metric]; f {
+	if w, f = cwp.st.written[metric]; f {
 		f = w[cwp.c]
 	} else {
 		w = make(map[*container]bool)
-		written[metric] = w
+		cwp.st.written[metric] = w
 	}
 	w[cwp.c] = true
 	return !f
 }
 
-func (cwp *containerWorkloadProducer) getRowPrefix(cName string) string {
-	return fmt.Sprintf("%s,%s,%s,%s,%s", cwp.cluster, cwp.nsName, cwp.obj.name, getOwnerKindValue(cwp.obj.kind), common.ReplaceColons(cName))
+func (cwp *containerWorkloadProducer) getEntity(cName string) []string {
+	return []string{cwp.cluster, cwp.nsName, cwp.obj.name, getOwnerKindValue(cwp.obj.kind), cwp.st.rc.ReplaceColons(cName)}
 }
@@ -0,0 +1,56 @@
+package container
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/densify-dev/container-data-collection/internal/common"
+	"github.com/prometheus/common/model"
+)
+
+// TestHpaWorkloadFiles checks that an HPA workload file is created once and keeps the values of all history
+// intervals; it used to be re-created for each interval, keeping only the last one
+func TestHpaWorkloadFiles(t *testing.T) {
+	rc := common.NewRunContext(context.Background(), nil)
+	defer rc.End()
+	rc.SetRootFolder(t.TempDir())
+	csvHeaderFormat, _ := common.GetCsvHeaderFormat(common.HpaEntityKind, common.Metric)
+	wmh := common.NewWorkloadMetricHolder(common.Hpa, common.Current, common.Size)
+	for _, entityKind := range hpaWorkloadEntityTypes {
+		if err := os.MkdirAll(filepath.Dir(rc.GetFileName("c1", entityKind, wmh.GetFileName())), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	hwf := make(hpaWorkloadFiles)
+	fields := []string{"ns", "obj", "Deployment", "c", "h"}
+	for historyInterval := range 2 {
+		sink := hwf.get(rc, "c1", true, wmh, csvHeaderFormat)
+		if sink == nil {
+			t.Fatalf("interval %d: no workload file", historyInterval)
+		}
+		values := []model.SamplePair{{Timestamp: model.Time(historyInterval * 300000), Value: model.SampleValue(historyInterval + 1)}}
+		if err := rc.WriteValues(sink, "c1", wmh.GetMetricName(), fields, values, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if hwf.get(rc, "c1", false, wmh, csvHeaderFormat) == hwf["c1"][true] {
+		t.Error("classified and unclassified HPAs share a workload file")
+	}
+	for _, sinks := range hwf {
+		for _, sink := range sinks {
+			if err := rc.CloseWorkloadFile(sink); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	b, err := os.ReadFile(rc.GetFileName("c1", hpaWorkloadEntityTypes[true], wmh.GetFileName()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Split(strings.TrimSpace(string(b)), "\n"); len(lines) != 3 {
+		t.Errorf("workload file has %d lines, want a header and one per interval:\n%s", len(lines), b)
+	}
+}
@@ -8,7 +8,7 @@ const (
 	idSep               = "__"
 	powerSt             = "powerState"
 	restart             = "restart"
-	noOwnersFoundFormat = common.ClusterFormat + " - no %s owners found"
+	noOwnersFoundFormat = common.ClusterFormat + " no %s owners found"
 	create              = "create"
 	surge               = "surge"
 	unavailable         = "unavailable"
@@ -42,8 +42,13 @@ const (
 )
 
 var (
-	restarts    = common.Plural(restart)
-	hpaFullName = common.JoinNoSep(horizontal, common.Pod, autoscaler)
+	restarts = common.Plural(restart)
+	// names of the container workloads
+	cpuName                   = common.CamelCase(common.Cpu, common.MCoresSt)
+	cpuThrottlingPercentName  = common.CamelCase(common.Cpu, common.Throttling, common.Percent)
+	cpuThrottlingSecondsName  = common.CamelCase(common.Cpu, common.Throttling, common.Seconds)
+	ephemeralStorageUsageName = common.CamelCase(common.Ephemeral, common.Storage, common.Usage, common.Bytes)
+	hpaFullName               = common.JoinNoSep(horizontal, common.Pod, autoscaler)
 	// ownership labels
 	ownerName = common.SnakeCase(common.Owner, common.Name)
 	ownerKind = common.SnakeCase(common.Owner, common.Kind)
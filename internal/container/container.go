@@ -3,7 +3,6 @@ package container
 import (
 	"fmt"
 	"strings"
-	"sync"
 	"time"
 
 	"github.com/densify-dev/container-data-collection/internal/common"
@@ -15,7 +14,7 @@ import (
 type namespace struct {
 	objects                                               map[string]*k8sObject
 	cpuLimit, cpuRequest, memLimit, memRequest, podsLimit int
-	labelMap                                              map[string]string
+	labelMap                                              common.LabelValues
 }
 
 type objectId struct {
@@ -147,7 +146,7 @@ type k8sObject struct {
 	containers  map[string]*container
 	currentSize int
 	createTime  time.Time
-	labelMap    map[string]string
+	labelMap    common.LabelValues
 	hpa         *hpa
 	qosClass    string
 }
@@ -166,7 +165,7 @@ type container struct {
 	name                           string
 	gpuModel, gpuSharingStrategy   string
 	runtimes                       *Runtimes
-	labelMap                       map[string]string
+	labelMap                       common.LabelValues
 }
 
 var nonContinuousKinds = map[string]bool{
@@ -228,21 +227,59 @@ type hpa struct {
 	metricName        string
 	metricTargetType  string
 	metricTargetValue float64
-	labels            map[string]string
+	labels            common.LabelValues
 	targetMetrics     []*hpaTargetMetric
 	workload          [][]model.SamplePair
 }
 
 type hpaMap map[string]map[string]map[string]*hpa
 
-var (
-	namespaces       = make(map[string]map[string]*namespace)
-	ownerships       = make(map[string]clusterOwnerships)
-	detectedOwners   = make(map[string]map[string]bool)
-	objectHpas       = make(hpaMap)
-	unclassifiedHpas = make(hpaMap)
-	hpaMaps          = map[bool]hpaMap{true: objectHpas, false: unclassifiedHpas}
-)
+// state holds the namespaces, owners and HPAs of a run
+type state struct {
+	rc                       *common.RunContext
+	range5Min                *v1.Range
+	namespaces               map[string]map[string]*namespace
+	ownerships               map[string]clusterOwnerships
+	detectedOwners           map[string]map[string]bool
+	detectedOwnershipTypes   map[string]map[string]map[string]bool
+	unclassifiedHpas         hpaMap
+	hpaMaps                  map[bool]hpaMap
+	clusterLabelHolders      map[string]*labelHolder
+	detectedLabelHolders     map[*labelHolder]bool
+	indicators               *common.Indicators
+	written                  map[string]map[*container]bool
+	containerWorkloadWriters *common.WorkloadWriters
+}
+
+type stateKey struct{}
+
+func getState(rc *common.RunContext) *state {
+	return common.CollectorState(rc, stateKey{}, newState)
+}
+
+func newState(rc *common.RunContext) *state {
+	objectHpas := make(hpaMap)
+	unclassifiedHpas := make(hpaMap)
+	return &state{
+		rc:                       rc,
+		namespaces:               make(map[string]map[string]*namespace),
+		ownerships:               make(map[string]clusterOwnerships),
+		detectedOwners:           make(map[string]map[string]bool),
+		detectedOwnershipTypes:   make(map[string]map[string]map[string]bool),
+		unclassifiedHpas:         unclassifiedHpas,
+		hpaMaps:                  map[bool]hpaMap{true: objectHpas, false: unclassifiedHpas},
+		clusterLabelHolders:      make(map[string]*labelHolder),
+		detectedLabelHolders:     make(map[*labelHolder]bool),
+		indicators:               common.NewIndicators(),
+		written:                  make(map[string]map[*container]bool),
+		containerWorkloadWriters: rc.NewWorkloadWriters(),
+	}
+}
+
+// objectHolder binds th to the state of the run
+func (st *state) objectHolder(th *typeHolder) *objectMetricHolder {
+	return &objectMetricHolder{metricHolder: &metricHolder{st: st}, typeHolder: th}
+}
 
 func key(s ...string) string {
 	return common.Join(idSep, s...)
@@ -280,7 +317,7 @@ func (th *typeHolder) getKey(ss *model.SampleStream) (k string) {
 
 func (th *typeHolder) getValues(ss *model.SampleStream) (values map[string]string, ok bool) {
 	typeLabelName := th.getTypeLabelName()
-	if _, _, values, ok = getNamespaceAndValues([]string{typeLabelName}, common.Empty, ss); ok {
+	if _, values, ok = getNamespaceNameAndValues([]string{typeLabelName}, ss); ok {
 		values[common.Kind] = th.typeName
 		values[common.Name] = values[typeLabelName]
 	}
@@ -306,35 +343,33 @@ var (
 	hpaTypeHolders = []*typeHolder{hpath, oldhpath}
 )
 
-var detectedOwnershipTypes = make(map[string]map[string]map[string]bool)
-
 var ownerLabelNames = []string{ownerKind, ownerName}
 
-func (th *typeHolder) getOwners(cluster string, result model.Matrix) {
+func (omh *objectMetricHolder) getOwners(cluster string, result model.Matrix) {
 	var co clusterOwnerships
 	var f bool
-	if co, f = ownerships[cluster]; !f {
+	if co, f = omh.st.ownerships[cluster]; !f {
 		co = make(clusterOwnerships)
-		ownerships[cluster] = co
+		omh.st.ownerships[cluster] = co
 	}
 	var do map[string]bool
-	if do, f = detectedOwners[cluster]; !f {
+	if do, f = omh.st.detectedOwners[cluster]; !f {
 		do = make(map[string]bool)
-		detectedOwners[cluster] = do
+		omh.st.detectedOwners[cluster] = do
 	}
 	var ott map[string]map[string]bool
-	if ott, f = detectedOwnershipTypes[th.typeName]; !f {
+	if ott, f = omh.st.detectedOwnershipTypes[omh.typeName]; !f {
 		ott = make(map[string]map[string]bool)
-		detectedOwnershipTypes[th.typeName] = ott
+		omh.st.detectedOwnershipTypes[omh.typeName] = ott
 	}
 	for _, ss := range result {
-		// don't pass cluster name as the cluster is not populated yet and we don't need the namespace
-		if nsName, _, values, ok := getNamespaceAndValues(ownerLabelNames, common.Empty, ss); ok {
+		// the namespaces of the cluster are not populated yet and we don't need them
+		if nsName, values, ok := getNamespaceNameAndValues(ownerLabelNames, ss); ok {
 			owShip := newOwnership(values[ownerKind], values[ownerName])
-			ownedId := th.getObjectId(ss)
+			ownedId := omh.getObjectId(ss)
 			ownedKey := ownedId.Key(nsName)
 			co[ownedKey] = owShip
-			if isRelevant(cluster, nsName, ownedId) {
+			if omh.st.isRelevant(cluster, nsName, ownedId) {
 				do[owShip.directOwner.Key(nsName)] = true
 				var cott map[string]bool
 				if cott, f = ott[cluster]; !f {
@@ -346,22 +381,22 @@ func (th *typeHolder) getOwners(cluster string, result model.Matrix) {
 		}
 	}
 	if len(co) == 0 {
-		common.LogCluster(1, common.Info, noOwnersFoundFormat, cluster, true, cluster, common.Plural(th.typeName))
+		omh.st.rc.LogCluster(1, common.Info, noOwnersFoundFormat, cluster, true, cluster, common.Plural(omh.typeName))
 	}
 }
 
-func addContainerAndOwners(cluster string, result model.Matrix) {
+func (st *state) addContainerAndOwners(cluster string, result model.Matrix) {
 	var co clusterOwnerships
 	var f bool
-	if co, f = ownerships[cluster]; !f {
+	if co, f = st.ownerships[cluster]; !f {
 		err := fmt.Errorf("failed to find ownerships for cluster %s", cluster)
-		common.LogError(err, "internal error")
+		st.rc.LogError(err, "internal error")
 		return
 	}
 	var cl map[string]*namespace
-	if cl, f = namespaces[cluster]; !f {
+	if cl, f = st.namespaces[cluster]; !f {
 		cl = make(map[string]*namespace)
-		namespaces[cluster] = cl
+		st.namespaces[cluster] = cl
 	}
 	for _, ss := range result {
 		nsName, podName, containerName, ok := stdLabelHolder.values(ss)
@@ -377,7 +412,7 @@ func addContainerAndOwners(cluster string, result model.Matrix) {
 				memLimit:   common.UnknownValue,
 				memRequest: common.UnknownValue,
 				podsLimit:  common.UnknownValue,
-				labelMap:   make(map[string]string),
+				labelMap:   make(common.LabelValues),
 			}
 			cl[nsName] = ns
 		}
@@ -410,7 +445,7 @@ func addContainerAndOwners(cluster string, result model.Matrix) {
 				objectId:    owner,
 				containers:  make(map[string]*container),
 				currentSize: common.UnknownValue,
-				labelMap:    make(map[string]string),
+				labelMap:    make(common.LabelValues),
 			}
 			ns.objects[ownerKey] = obj
 		}
@@ -435,20 +470,20 @@ func addContainerAndOwners(cluster string, result model.Matrix) {
 			ephemeralStorageLimit:   common.UnknownValue,
 			ephemeralStorageRequest: common.UnknownValue,
 			name:                    containerName,
-			labelMap:                make(map[string]string),
+			labelMap:                make(common.LabelValues),
 			runtimes:                &Runtimes{runtimes: make([]*Runtime, 0), fingerprints: make(map[uint64]bool)},
 		}
 	}
 }
 
-func getOwnerQuery(metricName string, owned bool) (query string) {
+func (st *state) getOwnerQuery(metricName string, owned bool) (query string) {
 	// Azure Monitor does not support PromQL regex properly -
 	// https://learn.microsoft.com/en-us/azure/azure-monitor/essentials/prometheus-api-promql#api-limitations
 	// claims that "Query/series does not support regular expression filter".
 	// In practice, it is supported, but with limitations;
 	// e.g. regex with OR of an empty string like "<none>|" returns ALL label values i.s.o. "<none>" and the empty string only
 	var binOp, logOp string
-	if common.GetObservabilityPlatform() == common.AzureMonitorManagedPrometheus {
+	if st.rc.GetObservabilityPlatform() == common.AzureMonitorManagedPrometheus {
 		if owned {
 			binOp = "!="
 			logOp = "and"
@@ -472,290 +507,290 @@ func initContainersQuery(extraLabels ...string) string {
 	return fmt.Sprintf(`max(kube_pod_init_container_info{%s="%s"}) by (%s, %s, %s, %s)`, restartPolicyLabel, always, common.Container, common.Pod, common.Namespace, common.JoinComma(extraLabels...))
 }
 
-var range5Min *v1.Range
-
 // Metrics function to collect data related to containers.
-func Metrics() {
+func Metrics(rc *common.RunContext) {
+	st := getState(rc)
 	var query string
 	var err error
 	var n int
 
-	range5Min = common.TimeRange()
+	range5Min := rc.TimeRange()
+	st.range5Min = range5Min
 
-	common.DebugLogMemStats(1, "container data collection")
+	rc.DebugLogMemStats(1, "container data collection")
 	// queries to gather hierarchy information for containers
-	query = fmt.Sprintf(`sum(%s) by (namespace, pod, owner_name, owner_kind)`, getOwnerQuery("kube_pod_owner", true))
-	if n, err = common.CollectAndProcessMetric(query, range5Min, pth.getOwners); err != nil || n == 0 {
+	query = fmt.Sprintf(`sum(%s) by (namespace, pod, owner_name, owner_kind)`, st.getOwnerQuery("kube_pod_owner", true))
+	if n, err = rc.CollectAndProcessMetric(query, range5Min, st.objectHolder(pth).getOwners); err != nil || n == 0 {
 		// error already handled
 		return
 	}
-	query = fmt.Sprintf(`sum(%s) by (namespace, replicaset, owner_name, owner_kind)`, getOwnerQuery("kube_replicaset_owner", true))
-	_, _ = common.CollectAndProcessMetric(query, range5Min, rsth.getOwners)
-	query = fmt.Sprintf(`sum(%s) by (namespace, job_name, owner_name, owner_kind)`, getOwnerQuery("kube_job_owner", true))
-	_, _ = common.CollectAndProcessMetric(query, range5Min, jth.getOwners)
+	query = fmt.Sprintf(`sum(%s) by (namespace, replicaset, owner_name, owner_kind)`, st.getOwnerQuery("kube_replicaset_owner", true))
+	_, _ = rc.CollectAndProcessMetric(query, range5Min, st.objectHolder(rsth).getOwners)
+	query = fmt.Sprintf(`sum(%s) by (namespace, job_name, owner_name, owner_kind)`, st.getOwnerQuery("kube_job_owner", true))
+	_, _ = rc.CollectAndProcessMetric(query, range5Min, st.objectHolder(jth).getOwners)
 	query = fmt.Sprintf(`max(kube_pod_container_info{}) by (%s, %s, %s) or %s`, common.Container, common.Pod, common.Namespace, initContainersQuery(restartPolicyLabel))
-	if n, err = common.CollectAndProcessMetric(query, range5Min, addContainerAndOwners); err != nil || n == 0 {
+	if n, err = rc.CollectAndProcessMetric(query, range5Min, st.addContainerAndOwners); err != nil || n == 0 {
 		// error already handled
 		return
 	}
 
 	// container metrics
-	common.DebugLogObjectMemStats(common.Container)
-	containerWorkloadWriters.AddMetricWorkloadWriters(common.CurrentSize, common.CpuLimits, common.CpuRequests, common.MemoryLimits, common.MemoryRequests, common.GpuLimits, common.GpuRequests, common.EphemeralStorageRequests, common.EphemeralStorageLimits)
+	rc.DebugLogObjectMemStats(common.Container)
+	st.containerWorkloadWriters.AddMetricWorkloadWriters(common.CurrentSize, common.CpuLimits, common.CpuRequests, common.MemoryLimits, common.MemoryRequests, common.GpuLimits, common.GpuRequests, common.EphemeralStorageRequests, common.EphemeralStorageLimits)
 
-	mh := &metricHolder{}
-	if node.HasBeylaExporter(range5Min) {
+	mh := &metricHolder{st: st}
+	if node.HasBeylaExporter(rc, range5Min) {
 		mh.metric = runtime
 		mh.isOTelMetric = true
 		query = fmt.Sprintf("max(%s%s) by (%s, %s, %s ,%s ,%s)", common.SurveyInfo, common.Braces, common.SemconvNamespaceName, common.SemconvKind, common.SemconvOwnerName, common.SemconvContainerName, common.TelemetrySdkLanguage)
-		_, _ = common.CollectAndProcessMetric(query, range5Min, mh.getContainerMetric)
+		_, _ = rc.CollectAndProcessMetric(query, range5Min, mh.getContainerMetric)
 		mh.isOTelMetric = false
 	}
 
 	mh.metric = common.Memory
 	query = `container_spec_memory_limit_bytes{name!~"k8s_POD_.*"}`
-	_, _ = common.CollectAndProcessMetric(query, range5Min, mh.getContainerMetric)
+	_, _ = rc.CollectAndProcessMetric(query, range5Min, mh.getContainerMetric)
 
-	if node.HasDcgmExporter(range5Min) {
+	if node.HasDcgmExporter(rc, range5Min) {
 		mh.metric = common.GpuMemoryTotal
 		query = fmt.Sprintf("sum(%s) by (namespace, pod, container, %s, %s)", common.DcgmExporterLabelReplace("DCGM_FI_DEV_FB_USED{} + DCGM_FI_DEV_FB_FREE{}"), common.Node, common.ModelName)
-		_, _ = common.CollectAndProcessMetric(query, range5Min, mh.getContainerMetric)
+		_, _ = rc.CollectAndProcessMetric(query, range5Min, mh.getContainerMetric)
 	}
 
 	stsq := fmt.Sprintf(`sgn(sum(sum_over_time(kube_pod_container_info{}[%dm])) by (namespace,pod,container) - max(sum_over_time(kube_pod_container_status_terminated{}[%dm]) or sum_over_time(kube_pod_container_status_terminated_reason{}[%dm]) or sum_over_time(kube_pod_container_info{}[%dm])/100000) by (namespace,pod,container) or sum(sum_over_time(kube_pod_init_container_info{restart_policy="Always"}[%dm])) by (namespace,pod,container) - max(sum_over_time(kube_pod_init_container_status_terminated{}[%dm]) or sum_over_time(kube_pod_init_container_status_terminated_reason{}[%dm]) or sum_over_time(kube_pod_init_container_info{}[%dm])/100000) by (namespace,pod,container))`,
-		common.Params.Collection.SampleRate, common.Params.Collection.SampleRate, common.Params.Collection.SampleRate, common.Params.Collection.SampleRate, common.Params.Collection.SampleRate, common.Params.Collection.SampleRate, common.Params.Collection.SampleRate, common.Params.Collection.SampleRate)
+		rc.Params().Collection.SampleRate, rc.Params().Collection.SampleRate, rc.Params().Collection.SampleRate, rc.Params().Collection.SampleRate, rc.Params().Collection.SampleRate, rc.Params().Collection.SampleRate, rc.Params().Collection.SampleRate, rc.Params().Collection.SampleRate)
 	mh.metric = powerSt
 	query = stsq
-	_, _ = common.CollectAndProcessMetric(query, range5Min, mh.getContainerMetric)
+	_, _ = rc.CollectAndProcessMetric(query, range5Min, mh.getContainerMetric)
 
 	fstsq := fmt.Sprintf(" unless on (namespace,pod,container) (%s == 0)", stsq)
 	mh.metric = common.Limits
 	query = fmt.Sprintf("sum(kube_pod_container_resource_limits{}%s) by (pod,namespace,container,resource) or sum(kube_pod_init_container_resource_limits{}) by (pod,namespace,container,resource)", fstsq)
-	if n, err = common.CollectAndProcessMetric(query, range5Min, mh.getContainerMetric); err != nil || n < common.NumClusters() {
+	if n, err = rc.CollectAndProcessMetric(query, range5Min, mh.getContainerMetric); err != nil || n < rc.NumClusters() {
 		mh.metric = common.CpuLimit
 		query = fmt.Sprintf("sum(kube_pod_container_resource_limits_cpu_cores{}%s) by (pod,namespace,container)", fstsq)
-		_, _ = common.CollectAndProcessMetric(query, range5Min, mh.getContainerMetric)
+		_, _ = rc.CollectAndProcessMetric(query, range5Min, mh.getContainerMetric)
 		mh.metric = common.MemLimit
 		query = fmt.Sprintf("sum(kube_pod_container_resource_limits_memory_bytes{}%s) by (pod,namespace,container)", fstsq)
-		_, _ = common.CollectAndProcessMetric(query, range5Min, mh.getContainerMetric)
+		_, _ = rc.CollectAndProcessMetric(query, range5Min, mh.getContainerMetric)
 	}
 
 	mh.metric = common.Requests
 	query = fmt.Sprintf("sum(kube_pod_container_resource_requests{}%s) by (pod,namespace,container,resource) or sum(kube_pod_init_container_resource_requests{}) by (pod,namespace,container,resource)", fstsq)
-	if n, err = common.CollectAndProcessMetric(query, range5Min, mh.getContainerMetric); err != nil || n < common.NumClusters() {
+	if n, err = rc.CollectAndProcessMetric(query, range5Min, mh.getContainerMetric); err != nil || n < rc.NumClusters() {
 		mh.metric = common.CpuRequest
 		query = fmt.Sprintf("sum(kube_pod_container_resource_requests_cpu_cores{}%s) by (pod,namespace,container)", fstsq)
-		_, _ = common.CollectAndProcessMetric(query, range5Min, mh.getContainerMetric)
+		_, _ = rc.CollectAndProcessMetric(query, range5Min, mh.getContainerMetric)
 		mh.metric = common.MemRequest
 		query = fmt.Sprintf("sum(kube_pod_container_resource_requests_memory_bytes{}%s) by (pod,namespace,container)", fstsq)
-		_, _ = common.CollectAndProcessMetric(query, range5Min, mh.getContainerMetric)
+		_, _ = rc.CollectAndProcessMetric(query, range5Min, mh.getContainerMetric)
 	}
 
-	if node.HasKubexGpuExporter(range5Min) {
+	if node.HasKubexGpuExporter(rc, range5Min) {
 		mh.metric = common.GpuMemoryTotal
 		query = fmt.Sprintf("(%s / %d)", makeKubexGpuQuery("kubex_gpu_container_memory_total_bytes", common.Sum, 0, common.Node, common.GpuModel), common.Mib)
-		_, _ = common.CollectAndProcessMetric(query, range5Min, mh.getContainerMetric)
+		_, _ = rc.CollectAndProcessMetric(query, range5Min, mh.getContainerMetric)
 
 		// need to get limits & requests using specific queries
 		mh.metric = common.GpuRequest
 		query = fmt.Sprintf("max(kubex_gpu_container_requests{}%s) by (pod,namespace,container,gpu_allocation_type)", fstsq)
-		_, _ = common.CollectAndProcessMetric(query, range5Min, mh.getContainerMetric)
+		_, _ = rc.CollectAndProcessMetric(query, range5Min, mh.getContainerMetric)
 		mh.metric = common.GpuLimit
 		query = fmt.Sprintf("max(kubex_gpu_container_limits{}%s) by (pod,namespace,container,gpu_allocation_type)", fstsq)
-		_, _ = common.CollectAndProcessMetric(query, range5Min, mh.getContainerMetric)
+		_, _ = rc.CollectAndProcessMetric(query, range5Min, mh.getContainerMetric)
 	}
 
 	query = `kube_pod_container_info{} or kube_pod_init_container_info{restart_policy="Always"}`
-	_, _ = common.CollectAndProcessMetric(query, range5Min, getContainerMetricString)
+	_, _ = rc.CollectAndProcessMetric(query, range5Min, st.getContainerMetricString)
 
 	// pod metrics
-	common.DebugLogObjectMemStats(common.Pod)
+	rc.DebugLogObjectMemStats(common.Pod)
 	query = `kube_pod_info{}`
-	_, _ = common.CollectAndProcessMetric(query, range5Min, pth.getObjectMetricStringIncludeAll)
+	_, _ = rc.CollectAndProcessMetric(query, range5Min, st.objectHolder(pth).getObjectMetricStringIncludeAll)
 	query = `kube_pod_labels{}`
-	_, _ = common.CollectAndProcessMetric(query, range5Min, pth.getObjectMetricString)
+	_, _ = rc.CollectAndProcessMetric(query, range5Min, st.objectHolder(pth).getObjectMetricString)
 
 	mh.metric = restarts
 	query = `sum(kube_pod_container_status_restarts_total{}) by (pod,namespace,container) or sum(kube_pod_init_container_status_restarts_total{}) by (pod,namespace,container)`
-	_, _ = common.CollectAndProcessMetric(query, range5Min, mh.getContainerMetric)
+	_, _ = rc.CollectAndProcessMetric(query, range5Min, mh.getContainerMetric)
 
 	mh.metric = createTime
 	omh := &objectMetricHolder{metricHolder: mh, typeHolder: pth}
 	query = `kube_pod_created{}`
-	_, _ = common.CollectAndProcessMetric(query, range5Min, omh.getObjectMetric)
+	_, _ = rc.CollectAndProcessMetric(query, range5Min, omh.getObjectMetric)
 
 	mh.metric = qosClass
 	query = `kube_pod_status_qos_class{} == 1`
-	_, _ = common.CollectAndProcessMetric(query, range5Min, omh.getObjectMetric)
+	_, _ = rc.CollectAndProcessMetric(query, range5Min, omh.getObjectMetric)
 
 	// namespace metrics
-	common.DebugLogObjectMemStats(common.Namespace)
+	rc.DebugLogObjectMemStats(common.Namespace)
 	query = `kube_namespace_labels{}`
-	_, _ = common.CollectAndProcessMetric(query, range5Min, getNamespaceMetricString)
+	_, _ = rc.CollectAndProcessMetric(query, range5Min, st.getNamespaceMetricString)
 	query = `kube_namespace_annotations{}`
-	_, _ = common.CollectAndProcessMetric(query, range5Min, getNamespaceMetricString)
+	_, _ = rc.CollectAndProcessMetric(query, range5Min, st.getNamespaceMetricString)
 	// this is min as want to know what the most restrictive quota is if there are multiple.
 	query = `min(kube_resourcequota{type="hard"}) by (resource, namespace)`
-	_, _ = common.CollectAndProcessMetric(query, range5Min, getNamespaceLimits)
+	_, _ = rc.CollectAndProcessMetric(query, range5Min, st.getNamespaceLimits)
 
 	// deployment metrics
-	common.DebugLogObjectMemStats(common.Deployment)
+	rc.DebugLogObjectMemStats(common.Deployment)
 	query = `kube_deployment_labels{}`
-	_, _ = common.CollectAndProcessMetric(query, range5Min, dth.getObjectMetricString)
+	_, _ = rc.CollectAndProcessMetric(query, range5Min, st.objectHolder(dth).getObjectMetricString)
 
 	omh.typeHolder = dth
 	mh.metric = maxSurge
 	query = `kube_deployment_spec_strategy_rollingupdate_max_surge{}`
-	_, _ = common.CollectAndProcessMetric(query, range5Min, omh.getObjectMetric)
+	_, _ = rc.CollectAndProcessMetric(query, range5Min, omh.getObjectMetric)
 	mh.metric = maxUnavailable
 	query = `kube_deployment_spec_strategy_rollingupdate_max_unavailable{}`
-	_, _ = common.CollectAndProcessMetric(query, range5Min, omh.getObjectMetric)
+	_, _ = rc.CollectAndProcessMetric(query, range5Min, omh.getObjectMetric)
 	mh.metric = metadataGeneration
 	query = `kube_deployment_metadata_generation{}`
-	_, _ = common.CollectAndProcessMetric(query, range5Min, omh.getObjectMetric)
+	_, _ = rc.CollectAndProcessMetric(query, range5Min, omh.getObjectMetric)
 	mh.metric = createTime
 	query = `kube_deployment_created{}`
-	_, _ = common.CollectAndProcessMetric(query, range5Min, omh.getObjectMetric)
+	_, _ = rc.CollectAndProcessMetric(query, range5Min, omh.getObjectMetric)
 
 	// replicaset metrics
-	common.DebugLogObjectMemStats(common.ReplicaSet)
+	rc.DebugLogObjectMemStats(common.ReplicaSet)
 	query = `kube_replicaset_labels{}`
-	_, _ = common.CollectAndProcessMetric(query, range5Min, rsth.getObjectMetricString)
+	_, _ = rc.CollectAndProcessMetric(query, range5Min, st.objectHolder(rsth).getObjectMetricString)
 	omh.typeHolder = rsth
 	query = `kube_replicaset_created{}`
-	_, _ = common.CollectAndProcessMetric(query, range5Min, omh.getObjectMetric)
+	_, _ = rc.CollectAndProcessMetric(query, range5Min, omh.getObjectMetric)
 
 	// replicationcontroller metrics
-	common.DebugLogObjectMemStats(common.ReplicationController)
+	rc.DebugLogObjectMemStats(common.ReplicationController)
 	query = `kube_replicationcontroller_created{}`
-	_, _ = common.CollectAndProcessMetric(query, range5Min, omh.getObjectMetric)
+	_, _ = rc.CollectAndProcessMetric(query, range5Min, omh.getObjectMetric)
 
 	// daemonset metrics
-	common.DebugLogObjectMemStats(common.DaemonSet)
+	rc.DebugLogObjectMemStats(common.DaemonSet)
 	query = `kube_daemonset_labels{}`
-	_, _ = common.CollectAndProcessMetric(query, range5Min, dsth.getObjectMetricString)
+	_, _ = rc.CollectAndProcessMetric(query, range5Min, st.objectHolder(dsth).getObjectMetricString)
 	omh.typeHolder = dsth
 	query = `kube_daemonset_created{}`
-	_, _ = common.CollectAndProcessMetric(query, range5Min, omh.getObjectMetric)
+	_, _ = rc.CollectAndProcessMetric(query, range5Min, omh.getObjectMetric)
 
 	// statefulset metrics
-	common.DebugLogObjectMemStats(common.StatefulSet)
+	rc.DebugLogObjectMemStats(common.StatefulSet)
 	query = `kube_statefulset_labels{}`
-	_, _ = common.CollectAndProcessMetric(query, range5Min, ssth.getObjectMetricString)
+	_, _ = rc.CollectAndProcessMetric(query, range5Min, st.objectHolder(ssth).getObjectMetricString)
 	omh.typeHolder = ssth
 	query = `kube_statefulset_created{}`
-	_, _ = common.CollectAndProcessMetric(query, range5Min, omh.getObjectMetric)
+	_, _ = rc.CollectAndProcessMetric(query, range5Min, omh.getObjectMetric)
 
 	// job metrics
-	common.DebugLogObjectMemStats(common.Job)
+	rc.DebugLogObjectMemStats(common.Job)
 	query = `kube_job_info{} * on (namespace,job_name) group_left (owner_name) max(kube_job_owner{}) by (namespace, job_name, owner_name)`
-	_, _ = common.CollectAndProcessMetric(query, range5Min, jth.getObjectMetricString)
+	_, _ = rc.CollectAndProcessMetric(query, range5Min, st.objectHolder(jth).getObjectMetricString)
 	query = `kube_job_labels{} * on (namespace,job_name) group_left (owner_name) max(kube_job_owner{}) by (namespace, job_name, owner_name)`
-	_, _ = common.CollectAndProcessMetric(query, range5Min, jth.getObjectMetricString)
+	_, _ = rc.CollectAndProcessMetric(query, range5Min, st.objectHolder(jth).getObjectMetricString)
 	omh.typeHolder = jth
 	mh.metric = specCompletions
 	query = `kube_job_spec_completions{} * on (namespace,job_name) group_left (owner_name) max(kube_job_owner{}) by (namespace, job_name, owner_name)`
-	_, _ = common.CollectAndProcessMetric(query, range5Min, omh.getObjectMetric)
+	_, _ = rc.CollectAndProcessMetric(query, range5Min, omh.getObjectMetric)
 	mh.metric = specParallelism
 	query = `kube_job_spec_parallelism{} * on (namespace,job_name) group_left (owner_name) max(kube_job_owner{}) by (namespace, job_name, owner_name)`
-	_, _ = common.CollectAndProcessMetric(query, range5Min, omh.getObjectMetric)
+	_, _ = rc.CollectAndProcessMetric(query, range5Min, omh.getObjectMetric)
 	mh.metric = statusCompletionTime
 	query = `kube_job_status_completion_time{} * on (namespace,job_name) group_left (owner_name) max(kube_job_owner{}) by (namespace, job_name, owner_name)`
-	_, _ = common.CollectAndProcessMetric(query, range5Min, omh.getObjectMetric)
+	_, _ = rc.CollectAndProcessMetric(query, range5Min, omh.getObjectMetric)
 	mh.metric = statusStartTime
 	query = `kube_job_status_start_time{} * on (namespace,job_name) group_left (owner_name) max(kube_job_owner{}) by (namespace, job_name, owner_name)`
-	_, _ = common.CollectAndProcessMetric(query, range5Min, omh.getObjectMetric)
+	_, _ = rc.CollectAndProcessMetric(query, range5Min, omh.getObjectMetric)
 	mh.metric = createTime
 	query = `kube_job_created{}`
-	_, _ = common.CollectAndProcessMetric(query, range5Min, omh.getObjectMetric)
+	_, _ = rc.CollectAndProcessMetric(query, range5Min, omh.getObjectMetric)
 
 	// cronjob metrics
-	common.DebugLogObjectMemStats(common.CronJob)
+	rc.DebugLogObjectMemStats(common.CronJob)
 	query = `kube_cronjob_labels{}`
-	_, _ = common.CollectAndProcessMetric(query, range5Min, cjth.getObjectMetricString)
+	_, _ = rc.CollectAndProcessMetric(query, range5Min, st.objectHolder(cjth).getObjectMetricString)
 	query = `kube_cronjob_info{}`
-	_, _ = common.CollectAndProcessMetric(query, range5Min, cjth.getObjectMetricString)
+	_, _ = rc.CollectAndProcessMetric(query, range5Min, st.objectHolder(cjth).getObjectMetricString)
 	omh.typeHolder = cjth
 	mh.metric = nextScheduleTime
 	query = `kube_cronjob_next_schedule_time{}`
-	_, _ = common.CollectAndProcessMetric(query, range5Min, omh.getObjectMetric)
+	_, _ = rc.CollectAndProcessMetric(query, range5Min, omh.getObjectMetric)
 	mh.metric = lastScheduleTime
 	query = `kube_cronjob_status_last_schedule_time{}`
-	_, _ = common.CollectAndProcessMetric(query, range5Min, omh.getObjectMetric)
+	_, _ = rc.CollectAndProcessMetric(query, range5Min, omh.getObjectMetric)
 	mh.metric = statusActive
 	query = `kube_cronjob_status_active{}`
-	_, _ = common.CollectAndProcessMetric(query, range5Min, omh.getObjectMetric)
+	_, _ = rc.CollectAndProcessMetric(query, range5Min, omh.getObjectMetric)
 	mh.metric = createTime
 	query = `kube_cronjob_created{}`
-	_, _ = common.CollectAndProcessMetric(query, range5Min, omh.getObjectMetric)
+	_, _ = rc.CollectAndProcessMetric(query, range5Min, omh.getObjectMetric)
 
 	// HPA metrics
-	common.DebugLogObjectMemStats(common.Hpa)
+	rc.DebugLogObjectMemStats(common.Hpa)
 	var hmhs []*hpaMetricHolder
 	var totals int
 	for _, th := range hpaTypeHolders {
-		hmh := &hpaMetricHolder{objectMetricHolder: &objectMetricHolder{typeHolder: th}}
+		hmh := &hpaMetricHolder{objectMetricHolder: st.objectHolder(th)}
 		query = fmt.Sprintf("%s%s * on (namespace, %s) group_left (%s, %s) %s%s",
 			hmh.query(spec, target, common.Metric), common.Braces, th.getTypeLabelName(),
 			strKind, strName, hmh.query(common.InfoSt), common.Braces)
-		_, _ = common.CollectAndProcessMetric(query, range5Min, hmh.getHpa)
+		_, _ = rc.CollectAndProcessMetric(query, range5Min, hmh.getHpa)
 		query = hmh.query(common.Labels) + common.Braces
-		if n, err = common.CollectAndProcessMetric(query, range5Min, hmh.getHpaMetricString); n > 0 {
+		if n, err = rc.CollectAndProcessMetric(query, range5Min, hmh.getHpaMetricString); n > 0 {
 			hmhs = append(hmhs, hmh)
 		}
-		if totals += n; totals == common.NumClusters() {
+		if totals += n; totals == rc.NumClusters() {
 			break
 		}
 	}
 
 	// current size workloads
-	common.DebugLogObjectMemStats(common.CurrentSizeName)
+	rc.DebugLogObjectMemStats(common.CurrentSizeName)
 	mh.metric = common.CurrentSizeName
 	omh.typeHolder = rsth
 	oomh := &ownedObjectMetricHolder{objectMetricHolder: omh}
 	query = `kube_replicaset_spec_replicas{}`
-	_, _ = common.CollectAndProcessMetric(query, range5Min, omh.getObjectMetric)
+	_, _ = rc.CollectAndProcessMetric(query, range5Min, omh.getObjectMetric)
 	query = `max(max(kube_replicaset_spec_replicas{}) by (namespace,replicaset) * on (namespace,replicaset) group_right max(kube_replicaset_owner{}) by (namespace, replicaset, owner_name)) by (owner_name, namespace)`
-	_, _ = common.CollectAndProcessMetric(query, range5Min, oomh.getObjectMetric)
+	_, _ = rc.CollectAndProcessMetric(query, range5Min, oomh.getObjectMetric)
 	omh.typeHolder = rcth
 	query = `kube_replicationcontroller_spec_replicas{}`
-	_, _ = common.CollectAndProcessMetric(query, range5Min, omh.getObjectMetric)
+	_, _ = rc.CollectAndProcessMetric(query, range5Min, omh.getObjectMetric)
 	omh.typeHolder = dsth
 	query = `kube_daemonset_status_number_available{}`
-	_, _ = common.CollectAndProcessMetric(query, range5Min, omh.getObjectMetric)
+	_, _ = rc.CollectAndProcessMetric(query, range5Min, omh.getObjectMetric)
 	omh.typeHolder = ssth
 	query = `kube_statefulset_replicas{}`
-	_, _ = common.CollectAndProcessMetric(query, range5Min, omh.getObjectMetric)
+	_, _ = rc.CollectAndProcessMetric(query, range5Min, omh.getObjectMetric)
 	omh.typeHolder = jth
-	jczsq := fmt.Sprintf("max_over_time(kube_job_spec_parallelism{}[%dm]) and (max_over_time(kube_job_status_active{}[%dm]) == 1)", common.Params.Collection.SampleRate, common.Params.Collection.SampleRate)
+	jczsq := fmt.Sprintf("max_over_time(kube_job_spec_parallelism{}[%dm]) and (max_over_time(kube_job_status_active{}[%dm]) == 1)", rc.Params().Collection.SampleRate, rc.Params().Collection.SampleRate)
 	query = jczsq
-	_, _ = common.CollectAndProcessMetric(query, range5Min, omh.getObjectMetric)
+	_, _ = rc.CollectAndProcessMetric(query, range5Min, omh.getObjectMetric)
 	query = fmt.Sprintf("max(max(%s) by (namespace,job_name) * on (namespace,job_name) group_right max(kube_job_owner{}) by (namespace, job_name, owner_name)) by (owner_name, namespace)", jczsq)
-	_, _ = common.CollectAndProcessMetric(query, range5Min, oomh.getObjectMetric)
+	_, _ = rc.CollectAndProcessMetric(query, range5Min, oomh.getObjectMetric)
 
-	containerWorkloadWriters.CloseAndClearWorkloadWriters(common.ContainerEntityKind)
-	clear(written)
+	st.containerWorkloadWriters.CloseAndClearWorkloadWriters(common.ContainerEntityKind)
+	clear(st.written)
 
-	writeConfig()
-	writeAttributes()
+	st.writeConfig()
+	st.writeAttributes()
 
 	// container workloads
-	common.DebugLogObjectMemStats(common.JoinSpace(common.Container, common.Workload))
-	groupClauses := buildGroupClauses(common.Metric)
+	rc.DebugLogObjectMemStats(common.JoinSpace(common.Container, common.Workload))
+	groupClauses := st.buildGroupClauses(common.Metric)
 	wq := &workloadQuery{
 		wqwIdx:       podIdx,
 		hasSuffix:    true,
 		aggregators:  map[string]string{common.Max: common.Empty, common.Avg: common.Empty},
 		groupClauses: groupClauses,
 	}
-	getCpuWorkloads(wq)
-	getMemoryWorkloads(wq)
+	st.getCpuWorkloads(wq)
+	st.getMemoryWorkloads(wq)
 
 	wq.aggregators[common.Max] = common.Empty
 	wq.aggregators[common.Avg] = common.Empty
 
-	if node.HasEphemeralStorageExporter(range5Min) {
-		wq.metricName = common.CamelCase(common.Ephemeral, common.Storage, common.Usage, common.Bytes)
+	if node.HasEphemeralStorageExporter(rc, range5Min) {
+		wq.metricName = ephemeralStorageUsageName
 		wq.aggregatorAsSuffix = true
 		rootfsUsage := common.LabelReplace(`ephemeral_storage_container_rootfs_used_bytes{name!~"k8s_POD_.*"}`, common.Container, common.ExportedContainer, common.HasValue)
 		logUsage := common.LabelReplace(`ephemeral_storage_container_logs_used_bytes{name!~"k8s_POD_.*"}`, common.Container, common.ExportedContainer, common.HasValue)
@@ -765,7 +800,7 @@ func Metrics() {
 		queryTemplate := fmt.Sprintf(`(%[1]s + %[2]s) + on (pod_name, pod_namespace, container) group_left() (sum by (pod_name, pod_namespace, container) (%[3]s * on (pod_name, pod_namespace, volume_name) group_left() (%[4]s == 1)) or sum by (pod_name, pod_namespace, container) (%[2]s * 0)) + on (pod_name, pod_namespace, container) group_left() (sum by (pod_name, pod_namespace, container) (bottomk (1, %[3]s) by (pod_name, pod_namespace, volume_name)  and on (pod_name, pod_namespace, volume_name) (%[4]s > 1)) or sum by (pod_name, pod_namespace, container) (%[2]s * 0))`, rootfsUsage, logUsage, volumeUsage, volumeCount)
 		query = common.LabelReplace(common.LabelReplace(queryTemplate, common.Pod, common.PodName, common.Always), common.Namespace, common.PodNamespace, common.Always)
 		wq.baseQuery = fmt.Sprintf(`max(%s) by (instance,%s,namespace,%s)`, query, labelPlaceholders[podIdx], labelPlaceholders[containerIdx]) + terminatedFilter
-		getWorkload(wq)
+		st.getWorkload(wq)
 	}
 
 	// container_fs_usage_bytes is an issue if the k8s cluster container runtime is containerd, see
@@ -774,20 +809,20 @@ func Metrics() {
 	wq.metricName = common.Disk
 	wq.aggregatorAsSuffix = false
 	wq.baseQuery = fmt.Sprintf(`max(container_fs_usage_bytes{name!~"k8s_POD_.*"}) by (instance,%s,namespace,%s)`, labelPlaceholders[podIdx], labelPlaceholders[containerIdx])
-	getWorkload(wq)
+	st.getWorkload(wq)
 
-	wq.metricName = common.CamelCase(common.Cpu, common.Throttling, common.Percent)
+	wq.metricName = cpuThrottlingPercentName
 	wq.baseQuery = fmt.Sprintf(`(sum by (instance, %s, namespace, %s) (increase(container_cpu_cfs_throttled_periods_total{name!~"k8s_POD_.*"}[%dm])) / sum by (instance, %s, namespace, %s) (increase(container_cpu_cfs_periods_total{name!~"k8s_POD_.*"}[%dm]) > 0)) * 100`,
-		labelPlaceholders[podIdx], labelPlaceholders[containerIdx], common.Params.Collection.SampleRate, labelPlaceholders[podIdx], labelPlaceholders[containerIdx], common.Params.Collection.SampleRate)
-	getWorkload(wq)
+		labelPlaceholders[podIdx], labelPlaceholders[containerIdx], rc.Params().Collection.SampleRate, labelPlaceholders[podIdx], labelPlaceholders[containerIdx], rc.Params().Collection.SampleRate)
+	st.getWorkload(wq)
 
-	wq.metricName = common.CamelCase(common.Cpu, common.Throttling, common.Seconds)
+	wq.metricName = cpuThrottlingSecondsName
 	wq.aggregators = map[string]string{common.Sum: common.Empty}
 	wq.baseQuery = fmt.Sprintf(`sum(increase(container_cpu_cfs_throttled_seconds_total{name!~"k8s_POD_.*"}[%dm])) by (instance,%s,namespace,%s)`,
-		common.Params.Collection.SampleRate, labelPlaceholders[podIdx], labelPlaceholders[containerIdx])
-	getWorkload(wq)
+		rc.Params().Collection.SampleRate, labelPlaceholders[podIdx], labelPlaceholders[containerIdx])
+	st.getWorkload(wq)
 
-	getGpuWorkloads(range5Min, wq, common.Params.Collection.SampleRate)
+	st.getGpuWorkloads(wq, rc.Params().Collection.SampleRate)
 
 	wq.metricName = restarts
 	wq.wqwIdx = containerIdx
@@ -795,8 +830,8 @@ func Metrics() {
 	wq.aggregators = map[string]string{common.Sum: common.Empty}
 	wq.aggregatorNames = map[string]string{common.Sum: common.Max}
 	wq.baseQuery = fmt.Sprintf(`max((round(increase(kube_pod_container_status_restarts_total{}[%dm]),1))%s) by (instance,pod,namespace,%s) or (max((round(increase(kube_pod_init_container_status_restarts_total{}[%dm]),1))) by (instance,pod,namespace,container) and (%s == 1))`,
-		common.Params.Collection.SampleRate, fstsq, labelPlaceholders[containerIdx], common.Params.Collection.SampleRate, initContainersQuery(common.Instance))
-	getWorkload(wq)
+		rc.Params().Collection.SampleRate, fstsq, labelPlaceholders[containerIdx], rc.Params().Collection.SampleRate, initContainersQuery(common.Instance))
+	st.getWorkload(wq)
 
 	spmxr := &hpaWorkloadQuery{
 		queryContext: spec,
@@ -828,7 +863,7 @@ func Metrics() {
 			metricNameSuffixes: []string{scaling, limited},
 		}
 		for _, lh := range labelHolders {
-			if lh.detected {
+			if st.detectedLabelHolders[lh] {
 				labelFilter = hpaStatusConditionLabelFilter(lh)
 				hwq.getWorkload(hmh, labelFilter)
 			}
@@ -849,41 +884,40 @@ func Metrics() {
 	}
 }
 
-func getCpuWorkloads(wq *workloadQuery) {
-	getAvgMaxSeparateQueries(wq, cpuQueryMap())
+func (st *state) getCpuWorkloads(wq *workloadQuery) {
+	st.getAvgMaxSeparateQueries(wq, cpuQueryMap(st.rc.Params().Collection.SampleRate))
 }
 
-func cpuQueryMap() map[string][]*baseWorkloadQuery {
-	mName := common.CamelCase(common.Cpu, common.MCoresSt)
+func cpuQueryMap(sampleRate uint64) map[string][]*baseWorkloadQuery {
 	return map[string][]*baseWorkloadQuery{
 		common.Max: {
 			{
-				metricName: mName,
-				baseQuery:  fmt.Sprintf(`%s(round(1000 * irate(container_cpu_usage_seconds_total{name!~"k8s_POD_.*"}[*3]), 1)[%dm:*1])`, common.AggOverTime(common.Max), common.Params.Collection.SampleRate),
+				metricName: cpuName,
+				baseQuery:  fmt.Sprintf(`%s(round(1000 * irate(container_cpu_usage_seconds_total{name!~"k8s_POD_.*"}[*3]), 1)[%dm:*1])`, common.AggOverTime(common.Max), sampleRate),
 			},
 		},
 		common.Avg: {
 			{
-				metricName: mName,
-				baseQuery:  fmt.Sprintf(`1000 * rate(container_cpu_usage_seconds_total{name!~"k8s_POD_.*"}[%dm])`, common.Params.Collection.SampleRate),
+				metricName: cpuName,
+				baseQuery:  fmt.Sprintf(`1000 * rate(container_cpu_usage_seconds_total{name!~"k8s_POD_.*"}[%dm])`, sampleRate),
 			},
 		},
 	}
 }
 
-func getMemoryWorkloads(wq *workloadQuery) {
-	getAvgMaxSeparateQueries(wq, memQueryMap())
+func (st *state) getMemoryWorkloads(wq *workloadQuery) {
+	st.getAvgMaxSeparateQueries(wq, st.memQueryMap())
 }
 
-func addToQueryMap(queryMap map[string][]*baseWorkloadQuery, mName, agg, metric, suffix string) {
+func (st *state) addToQueryMap(queryMap map[string][]*baseWorkloadQuery, mName, agg, metric, suffix string) {
 	queryMap[agg] = append(queryMap[agg], &baseWorkloadQuery{
 		metricName: mName,
-		baseQuery:  common.AggOverTimeQuery(metric, agg),
+		baseQuery:  st.rc.AggOverTimeQuery(metric, agg),
 		aggSuffix:  suffix,
 	})
 }
 
-func memQueryMap() map[string][]*baseWorkloadQuery {
+func (st *state) memQueryMap() map[string][]*baseWorkloadQuery {
 	queryMap := make(map[string][]*baseWorkloadQuery)
 	suffixes := map[string]string{
 		common.Avg: " / (1024 * 1024)",
@@ -896,19 +930,19 @@ func memQueryMap() map[string][]*baseWorkloadQuery {
 	}
 	for _, agg := range aggregators {
 		for mName, metric := range metrics {
-			addToQueryMap(queryMap, mName, agg, metric, suffixes[agg])
+			st.addToQueryMap(queryMap, mName, agg, metric, suffixes[agg])
 		}
 	}
 	return queryMap
 }
 
-func getAvgMaxSeparateQueries(wq *workloadQuery, queryMap map[string][]*baseWorkloadQuery) {
+func (st *state) getAvgMaxSeparateQueries(wq *workloadQuery, queryMap map[string][]*baseWorkloadQuery) {
 	for agg, baseQueries := range queryMap {
 		for _, baseQuery := range baseQueries {
 			wq.metricName = baseQuery.metricName
 			wq.baseQuery = baseQuery.baseQuery
 			wq.aggregators = map[string]string{agg: baseQuery.aggSuffix}
-			getWorkload(wq)
+			st.getWorkload(wq)
 		}
 	}
 }
@@ -1010,12 +1044,14 @@ func toMib(q string) string {
 	return fmt.Sprintf("(%s / %d)", q, common.Mib)
 }
 
-func getGpuWorkloads(range5Min *v1.Range, wq *workloadQuery, sampleRate uint64) {
-	ge := node.DetermineGpuExporter(range5Min)
-	gqg := gqgs[ge]
-	if gqg == nil {
+func (st *state) getGpuWorkloads(wq *workloadQuery, sampleRate uint64) {
+	ge := node.DetermineGpuExporter(st.rc, st.range5Min)
+	base := gqgs[ge]
+	if base == nil {
 		return
 	}
+	// the generator is set per query, work on a copy of the shared one
+	gqg := *base
 	gpuWorkloadQueries := makeGpuWorkloadQueries(sampleRate)
 	wq.aggregatorAsSuffix = true
 	for _, agg := range aggregators {
@@ -1030,10 +1066,10 @@ func getGpuWorkloads(range5Min *v1.Range, wq *workloadQuery, sampleRate uint64)
 			} else {
 				gqg.F = gwq.queryFunc[ge]
 				gqg.UseSubquery = gwq.useSubquery[ge]
-				wq.baseQuery = gqg.GpuAggOverTimeQuery(baseQuery, agg)
+				wq.baseQuery = gqg.GpuAggOverTimeQuery(baseQuery, agg, st.rc.Step())
 			}
 			wq.aggregators = map[string]string{agg: common.Empty}
-			getWorkload(wq)
+			st.getWorkload(wq)
 		}
 	}
 	// restore the default
@@ -1047,16 +1083,16 @@ const (
 	jobGroupClause           = ` * on (namespace,pod) group_left (job) max(label_replace(kube_pod_owner{owner_kind="Job"}, "job", "$1", "owner_name", "(.*)")) by (namespace,job,pod) * on (namespace,job) group_left (owner_kind,owner_name) max(label_replace(kube_job_owner{}, "job", "$1", "job_name", "(.*)")) by (namespace,owner_kind,owner_name,job)`
 )
 
-func buildGroupClauses(subject string) map[string]*queryProcessorBuilder {
+func (st *state) buildGroupClauses(subject string) map[string]*queryProcessorBuilder {
 	useSuffix := subject == common.Metric
 	groupClauses := make(map[string]*queryProcessorBuilder, 4)
-	buildGroupClause(groupClauses, false, unownedGroupClause, useSuffix)
-	buildGroupClause(groupClauses, true, directlyOwnedGroupClause, useSuffix)
-	if len(detectedOwnershipTypes[common.ReplicaSet]) > 0 {
-		buildGroupClause(groupClauses, true, replicaSetGroupClause, useSuffix)
+	st.buildGroupClause(groupClauses, false, unownedGroupClause, useSuffix)
+	st.buildGroupClause(groupClauses, true, directlyOwnedGroupClause, useSuffix)
+	if len(st.detectedOwnershipTypes[common.ReplicaSet]) > 0 {
+		st.buildGroupClause(groupClauses, true, replicaSetGroupClause, useSuffix)
 	}
-	if len(detectedOwnershipTypes[common.Job]) > 0 {
-		buildGroupClause(groupClauses, true, jobGroupClause, useSuffix)
+	if len(st.detectedOwnershipTypes[common.Job]) > 0 {
+		st.buildGroupClause(groupClauses, true, jobGroupClause, useSuffix)
 	}
 	return groupClauses
 }
@@ -1066,9 +1102,8 @@ type groupClauseBuilder struct {
 	args   []any
 }
 
-func buildGroupClause(qpbs map[string]*queryProcessorBuilder, owned bool, clauseFormat string, useSuffix bool) {
-	ensureGroupClauseBuilders()
-	gcb := groupClauseBuilders[owned]
+func (st *state) buildGroupClause(qpbs map[string]*queryProcessorBuilder, owned bool, clauseFormat string, useSuffix bool) {
+	gcb := st.groupClauseBuilder(owned)
 	clf := clauseFormat
 	var args []any
 	if useSuffix {
@@ -1087,18 +1122,14 @@ func buildGroupClause(qpbs map[string]*queryProcessorBuilder, owned bool, clause
 		lnt = podLabelNames
 		th = pth
 	}
-	qpbs[cl] = &queryProcessorBuilder{lnt: lnt, th: th}
+	qpbs[cl] = &queryProcessorBuilder{lnt: lnt, oh: st.objectHolder(th)}
 }
 
-var groupClauseBuilders map[bool]*groupClauseBuilder
-
-var gcbOnce sync.Once
-
-func ensureGroupClauseBuilders() {
-	gcbOnce.Do(func() {
-		groupClauseBuilders = map[bool]*groupClauseBuilder{
-			true:  {suffix: `) by (namespace,owner_kind,owner_name,%s)`},
-			false: {suffix: `) by (namespace,pod,%s)`, args: []any{getOwnerQuery("kube_pod_owner", false), labelPlaceholders[containerIdx]}},
-		}
-	})
+// groupClauseBuilder returns the builder of the group clauses of the owned or unowned containers; the latter
+// depends on the observability platform of the run
+func (st *state) groupClauseBuilder(owned bool) *groupClauseBuilder {
+	if owned {
+		return &groupClauseBuilder{suffix: `) by (namespace,owner_kind,owner_name,%s)`}
+	}
+	return &groupClauseBuilder{suffix: `) by (namespace,pod,%s)`, args: []any{st.getOwnerQuery("kube_pod_owner", false), labelPlaceholders[containerIdx]}}
 }
@@ -0,0 +1,96 @@
+package container
+
+import "github.com/densify-dev/container-data-collection/internal/common"
+
+func aggregatorWorkloadOutputs(aggregatorAsSuffix, workloadSuffix bool, metricName string, aggregators ...string) []string {
+	wmhs := make([]*common.WorkloadMetricHolder, len(aggregators))
+	for i, agg := range aggregators {
+		wmhs[i] = newAggregatorWorkloadMetricHolder(agg, aggregatorAsSuffix, workloadSuffix, metricName)
+	}
+	return common.WorkloadOutputs(common.ContainerEntityKind, wmhs...)
+}
+
+var _ = common.RegisterCoverage(
+	&common.CoverageMetric{Names: []string{"container_cpu_usage_seconds_total"}, Exporter: common.Cadvisor,
+		Outputs: aggregatorWorkloadOutputs(false, true, cpuName, common.Avg, common.Max)},
+	&common.CoverageMetric{Names: []string{"container_memory_usage_bytes"}, Exporter: common.Cadvisor,
+		Outputs: aggregatorWorkloadOutputs(false, true, common.Mem, common.Avg, common.Max)},
+	&common.CoverageMetric{Names: []string{"container_memory_rss"}, Exporter: common.Cadvisor,
+		Outputs: aggregatorWorkloadOutputs(false, true, rss, common.Avg, common.Max)},
+	&common.CoverageMetric{Names: []string{"container_memory_working_set_bytes"}, Exporter: common.Cadvisor,
+		Outputs: aggregatorWorkloadOutputs(false, true, common.WorkingSet, common.Avg, common.Max)},
+	&common.CoverageMetric{Names: []string{"container_fs_usage_bytes"}, Exporter: common.Cadvisor,
+		Outputs: aggregatorWorkloadOutputs(false, true, common.Disk, common.Avg, common.Max),
+		Hint:    "not reported by cAdvisor for the containerd runtime, expected to be missing there"},
+	&common.CoverageMetric{Names: []string{"container_cpu_cfs_throttled_periods_total"}, Exporter: common.Cadvisor,
+		Outputs: common.Outputs(aggregatorWorkloadOutputs(false, true, cpuThrottlingPercentName, common.Avg, common.Max),
+			aggregatorWorkloadOutputs(false, true, cpuThrottlingSecondsName, common.Sum))},
+	&common.CoverageMetric{Names: []string{"container_spec_memory_limit_bytes"}, Exporter: common.Cadvisor,
+		Outputs: configSchema.ColumnOutputs("HwTotalMemory")},
+	&common.CoverageMetric{Names: []string{"kube_pod_info"}, Exporter: common.Ksm,
+		Outputs: []string{configSchema.FileOutput(), attributesSchema.FileOutput()}},
+	&common.CoverageMetric{Names: []string{"kube_pod_owner"}, Exporter: common.Ksm,
+		Outputs: attributesSchema.ColumnOutputs("CreatedByKind", "CreatedByName")},
+	&common.CoverageMetric{Names: []string{"kube_pod_labels"}, Exporter: common.Ksm,
+		Outputs: attributesSchema.ColumnOutputs("PodLabels"), Hint: common.KsmLabelsHint},
+	&common.CoverageMetric{Names: []string{"kube_namespace_labels"}, Exporter: common.Ksm,
+		Outputs: attributesSchema.ColumnOutputs("NamespaceLabels"), Hint: common.KsmLabelsHint},
+	&common.CoverageMetric{Names: []string{"kube_pod_container_resource_limits", "kube_pod_container_resource_limits_cpu_cores"}, Exporter: common.Ksm,
+		Outputs: common.Outputs(attributesSchema.ColumnOutputs("CpuLimit", "MemoryLimit"),
+			common.WorkloadOutputs(common.ContainerEntityKind, common.CpuLimits, common.MemoryLimits))},
+	&common.CoverageMetric{Names: []string{"kube_pod_container_resource_requests", "kube_pod_container_resource_requests_cpu_cores"}, Exporter: common.Ksm,
+		Outputs: common.Outputs(attributesSchema.ColumnOutputs("CpuRequest", "MemoryRequest"),
+			common.WorkloadOutputs(common.ContainerEntityKind, common.CpuRequests, common.MemoryRequests))},
+	&common.CoverageMetric{Names: []string{"kube_pod_container_status_restarts_total"}, Exporter: common.Ksm,
+		Outputs: common.Outputs(attributesSchema.ColumnOutputs("ContainerRestarts"), aggregatorWorkloadOutputs(false, false, restarts, common.Max))},
+	&common.CoverageMetric{Names: []string{"kube_pod_container_status_last_terminated_exitcode"}, Exporter: common.Ksm,
+		Outputs: common.WorkloadOutputs(common.ContainerEntityKind, common.NewWorkloadMetricHolder(common.Events)),
+		Hint:    "available from kube-state-metrics v2.11"},
+	&common.CoverageMetric{Names: []string{"kube_horizontalpodautoscaler_labels", "kube_hpa_labels"}, Exporter: common.Ksm,
+		Outputs: []string{hpaConfigSchema.FileOutput(), hpaAttributesSchema.FileOutput()}},
+	&common.CoverageMetric{Names: []string{"kubex_gpu_container_requests"}, Exporter: common.KubexGpu,
+		Outputs: attributesSchema.ColumnOutputs("GpuRequest", "GpuRequestFloat")},
+	&common.CoverageMetric{Names: []string{"ephemeral_storage_container_rootfs_used_bytes"}, Exporter: common.EphemeralStorageExporter,
+		Outputs: aggregatorWorkloadOutputs(true, true, ephemeralStorageUsageName, common.Avg, common.Max)},
+	&common.CoverageMetric{Names: []string{common.SurveyInfo}, Exporter: common.Beyla,
+		Outputs: attributesSchema.ColumnOutputs("Runtimes")},
+)
+
+// overridableWorkloadMetricHolders returns the workload metric holders of the outputs issuing queries, named by
+// the helpers of the queries
+func overridableWorkloadMetricHolders() (wmhs []*common.WorkloadMetricHolder) {
+	add := func(aggregatorAsSuffix, workloadSuffix bool, metricName string, aggregators ...string) {
+		for _, agg := range aggregators {
+			wmhs = append(wmhs, newAggregatorWorkloadMetricHolder(agg, aggregatorAsSuffix, workloadSuffix, metricName))
+		}
+	}
+	for _, metricName := range []string{cpuName, common.Mem, rss, common.WorkingSet, common.Disk, cpuThrottlingPercentName} {
+		add(false, true, metricName, common.Avg, common.Max)
+	}
+	add(false, true, cpuThrottlingSecondsName, common.Sum)
+	add(false, false, restarts, common.Max)
+	add(true, true, ephemeralStorageUsageName, aggregators...)
+	for _, gwq := range makeGpuWorkloadQueries(0) {
+		add(true, true, gwq.metricName, aggregators...)
+	}
+	hwqs := []*hpaWorkloadQuery{
+		{querySubject: []string{common.Max, common.Replicas}},
+		{querySubject: []string{common.Min, common.Replicas}},
+		{querySubject: []string{common.Current, common.Replicas}},
+		{querySubject: []string{condition}, metricNameSuffixes: []string{scaling, limited}},
+	}
+	for _, c := range []string{target, common.Current} {
+		for _, metricName := range []string{common.Cpu, common.Memory} {
+			for _, t := range []string{common.Avg, common.Utilization} {
+				hwqs = append(hwqs, &hpaWorkloadQuery{querySubject: targetMetricSubject[:], metricNameSuffixes: []string{metricName, c, t}})
+			}
+		}
+	}
+	for _, hwq := range hwqs {
+		swmh, _ := hwq.metricHolders()
+		wmhs = append(wmhs, swmh)
+	}
+	return append(wmhs, common.NewWorkloadMetricHolder(common.Events))
+}
+
+var _ = common.RegisterOverridableOutputs(common.ContainerEntityKind, overridableWorkloadMetricHolders()...)
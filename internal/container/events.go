@@ -29,14 +29,14 @@ const (
 	maxEventCount                     = 100 // should probably be a single digit, take 100 to be on the safe side
 )
 
-func excludeHiddenOomKills(cluster string, query string) bool {
+func (st *state) excludeHiddenOomKills(cluster string, query string) bool {
 	return strings.Contains(query, cadvisorOomKillsMetric) &&
-		kubernetes.HasMinimumVersion(cluster, majorCgroupV2Grouping, minorCgroupV2Grouping)
+		kubernetes.HasMinimumVersion(st.rc, cluster, majorCgroupV2Grouping, minorCgroupV2Grouping)
 }
 
-func excludeKsmLastTerminated(cluster string, query string) (result bool) {
+func (st *state) excludeKsmLastTerminated(cluster string, query string) (result bool) {
 	if result = strings.Contains(query, ksmLastTerminatedExitCode); result {
-		result = common.IsMetricPresent(cluster, ksmLastTerminatedTimestamp) !=
+		result = st.rc.IsMetricPresent(cluster, ksmLastTerminatedTimestamp) !=
 			strings.Contains(query, ksmLastTerminatedTimestamp)
 	}
 	return
@@ -44,6 +44,8 @@ func excludeKsmLastTerminated(cluster string, query string) (result bool) {
 
 type ProcessExitEventProvider struct {
 	PromRange *v1.Range
+	// Interval is the interval of the run
+	Interval time.Duration
 }
 
 // TimeAndValues "parses" a Prometheus SamplePair (Timestamp and Value) and generates a time and values string from it.
@@ -85,7 +87,7 @@ func (peep *ProcessExitEventProvider) TimeAndValues(value *model.SamplePair) *co
 		count = n
 	} else {
 		// the timestamp may lie before the start time, go back a while
-		st := peep.PromRange.Start.Add(-common.Interval).Unix()
+		st := peep.PromRange.Start.Add(-peep.Interval).Unix()
 		if count = n / st; count == 0 {
 			count = 1
 		}
@@ -97,23 +99,25 @@ func (peep *ProcessExitEventProvider) TimeAndValues(value *model.SamplePair) *co
 	isPid1 := math.Round(f*residualFactor) == 0
 	return &common.TimeAndValues{
 		Time:   t,
-		Values: fmt.Sprintf("%d,%v", int(exitCode), isPid1),
+		Values: []any{int(exitCode), isPid1},
 		Count:  int(count),
 	}
 }
 
-func (peep *ProcessExitEventProvider) CalculateRange(historyInterval int) *v1.Range {
-	peep.PromRange = common.TimeRangeForIntervals(time.Duration(historyInterval), 1, common.ApiQueryRange)
+func (peep *ProcessExitEventProvider) CalculateRange(rc *common.RunContext, historyInterval int) *v1.Range {
+	peep.PromRange, peep.Interval = rc.TimeRangeForIntervals(time.Duration(historyInterval), 1, common.ApiQueryRange), rc.Interval()
 	return peep.PromRange
 }
 
-func Events() {
-	common.ResolveMetrics(map[string]common.ResolveMetricFunc{ksmLastTerminatedTimestamp: incrementIndicator})
-	common.RegisterClusterQueryExclusion(noHiddenOomKills, excludeHiddenOomKills)
-	common.RegisterClusterQueryExclusion(noLastTerminated, excludeKsmLastTerminated)
+func Events(rc *common.RunContext) {
+	st := getState(rc)
+	rc.ResolveMetrics(map[string]common.ResolveMetricFunc{ksmLastTerminatedTimestamp: st.incrementIndicator})
+	rc.RegisterClusterQueryExclusion(noHiddenOomKills, st.excludeHiddenOomKills)
+	rc.RegisterClusterQueryExclusion(noLastTerminated, st.excludeKsmLastTerminated)
+	common.SetWorkloadValueTypes(eventMetricName, common.IntColumn, common.BoolColumn)
 	multipliers := map[bool]string{true: common.Asterisk + ksmLastTerminatedTimestamp + common.Braces, false: common.Empty}
 	eventQueries := make(map[string]int, 3)
-	for _, f := range common.FoundIndicatorCounter(indicators, ksmLastTerminatedTimestamp) {
+	for _, f := range rc.FoundIndicatorCounter(st.indicators, ksmLastTerminatedTimestamp) {
 		eventQueries[makeRestartEventQuery(multipliers[f]).String()] = containerIdx
 	}
 	// cadvisor OOM kills are quickly deregistered when the kill causes container restart - see https://github.com/google/cadvisor/issues/3015 ;
@@ -121,8 +125,8 @@ func Events() {
 	// https://github.com/kubernetes/kubernetes/pull/117793
 	oomkeqb := &eventQueryBuilder{baseMetric: cadvisorOomKillsMetric + common.Braces, fraction: fmt.Sprintf(`%.4f`, hiddenOomKillFraction)}
 	eventQueries[oomkeqb.String()] = podIdx
-	groupClauses := buildGroupClauses(common.Event)
-	getEvents(eventQueries, groupClauses)
+	groupClauses := st.buildGroupClauses(common.Event)
+	st.getEvents(rc, eventQueries, groupClauses)
 }
 
 type eventQueryBuilder struct {
@@ -146,20 +150,20 @@ func makeRestartEventQuery(multiplier string) *eventQueryBuilder {
 	return &eventQueryBuilder{baseMetric: ksmRestartsTotal + common.Braces, multiplier: multiplier, fraction: exitCodeFraction}
 }
 
-var indicators = make(map[string]int)
-
-func incrementIndicator(_ string, name string) {
-	indicators[name] = indicators[name] + 1
+func (st *state) incrementIndicator(_ string, name string) {
+	st.indicators.Inc(name)
 }
 
 const (
 	eventMetricName = "ExitCode,IsPid1"
 )
 
-func getEvents(eventQueries map[string]int, groupClauses map[string]*queryProcessorBuilder) {
+// getEvents collects the events with the run context of the container events stage, the state being the one of
+// the container stage
+func (st *state) getEvents(rc *common.RunContext, eventQueries map[string]int, groupClauses map[string]*queryProcessorBuilder) {
 	for _, lh := range labelHolders {
 		queries := make(map[string]*common.QueryProcessor, len(eventQueries)*len(groupClauses))
-		if lh.detected {
+		if st.detectedLabelHolders[lh] {
 			for baseQuery, wqwIdx := range eventQueries {
 				q := baseQuery
 				if wqw := lh.wqws[wqwIdx]; wqw != nil {
@@ -175,7 +179,7 @@ func getEvents(eventQueries map[string]int, groupClauses map[string]*queryProces
 					queries[query] = lh.getQueryProcessor(qpb)
 				}
 			}
-			common.GetWorkloadQueryVariantsFieldConversion(1, common.Events, eventMetricName, queries, common.ContainerEntityKind, common.Event, &ProcessExitEventProvider{})
+			rc.GetWorkloadQueryVariantsFieldConversion(1, common.Events, eventMetricName, queries, common.ContainerEntityKind, common.Event, &ProcessExitEventProvider{})
 		}
 	}
 }
@@ -3,8 +3,6 @@ package container
 
 import (
 	"encoding/json"
-	"fmt"
-	"os"
 	"strings"
 
 	"github.com/densify-dev/container-data-collection/internal/common"
@@ -15,62 +13,79 @@ type namespacesWrite func(name string, cluster map[string]*namespace)
 
 type hpaWrite func(name string, cluster map[string]map[string]*hpa)
 
-func writeConfig() {
-	write(writeConf, writeHpaConf)
+func (st *state) writeConfig() {
+	st.write(st.writeConf, st.writeHpaConf)
 }
 
-func writeAttributes() {
-	write(writeAttrs, writeHpaAttrs)
+func (st *state) writeAttributes() {
+	st.mergeCustomAttributes()
+	st.write(st.writeAttrs, st.writeHpaAttrs)
 }
 
-func write(nw namespacesWrite, hw hpaWrite) {
+// mergeCustomAttributes merges the custom attributes of the containers into their labels
+func (st *state) mergeCustomAttributes() {
+	cas := st.rc.GetCustomAttributes(common.ContainerEntityKind)
+	if cas == nil {
+		return
+	}
+	for name, cluster := range st.namespaces {
+		for nsName, ns := range cluster {
+			for _, obj := range ns.objects {
+				for cName, c := range obj.containers {
+					cas.Merge(name, c.labelMap, nsName, obj.name, getOwnerKindValue(obj.kind), cName)
+				}
+			}
+		}
+	}
+}
+
+func (st *state) write(nw namespacesWrite, hw hpaWrite) {
 	if nw != nil {
-		for name, cluster := range namespaces {
+		for name, cluster := range st.namespaces {
 			nw(name, cluster)
 		}
 	}
 	if hw != nil {
-		for name, cluster := range unclassifiedHpas {
+		for name, cluster := range st.unclassifiedHpas {
 			hw(name, cluster)
 		}
 	}
 }
 
-func writeConf(name string, cluster map[string]*namespace) {
-	configWrite, err := os.Create(common.GetFileNameByType(name, common.ContainerEntityKind, common.Config))
+var configSchema = common.NewSchema(common.ContainerEntityKind, common.Config, 1).
+	Add(common.TimeColumn, false, "AuditTime").
+	Add(common.StringColumn, false, "ClusterName", "Namespace", "EntityName", "EntityType", "ContainerName").
+	Add(common.IntColumn, true, "HwTotalMemory", "GpuMemoryTotal").
+	Add(common.StringColumn, false, "OsName", "HwManufacturer")
+
+// hpaConfigSchema is the schema of the HPAs not associated with an object, which have no object and container
+var hpaConfigSchema = common.NewExtraSchema(common.Hpa, common.Config, 1).
+	Add(common.TimeColumn, false, "AuditTime").
+	Add(common.StringColumn, false, "ClusterName", "Namespace").
+	Add(common.StringColumn, true, "EntityName", "EntityType", "ContainerName").
+	Add(common.StringColumn, false, "HpaName", "OsName", "HwManufacturer")
+
+func (st *state) writeConf(name string, cluster map[string]*namespace) {
+	configWrite, err := st.rc.NewSchemaSink(name, configSchema)
 	if err != nil {
-		common.LogError(err, common.DefaultLogFormat, name, common.ContainerEntityKind)
+		st.rc.LogError(err, common.DefaultLogFormat, name, common.ContainerEntityKind)
 		return
 	}
-	defer func(file *os.File) {
-		if err = file.Close(); err != nil {
-			common.LogError(err, common.DefaultLogFormat, name, common.ContainerEntityKind)
+	defer func(sink common.Sink) {
+		if err = sink.Close(); err != nil {
+			st.rc.LogError(err, common.DefaultLogFormat, name, common.ContainerEntityKind)
 		}
 	}(configWrite)
-	if _, err = fmt.Fprintln(configWrite, "AuditTime,ClusterName,Namespace,EntityName,EntityType,ContainerName,HwTotalMemory,GpuMemoryTotal,OsName,HwManufacturer"); err != nil {
-		common.LogError(err, common.DefaultLogFormat, name, common.ContainerEntityKind)
-		return
-	}
 	for nsName, ns := range cluster {
 		for _, obj := range ns.objects {
 			for cName, c := range obj.containers {
-				if _, err = fmt.Fprintf(configWrite, "%s,%s,%s,%s,%s,%s", common.FormatCurrentTime(), name, nsName, obj.name, getOwnerKindValue(obj.kind), common.ReplaceColons(cName)); err != nil {
-					common.LogError(err, common.DefaultLogFormat, name, common.ContainerEntityKind)
-					return
-				}
 				gpuMemTotal := common.UnknownValue
 				if c.gpuMemCount > 0 {
 					gpuMemTotal = c.gpuMemTotal / c.gpuMemCount
 				}
-				values := []int{c.memory, gpuMemTotal}
-				for _, value := range values {
-					if err = common.PrintCSVPositiveNumberValue(configWrite, value, false); err != nil {
-						common.LogError(err, common.DefaultLogFormat, name, common.ContainerEntityKind)
-						return
-					}
-				}
-				if _, err = fmt.Fprintln(configWrite, ",Linux,CONTAINERS"); err != nil {
-					common.LogError(err, common.DefaultLogFormat, name, common.ContainerEntityKind)
+				if err = configWrite.WriteRecord(st.rc.CurrentTime(), name, nsName, obj.name, getOwnerKindValue(obj.kind), st.rc.ReplaceColons(cName),
+					common.PositiveValue(c.memory), common.PositiveValue(gpuMemTotal), "Linux", "CONTAINERS"); err != nil {
+					st.rc.LogError(err, common.DefaultLogFormat, name, common.ContainerEntityKind)
 					return
 				}
 			}
@@ -78,150 +93,99 @@ func writeConf(name string, cluster map[string]*namespace) {
 	}
 }
 
-func writeHpaConf(name string, cluster map[string]map[string]*hpa) {
+func (st *state) writeHpaConf(name string, cluster map[string]map[string]*hpa) {
 	if len(cluster) == 0 {
-		common.LogCluster(1, common.Info, "no HPA found for cluster %s", name, true, name)
+		st.rc.LogCluster(1, common.Info, "no HPA found for cluster %s", name, true, name)
 		return
 	}
-	configWrite, err := os.Create(common.GetExtraFileNameByType(name, common.Hpa, common.Config))
+	configWrite, err := st.rc.NewSchemaSink(name, hpaConfigSchema)
 	if err != nil {
-		common.LogError(err, common.DefaultLogFormat, name, common.Hpa)
+		st.rc.LogError(err, common.DefaultLogFormat, name, common.Hpa)
 		return
 	}
-	defer func(file *os.File) {
-		if err = file.Close(); err != nil {
-			common.LogError(err, common.DefaultLogFormat, name, common.Hpa)
+	defer func(sink common.Sink) {
+		if err = sink.Close(); err != nil {
+			st.rc.LogError(err, common.DefaultLogFormat, name, common.Hpa)
 		}
 	}(configWrite)
-	if _, err = fmt.Fprintln(configWrite, "AuditTime,ClusterName,Namespace,EntityName,EntityType,ContainerName,HpaName,OsName,HwManufacturer"); err != nil {
-		common.LogError(err, common.DefaultLogFormat, name, common.Hpa)
-		return
-	}
 	for nsName, ns := range cluster {
 		for hpaName := range ns {
-			if _, err = fmt.Fprintf(configWrite, "%s,%s,%s,,,,%s,Linux,HPA\n", common.FormatCurrentTime(), name, nsName, hpaName); err != nil {
-				common.LogError(err, common.DefaultLogFormat, name, common.Hpa)
+			if err = configWrite.WriteRecord(st.rc.CurrentTime(), name, nsName, nil, nil, nil, hpaName, "Linux", "HPA"); err != nil {
+				st.rc.LogError(err, common.DefaultLogFormat, name, common.Hpa)
 				return
 			}
 		}
 	}
 }
 
-func writeAttrs(name string, cluster map[string]*namespace) {
-	attributeWrite, err := os.Create(common.GetFileNameByType(name, common.ContainerEntityKind, common.Attributes))
+var attributesSchema = newAttributesSchema()
+
+func newAttributesSchema() *common.Schema {
+	s := common.NewSchema(common.ContainerEntityKind, common.Attributes, 1).
+		Add(common.StringColumn, false, "ClusterName", "Namespace", "EntityName", "EntityType", "ContainerName", "ContainerType",
+			"VirtualTechnology", "VirtualDomain", "VirtualDatacenter", "VirtualCluster").
+		Add(common.LabelsColumn, false, "ContainerLabels", "PodLabels").
+		Add(common.IntColumn, true, "CpuLimit", "CpuRequest", "MemoryLimit", "MemoryRequest", "GpuLimit", "GpuRequest").
+		Add(common.FloatColumn, true, "GpuLimitFloat", "GpuRequestFloat").
+		Add(common.StringColumn, false, "CurrentNodes", "PowerState", "CreatedByKind", "CreatedByName").
+		Add(common.IntColumn, true, "CurrentSize").
+		Add(common.TimeColumn, true, "CreateTime").
+		Add(common.IntColumn, true, "ContainerRestarts").
+		Add(common.LabelsColumn, false, "NamespaceLabels").
+		Add(common.IntColumn, true, "NamespaceCpuRequest", "NamespaceCpuLimit", "NamespaceMemoryRequest", "NamespaceMemoryLimit", "NamespacePodsLimit")
+	return addHpaColumns(s).
+		Add(common.StringColumn, false, "QosClass", "GpuModel", "GpuSharingStrategy").
+		Add(common.IntColumn, true, "EphemeralStorageRequest", "EphemeralStorageLimit").
+		Add(common.JsonColumn, false, "Runtimes")
+}
+
+var hpaAttributesSchema = addHpaColumns(common.NewExtraSchema(common.Hpa, common.Attributes, 1).
+	Add(common.StringColumn, false, "ClusterName", "Namespace").
+	Add(common.StringColumn, true, "EntityName", "EntityType", "ContainerName"))
+
+// addHpaColumns adds the columns of hpa.attributeValues, which are all nil if the object has no HPA
+func addHpaColumns(s *common.Schema) *common.Schema {
+	return s.Add(common.StringColumn, true, "HpaName").
+		Add(common.LabelsColumn, true, "HpaLabels").
+		Add(common.StringColumn, true, "HpaTargetMetricName", "HpaTargetMetricType").
+		Add(common.FloatColumn, true, "HpaTargetMetricValue").
+		Add(common.StringColumn, true, "HpaTargetMetrics")
+}
+
+func (st *state) writeAttrs(name string, cluster map[string]*namespace) {
+	attributeWrite, err := st.rc.NewSchemaSink(name, attributesSchema)
 	if err != nil {
-		common.LogError(err, common.DefaultLogFormat, name, common.ContainerEntityKind)
+		st.rc.LogError(err, common.DefaultLogFormat, name, common.ContainerEntityKind)
 		return
 	}
-	defer func(file *os.File) {
-		if err = file.Close(); err != nil {
-			common.LogError(err, common.DefaultLogFormat, name, common.ContainerEntityKind)
+	defer func(sink common.Sink) {
+		if err = sink.Close(); err != nil {
+			st.rc.LogError(err, common.DefaultLogFormat, name, common.ContainerEntityKind)
 		}
 	}(attributeWrite)
-	if _, err = fmt.Fprintln(attributeWrite, "ClusterName,Namespace,EntityName,EntityType,ContainerName,ContainerType,VirtualTechnology,VirtualDomain,VirtualDatacenter,VirtualCluster,ContainerLabels,PodLabels,CpuLimit,CpuRequest,MemoryLimit,MemoryRequest,GpuLimit,GpuRequest,GpuLimitFloat,GpuRequestFloat,CurrentNodes,PowerState,CreatedByKind,CreatedByName,CurrentSize,CreateTime,ContainerRestarts,NamespaceLabels,NamespaceCpuRequest,NamespaceCpuLimit,NamespaceMemoryRequest,NamespaceMemoryLimit,NamespacePodsLimit,HpaName,HpaLabels,HpaTargetMetricName,HpaTargetMetricType,HpaTargetMetricValue,HpaTargetMetrics,QosClass,GpuModel,GpuSharingStrategy,EphemeralStorageRequest,EphemeralStorageLimit,Runtimes"); err != nil {
-		common.LogError(err, common.DefaultLogFormat, name, common.ContainerEntityKind)
-		return
-	}
 	for nsName, ns := range cluster {
 		for _, obj := range ns.objects {
 			for cName, c := range obj.containers {
-				if _, err = fmt.Fprintf(attributeWrite, "%s,%s,%s,%s,%s,%v,Containers,%s,%s,%s,", name, nsName, common.ReplaceSemiColons(obj.name), getOwnerKindValue(obj.kind), common.ReplaceColons(cName), c.containerType, name, nsName, obj.name); err != nil {
-					common.LogError(err, common.DefaultLogFormat, name, common.ContainerEntityKind)
-					return
-				}
-				if err = common.ConditionalPrintCSVLabelMap(attributeWrite, c.labelMap, false, rejectKeys); err != nil {
-					common.LogError(err, common.DefaultLogFormat, name, common.ContainerEntityKind)
-					return
-				}
-				if err = common.PrintCSVStringValue(attributeWrite, common.Empty, false); err != nil {
-					common.LogError(err, common.DefaultLogFormat, name, common.ContainerEntityKind)
-					return
-				}
-				if err = common.ConditionalPrintCSVLabelMap(attributeWrite, obj.labelMap, false, rejectKeys); err != nil {
-					common.LogError(err, common.DefaultLogFormat, name, common.ContainerEntityKind)
-					return
-				}
-				values := []int{c.cpuLimit, c.cpuRequest, c.memLimit, c.memRequest, c.gpuLimit, c.gpuRequest}
-				for _, value := range values {
-					if err = common.PrintCSVNumberValue(attributeWrite, value, false); err != nil {
-						common.LogError(err, common.DefaultLogFormat, name, common.ContainerEntityKind)
-						return
-					}
-				}
-				floatValues := []float64{c.gpuLimitFloat, c.gpuRequestFloat}
-				for _, value := range floatValues {
-					if err = common.PrintCSVNumberValue(attributeWrite, value, false); err != nil {
-						common.LogError(err, common.DefaultLogFormat, name, common.ContainerEntityKind)
-						return
-					}
-				}
-				nodes := node.OverrideNodeNames(name, common.ReplaceSemiColonsPipes(obj.labelMap[common.Node]), common.Or)
-				if _, err = fmt.Fprintf(attributeWrite, ",%s,%s,%s,%s", nodes, c.powerState.String(), getOwnerKindValue(obj.kind), obj.name); err != nil {
-					common.LogError(err, common.DefaultLogFormat, name, common.ContainerEntityKind)
-					return
-				}
-				if err = common.PrintCSVNumberValue(attributeWrite, obj.currentSize, false); err != nil {
-					common.LogError(err, common.DefaultLogFormat, name, common.ContainerEntityKind)
-					return
-				}
-				if err = common.PrintCSVTimeValue(attributeWrite, &obj.createTime, false); err != nil {
-					common.LogError(err, common.DefaultLogFormat, name, common.ContainerEntityKind)
-					return
-				}
-				if err = common.PrintCSVNumberValue(attributeWrite, c.restarts, false); err != nil {
-					common.LogError(err, common.DefaultLogFormat, name, common.ContainerEntityKind)
-					return
-				}
-				if err = common.PrintCSVStringValue(attributeWrite, common.Empty, false); err != nil {
-					common.LogError(err, common.DefaultLogFormat, name, common.ContainerEntityKind)
-					return
-				}
-				if err = common.ConditionalPrintCSVLabelMap(attributeWrite, ns.labelMap, false, rejectKeys); err != nil {
-					common.LogError(err, common.DefaultLogFormat, name, common.ContainerEntityKind)
-					return
-				}
-				values = []int{ns.cpuRequest, ns.cpuLimit, ns.memRequest, ns.memLimit, ns.podsLimit}
-				for _, value := range values {
-					if err = common.PrintCSVNumberValue(attributeWrite, value, false); err != nil {
-						common.LogError(err, common.DefaultLogFormat, name, common.ContainerEntityKind)
-						return
-					}
-				}
-				if err = obj.hpa.writeAttributes(attributeWrite, name, common.ContainerEntityKind, false); err != nil {
-					return
-				}
-				if err = common.PrintCSVStringValue(attributeWrite, obj.qosClass, false); err != nil {
-					common.LogError(err, common.DefaultLogFormat, name, common.ContainerEntityKind)
-					return
-				}
-				if err = common.PrintCSVStringValue(attributeWrite, c.gpuModel, false); err != nil {
-					common.LogError(err, common.DefaultLogFormat, name, common.ContainerEntityKind)
-					return
-				}
-				if err = common.PrintCSVStringValue(attributeWrite, c.gpuSharingStrategy, false); err != nil {
-					common.LogError(err, common.DefaultLogFormat, name, common.ContainerEntityKind)
-					return
-				}
-				if err = common.PrintCSVNumberValue(attributeWrite, c.ephemeralStorageRequest, false); err != nil {
-					common.LogError(err, common.DefaultLogFormat, name, common.ContainerEntityKind)
-					return
-				}
-				if err = common.PrintCSVNumberValue(attributeWrite, c.ephemeralStorageLimit, false); err != nil {
-					common.LogError(err, common.DefaultLogFormat, name, common.ContainerEntityKind)
-					return
-				}
 				var jsonRuntimes []byte
 				if jsonRuntimes, err = json.Marshal(c.runtimes.runtimes); err != nil {
-					common.LogError(err, common.DefaultLogFormat, name, common.ContainerEntityKind)
+					st.rc.LogError(err, common.DefaultLogFormat, name, common.ContainerEntityKind)
 					return
 				}
-				jsonRuntimesEscaped := strings.ReplaceAll(string(jsonRuntimes), `"`, `""`)
-				jsonRuntimesEscapedQuoted := fmt.Sprintf(`"%s"`, jsonRuntimesEscaped)
-				if err = common.PrintCSVStringValue(attributeWrite, jsonRuntimesEscapedQuoted, true); err != nil {
-					common.LogError(err, common.DefaultLogFormat, name, common.ContainerEntityKind)
+				values := []any{name, nsName, st.rc.ReplaceSemiColons(obj.name), getOwnerKindValue(obj.kind), st.rc.ReplaceColons(cName), c.containerType.String(),
+					"Containers", name, nsName, obj.name, common.LabelMap{Map: c.labelMap, Reject: rejectKeys}, common.LabelMap{Map: obj.labelMap, Reject: rejectKeys}}
+				values = append(values, common.KnownValues(c.cpuLimit, c.cpuRequest, c.memLimit, c.memRequest, c.gpuLimit, c.gpuRequest)...)
+				values = append(values, common.KnownValues(c.gpuLimitFloat, c.gpuRequestFloat)...)
+				nodes := node.OverrideNodeNames(st.rc, name, strings.Join(obj.labelMap[common.Node], common.Or), common.Or)
+				values = append(values, nodes, c.powerState.String(), getOwnerKindValue(obj.kind), obj.name, common.KnownValue(obj.currentSize),
+					common.TimeValue(&obj.createTime), common.KnownValue(c.restarts), common.LabelMap{Map: ns.labelMap, Reject: rejectKeys})
+				values = append(values, common.KnownValues(ns.cpuRequest, ns.cpuLimit, ns.memRequest, ns.memLimit, ns.podsLimit)...)
+				values = append(values, obj.hpa.attributeValues()...)
+				values = append(values, obj.qosClass, c.gpuModel, c.gpuSharingStrategy, common.KnownValue(c.ephemeralStorageRequest), common.KnownValue(c.ephemeralStorageLimit),
+					json.RawMessage(jsonRuntimes))
+				if err = attributeWrite.WriteRecord(values...); err != nil {
+					st.rc.LogError(err, common.DefaultLogFormat, name, common.ContainerEntityKind)
 					return
 				}
-
 			}
 		}
 	}
@@ -233,85 +197,45 @@ const (
 
 var rejectKeys = map[string]bool{kubeLastAppliedConfLabel: true}
 
-func writeHpaAttrs(name string, cluster map[string]map[string]*hpa) {
+func (st *state) writeHpaAttrs(name string, cluster map[string]map[string]*hpa) {
 	if len(cluster) == 0 {
 		return
 	}
-	attributeWrite, err := os.Create(common.GetExtraFileNameByType(name, common.Hpa, common.Attributes))
+	attributeWrite, err := st.rc.NewSchemaSink(name, hpaAttributesSchema)
 	if err != nil {
-		common.LogError(err, common.DefaultLogFormat, name, common.Hpa)
+		st.rc.LogError(err, common.DefaultLogFormat, name, common.Hpa)
 		return
 	}
-	defer func(file *os.File) {
-		if err = file.Close(); err != nil {
-			common.LogError(err, common.DefaultLogFormat, name, common.Hpa)
+	defer func(sink common.Sink) {
+		if err = sink.Close(); err != nil {
+			st.rc.LogError(err, common.DefaultLogFormat, name, common.Hpa)
 		}
 	}(attributeWrite)
-	if _, err = fmt.Fprintln(attributeWrite, "ClusterName,Namespace,EntityName,EntityType,ContainerName,HpaName,HpaLabels,HpaTargetMetricName,HpaTargetMetricType,HpaTargetMetricValue,HpaTargetMetrics"); err != nil {
-		common.LogError(err, common.DefaultLogFormat, name, common.Hpa)
-		return
-	}
 	for nsName, ns := range cluster {
 		for _, h := range ns {
-			if _, err = fmt.Fprintf(attributeWrite, "%s,%s,,,,", name, nsName); err != nil {
-				common.LogError(err, common.DefaultLogFormat, name, common.Hpa)
-				return
-			}
-			if err = h.writeAttributes(attributeWrite, name, common.Hpa, true); err != nil {
+			values := append([]any{name, nsName, nil, nil, nil}, h.attributeValues()...)
+			if err = attributeWrite.WriteRecord(values...); err != nil {
+				st.rc.LogError(err, common.DefaultLogFormat, name, common.Hpa)
 				return
 			}
 		}
 	}
 }
 
-func (h *hpa) writeAttributes(attributeWrite *os.File, cluster, entityKind string, last bool) error {
-	var err error
+// attributeValues returns the values of the HpaName, HpaLabels, HpaTargetMetricName, HpaTargetMetricType,
+// HpaTargetMetricValue and HpaTargetMetrics columns
+func (h *hpa) attributeValues() []any {
 	if h == nil {
-		if err = common.PrintCSVStringValue(attributeWrite, ",,,,,", last); err != nil {
-			common.LogError(err, common.DefaultLogFormat, cluster, entityKind)
-			return err
-		}
-	} else {
-		if err = common.PrintCSVStringValue(attributeWrite, h.name, false); err != nil {
-			common.LogError(err, common.DefaultLogFormat, cluster, entityKind)
-			return err
-		}
-		if err = common.PrintCSVStringValue(attributeWrite, common.Empty, false); err != nil {
-			common.LogError(err, common.DefaultLogFormat, cluster, entityKind)
-			return err
-		}
-		if err = common.PrintCSVLabelMap(attributeWrite, h.labels, false); err != nil {
-			common.LogError(err, common.DefaultLogFormat, cluster, entityKind)
-			return err
-		}
-		if err = common.PrintCSVStringValue(attributeWrite, h.metricName, false); err != nil {
-			common.LogError(err, common.DefaultLogFormat, cluster, entityKind)
-			return err
-		}
-		if err = common.PrintCSVStringValue(attributeWrite, h.metricTargetType, false); err != nil {
-			common.LogError(err, common.DefaultLogFormat, cluster, entityKind)
-			return err
-		}
-		if err = common.PrintCSVNumberValue(attributeWrite, h.metricTargetValue, false); err != nil {
-			common.LogError(err, common.DefaultLogFormat, cluster, entityKind)
-			return err
-		}
-		var hpaTargetMetrics []string
-		for _, htm := range h.targetMetrics {
-			hpaTargetMetrics = append(hpaTargetMetrics, htm.String())
-		}
-		if err = common.PrintCSVStringValue(attributeWrite, common.Join(hpaSeparator, hpaTargetMetrics...), last); err != nil {
-			common.LogError(err, common.DefaultLogFormat, cluster, entityKind)
-			return err
-		}
+		return make([]any, 6)
+	}
+	var hpaTargetMetrics []string
+	for _, htm := range h.targetMetrics {
+		hpaTargetMetrics = append(hpaTargetMetrics, htm.String())
 	}
-	return nil
+	return []any{h.name, common.LabelMap{Map: h.labels}, h.metricName, h.metricTargetType, common.KnownValue(h.metricTargetValue),
+		common.Join(hpaSeparator, hpaTargetMetrics...)}
 }
 
-var containerWorkloadWriters = common.NewWorkloadWriters()
-
-var written = make(map[string]map[*container]bool)
-
 var ownerLabelValues = []string{common.PodOwner, common.DeploymentOwner, common.JobOwner, common.NodeOwner,
 	common.ReplicaSetOwner, common.DaemonSetOwner, common.StatefulSetOwner,
 	common.ReplicationControllerOwner, common.CronJobOwner, common.ConfigMapOwner,
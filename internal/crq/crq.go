@@ -1,16 +1,14 @@
 package crq
 
 import (
-	"fmt"
 	"github.com/densify-dev/container-data-collection/internal/common"
 	"github.com/prometheus/common/model"
-	"os"
 	"time"
 )
 
 type crq struct {
 	//Labels & general information about each node
-	labelMap map[string]string
+	labelMap common.LabelValues
 
 	selectorType, selectorKey, selectorValue                                                                                              string
 	resources, namespaces                                                                                                                 string
@@ -18,7 +16,19 @@ type crq struct {
 	createTime                                                                                                                            time.Time
 }
 
-var crqs = make(map[string]map[string]*crq)
+// state holds the cluster resource quotas of a run
+type state struct {
+	rc   *common.RunContext
+	crqs map[string]map[string]*crq
+}
+
+type stateKey struct{}
+
+func getState(rc *common.RunContext) *state {
+	return common.CollectorState(rc, stateKey{}, func(rc *common.RunContext) *state {
+		return &state{rc: rc, crqs: make(map[string]map[string]*crq)}
+	})
+}
 
 const (
 	labelCrq   = "name"
@@ -26,17 +36,17 @@ const (
 	labelValue = "value"
 )
 
-func createCRQ(cluster string, result model.Matrix) {
-	if _, f := crqs[cluster]; !f {
+func (st *state) createCRQ(cluster string, result model.Matrix) {
+	if _, f := st.crqs[cluster]; !f {
 		if l := result.Len(); l > 0 {
-			crqs[cluster] = make(map[string]*crq, l)
+			st.crqs[cluster] = make(map[string]*crq, l)
 		}
 	}
 	for _, ss := range result {
 		unixTimeInt := int64(ss.Values[len(ss.Values)-1].Value)
 		crqName := string(ss.Metric[labelCrq])
-		crqs[cluster][crqName] = &crq{
-			labelMap:        make(map[string]string),
+		st.crqs[cluster][crqName] = &crq{
+			labelMap:        make(common.LabelValues),
 			cpuLimit:        common.UnknownValue,
 			cpuRequest:      common.UnknownValue,
 			memLimit:        common.UnknownValue,
@@ -52,34 +62,34 @@ func createCRQ(cluster string, result model.Matrix) {
 	}
 }
 
-func extractCRQAttributes(cluster string, result model.Matrix) {
+func (st *state) extractCRQAttributes(cluster string, result model.Matrix) {
 	for _, val := range result {
 		crqNameLabel, ok := val.Metric[labelCrq]
 		if !ok {
 			continue
 		}
 		crqName := string(crqNameLabel)
-		if _, ok = crqs[cluster][crqName]; !ok {
+		if _, ok = st.crqs[cluster][crqName]; !ok {
 			continue
 		}
 		for labelName, labelVal := range val.Metric {
 			lv := string(labelVal)
 			switch labelName {
 			case common.Type:
-				crqs[cluster][crqName].selectorType = lv
+				st.crqs[cluster][crqName].selectorType = lv
 			case labelKey:
-				crqs[cluster][crqName].selectorKey = lv
+				st.crqs[cluster][crqName].selectorKey = lv
 			case labelValue:
-				crqs[cluster][crqName].selectorValue = lv
+				st.crqs[cluster][crqName].selectorValue = lv
 			case common.Namespace:
-				crqs[cluster][crqName].namespaces += lv + "|"
+				st.crqs[cluster][crqName].namespaces += lv + "|"
 			default: //Do nothing
 			}
 		}
 	}
 }
 
-func getExistingQuotas(cluster string, result model.Matrix) {
+func (st *state) getExistingQuotas(cluster string, result model.Matrix) {
 	for _, val := range result {
 		var crqNameLabel model.LabelValue
 		var ok bool
@@ -87,7 +97,7 @@ func getExistingQuotas(cluster string, result model.Matrix) {
 			continue
 		}
 		crqName := string(crqNameLabel)
-		if _, ok := crqs[cluster][crqName]; !ok {
+		if _, ok := st.crqs[cluster][crqName]; !ok {
 			continue
 		}
 		var resourceLabel model.LabelValue
@@ -98,187 +108,181 @@ func getExistingQuotas(cluster string, result model.Matrix) {
 		lsv := common.LastSampleValue(val)
 		v := float64(lsv)
 		if typeHard := val.Metric[common.Type]; typeHard == common.Hard {
-			crqs[cluster][crqName].resources += resource + ": " + lsv.String() + "|"
+			st.crqs[cluster][crqName].resources += resource + ": " + lsv.String() + "|"
 			switch resource {
 			case common.LimitsCpu:
-				crqs[cluster][crqName].cpuLimit = common.IntMCores(v)
+				st.crqs[cluster][crqName].cpuLimit = common.IntMCores(v)
 			case common.RequestsCpu, common.Cpu:
-				crqs[cluster][crqName].cpuRequest = common.IntMCores(v)
+				st.crqs[cluster][crqName].cpuRequest = common.IntMCores(v)
 			case common.LimitsMem:
-				crqs[cluster][crqName].memLimit = common.IntMiB(v)
+				st.crqs[cluster][crqName].memLimit = common.IntMiB(v)
 			case common.RequestsMem, common.Memory:
-				crqs[cluster][crqName].memRequest = common.IntMiB(v)
+				st.crqs[cluster][crqName].memRequest = common.IntMiB(v)
 			case common.Pods:
-				crqs[cluster][crqName].podsLimit = int(lsv)
+				st.crqs[cluster][crqName].podsLimit = int(lsv)
 			default:
 			}
 		} else if typeUsed := val.Metric[common.Type]; typeUsed == common.Used {
 			switch resource {
 			case common.LimitsCpu:
-				crqs[cluster][crqName].usageCpuLimit = common.IntMCores(v)
+				st.crqs[cluster][crqName].usageCpuLimit = common.IntMCores(v)
 			case common.RequestsCpu, common.Cpu:
-				crqs[cluster][crqName].usageCpuRequest = common.IntMCores(v)
+				st.crqs[cluster][crqName].usageCpuRequest = common.IntMCores(v)
 			case common.LimitsMem:
-				crqs[cluster][crqName].usageMemLimit = common.IntMiB(v)
+				st.crqs[cluster][crqName].usageMemLimit = common.IntMiB(v)
 			case common.RequestsMem, common.Memory:
-				crqs[cluster][crqName].usageMemRequest = common.IntMiB(v)
+				st.crqs[cluster][crqName].usageMemRequest = common.IntMiB(v)
 			case common.Pods:
-				crqs[cluster][crqName].usagePodsLimit = int(lsv)
+				st.crqs[cluster][crqName].usagePodsLimit = int(lsv)
 			default:
 			}
 		}
 	}
 }
 
-func populateNameLabels(cluster string, result model.Matrix) {
-	populateLabelMap(cluster, result, labelCrq)
+func (st *state) populateNameLabels(cluster string, result model.Matrix) {
+	st.populateLabelMap(cluster, result, labelCrq)
 }
 
 // populateLabelMap is used to parse the label based results from Prometheus related to CRQ Entities and store them in the system's data structure.
-func populateLabelMap(cluster string, result model.Matrix, nameLabel model.LabelName) {
+func (st *state) populateLabelMap(cluster string, result model.Matrix, nameLabel model.LabelName) {
 	//Loop through the different entities in the results.
 	for _, ss := range result {
 		crqName, ok := ss.Metric[nameLabel]
 		if !ok {
 			continue
 		}
-		if _, ok := crqs[cluster][string(crqName)]; !ok {
+		if _, ok := st.crqs[cluster][string(crqName)]; !ok {
 			continue
 		}
 		for key, value := range ss.Metric {
-			common.AddToLabelMap(string(key), string(value), crqs[cluster][string(crqName)].labelMap)
+			common.AddToLabelMap(string(key), string(value), st.crqs[cluster][string(crqName)].labelMap)
 		}
 	}
 }
 
-func writeConfig() {
-	for name, cluster := range crqs {
-		writeConf(name, cluster)
+func (st *state) writeConfig() {
+	for name, cluster := range st.crqs {
+		st.writeConf(name, cluster)
 	}
 }
 
-func writeConf(name string, cluster map[string]*crq) {
-	configWrite, err := os.Create(common.GetFileNameByType(name, common.CrqEntityKind, common.Config))
+var configSchema = common.NewSchema(common.CrqEntityKind, common.Config, 1).
+	Add(common.TimeColumn, false, "AuditTime").
+	Add(common.StringColumn, false, "ClusterName", "CrqName")
+
+func (st *state) writeConf(name string, cluster map[string]*crq) {
+	configWrite, err := st.rc.NewSchemaSink(name, configSchema)
 	if err != nil {
-		common.LogError(err, common.DefaultLogFormat, name, common.CrqEntityKind)
+		st.rc.LogError(err, common.DefaultLogFormat, name, common.CrqEntityKind)
 		return
 	}
-	defer func(file *os.File) {
-		if err = file.Close(); err != nil {
-			common.LogError(err, common.DefaultLogFormat, name, common.CrqEntityKind)
+	defer func(sink common.Sink) {
+		if err = sink.Close(); err != nil {
+			st.rc.LogError(err, common.DefaultLogFormat, name, common.CrqEntityKind)
 		}
 	}(configWrite)
-	if _, err = fmt.Fprintln(configWrite, "AuditTime,ClusterName,CrqName"); err != nil {
-		common.LogError(err, common.DefaultLogFormat, name, common.CrqEntityKind)
-		return
-	}
 	for crqName := range cluster {
-		if _, err = fmt.Fprintf(configWrite, "%s,%s,%s\n", common.FormatCurrentTime(), name, crqName); err != nil {
-			common.LogError(err, common.DefaultLogFormat, name, common.CrqEntityKind)
+		if err = configWrite.WriteRecord(st.rc.CurrentTime(), name, crqName); err != nil {
+			st.rc.LogError(err, common.DefaultLogFormat, name, common.CrqEntityKind)
 			return
 		}
 	}
 }
 
-func writeAttributes() {
-	for name, cluster := range crqs {
-		writeAttrs(name, cluster)
+func (st *state) writeAttributes() {
+	cas := st.rc.GetCustomAttributes(common.CrqEntityKind)
+	for name, cluster := range st.crqs {
+		for crqName, clrq := range cluster {
+			cas.Merge(name, clrq.labelMap, crqName)
+		}
+		st.writeAttrs(name, cluster)
 	}
 }
 
-func writeAttrs(name string, cluster map[string]*crq) {
-	attributeWrite, err := os.Create(common.GetFileNameByType(name, common.CrqEntityKind, common.Attributes))
+var attributesSchema = common.NewSchema(common.CrqEntityKind, common.Attributes, 1).
+	Add(common.StringColumn, false, "ClusterName", "CrqName", "VirtualTechnology", "VirtualDomain", "VirtualDatacenter", "VirtualCluster",
+		"SelectorType", "SelectorKey", "SelectorValue").
+	Add(common.TimeColumn, true, "CreateTime").
+	Add(common.LabelsColumn, false, "NamespaceLabels").
+	Add(common.StringColumn, false, "ResourceMetadata").
+	Add(common.IntColumn, true, "CpuLimit", "CpuRequest", "MemoryLimit", "MemoryRequest", "CurrentSize",
+		"NamespaceCpuLimit", "NamespaceCpuRequest", "NamespaceMemoryLimit", "NamespaceMemoryRequest", "NamespacePodsLimit").
+	Add(common.StringColumn, false, "Namespaces")
+
+func (st *state) writeAttrs(name string, cluster map[string]*crq) {
+	attributeWrite, err := st.rc.NewSchemaSink(name, attributesSchema)
 	if err != nil {
-		common.LogError(err, common.DefaultLogFormat, name, common.CrqEntityKind)
+		st.rc.LogError(err, common.DefaultLogFormat, name, common.CrqEntityKind)
 		return
 	}
-	defer func(file *os.File) {
-		if err = file.Close(); err != nil {
-			common.LogError(err, common.DefaultLogFormat, name, common.CrqEntityKind)
+	defer func(sink common.Sink) {
+		if err = sink.Close(); err != nil {
+			st.rc.LogError(err, common.DefaultLogFormat, name, common.CrqEntityKind)
 		}
 	}(attributeWrite)
-	if _, err = fmt.Fprintln(attributeWrite, "ClusterName,CrqName,VirtualTechnology,VirtualDomain,VirtualDatacenter,VirtualCluster,SelectorType,SelectorKey,SelectorValue,CreateTime,NamespaceLabels,ResourceMetadata,CpuLimit,CpuRequest,MemoryLimit,MemoryRequest,CurrentSize,NamespaceCpuLimit,NamespaceCpuRequest,NamespaceMemoryLimit,NamespaceMemoryRequest,NamespacePodsLimit,Namespaces"); err != nil {
-		common.LogError(err, common.DefaultLogFormat, name, common.CrqEntityKind)
-		return
-	}
 	for crqName, clrq := range cluster {
-		if _, err = fmt.Fprintf(attributeWrite, "%s,%s,ClusterResourceQuota,%s,%s,%s,%s,%s,%s", name, crqName, name, clrq.selectorType, clrq.selectorKey, clrq.selectorType, clrq.selectorKey, clrq.selectorValue); err != nil {
-			common.LogError(err, common.DefaultLogFormat, name, common.CrqEntityKind)
-			return
-		}
-		if err = common.PrintCSVTimeValue(attributeWrite, &clrq.createTime, false); err != nil {
-			common.LogError(err, common.DefaultLogFormat, name, common.CrqEntityKind)
-			return
-		}
-		if _, err = fmt.Fprint(attributeWrite, ","); err != nil {
-			common.LogError(err, common.DefaultLogFormat, name, common.CrqEntityKind)
-			return
-		}
-		if err = common.PrintCSVLabelMap(attributeWrite, clrq.labelMap, false); err != nil {
-			common.LogError(err, common.DefaultLogFormat, name, common.CrqEntityKind)
-			return
-		}
-		if _, err = fmt.Fprintf(attributeWrite, ",%s", clrq.resources); err != nil {
-			common.LogError(err, common.DefaultLogFormat, name, common.CrqEntityKind)
-			return
-		}
-		values := []int{clrq.usageCpuLimit, clrq.usageCpuRequest, clrq.usageMemLimit, clrq.usageMemRequest, clrq.usagePodsLimit,
-			clrq.cpuLimit, clrq.cpuRequest, clrq.memLimit, clrq.memRequest, clrq.podsLimit}
-		for _, value := range values {
-			if err = common.PrintCSVNumberValue(attributeWrite, value, false); err != nil {
-				common.LogError(err, common.DefaultLogFormat, name, common.CrqEntityKind)
-				return
-			}
-		}
-		if _, err = fmt.Fprintf(attributeWrite, ",%s\n", clrq.namespaces); err != nil {
-			common.LogError(err, common.DefaultLogFormat, name, common.CrqEntityKind)
+		values := []any{name, crqName, "ClusterResourceQuota", name, clrq.selectorType, clrq.selectorKey, clrq.selectorType, clrq.selectorKey, clrq.selectorValue,
+			common.TimeValue(&clrq.createTime), common.LabelMap{Map: clrq.labelMap}, clrq.resources}
+		values = append(values, common.KnownValues(clrq.usageCpuLimit, clrq.usageCpuRequest, clrq.usageMemLimit, clrq.usageMemRequest, clrq.usagePodsLimit,
+			clrq.cpuLimit, clrq.cpuRequest, clrq.memLimit, clrq.memRequest, clrq.podsLimit)...)
+		values = append(values, clrq.namespaces)
+		if err = attributeWrite.WriteRecord(values...); err != nil {
+			st.rc.LogError(err, common.DefaultLogFormat, name, common.CrqEntityKind)
 			return
 		}
 	}
 }
 
 // Metrics a global func for collecting quota level metrics in prometheus
-func Metrics() {
+func Metrics(rc *common.RunContext) {
 	var query string
+	st := getState(rc)
 
 	//Start and end time + the prometheus address used for querying
-	range5Min := common.TimeRange()
+	range5Min := rc.TimeRange()
 
 	query = `max(openshift_clusterresourcequota_created{}) by (namespace,name)`
-	if n, err := common.CollectAndProcessMetric(query, range5Min, createCRQ); err != nil || n == 0 {
+	if n, err := rc.CollectAndProcessMetric(query, range5Min, st.createCRQ); err != nil || n == 0 {
 		// error already handled
 		return
 	}
 
 	// for all other queries we ignore failures
 	query = `max(openshift_clusterresourcequota_selector{}) by (name, key, type, value)`
-	_, _ = common.CollectAndProcessMetric(query, range5Min, extractCRQAttributes)
+	_, _ = rc.CollectAndProcessMetric(query, range5Min, st.extractCRQAttributes)
 
 	query = `openshift_clusterresourcequota_labels{}`
-	_, _ = common.CollectAndProcessMetric(query, range5Min, populateNameLabels)
+	_, _ = rc.CollectAndProcessMetric(query, range5Min, st.populateNameLabels)
 
 	query = `max(openshift_clusterresourcequota_usage{}) by (name, resource, type)`
-	_, _ = common.CollectAndProcessMetric(query, range5Min, getExistingQuotas)
+	_, _ = rc.CollectAndProcessMetric(query, range5Min, st.getExistingQuotas)
 
 	query = `max(openshift_clusterresourcequota_namespace_usage{}) by (name, namespace)`
-	_, _ = common.CollectAndProcessMetric(query, range5Min, extractCRQAttributes)
+	_, _ = rc.CollectAndProcessMetric(query, range5Min, st.extractCRQAttributes)
 
-	writeConfig()
-	writeAttributes()
+	st.writeConfig()
+	st.writeAttributes()
 
 	var metricField = []model.LabelName{labelCrq}
 	query = `sum(openshift_clusterresourcequota_usage{type="used", resource="limits.cpu"}) by (name) * 1000`
-	common.CpuLimits.GetWorkload(query, metricField, common.CrqEntityKind)
+	common.CpuLimits.GetWorkload(rc, query, metricField, common.CrqEntityKind)
 
 	query = `sum(openshift_clusterresourcequota_usage{type="used", resource=~"cpu|requests\\.cpu"}) by (name) * 1000`
-	common.CpuRequests.GetWorkload(query, metricField, common.CrqEntityKind)
+	common.CpuRequests.GetWorkload(rc, query, metricField, common.CrqEntityKind)
 
 	query = `sum(openshift_clusterresourcequota_usage{type="used", resource="limits.memory"}) by (name)`
-	common.MemLimits.GetWorkload(query, metricField, common.CrqEntityKind)
+	common.MemLimits.GetWorkload(rc, query, metricField, common.CrqEntityKind)
 
 	query = `sum(openshift_clusterresourcequota_usage{type="used", resource=~"memory|requests\\.memory"}) by (name) / (1024 * 1024)`
-	common.MemRequests.GetWorkload(query, metricField, common.CrqEntityKind)
+	common.MemRequests.GetWorkload(rc, query, metricField, common.CrqEntityKind)
 
 	query = `sum(openshift_clusterresourcequota_usage{type="used", resource="pods"}) by (name)`
-	common.PodsLimits.GetWorkload(query, metricField, common.CrqEntityKind)
+	common.PodsLimits.GetWorkload(rc, query, metricField, common.CrqEntityKind)
 }
+
+var _ = common.RegisterCoverage(&common.CoverageMetric{Names: []string{"openshift_clusterresourcequota_usage"}, Exporter: common.Ossm,
+	Outputs: common.Outputs([]string{configSchema.FileOutput()},
+		common.WorkloadOutputs(common.CrqEntityKind, common.CpuLimits, common.CpuRequests, common.MemLimits, common.MemRequests, common.PodsLimits))})
+
+var _ = common.RegisterOverridableOutputs(common.CrqEntityKind, common.CpuLimits, common.CpuRequests, common.MemLimits, common.MemRequests, common.PodsLimits)
@@ -0,0 +1,20 @@
+// Package custom collects the workload metrics defined in the custom metrics file
+package custom
+
+import (
+	"github.com/densify-dev/container-data-collection/internal/common"
+)
+
+var entityKinds = []string{common.ClusterEntityKind, common.NodeEntityKind, common.NodeGroupEntityKind, common.ContainerEntityKind, common.CrqEntityKind, common.RqEntityKind}
+
+// Metrics collects the custom metrics of the entity kinds included
+func Metrics(rc *common.RunContext, includes func(rc *common.RunContext, entityKind string) bool) {
+	for _, entityKind := range entityKinds {
+		if !includes(rc, entityKind) {
+			continue
+		}
+		for _, cm := range rc.CustomMetrics(entityKind) {
+			cm.GetWorkload(rc)
+		}
+	}
+}
@@ -16,12 +16,13 @@ const (
 	clusterKubernetesVersionsLogFormat = common.ClusterFormat + common.Space + "API servers version: %s; Nodes versions: %s"
 )
 
-func Metrics() {
+func Metrics(rc *common.RunContext) {
 	query := `kubernetes_build_info{}`
-	range5Min := common.TimeRange()
-	_, _ = common.CollectAndProcessMetric(query, range5Min, getVersion)
-	for cluster, ckv := range clusterKubernetesVersions {
-		common.LogCluster(1, common.Debug, clusterKubernetesVersionsLogFormat, cluster, true, cluster, ckv.ApiServers.String(), ckv.Nodes.String())
+	range5Min := rc.TimeRange()
+	ckvs := getClusterVersions(rc)
+	_, _ = rc.CollectAndProcessMetric(query, range5Min, ckvs.getVersion)
+	for cluster, ckv := range ckvs {
+		rc.LogCluster(1, common.Debug, clusterKubernetesVersionsLogFormat, cluster, true, cluster, ckv.ApiServers.String(), ckv.Nodes.String())
 	}
 }
 
@@ -126,11 +127,20 @@ type ClusterVersions struct {
 	Nodes      *TypedVersions
 }
 
-var clusterKubernetesVersions = make(map[string]*ClusterVersions)
+// clusterVersions are the Kubernetes versions of the clusters of a run
+type clusterVersions map[string]*ClusterVersions
 
-func GetClusterVersion(cluster string) (s string) {
+type clusterVersionsKey struct{}
+
+func getClusterVersions(rc *common.RunContext) clusterVersions {
+	return common.CollectorState(rc, clusterVersionsKey{}, func(*common.RunContext) clusterVersions {
+		return make(clusterVersions)
+	})
+}
+
+func GetClusterVersion(rc *common.RunContext, cluster string) (s string) {
 	var bi *BuildInfo
-	if ckv := clusterKubernetesVersions[cluster]; ckv != nil {
+	if ckv := getClusterVersions(rc)[cluster]; ckv != nil {
 		if bi = ckv.ApiServers.GetMinimum(); bi == nil {
 			bi = ckv.Nodes.GetMaximum()
 		}
@@ -141,9 +151,9 @@ func GetClusterVersion(cluster string) (s string) {
 	return
 }
 
-func GetNodeVersion(cluster, node string) (s string) {
+func GetNodeVersion(rc *common.RunContext, cluster, node string) (s string) {
 	var bi *BuildInfo
-	if ckv, f := clusterKubernetesVersions[cluster]; f && ckv != nil && ckv.Nodes != nil {
+	if ckv, f := getClusterVersions(rc)[cluster]; f && ckv != nil && ckv.Nodes != nil {
 		bi, f = ckv.Nodes.byName[node]
 	}
 	if bi != nil {
@@ -152,8 +162,8 @@ func GetNodeVersion(cluster, node string) (s string) {
 	return
 }
 
-func HasMinimumVersion(cluster string, major, minor uint64) bool {
-	if ckv, f := clusterKubernetesVersions[cluster]; f {
+func HasMinimumVersion(rc *common.RunContext, cluster string, major, minor uint64) bool {
+	if ckv, f := getClusterVersions(rc)[cluster]; f {
 		return hasMinimum(&BuildInfo{Major: major, Minor: minor}, ckv.Nodes)
 	}
 	return false
@@ -176,11 +186,11 @@ var nodes = common.Plural(common.Node)
 
 var buildInfoLabels = []string{common.Job, common.Instance, gitVersion, major, minor}
 
-func getVersion(cluster string, result model.Matrix) {
+func (ckvs clusterVersions) getVersion(cluster string, result model.Matrix) {
 	var cvs *ClusterVersions
-	if cvs = clusterKubernetesVersions[cluster]; cvs == nil {
+	if cvs = ckvs[cluster]; cvs == nil {
 		cvs = &ClusterVersions{ApiServers: NewTypedVersions(), Nodes: NewTypedVersions()}
-		clusterKubernetesVersions[cluster] = cvs
+		ckvs[cluster] = cvs
 	}
 	for _, ss := range result {
 		if bil, f := common.GetLabelsValues(ss, buildInfoLabels); f {
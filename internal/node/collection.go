@@ -1,22 +1,16 @@
 package node
 
 import (
-	"fmt"
-
 	"github.com/densify-dev/container-data-collection/internal/common"
 	"github.com/prometheus/common/model"
 )
 
-var indicators = make(map[string]int)
-
-var ClusterNodeRoles = make(map[string]map[model.LabelValue]bool)
-
-func getNode(cluster string, ss *model.SampleStream, nodeLabel model.LabelName) (n *node, f bool) {
+func (st *state) getNode(cluster string, ss *model.SampleStream, nodeLabel model.LabelName) (n *node, f bool) {
 	var nodeLabelValue model.LabelValue
 	nodeLabelValue, f = ss.Metric[nodeLabel]
 	if f {
 		nodeValue := string(nodeLabelValue)
-		n, f = nodes[cluster][nodeValue]
+		n, f = st.nodes[cluster][nodeValue]
 	}
 	return
 }
@@ -37,26 +31,28 @@ func setValueIfUnknown(what *int, value float64) {
 }
 
 type metricHolder struct {
+	st        *state
 	name      string
 	labelName model.LabelName
 }
 
 func (mh *metricHolder) getNodeMetric(cluster string, result model.Matrix) {
+	st := mh.st
 	if result.Len() > 0 {
 		switch mh.name {
 		case common.Capacity, common.Allocatable, common.Limits, common.Requests:
-			indicators[mh.name] = indicators[mh.name] + 1
+			st.indicators.Inc(mh.name)
 		default:
 		}
 	}
 	for _, ss := range result {
-		n, ok := getNode(cluster, ss, mh.labelName)
+		n, ok := st.getNode(cluster, ss, mh.labelName)
 		if !ok {
 			continue
 		}
 		value := common.LastValue(ss)
 		res := ss.Metric[common.Resource]
-		nwp := &nodeWorkloadProducer{cluster: cluster, node: n}
+		nwp := &nodeWorkloadProducer{st: st, cluster: cluster, node: n}
 		switch mh.name {
 		case common.Capacity:
 			switch res {
@@ -111,42 +107,42 @@ func (mh *metricHolder) getNodeMetric(cluster string, result model.Matrix) {
 			switch res {
 			case common.Cpu:
 				setValue(&n.cpuLimit, common.MCores(value))
-				common.WriteWorkload(nwp, nodeWorkloadWriters, common.CpuLimits, ss, common.MCores[float64])
+				common.WriteWorkload(nwp, st.nodeWorkloadWriters, common.CpuLimits, ss, common.MCores[float64])
 			case common.Memory:
 				setValue(&n.memLimit, common.MiB(value))
-				common.WriteWorkload(nwp, nodeWorkloadWriters, common.MemoryLimits, ss, common.MiB[float64])
+				common.WriteWorkload(nwp, st.nodeWorkloadWriters, common.MemoryLimits, ss, common.MiB[float64])
 			case model.LabelValue(common.NvidiaGpuResource):
 				setValue(&n.gpuLimit, value)
-				common.WriteWorkload(nwp, nodeWorkloadWriters, common.GpuLimits, ss, nil)
+				common.WriteWorkload(nwp, st.nodeWorkloadWriters, common.GpuLimits, ss, nil)
 			case model.LabelValue(common.EphemeralStorage):
-				common.WriteWorkload(nwp, nodeWorkloadWriters, common.EphemeralStorageLimits, ss, nil)
+				common.WriteWorkload(nwp, st.nodeWorkloadWriters, common.EphemeralStorageLimits, ss, nil)
 			}
 		case common.Requests:
 			switch res {
 			case common.Cpu:
 				setValue(&n.cpuRequest, common.MCores(value))
-				common.WriteWorkload(nwp, nodeWorkloadWriters, common.CpuRequests, ss, common.MCores[float64])
+				common.WriteWorkload(nwp, st.nodeWorkloadWriters, common.CpuRequests, ss, common.MCores[float64])
 			case common.Memory:
 				setValue(&n.memRequest, common.MiB(value))
-				common.WriteWorkload(nwp, nodeWorkloadWriters, common.MemoryRequests, ss, common.MiB[float64])
+				common.WriteWorkload(nwp, st.nodeWorkloadWriters, common.MemoryRequests, ss, common.MiB[float64])
 			case model.LabelValue(common.NvidiaGpuResource):
 				setValue(&n.gpuRequest, value)
-				common.WriteWorkload(nwp, nodeWorkloadWriters, common.GpuRequests, ss, nil)
+				common.WriteWorkload(nwp, st.nodeWorkloadWriters, common.GpuRequests, ss, nil)
 			case model.LabelValue(common.EphemeralStorage):
-				common.WriteWorkload(nwp, nodeWorkloadWriters, common.EphemeralStorageRequests, ss, nil)
+				common.WriteWorkload(nwp, st.nodeWorkloadWriters, common.EphemeralStorageRequests, ss, nil)
 			}
 		case common.CpuLimit:
 			setValue(&n.cpuLimit, value)
-			common.WriteWorkload(nwp, nodeWorkloadWriters, common.CpuLimits, ss, nil)
+			common.WriteWorkload(nwp, st.nodeWorkloadWriters, common.CpuLimits, ss, nil)
 		case common.CpuRequest:
 			setValue(&n.cpuRequest, value)
-			common.WriteWorkload(nwp, nodeWorkloadWriters, common.CpuRequests, ss, nil)
+			common.WriteWorkload(nwp, st.nodeWorkloadWriters, common.CpuRequests, ss, nil)
 		case common.MemLimit:
 			setValue(&n.memLimit, value)
-			common.WriteWorkload(nwp, nodeWorkloadWriters, common.MemoryLimits, ss, nil)
+			common.WriteWorkload(nwp, st.nodeWorkloadWriters, common.MemoryLimits, ss, nil)
 		case common.MemRequest:
 			setValue(&n.memRequest, value)
-			common.WriteWorkload(nwp, nodeWorkloadWriters, common.MemoryRequests, ss, nil)
+			common.WriteWorkload(nwp, st.nodeWorkloadWriters, common.MemoryRequests, ss, nil)
 		case common.ModelName:
 			// override existing model name from node labels
 			if mn := string(ss.Metric[model.LabelName(common.ModelName)]); mn != common.Empty {
@@ -161,13 +157,13 @@ func (mh *metricHolder) getNodeMetric(cluster string, result model.Matrix) {
 }
 
 // getNodeMetricString is used to parse the label-based results from Prometheus related to nodes and store them
-func getNodeMetricString(cluster string, result model.Matrix) {
+func (st *state) getNodeMetricString(cluster string, result model.Matrix) {
 	for _, ss := range result {
-		n, ok := getNode(cluster, ss, common.Node)
+		n, ok := st.getNode(cluster, ss, common.Node)
 		if !ok {
 			continue
 		}
-		dstMaps := []map[string]string{n.labelMap, n.gpuLabelMap}
+		dstMaps := []common.LabelValues{n.labelMap, n.gpuLabelMap}
 		l := len(dstMaps)
 		srcMaps := make([]map[string]string, 0, l)
 		for i := 0; i < l; i++ {
@@ -185,9 +181,9 @@ func getNodeMetricString(cluster string, result model.Matrix) {
 			// record the role as an applicable role for the cluster (required for nodegroups)
 			if key == common.Role {
 				var nodeRoles map[model.LabelValue]bool
-				if nodeRoles, ok = ClusterNodeRoles[cluster]; !ok {
+				if nodeRoles, ok = st.clusterNodeRoles[cluster]; !ok {
 					nodeRoles = make(map[model.LabelValue]bool)
-					ClusterNodeRoles[cluster] = nodeRoles
+					st.clusterNodeRoles[cluster] = nodeRoles
 				}
 				nodeRoles[value] = true
 			}
@@ -201,9 +197,9 @@ func getNodeMetricString(cluster string, result model.Matrix) {
 	}
 }
 
-func getNodeTaints(cluster string, result model.Matrix) {
+func (st *state) getNodeTaints(cluster string, result model.Matrix) {
 	for _, ss := range result {
-		n, ok := getNode(cluster, ss, common.Node)
+		n, ok := st.getNode(cluster, ss, common.Node)
 		if !ok {
 			continue
 		}
@@ -217,6 +213,7 @@ func getNodeTaints(cluster string, result model.Matrix) {
 }
 
 type nodeWorkloadProducer struct {
+	st      *state
 	cluster string
 	node    *node
 }
@@ -229,8 +226,8 @@ func (nwp *nodeWorkloadProducer) GetEntityKind() string {
 	return common.NodeEntityKind
 }
 
-func (nwp *nodeWorkloadProducer) GetRowPrefixes() []string {
-	return []string{fmt.Sprintf("%s,%s", nwp.cluster, overrideNodeName(nwp.cluster, nwp.node.name))}
+func (nwp *nodeWorkloadProducer) GetEntities() [][]string {
+	return [][]string{{nwp.cluster, nwp.st.overrideNodeName(nwp.cluster, nwp.node.name)}}
 }
 
 func (nwp *nodeWorkloadProducer) ShouldWrite(_ string) bool {
@@ -0,0 +1,44 @@
+package node
+
+import "github.com/densify-dev/container-data-collection/internal/common"
+
+var _ = common.RegisterCoverage(
+	&common.CoverageMetric{Names: []string{"kube_pod_info"}, Exporter: common.Ksm,
+		Outputs: common.WorkloadOutputs(common.NodeEntityKind, common.PodCount)},
+	&common.CoverageMetric{Names: []string{"kube_pod_container_resource_limits", "kube_pod_container_resource_limits_cpu_cores"}, Exporter: common.Ksm,
+		Outputs: attributesSchema.ColumnOutputs("CpuLimit", "MemoryLimit")},
+	&common.CoverageMetric{Names: []string{"kube_pod_container_resource_requests", "kube_pod_container_resource_requests_cpu_cores"}, Exporter: common.Ksm,
+		Outputs: common.Outputs(attributesSchema.ColumnOutputs("CpuRequest", "MemoryRequest"),
+			common.WorkloadOutputs(common.NodeEntityKind, common.CpuReservationPercent, common.MemoryReservationPercent))},
+	&common.CoverageMetric{Names: []string{"kube_node_info"}, Exporter: common.Ksm,
+		Outputs: attributesSchema.ColumnOutputs("ProviderId", "K8sVersion")},
+	&common.CoverageMetric{Names: []string{"kube_node_labels"}, Exporter: common.Ksm,
+		Outputs: attributesSchema.ColumnOutputs("NodeLabels"), Hint: common.KsmLabelsHint},
+	&common.CoverageMetric{Names: []string{"kube_node_status_capacity", "kube_node_status_capacity_cpu_cores"}, Exporter: common.Ksm,
+		Outputs: attributesSchema.ColumnOutputs("CapacityPods", "CapacityCpu", "CapacityMemory")},
+	&common.CoverageMetric{Names: []string{"kube_node_status_allocatable", "kube_node_status_allocatable_cpu_cores"}, Exporter: common.Ksm,
+		Outputs: attributesSchema.ColumnOutputs("AllocatablePods", "AllocatableCpu", "AllocatableMemory")},
+	&common.CoverageMetric{Names: []string{"node_cpu_seconds_total"}, Exporter: common.NodeExporter,
+		Outputs: common.WorkloadOutputs(common.NodeEntityKind, common.CpuUtilization)},
+	&common.CoverageMetric{Names: []string{"node_memory_MemTotal_bytes"}, Exporter: common.NodeExporter,
+		Outputs: common.Outputs(attributesSchema.ColumnOutputs("MemoryTotalBytes"),
+			common.WorkloadOutputs(common.NodeEntityKind, common.MemoryBytes, common.MemoryUtilization))},
+	&common.CoverageMetric{Names: []string{"node_memory_Cached_bytes"}, Exporter: common.NodeExporter,
+		Outputs: common.WorkloadOutputs(common.NodeEntityKind, common.MemoryActualWorkload, common.MemoryActualUtilization)},
+	&common.CoverageMetric{Names: []string{"node_network_speed_bytes"}, Exporter: common.NodeExporter,
+		Outputs: common.Outputs(configSchema.ColumnOutputs("HwMaxNetworkIoBps"), attributesSchema.ColumnOutputs("NetworkSpeed"))},
+	&common.CoverageMetric{Names: []string{"node_disk_read_bytes_total"}, Exporter: common.NodeExporter,
+		Outputs: common.WorkloadOutputs(common.NodeEntityKind, common.DiskReadBytes, common.DiskTotalBytes)},
+	&common.CoverageMetric{Names: []string{"node_network_receive_bytes_total"}, Exporter: common.NodeExporter,
+		Outputs: common.WorkloadOutputs(common.NodeEntityKind, common.NetReceivedBytes, common.NetTotalBytes)},
+	&common.CoverageMetric{Names: []string{"node_vmstat_oom_kill"}, Exporter: common.NodeExporter,
+		Outputs: common.WorkloadOutputs(common.NodeEntityKind, common.OomKillEvents)},
+	&common.CoverageMetric{Names: []string{"DCGM_FI_DEV_GPU_UTIL"}, Exporter: common.Dcgm,
+		Outputs: common.Outputs(attributesSchema.ColumnOutputs("GpuModel"),
+			common.WorkloadOutputs(common.NodeEntityKind, common.GpuUtilizationAvg, common.GpuUtilizationGpusAvg))},
+	&common.CoverageMetric{Names: []string{"DCGM_FI_DEV_FB_USED"}, Exporter: common.Dcgm,
+		Outputs: common.Outputs(attributesSchema.ColumnOutputs("GpuMemoryTotal"),
+			common.WorkloadOutputs(common.NodeEntityKind, common.GpuMemUtilizationAvg, common.GpuMemUsedAvg))},
+	&common.CoverageMetric{Names: []string{"ephemeral_storage_node_capacity"}, Exporter: common.EphemeralStorageExporter,
+		Outputs: common.WorkloadOutputs(common.NodeEntityKind, common.EphemeralStorageUsageBytes, common.EphemeralStorageUsageUtilization)},
+)
@@ -2,6 +2,7 @@ package node
 
 import (
 	"github.com/densify-dev/container-data-collection/internal/common"
+	"slices"
 	"strings"
 )
 
@@ -47,8 +48,8 @@ var (
 	memTotal          = common.DromedaryCase(common.Mem, common.Total)
 )
 
-func GetNodeGpuSharingStrategy(cluster, nodeName string) (gss string) {
-	if n := nodes[cluster][nodeName]; n != nil {
+func GetNodeGpuSharingStrategy(rc *common.RunContext, cluster, nodeName string) (gss string) {
+	if n := getState(rc).nodes[cluster][nodeName]; n != nil {
 		gss = n.gpuSharingStrategy
 	}
 	return
@@ -107,8 +108,10 @@ func appendGpu(s []string) []string {
 	return append(s, common.Gpu)
 }
 
+// getLabelName concatenates into a new slice, as the prefixes have spare capacity and the label names of
+// concurrent runs are built at the same time
 func getLabelName(labelProvider string, includeGpu bool, elements ...string) string {
-	return common.SnakeCase(append(prefixComponents[labelProvider][includeGpu], elements...)...)
+	return common.SnakeCase(slices.Concat(prefixComponents[labelProvider][includeGpu], elements)...)
 }
 
 var GpuPercentQuerySuffix = common.DcgmPercentQuerySuffix("kube_node_status_allocatable", common.Node)
@@ -41,7 +41,7 @@ func (ts taints) String() string {
 
 // A node structure. Used for storing attributes and config details.
 type node struct {
-	labelMap, gpuLabelMap                          map[string]string
+	labelMap, gpuLabelMap                          common.LabelValues
 	name                                           string
 	providerId                                     string
 	k8sVersion                                     string
@@ -58,8 +58,45 @@ type node struct {
 	taints                                                           taints
 }
 
-// Map that labels and values will be stored in
-var nodes = make(map[string]map[string]*node)
+// state holds the nodes and the exporters detected by a run
+type state struct {
+	rc                                 *common.RunContext
+	nodes                              map[string]map[string]*node
+	indicators                         *common.Indicators
+	clusterNodeRoles                   map[string]map[model.LabelValue]bool
+	once                               sync.Once
+	nodeExporterIndicators             map[string][]string
+	gpuExporters                       map[string][]string
+	dcgmExporterIndicators             map[string]bool
+	kubexGpuExporterIndicators         map[string]bool
+	ephemeralStorageExporterIndicators map[string]bool
+	beylaExporterIndicators            map[string]bool
+	queryWrappers                      []*QueryWrapper
+	memActualAdditionalMetrics         string
+	nodeWorkloadWriters                *common.WorkloadWriters
+}
+
+type stateKey struct{}
+
+func getState(rc *common.RunContext) *state {
+	return common.CollectorState(rc, stateKey{}, newState)
+}
+
+func newState(rc *common.RunContext) *state {
+	return &state{
+		rc:                                 rc,
+		nodes:                              make(map[string]map[string]*node),
+		indicators:                         common.NewIndicators(),
+		clusterNodeRoles:                   make(map[string]map[model.LabelValue]bool),
+		nodeExporterIndicators:             make(map[string][]string),
+		gpuExporters:                       make(map[string][]string),
+		dcgmExporterIndicators:             make(map[string]bool),
+		kubexGpuExporterIndicators:         make(map[string]bool),
+		ephemeralStorageExporterIndicators: make(map[string]bool),
+		beylaExporterIndicators:            make(map[string]bool),
+		nodeWorkloadWriters:                rc.NewWorkloadWriters(),
+	}
+}
 
 type reservationPercentQuery struct {
 	metrics  []string
@@ -68,118 +105,119 @@ type reservationPercentQuery struct {
 }
 
 // Metrics a global func for collecting node level metrics in prometheus
-func Metrics() {
-	common.ResolveMetrics(map[string]common.ResolveMetricFunc{memSReclaimable: additionalMemActualMetrics})
+func Metrics(rc *common.RunContext) {
+	st := getState(rc)
+	rc.ResolveMetrics(map[string]common.ResolveMetricFunc{memSReclaimable: st.additionalMemActualMetrics})
 
 	var query string
 	var err error
-	range5Min := common.TimeRange()
+	range5Min := rc.TimeRange()
 
 	// node information/labels
 	query = "kube_node_info{}"
-	if _, err := common.CollectAndProcessMetric(query, range5Min, createNode); err != nil {
+	if _, err := rc.CollectAndProcessMetric(query, range5Min, st.createNode); err != nil {
 		// error already handled
 		return
 	}
 
 	// additional config/attribute queries
 	query = `kube_node_labels{}`
-	_, _ = common.CollectAndProcessMetric(query, range5Min, getNodeMetricString)
+	_, _ = rc.CollectAndProcessMetric(query, range5Min, st.getNodeMetricString)
 
 	query = `kube_node_role{}`
-	_, _ = common.CollectAndProcessMetric(query, range5Min, getNodeMetricString)
+	_, _ = rc.CollectAndProcessMetric(query, range5Min, st.getNodeMetricString)
 
 	query = `kube_node_spec_taint{}`
-	_, _ = common.CollectAndProcessMetric(query, range5Min, getNodeTaints)
+	_, _ = rc.CollectAndProcessMetric(query, range5Min, st.getNodeTaints)
 
-	mh := &metricHolder{}
-	if HasNodeExporter(range5Min) {
-		for _, qw := range GetQueryWrappers(&queryWrappers, queryWrappersMap) {
+	mh := &metricHolder{st: st}
+	if HasNodeExporter(rc, range5Min) {
+		for _, qw := range GetQueryWrappers(rc, &st.queryWrappers, queryWrappersMap) {
 			mh.labelName = qw.MetricField[0]
 			mh.name = common.NetSpeedBytes
 			query = qw.Query.Wrap(`max(node_network_speed_bytes{device!~"veth.*|docker.*|cilium.*|lxc.*"}) by (node, instance)`)
-			_, _ = common.CollectAndProcessMetric(query, range5Min, mh.getNodeMetric)
+			_, _ = rc.CollectAndProcessMetric(query, range5Min, mh.getNodeMetric)
 			mh.name = common.MemTotal
 			query = qw.Query.Wrap(`max(node_memory_MemTotal_bytes{}) by (node, instance)`)
-			_, _ = common.CollectAndProcessMetric(query, range5Min, mh.getNodeMetric)
+			_, _ = rc.CollectAndProcessMetric(query, range5Min, mh.getNodeMetric)
 		}
 	}
 
 	mh.labelName = common.Node
-	if HasDcgmExporter(range5Min) {
+	if HasDcgmExporter(rc, range5Min) {
 		// The model name should be collect in any case and override what we got from the node labels
 		// (for consistency with the containers' model name)
 		mh.name = common.ModelName
 		query = fmt.Sprintf("max(%s) by (%s, %s)", common.DcgmExporterLabelReplace("DCGM_FI_DEV_GPU_UTIL{}"), common.Node, common.ModelName)
-		_, _ = common.CollectAndProcessMetric(query, range5Min, mh.getNodeMetric)
+		_, _ = rc.CollectAndProcessMetric(query, range5Min, mh.getNodeMetric)
 		mh.name = common.GpuMemoryTotal
 		query = fmt.Sprintf("sum(%s) by (%s)", common.DcgmExporterLabelReplace("DCGM_FI_DEV_FB_USED{} + DCGM_FI_DEV_FB_FREE{}"), common.Node)
-		_, _ = common.CollectAndProcessMetric(query, range5Min, mh.getNodeMetric)
+		_, _ = rc.CollectAndProcessMetric(query, range5Min, mh.getNodeMetric)
 	}
 	// Queries the capacity fields of all nodes
 	mh.name = common.Capacity
 	query = `kube_node_status_capacity{}`
-	_, _ = common.CollectAndProcessMetric(query, range5Min, mh.getNodeMetric)
-	if common.Found(indicators, mh.name, false) {
+	_, _ = rc.CollectAndProcessMetric(query, range5Min, mh.getNodeMetric)
+	if rc.Found(st.indicators, mh.name, false) {
 		mh.name = common.CpuCapacity
 		query = `kube_node_status_capacity_cpu_cores{}`
-		_, _ = common.CollectAndProcessMetric(query, range5Min, mh.getNodeMetric)
+		_, _ = rc.CollectAndProcessMetric(query, range5Min, mh.getNodeMetric)
 
 		mh.name = common.MemCapacity
 		query = `kube_node_status_capacity_memory_bytes{}`
-		_, _ = common.CollectAndProcessMetric(query, range5Min, mh.getNodeMetric)
+		_, _ = rc.CollectAndProcessMetric(query, range5Min, mh.getNodeMetric)
 
 		mh.name = common.PodsCapacity
 		query = `kube_node_status_capacity_pods{}`
-		_, _ = common.CollectAndProcessMetric(query, range5Min, mh.getNodeMetric)
+		_, _ = rc.CollectAndProcessMetric(query, range5Min, mh.getNodeMetric)
 	}
 
 	mh.name = common.Allocatable
 	query = `kube_node_status_allocatable{}`
-	_, _ = common.CollectAndProcessMetric(query, range5Min, mh.getNodeMetric)
-	if common.Found(indicators, mh.name, false) {
+	_, _ = rc.CollectAndProcessMetric(query, range5Min, mh.getNodeMetric)
+	if rc.Found(st.indicators, mh.name, false) {
 		mh.name = common.CpuAllocatable
 		query = `kube_node_status_allocatable_cpu_cores{}`
-		_, _ = common.CollectAndProcessMetric(query, range5Min, mh.getNodeMetric)
+		_, _ = rc.CollectAndProcessMetric(query, range5Min, mh.getNodeMetric)
 
 		mh.name = common.MemAllocatable
 		query = `kube_node_status_allocatable_memory_bytes{}`
-		_, _ = common.CollectAndProcessMetric(query, range5Min, mh.getNodeMetric)
+		_, _ = rc.CollectAndProcessMetric(query, range5Min, mh.getNodeMetric)
 
 		mh.name = common.PodsAllocatable
 		query = `kube_node_status_allocatable_pods{}`
-		_, _ = common.CollectAndProcessMetric(query, range5Min, mh.getNodeMetric)
+		_, _ = rc.CollectAndProcessMetric(query, range5Min, mh.getNodeMetric)
 	}
-	nodeWorkloadWriters.AddMetricWorkloadWriters(common.CpuLimits, common.CpuRequests, common.MemoryLimits, common.MemoryRequests, common.GpuLimits, common.GpuRequests, common.EphemeralStorageLimits, common.EphemeralStorageRequests)
+	st.nodeWorkloadWriters.AddMetricWorkloadWriters(common.CpuLimits, common.CpuRequests, common.MemoryLimits, common.MemoryRequests, common.GpuLimits, common.GpuRequests, common.EphemeralStorageLimits, common.EphemeralStorageRequests)
 
 	mh.name = common.Limits
 	query = common.FilterTerminatedContainers(`sum(kube_pod_container_resource_limits{} or (kube_pod_init_container_resource_limits{} * on (namespace, pod, container) group_left kube_pod_init_container_info{restart_policy="Always"})`, `) by (node, resource)`)
-	_, _ = common.CollectAndProcessMetric(query, range5Min, mh.getNodeMetric)
-	if common.Found(indicators, mh.name, false) {
+	_, _ = rc.CollectAndProcessMetric(query, range5Min, mh.getNodeMetric)
+	if rc.Found(st.indicators, mh.name, false) {
 		mh.name = common.CpuLimit
 		query = common.FilterTerminatedContainers(`sum(kube_pod_container_resource_limits_cpu_cores{}`, `) by (node)*1000`)
-		_, _ = common.CollectAndProcessMetric(query, range5Min, mh.getNodeMetric)
+		_, _ = rc.CollectAndProcessMetric(query, range5Min, mh.getNodeMetric)
 		mh.name = common.MemLimit
 		query = common.FilterTerminatedContainers(`sum(kube_pod_container_resource_limits_memory_bytes{}`, `) by (node)/1024/1024`)
-		_, _ = common.CollectAndProcessMetric(query, range5Min, mh.getNodeMetric)
+		_, _ = rc.CollectAndProcessMetric(query, range5Min, mh.getNodeMetric)
 	}
 
 	mh.name = common.Requests
 	query = common.FilterTerminatedContainers(`sum(kube_pod_container_resource_requests{} or (kube_pod_init_container_resource_requests{} * on (namespace, pod, container) group_left kube_pod_init_container_info{restart_policy="Always"})`, `) by (node,resource)`)
-	_, _ = common.CollectAndProcessMetric(query, range5Min, mh.getNodeMetric)
-	if common.Found(indicators, mh.name, false) {
+	_, _ = rc.CollectAndProcessMetric(query, range5Min, mh.getNodeMetric)
+	if rc.Found(st.indicators, mh.name, false) {
 		mh.name = common.CpuRequest
 		query = common.FilterTerminatedContainers(`sum(kube_pod_container_resource_requests_cpu_cores{}`, `) by (node)*1000`)
-		_, _ = common.CollectAndProcessMetric(query, range5Min, mh.getNodeMetric)
+		_, _ = rc.CollectAndProcessMetric(query, range5Min, mh.getNodeMetric)
 		mh.name = common.MemRequest
 		query = common.FilterTerminatedContainers(`sum(kube_pod_container_resource_requests_memory_bytes{}`, `) by (node)/1024/1024`)
-		_, _ = common.CollectAndProcessMetric(query, range5Min, mh.getNodeMetric)
+		_, _ = rc.CollectAndProcessMetric(query, range5Min, mh.getNodeMetric)
 	}
 
-	nodeWorkloadWriters.CloseAndClearWorkloadWriters(common.NodeEntityKind)
+	st.nodeWorkloadWriters.CloseAndClearWorkloadWriters(common.NodeEntityKind)
 
-	writeConfig()
-	writeAttributes()
+	st.writeConfig()
+	st.writeAttributes()
 
 	// get the reservation percent metrics
 	wmhs := []*common.WorkloadMetricHolder{common.CpuReservationPercent, common.MemoryReservationPercent, common.EphemeralStorageReservationPercent}
@@ -201,7 +239,7 @@ func Metrics() {
 	}
 
 	qw := simpleQueryWrapper(common.Node)
-	for _, f := range common.FoundIndicatorCounter(indicators, common.Requests) {
+	for _, f := range rc.FoundIndicatorCounter(st.indicators, common.Requests) {
 		q := make([]string, len(rpCoreMetrics))
 		for i, wmh := range wmhs {
 			if rpArgs[f][i] == "" {
@@ -215,94 +253,94 @@ func Metrics() {
 				q[j] = qw.SumQuery.Wrap(fmt.Sprintf(rpcm.queryFmt, ms...) + rpcm.clause)
 			}
 			query = fmt.Sprintf(`(%s / %s) * 100`, q[0], q[1])
-			wmh.GetWorkloadFieldsFunc(query, qw.MetricField, overrideNodeNameFieldsFunc, common.NodeEntityKind)
+			wmh.GetWorkloadFieldsFunc(st.rc, query, qw.MetricField, st.overrideNodeNameFieldsFunc, common.NodeEntityKind)
 		}
 	}
 
 	query = qw.CountQuery.Wrap("kube_pod_info{} unless on (pod, namespace) (kube_pod_container_info{} - on (namespace,pod,container) group_left max(kube_pod_container_status_terminated{} or kube_pod_container_status_terminated_reason{}) by (namespace,pod,container)) == 0")
-	common.PodCount.GetWorkloadFieldsFunc(query, qw.MetricField, overrideNodeNameFieldsFunc, common.NodeEntityKind)
+	common.PodCount.GetWorkloadFieldsFunc(st.rc, query, qw.MetricField, st.overrideNodeNameFieldsFunc, common.NodeEntityKind)
 
-	if HasEphemeralStorageExporter(range5Min) {
+	if HasEphemeralStorageExporter(rc, range5Min) {
 		utilizationQuery := fmt.Sprintf(utilizationFmt, ephemeralStorageBaseQuery, qw.MetricField[0], utilizationBaseQueryEphemeralAllocatable)
 		wmhm := map[string]*common.WorkloadMetricHolder{ephemeralStorageBaseQuery: common.EphemeralStorageUsageBytes, utilizationQuery: common.EphemeralStorageUsageUtilization}
 		for baseQuery, wmh := range wmhm {
 			query := qw.Query.Wrap(baseQuery)
-			wmh.GetWorkloadFieldsFunc(query, qw.MetricField, overrideNodeNameFieldsFunc, common.NodeEntityKind)
+			wmh.GetWorkloadFieldsFunc(st.rc, query, qw.MetricField, st.overrideNodeNameFieldsFunc, common.NodeEntityKind)
 		}
 	} else {
-		common.LogAll(1, common.Info, "entity=%s Ephemeral storage exporter metrics not present for any cluster", common.NodeEntityKind)
+		rc.LogAll(1, common.Info, "entity=%s Ephemeral storage exporter metrics not present for any cluster", common.NodeEntityKind)
 	}
 
-	if HasDcgmExporter(range5Min) {
+	if HasDcgmExporter(rc, range5Min) {
 		query = qw.AvgQuery.Wrap(common.SafeDcgmGpuUtilizationQuery)
-		common.GpuUtilizationAvg.GetWorkloadFieldsFunc(query, qw.MetricField, overrideNodeNameFieldsFunc, common.NodeEntityKind)
+		common.GpuUtilizationAvg.GetWorkloadFieldsFunc(st.rc, query, qw.MetricField, st.overrideNodeNameFieldsFunc, common.NodeEntityKind)
 		query += GpuPercentQuerySuffix
-		common.GpuUtilizationGpusAvg.GetWorkloadFieldsFunc(query, qw.MetricField, overrideNodeNameFieldsFunc, common.NodeEntityKind)
+		common.GpuUtilizationGpusAvg.GetWorkloadFieldsFunc(st.rc, query, qw.MetricField, st.overrideNodeNameFieldsFunc, common.NodeEntityKind)
 		query = qw.AvgQuery.Wrap("100 * " + common.DcgmExporterLabelReplace("DCGM_FI_DEV_FB_USED{} / (DCGM_FI_DEV_FB_USED{} + DCGM_FI_DEV_FB_FREE{})"))
-		common.GpuMemUtilizationAvg.GetWorkloadFieldsFunc(query, qw.MetricField, overrideNodeNameFieldsFunc, common.NodeEntityKind)
+		common.GpuMemUtilizationAvg.GetWorkloadFieldsFunc(st.rc, query, qw.MetricField, st.overrideNodeNameFieldsFunc, common.NodeEntityKind)
 		query = qw.SumQuery.Wrap(common.DcgmExporterLabelReplace("DCGM_FI_DEV_FB_USED{}"))
-		common.GpuMemUsedAvg.GetWorkloadFieldsFunc(query, qw.MetricField, overrideNodeNameFieldsFunc, common.NodeEntityKind)
+		common.GpuMemUsedAvg.GetWorkloadFieldsFunc(st.rc, query, qw.MetricField, st.overrideNodeNameFieldsFunc, common.NodeEntityKind)
 		query = qw.SumQuery.Wrap(common.DcgmExporterLabelReplace("DCGM_FI_DEV_POWER_USAGE{}"))
-		common.GpuPowerUsageAvg.GetWorkloadFieldsFunc(query, qw.MetricField, overrideNodeNameFieldsFunc, common.NodeEntityKind)
+		common.GpuPowerUsageAvg.GetWorkloadFieldsFunc(st.rc, query, qw.MetricField, st.overrideNodeNameFieldsFunc, common.NodeEntityKind)
 	} else {
-		common.LogAll(1, common.Info, "entity=%s Nvidia DCGM exporter metrics not present for any cluster", common.NodeEntityKind)
+		rc.LogAll(1, common.Info, "entity=%s Nvidia DCGM exporter metrics not present for any cluster", common.NodeEntityKind)
 	}
 	// bail out if detected that Prometheus Node Exporter metrics are not present for any cluster
-	if !HasNodeExporter(range5Min) {
+	if !HasNodeExporter(rc, range5Min) {
 		err = fmt.Errorf("prometheus node exporter metrics not present for any cluster")
-		common.LogError(err, "entity=%s", common.NodeEntityKind)
+		rc.LogError(err, "entity=%s", common.NodeEntityKind)
 		return
 	}
 
-	for _, qw = range GetQueryWrappers(&queryWrappers, queryWrappersMap) {
+	for _, qw = range GetQueryWrappers(rc, &st.queryWrappers, queryWrappersMap) {
 
-		query = fmt.Sprintf(`sum(irate(node_cpu_seconds_total{mode!="idle"}[%sm])) by (%s) / on (%s) group_left count(node_cpu_seconds_total{mode="idle"}) by (%s) *100`, common.Params.Collection.SampleRateSt, qw.MetricField[0], qw.MetricField[0], qw.MetricField[0])
+		query = fmt.Sprintf(`sum(irate(node_cpu_seconds_total{mode!="idle"}[%sm])) by (%s) / on (%s) group_left count(node_cpu_seconds_total{mode="idle"}) by (%s) *100`, rc.Params().Collection.SampleRateSt, qw.MetricField[0], qw.MetricField[0], qw.MetricField[0])
 		query = qw.Query.Wrap(query)
-		common.CpuUtilization.GetWorkloadFieldsFunc(query, qw.MetricField, overrideNodeNameFieldsFunc, common.NodeEntityKind)
+		common.CpuUtilization.GetWorkloadFieldsFunc(st.rc, query, qw.MetricField, st.overrideNodeNameFieldsFunc, common.NodeEntityKind)
 
-		getMemoryMetrics(qw)
+		st.getMemoryMetrics(qw)
 
-		query = qw.Query.Wrap(`round(increase(node_vmstat_oom_kill{}[` + common.Params.Collection.SampleRateSt + `m]))`)
-		common.OomKillEvents.GetWorkloadFieldsFunc(query, qw.MetricField, overrideNodeNameFieldsFunc, common.NodeEntityKind)
+		query = qw.Query.Wrap(`round(increase(node_vmstat_oom_kill{}[` + rc.Params().Collection.SampleRateSt + `m]))`)
+		common.OomKillEvents.GetWorkloadFieldsFunc(st.rc, query, qw.MetricField, st.overrideNodeNameFieldsFunc, common.NodeEntityKind)
 
-		query = qw.SumQuery.Wrap(`round(increase(node_cpu_core_throttles_total{}[` + common.Params.Collection.SampleRateSt + `m]))`)
-		common.CpuThrottlingEvents.GetWorkloadFieldsFunc(query, qw.MetricField, overrideNodeNameFieldsFunc, common.NodeEntityKind)
+		query = qw.SumQuery.Wrap(`round(increase(node_cpu_core_throttles_total{}[` + rc.Params().Collection.SampleRateSt + `m]))`)
+		common.CpuThrottlingEvents.GetWorkloadFieldsFunc(st.rc, query, qw.MetricField, st.overrideNodeNameFieldsFunc, common.NodeEntityKind)
 
-		query = qw.SumQuery.Wrap(`irate(node_disk_read_bytes_total{device!~"dm-.*"}[` + common.Params.Collection.SampleRateSt + `m])`)
-		common.DiskReadBytes.GetWorkloadFieldsFunc(query, qw.MetricField, overrideNodeNameFieldsFunc, common.NodeEntityKind)
+		query = qw.SumQuery.Wrap(`irate(node_disk_read_bytes_total{device!~"dm-.*"}[` + rc.Params().Collection.SampleRateSt + `m])`)
+		common.DiskReadBytes.GetWorkloadFieldsFunc(st.rc, query, qw.MetricField, st.overrideNodeNameFieldsFunc, common.NodeEntityKind)
 
-		query = qw.SumQuery.Wrap(`irate(node_disk_written_bytes_total{device!~"dm-.*"}[` + common.Params.Collection.SampleRateSt + `m])`)
-		common.DiskWriteBytes.GetWorkloadFieldsFunc(query, qw.MetricField, overrideNodeNameFieldsFunc, common.NodeEntityKind)
+		query = qw.SumQuery.Wrap(`irate(node_disk_written_bytes_total{device!~"dm-.*"}[` + rc.Params().Collection.SampleRateSt + `m])`)
+		common.DiskWriteBytes.GetWorkloadFieldsFunc(st.rc, query, qw.MetricField, st.overrideNodeNameFieldsFunc, common.NodeEntityKind)
 
-		query = qw.SumQuery.Wrap(`irate(node_disk_read_bytes_total{device!~"dm-.*"}[` + common.Params.Collection.SampleRateSt + `m]) + irate(node_disk_written_bytes_total{device!~"dm-.*"}[` + common.Params.Collection.SampleRateSt + `m])`)
-		common.DiskTotalBytes.GetWorkloadFieldsFunc(query, qw.MetricField, overrideNodeNameFieldsFunc, common.NodeEntityKind)
+		query = qw.SumQuery.Wrap(`irate(node_disk_read_bytes_total{device!~"dm-.*"}[` + rc.Params().Collection.SampleRateSt + `m]) + irate(node_disk_written_bytes_total{device!~"dm-.*"}[` + rc.Params().Collection.SampleRateSt + `m])`)
+		common.DiskTotalBytes.GetWorkloadFieldsFunc(st.rc, query, qw.MetricField, st.overrideNodeNameFieldsFunc, common.NodeEntityKind)
 
-		query = qw.SumQuery.Wrap(`irate(node_disk_reads_completed_total{device!~"dm-.*"}[` + common.Params.Collection.SampleRateSt + `m])`)
-		common.DiskReadOps.GetWorkloadFieldsFunc(query, qw.MetricField, overrideNodeNameFieldsFunc, common.NodeEntityKind)
+		query = qw.SumQuery.Wrap(`irate(node_disk_reads_completed_total{device!~"dm-.*"}[` + rc.Params().Collection.SampleRateSt + `m])`)
+		common.DiskReadOps.GetWorkloadFieldsFunc(st.rc, query, qw.MetricField, st.overrideNodeNameFieldsFunc, common.NodeEntityKind)
 
-		query = qw.SumQuery.Wrap(`irate(node_disk_writes_completed_total{device!~"dm-.*"}[` + common.Params.Collection.SampleRateSt + `m])`)
-		common.DiskWriteOps.GetWorkloadFieldsFunc(query, qw.MetricField, overrideNodeNameFieldsFunc, common.NodeEntityKind)
+		query = qw.SumQuery.Wrap(`irate(node_disk_writes_completed_total{device!~"dm-.*"}[` + rc.Params().Collection.SampleRateSt + `m])`)
+		common.DiskWriteOps.GetWorkloadFieldsFunc(st.rc, query, qw.MetricField, st.overrideNodeNameFieldsFunc, common.NodeEntityKind)
 
-		query = qw.SumQuery.Wrap(`(irate(node_disk_reads_completed_total{device!~"dm-.*"}[` + common.Params.Collection.SampleRateSt + `m]) + irate(node_disk_writes_completed_total{device!~"dm-.*"}[` + common.Params.Collection.SampleRateSt + `m]))`)
-		common.DiskTotalOps.GetWorkloadFieldsFunc(query, qw.MetricField, overrideNodeNameFieldsFunc, common.NodeEntityKind)
+		query = qw.SumQuery.Wrap(`(irate(node_disk_reads_completed_total{device!~"dm-.*"}[` + rc.Params().Collection.SampleRateSt + `m]) + irate(node_disk_writes_completed_total{device!~"dm-.*"}[` + rc.Params().Collection.SampleRateSt + `m]))`)
+		common.DiskTotalOps.GetWorkloadFieldsFunc(st.rc, query, qw.MetricField, st.overrideNodeNameFieldsFunc, common.NodeEntityKind)
 
-		query = qw.SumQuery.Wrap(`irate(node_network_receive_bytes_total{device!~"veth.*|docker.*|cilium.*|lxc.*"}[` + common.Params.Collection.SampleRateSt + `m])`)
-		common.NetReceivedBytes.GetWorkloadFieldsFunc(query, qw.MetricField, overrideNodeNameFieldsFunc, common.NodeEntityKind)
+		query = qw.SumQuery.Wrap(`irate(node_network_receive_bytes_total{device!~"veth.*|docker.*|cilium.*|lxc.*"}[` + rc.Params().Collection.SampleRateSt + `m])`)
+		common.NetReceivedBytes.GetWorkloadFieldsFunc(st.rc, query, qw.MetricField, st.overrideNodeNameFieldsFunc, common.NodeEntityKind)
 
-		query = qw.SumQuery.Wrap(`irate(node_network_transmit_bytes_total{device!~"veth.*|docker.*|cilium.*|lxc.*"}[` + common.Params.Collection.SampleRateSt + `m])`)
-		common.NetSentBytes.GetWorkloadFieldsFunc(query, qw.MetricField, overrideNodeNameFieldsFunc, common.NodeEntityKind)
+		query = qw.SumQuery.Wrap(`irate(node_network_transmit_bytes_total{device!~"veth.*|docker.*|cilium.*|lxc.*"}[` + rc.Params().Collection.SampleRateSt + `m])`)
+		common.NetSentBytes.GetWorkloadFieldsFunc(st.rc, query, qw.MetricField, st.overrideNodeNameFieldsFunc, common.NodeEntityKind)
 
-		query = qw.SumQuery.Wrap(`irate(node_network_transmit_bytes_total{device!~"veth.*|docker.*|cilium.*|lxc.*"}[` + common.Params.Collection.SampleRateSt + `m]) + irate(node_network_receive_bytes_total{device!~"veth.*|docker.*|cilium.*|lxc.*"}[` + common.Params.Collection.SampleRateSt + `m])`)
-		common.NetTotalBytes.GetWorkloadFieldsFunc(query, qw.MetricField, overrideNodeNameFieldsFunc, common.NodeEntityKind)
+		query = qw.SumQuery.Wrap(`irate(node_network_transmit_bytes_total{device!~"veth.*|docker.*|cilium.*|lxc.*"}[` + rc.Params().Collection.SampleRateSt + `m]) + irate(node_network_receive_bytes_total{device!~"veth.*|docker.*|cilium.*|lxc.*"}[` + rc.Params().Collection.SampleRateSt + `m])`)
+		common.NetTotalBytes.GetWorkloadFieldsFunc(st.rc, query, qw.MetricField, st.overrideNodeNameFieldsFunc, common.NodeEntityKind)
 
-		query = qw.SumQuery.Wrap(`irate(node_network_receive_packets_total{device!~"veth.*|docker.*|cilium.*|lxc.*"}[` + common.Params.Collection.SampleRateSt + `m])`)
-		common.NetReceivedPackets.GetWorkloadFieldsFunc(query, qw.MetricField, overrideNodeNameFieldsFunc, common.NodeEntityKind)
+		query = qw.SumQuery.Wrap(`irate(node_network_receive_packets_total{device!~"veth.*|docker.*|cilium.*|lxc.*"}[` + rc.Params().Collection.SampleRateSt + `m])`)
+		common.NetReceivedPackets.GetWorkloadFieldsFunc(st.rc, query, qw.MetricField, st.overrideNodeNameFieldsFunc, common.NodeEntityKind)
 
-		query = qw.SumQuery.Wrap(`irate(node_network_transmit_packets_total{device!~"veth.*|docker.*|cilium.*|lxc.*"}[` + common.Params.Collection.SampleRateSt + `m])`)
-		common.NetSentPackets.GetWorkloadFieldsFunc(query, qw.MetricField, overrideNodeNameFieldsFunc, common.NodeEntityKind)
+		query = qw.SumQuery.Wrap(`irate(node_network_transmit_packets_total{device!~"veth.*|docker.*|cilium.*|lxc.*"}[` + rc.Params().Collection.SampleRateSt + `m])`)
+		common.NetSentPackets.GetWorkloadFieldsFunc(st.rc, query, qw.MetricField, st.overrideNodeNameFieldsFunc, common.NodeEntityKind)
 
-		query = qw.SumQuery.Wrap(`irate(node_network_transmit_packets_total{device!~"veth.*|docker.*|cilium.*|lxc.*"}[` + common.Params.Collection.SampleRateSt + `m]) + irate(node_network_receive_packets_total{device!~"veth.*|docker.*|cilium.*|lxc.*"}[` + common.Params.Collection.SampleRateSt + `m])`)
-		common.NetTotalPackets.GetWorkloadFieldsFunc(query, qw.MetricField, overrideNodeNameFieldsFunc, common.NodeEntityKind)
+		query = qw.SumQuery.Wrap(`irate(node_network_transmit_packets_total{device!~"veth.*|docker.*|cilium.*|lxc.*"}[` + rc.Params().Collection.SampleRateSt + `m]) + irate(node_network_receive_packets_total{device!~"veth.*|docker.*|cilium.*|lxc.*"}[` + rc.Params().Collection.SampleRateSt + `m])`)
+		common.NetTotalPackets.GetWorkloadFieldsFunc(st.rc, query, qw.MetricField, st.overrideNodeNameFieldsFunc, common.NodeEntityKind)
 
 	}
 }
@@ -329,22 +367,22 @@ var regionLabels = []string{labelRegion, labelRegionBeta}
 var zoneLabels = []string{labelZone, labelZoneBeta}
 
 // GetOSInstanceType is exported for usage in nodegroup package as well
-func GetOSInstanceType(labelMap map[string]string) (string, string) {
+func GetOSInstanceType(labelMap common.LabelValues) (string, string) {
 	opSys := getLabel(labelMap, osLabels)
 	instanceType := getLabel(labelMap, instanceTypeLabels)
 	return opSys, instanceType
 }
 
-func getArchRegionZone(labelMap map[string]string) (string, string, string) {
+func getArchRegionZone(labelMap common.LabelValues) (string, string, string) {
 	arch := getLabel(labelMap, archLabels)
 	region := getLabel(labelMap, regionLabels)
 	zone := getLabel(labelMap, zoneLabels)
 	return arch, region, zone
 }
 
-func getLabel(labelMap map[string]string, candidateLabelNames []string) (value string) {
+func getLabel(labelMap common.LabelValues, candidateLabelNames []string) (value string) {
 	for _, labelName := range candidateLabelNames {
-		if val, ok := labelMap[labelName]; ok {
+		if val, ok := labelMap.Value(labelName); ok {
 			value = val
 			break
 		}
@@ -352,11 +390,11 @@ func getLabel(labelMap map[string]string, candidateLabelNames []string) (value s
 	return
 }
 
-func createNode(cluster string, result model.Matrix) {
+func (st *state) createNode(cluster string, result model.Matrix) {
 	var f bool
-	if _, f = nodes[cluster]; !f {
+	if _, f = st.nodes[cluster]; !f {
 		if l := result.Len(); l > 0 {
-			nodes[cluster] = make(map[string]*node, l)
+			st.nodes[cluster] = make(map[string]*node, l)
 		}
 	}
 	for _, ss := range result {
@@ -364,24 +402,24 @@ func createNode(cluster string, result model.Matrix) {
 		// The provider Id is optional, populated for cloud providers k8s clusters (EKS, AKS, GKE)
 		// and OpenShift clusters on VMWare / cloud infrastructure. It's usually not populated for
 		// bare-metal / kind / OpenShift CRC trial clusters.
-		// common.AddToLabelMap() truncates the labels at 255 characters, and we have observed
-		// Azure's AKS provider Ids longer than 225 characters (the length depends on resource groups and VMSS names etc.).
+		// The CSV label maps truncate the labels, and we have observed Azure's AKS provider Ids longer
+		// than 225 characters (the length depends on resource groups and VMSS names etc.).
 		// So not taking the risk here and getting the provider Id directly from the metric (rather than
 		// later from the labelMap).
 		provId := string(ss.Metric[labelProviderId])
 		var k8sVer string
 		// if we did not get the node k8s version, get it from the kubelet version
-		if k8sVer = kubernetes.GetNodeVersion(cluster, nodeName); k8sVer == common.Empty {
+		if k8sVer = kubernetes.GetNodeVersion(st.rc, cluster, nodeName); k8sVer == common.Empty {
 			k8sVer = string(ss.Metric[labelKubeletVersion])
 		}
 		var n *node
-		if n, f = nodes[cluster][nodeName]; !f {
+		if n, f = st.nodes[cluster][nodeName]; !f {
 			n = &node{
 				name:                        nodeName,
 				providerId:                  provId,
 				k8sVersion:                  k8sVer,
-				labelMap:                    make(map[string]string),
-				gpuLabelMap:                 make(map[string]string),
+				labelMap:                    make(common.LabelValues),
+				gpuLabelMap:                 make(common.LabelValues),
 				netSpeedBytes:               common.UnknownValue,
 				memTotal:                    common.UnknownValue,
 				gpuTotal:                    common.UnknownValue,
@@ -406,7 +444,7 @@ func createNode(cluster string, result model.Matrix) {
 				gpuRequest:                  common.UnknownValue,
 				gpuReplicas:                 common.UnknownValue,
 			}
-			nodes[cluster][nodeName] = n
+			st.nodes[cluster][nodeName] = n
 		}
 		// collect all the labels too
 		for key, value := range ss.Metric {
@@ -423,7 +461,6 @@ const (
 )
 
 var (
-	once            sync.Once
 	beylaPivotQuery = fmt.Sprintf("max(%s%s) by (%s)", common.SurveyInfo, common.Braces, common.SemconvNodeName)
 )
 
@@ -431,19 +468,22 @@ func pivotQuery(query string) string {
 	return fmt.Sprintf("max(%s) by (%s)", query, common.Node)
 }
 
-func DetermineExporters(range5Min *v1.Range) {
-	once.Do(func() {
-		_, _ = common.CollectAndProcessMetric(nodeExporterPivotQuery, range5Min, determineNodeExporter)
-		_, _ = common.CollectAndProcessMetric(pivotQuery(common.DcgmExporterLabelReplace("DCGM_FI_DEV_GPU_UTIL{}")), range5Min, determineDcgmExporter)
-		_, _ = common.CollectAndProcessMetric(pivotQuery(common.EphemeralExporterLabelReplace("ephemeral_storage_node_available{}")), range5Min, determineEphemeralStorageExporter)
-		_, _ = common.CollectAndProcessMetric(pivotQuery("kubex_gpu_container_requests{}"), range5Min, determineKubexGpuExporter)
-		_, _ = common.CollectAndProcessMetric(beylaPivotQuery, range5Min, determineBeylaExporter)
-	})
+// DetermineExporters detects the exporters present for each cluster, once per run
+func DetermineExporters(rc *common.RunContext, range5Min *v1.Range) {
+	getState(rc).determineExporters(range5Min)
 }
 
-var nodeExporterIndicators = make(map[string][]string)
+func (st *state) determineExporters(range5Min *v1.Range) {
+	st.once.Do(func() {
+		_, _ = st.rc.CollectAndProcessMetric(nodeExporterPivotQuery, range5Min, st.determineNodeExporter)
+		_, _ = st.rc.CollectAndProcessMetric(pivotQuery(common.DcgmExporterLabelReplace("DCGM_FI_DEV_GPU_UTIL{}")), range5Min, st.determineDcgmExporter)
+		_, _ = st.rc.CollectAndProcessMetric(pivotQuery(common.EphemeralExporterLabelReplace("ephemeral_storage_node_available{}")), range5Min, st.determineEphemeralStorageExporter)
+		_, _ = st.rc.CollectAndProcessMetric(pivotQuery("kubex_gpu_container_requests{}"), range5Min, st.determineKubexGpuExporter)
+		_, _ = st.rc.CollectAndProcessMetric(beylaPivotQuery, range5Min, st.determineBeylaExporter)
+	})
+}
 
-func determineNodeExporter(cluster string, result model.Matrix) {
+func (st *state) determineNodeExporter(cluster string, result model.Matrix) {
 	if l := result.Len(); l > 0 {
 		ss := result[l-1]
 		var indicator string
@@ -461,74 +501,68 @@ func determineNodeExporter(cluster string, result model.Matrix) {
 			}
 		}
 		if f {
-			nodeExporterIndicators[indicator] = append(nodeExporterIndicators[indicator], cluster)
+			st.nodeExporterIndicators[indicator] = append(st.nodeExporterIndicators[indicator], cluster)
 		}
 	}
 }
 
-var gpuExporters = make(map[string][]string)
-
-var dcgmExporterIndicators = make(map[string]bool)
-
-func determineDcgmExporter(cluster string, result model.Matrix) {
+func (st *state) determineDcgmExporter(cluster string, result model.Matrix) {
 	if l := result.Len(); l > 0 {
-		dcgmExporterIndicators[cluster] = true
-		gpuExporters[common.Dcgm] = append(gpuExporters[common.Dcgm], cluster)
+		st.dcgmExporterIndicators[cluster] = true
+		st.gpuExporters[common.Dcgm] = append(st.gpuExporters[common.Dcgm], cluster)
 	}
 }
 
-var kubexGpuExporterIndicators = make(map[string]bool)
-
-func determineKubexGpuExporter(cluster string, result model.Matrix) {
+func (st *state) determineKubexGpuExporter(cluster string, result model.Matrix) {
 	if l := result.Len(); l > 0 {
-		kubexGpuExporterIndicators[cluster] = true
-		gpuExporters[common.KubexGpu] = append(gpuExporters[common.KubexGpu], cluster)
+		st.kubexGpuExporterIndicators[cluster] = true
+		st.gpuExporters[common.KubexGpu] = append(st.gpuExporters[common.KubexGpu], cluster)
 	}
 }
 
-var ephemeralStorageExporterIndicators = make(map[string]bool)
-
-func determineEphemeralStorageExporter(cluster string, result model.Matrix) {
+func (st *state) determineEphemeralStorageExporter(cluster string, result model.Matrix) {
 	if l := result.Len(); l > 0 {
-		ephemeralStorageExporterIndicators[cluster] = true
+		st.ephemeralStorageExporterIndicators[cluster] = true
 	}
 }
 
-var beylaExporterIndicators = make(map[string]bool)
-
-func determineBeylaExporter(cluster string, result model.Matrix) {
+func (st *state) determineBeylaExporter(cluster string, result model.Matrix) {
 	if l := result.Len(); l > 0 {
-		beylaExporterIndicators[cluster] = true
+		st.beylaExporterIndicators[cluster] = true
 	}
 }
 
 // HasNodeExporter returns true if node exporter metrics are present for any cluster
-func HasNodeExporter(range5Min *v1.Range) bool {
-	DetermineExporters(range5Min)
-	return len(nodeExporterIndicators) > 0
+func HasNodeExporter(rc *common.RunContext, range5Min *v1.Range) bool {
+	st := getState(rc)
+	st.determineExporters(range5Min)
+	return len(st.nodeExporterIndicators) > 0
 }
 
 // HasDcgmExporter returns true if DCGM exporter metrics are present for any cluster
-func HasDcgmExporter(range5Min *v1.Range) bool {
-	DetermineExporters(range5Min)
-	return len(dcgmExporterIndicators) > 0
+func HasDcgmExporter(rc *common.RunContext, range5Min *v1.Range) bool {
+	st := getState(rc)
+	st.determineExporters(range5Min)
+	return len(st.dcgmExporterIndicators) > 0
 }
 
 // HasKubexGpuExporter returns true if Kubex GPU exporter metrics are present for any cluster
-func HasKubexGpuExporter(range5Min *v1.Range) bool {
-	DetermineExporters(range5Min)
-	return len(kubexGpuExporterIndicators) > 0
+func HasKubexGpuExporter(rc *common.RunContext, range5Min *v1.Range) bool {
+	st := getState(rc)
+	st.determineExporters(range5Min)
+	return len(st.kubexGpuExporterIndicators) > 0
 }
 
-func GetGpuExporters(range5Min *v1.Range) map[string][]string {
-	DetermineExporters(range5Min)
-	return gpuExporters
+func GetGpuExporters(rc *common.RunContext, range5Min *v1.Range) map[string][]string {
+	st := getState(rc)
+	st.determineExporters(range5Min)
+	return st.gpuExporters
 }
 
 var gpuExportersOrdered = []string{common.KubexGpu, common.Dcgm}
 
-func DetermineGpuExporter(range5Min *v1.Range) (s string) {
-	ges := GetGpuExporters(range5Min)
+func DetermineGpuExporter(rc *common.RunContext, range5Min *v1.Range) (s string) {
+	ges := GetGpuExporters(rc, range5Min)
 	for _, ge := range gpuExportersOrdered {
 		if len(ges[ge]) > 0 {
 			s = ge
@@ -538,26 +572,29 @@ func DetermineGpuExporter(range5Min *v1.Range) (s string) {
 	return
 }
 
-func GetGpuExporterType(range5Min *v1.Range, cluster string) (s string) {
-	DetermineExporters(range5Min)
-	if kubexGpuExporterIndicators[cluster] {
+func GetGpuExporterType(rc *common.RunContext, range5Min *v1.Range, cluster string) (s string) {
+	st := getState(rc)
+	st.determineExporters(range5Min)
+	if st.kubexGpuExporterIndicators[cluster] {
 		s = common.KubexGpu
-	} else if dcgmExporterIndicators[cluster] {
+	} else if st.dcgmExporterIndicators[cluster] {
 		s = common.Dcgm
 	}
 	return
 }
 
 // HasEphemeralStorageExporter returns true if ephemeral storage exporter metrics are present for any cluster
-func HasEphemeralStorageExporter(range5Min *v1.Range) bool {
-	DetermineExporters(range5Min)
-	return len(ephemeralStorageExporterIndicators) > 0
+func HasEphemeralStorageExporter(rc *common.RunContext, range5Min *v1.Range) bool {
+	st := getState(rc)
+	st.determineExporters(range5Min)
+	return len(st.ephemeralStorageExporterIndicators) > 0
 }
 
 // HasBeylaExporter returns true if Beyla exporter metrics are present for any cluster
-func HasBeylaExporter(range5Min *v1.Range) bool {
-	DetermineExporters(range5Min)
-	return len(beylaExporterIndicators) > 0
+func HasBeylaExporter(rc *common.RunContext, range5Min *v1.Range) bool {
+	st := getState(rc)
+	st.determineExporters(range5Min)
+	return len(st.beylaExporterIndicators) > 0
 }
 
 var queryWrapperKeys = []string{HasNodeLabel, HasInstanceLabelPodIp, HasInstanceLabelOther}
@@ -608,16 +645,14 @@ func simpleQueryWrapper(labelName string) *QueryWrapper {
 	}
 }
 
-var queryWrappers []*QueryWrapper
-
 // GetQueryWrappers returns the query wrappers that are relevant for the current environment
-func GetQueryWrappers(qws *[]*QueryWrapper, qwm map[string]*QueryWrapper) []*QueryWrapper {
+func GetQueryWrappers(rc *common.RunContext, qws *[]*QueryWrapper, qwm map[string]*QueryWrapper) []*QueryWrapper {
 	if qws == nil {
 		return nil
 	}
 	if *qws == nil {
 		for _, key := range queryWrapperKeys {
-			if _, f := nodeExporterIndicators[key]; f {
+			if _, f := getState(rc).nodeExporterIndicators[key]; f {
 				var qw *QueryWrapper
 				if qw, f = qwm[key]; f {
 					*qws = append(*qws, qw)
@@ -646,10 +681,8 @@ const (
 
 var ephemeralStorageBaseQuery = common.EphemeralExporterLabelReplace(`ephemeral_storage_node_capacity{} - ephemeral_storage_node_available{}`)
 
-var memActualAdditionalMetrics string
-
-func additionalMemActualMetrics(_ string, name string) {
-	memActualAdditionalMetrics += fmt.Sprintf(" + %s{}", name)
+func (st *state) additionalMemActualMetrics(_ string, name string) {
+	st.memActualAdditionalMetrics += fmt.Sprintf(" + %s{}", name)
 }
 
 var utilizationBaseQueries = map[bool]string{
@@ -657,20 +690,20 @@ var utilizationBaseQueries = map[bool]string{
 	false: utilizationBaseQueryAllocatable,
 }
 
-func GetMemActualQuery() string {
-	return fmt.Sprintf(memActualQueryFmt, memActualAdditionalMetrics)
+func GetMemActualQuery(rc *common.RunContext) string {
+	return fmt.Sprintf(memActualQueryFmt, getState(rc).memActualAdditionalMetrics)
 }
 
-func getMemoryMetrics(qw *QueryWrapper) {
+func (st *state) getMemoryMetrics(qw *QueryWrapper) {
 	var wmhms []map[string]*common.WorkloadMetricHolder
 	wmhms = append(wmhms, makeWmhMap(memBaseQuery, common.MemoryBytes, common.MemoryUtilization, qw, true))
-	wmhms = append(wmhms, makeWmhMap(GetMemActualQuery(), common.MemoryActualWorkload, common.MemoryActualUtilization, qw, true))
+	wmhms = append(wmhms, makeWmhMap(GetMemActualQuery(st.rc), common.MemoryActualWorkload, common.MemoryActualUtilization, qw, true))
 	memWsQuery := common.LabelReplace(common.LabelReplace(common.LabelReplace(memBaseWsQuery, common.Instance, common.Node, common.HasValue), common.Instance, k8sIoHostname, common.HasValue), common.Node, common.Instance, common.Always)
 	wmhms = append(wmhms, makeWmhMap(memWsQuery, common.MemoryWs, common.MemoryWsUtilization, qw, false))
 	for _, wmhm := range wmhms {
 		for baseQuery, wmh := range wmhm {
 			query := qw.Query.Wrap(baseQuery)
-			wmh.GetWorkloadFieldsFunc(query, qw.MetricField, overrideNodeNameFieldsFunc, common.NodeEntityKind)
+			wmh.GetWorkloadFieldsFunc(st.rc, query, qw.MetricField, st.overrideNodeNameFieldsFunc, common.NodeEntityKind)
 		}
 	}
 }
@@ -687,3 +720,12 @@ func makeWmhMap(baseQuery string, absolute, utilization *common.WorkloadMetricHo
 	utilizationQuery := fmt.Sprintf(utilizationFmt, baseQuery, mf, divisor)
 	return map[string]*common.WorkloadMetricHolder{baseQuery: absolute, utilizationQuery: utilization}
 }
+
+var _ = common.RegisterOverridableOutputs(common.NodeEntityKind,
+	common.CpuReservationPercent, common.MemoryReservationPercent, common.EphemeralStorageReservationPercent,
+	common.PodCount, common.EphemeralStorageUsageBytes, common.EphemeralStorageUsageUtilization,
+	common.GpuUtilizationAvg, common.GpuUtilizationGpusAvg, common.GpuMemUtilizationAvg, common.GpuMemUsedAvg, common.GpuPowerUsageAvg,
+	common.CpuUtilization, common.MemoryBytes, common.MemoryUtilization, common.MemoryActualWorkload, common.MemoryActualUtilization,
+	common.MemoryWs, common.MemoryWsUtilization, common.OomKillEvents, common.CpuThrottlingEvents,
+	common.DiskReadBytes, common.DiskWriteBytes, common.DiskTotalBytes, common.DiskReadOps, common.DiskWriteOps, common.DiskTotalOps,
+	common.NetReceivedBytes, common.NetSentBytes, common.NetTotalBytes, common.NetReceivedPackets, common.NetSentPackets, common.NetTotalPackets)
@@ -1,152 +1,96 @@
 package node
 
 import (
-	"fmt"
 	"github.com/densify-dev/container-data-collection/internal/common"
-	"os"
 	"strings"
 )
 
-func writeConfig() {
-	for name, cluster := range nodes {
-		writeConf(name, cluster)
+func (st *state) writeConfig() {
+	for name, cluster := range st.nodes {
+		st.writeConf(name, cluster)
 	}
 }
 
+var configSchema = common.NewSchema(common.NodeEntityKind, common.Config, 1).
+	Add(common.TimeColumn, false, "AuditTime").
+	Add(common.StringColumn, false, "ClusterName", "NodeName", "HwModel", "OsName").
+	Add(common.IntColumn, true, "HwTotalCpus", "HwTotalPhysicalCpus", "HwCoresPerCpu", "HwThreadsPerCore", "HwTotalMemory", "HwMaxNetworkIoBps")
+
 // writeConf will create the config.csv file that will be sent to Densify by the Forwarder.
-func writeConf(name string, cluster map[string]*node) {
-	configWrite, err := os.Create(common.GetFileNameByType(name, common.NodeEntityKind, common.Config))
+func (st *state) writeConf(name string, cluster map[string]*node) {
+	configWrite, err := st.rc.NewSchemaSink(name, configSchema)
 	if err != nil {
-		common.LogError(err, common.DefaultLogFormat, name, common.NodeEntityKind)
+		st.rc.LogError(err, common.DefaultLogFormat, name, common.NodeEntityKind)
 		return
 	}
 
-	defer func(file *os.File) {
-		if err = file.Close(); err != nil {
-			common.LogError(err, common.DefaultLogFormat, name, common.NodeEntityKind)
+	defer func(sink common.Sink) {
+		if err = sink.Close(); err != nil {
+			st.rc.LogError(err, common.DefaultLogFormat, name, common.NodeEntityKind)
 		}
 	}(configWrite)
 
-	if _, err = fmt.Fprintln(configWrite, "AuditTime,ClusterName,NodeName,HwModel,OsName,HwTotalCpus,HwTotalPhysicalCpus,HwCoresPerCpu,HwThreadsPerCore,HwTotalMemory,HwMaxNetworkIoBps"); err != nil {
-		common.LogError(err, common.DefaultLogFormat, name, common.NodeEntityKind)
-		return
-	}
-
 	for nodeName, n := range cluster {
 		opSys, instanceType := GetOSInstanceType(n.labelMap)
-		if _, err = fmt.Fprintf(configWrite, "%s,%s,%s,%s,%s", common.FormatCurrentTime(), name, overrideNodeName(name, nodeName), instanceType, opSys); err != nil {
-			common.LogError(err, common.DefaultLogFormat, name, common.NodeEntityKind)
-			return
-		}
 		memCap := common.UnknownValue
 		if n.memCapacity != common.UnknownValue {
 			memCap = n.memCapacity / 1024 / 1024
 		}
-		values := []int{n.cpuCapacity, n.cpuCapacity, 1, 1, memCap, n.netSpeedBytes}
-		last := len(values) - 1
-		for i, value := range values {
-			if err = common.PrintCSVNumberValue(configWrite, value, i == last); err != nil {
-				common.LogError(err, common.DefaultLogFormat, name, common.NodeEntityKind)
-				return
-			}
+		values := []any{st.rc.CurrentTime(), name, st.overrideNodeName(name, nodeName), instanceType, opSys}
+		values = append(values, common.KnownValues(n.cpuCapacity, n.cpuCapacity, 1, 1, memCap, n.netSpeedBytes)...)
+		if err = configWrite.WriteRecord(values...); err != nil {
+			st.rc.LogError(err, common.DefaultLogFormat, name, common.NodeEntityKind)
+			return
 		}
 	}
 }
 
-func writeAttributes() {
-	for name, cluster := range nodes {
-		writeAttrs(name, cluster)
+func (st *state) writeAttributes() {
+	cas := st.rc.GetCustomAttributes(common.NodeEntityKind)
+	for name, cluster := range st.nodes {
+		for nodeName, n := range cluster {
+			cas.Merge(name, n.labelMap, nodeName)
+		}
+		st.writeAttrs(name, cluster)
 	}
 }
 
-func writeAttrs(name string, cluster map[string]*node) {
-	attributeWrite, err := os.Create(common.GetFileNameByType(name, common.NodeEntityKind, common.Attributes))
+var attributesSchema = common.NewSchema(common.NodeEntityKind, common.Attributes, 1).
+	Add(common.StringColumn, false, "ClusterName", "NodeName", "VirtualTechnology", "VirtualDomain", "VirtualDatacenter", "VirtualCluster", "OsArchitecture").
+	Add(common.IntColumn, true, "NetworkSpeed", "CpuLimit", "CpuRequest", "MemoryLimit", "MemoryRequest", "GpuLimit", "GpuRequest",
+		"CapacityPods", "CapacityCpu", "CapacityMemory", "CapacityGpu", "CapacityEphemeralStorage", "CapacityHugePages",
+		"AllocatablePods", "AllocatableCpu", "AllocatableMemory", "AllocatableGpu", "AllocatableEphemeralStorage", "AllocatableHugePages",
+		"MemoryTotalBytes", "GpuTotal", "GpuMemoryTotal", "GpuReplicas").
+	Add(common.StringColumn, false, "ProviderId", "K8sVersion").
+	Add(common.LabelsColumn, false, "NodeLabels", "GpuLabels").
+	Add(common.StringColumn, false, "NodeTaints", "GpuVendor", "GpuModel", "GpuSharingStrategy").
+	Add(common.BoolColumn, false, "GpuMpsCapable", "GpuVgpuPresent", "GpuMigCapable").
+	Add(common.StringColumn, false, "GpuMigStrategy")
+
+func (st *state) writeAttrs(name string, cluster map[string]*node) {
+	attributeWrite, err := st.rc.NewSchemaSink(name, attributesSchema)
 	if err != nil {
-		common.LogError(err, common.DefaultLogFormat, name, common.NodeEntityKind)
+		st.rc.LogError(err, common.DefaultLogFormat, name, common.NodeEntityKind)
 		return
 	}
 
-	defer func(file *os.File) {
-		if err = file.Close(); err != nil {
-			common.LogError(err, common.DefaultLogFormat, name, common.NodeEntityKind)
+	defer func(sink common.Sink) {
+		if err = sink.Close(); err != nil {
+			st.rc.LogError(err, common.DefaultLogFormat, name, common.NodeEntityKind)
 		}
 	}(attributeWrite)
 
-	if _, err = fmt.Fprintln(attributeWrite, "ClusterName,NodeName,VirtualTechnology,VirtualDomain,VirtualDatacenter,VirtualCluster,OsArchitecture,NetworkSpeed,CpuLimit,CpuRequest,MemoryLimit,MemoryRequest,GpuLimit,GpuRequest,CapacityPods,CapacityCpu,CapacityMemory,CapacityGpu,CapacityEphemeralStorage,CapacityHugePages,AllocatablePods,AllocatableCpu,AllocatableMemory,AllocatableGpu,AllocatableEphemeralStorage,AllocatableHugePages,MemoryTotalBytes,GpuTotal,GpuMemoryTotal,GpuReplicas,ProviderId,K8sVersion,NodeLabels,GpuLabels,NodeTaints,GpuVendor,GpuModel,GpuSharingStrategy,GpuMpsCapable,GpuVgpuPresent,GpuMigCapable,GpuMigStrategy"); err != nil {
-		common.LogError(err, common.DefaultLogFormat, name, common.NodeEntityKind)
-		return
-	}
-
 	for nodeName, n := range cluster {
 		arch, region, zone := getArchRegionZone(n.labelMap)
-		if _, err = fmt.Fprintf(attributeWrite, "%s,%s,Nodes,%s,%s,%s,%s", name, overrideNodeName(name, nodeName), name, region, zone, arch); err != nil {
-			common.LogError(err, common.DefaultLogFormat, name, common.NodeEntityKind)
-			return
-		}
-		values := []int{n.netSpeedBytes, n.cpuLimit, n.cpuRequest, n.memLimit, n.memRequest, n.gpuLimit, n.gpuRequest,
+		values := []any{name, st.overrideNodeName(name, nodeName), "Nodes", name, region, zone, arch}
+		values = append(values, common.KnownValues(n.netSpeedBytes, n.cpuLimit, n.cpuRequest, n.memLimit, n.memRequest, n.gpuLimit, n.gpuRequest,
 			n.podsCapacity, n.cpuCapacity, n.memCapacity, n.gpuCapacity, n.ephemeralStorageCapacity, n.hugepages2MiCapacity,
 			n.podsAllocatable, n.cpuAllocatable, n.memAllocatable, n.gpuAllocatable, n.ephemeralStorageAllocatable, n.hugepages2MiAllocatable,
-			n.memTotal, n.gpuTotal, n.gpuMemTotal, n.gpuReplicas}
-		for _, value := range values {
-			if err = common.PrintCSVNumberValue(attributeWrite, value, false); err != nil {
-				common.LogError(err, common.DefaultLogFormat, name, common.NodeEntityKind)
-				return
-			}
-		}
-		if err = common.PrintCSVStringValue(attributeWrite, n.providerId, false); err != nil {
-			common.LogError(err, common.DefaultLogFormat, name, common.NodeEntityKind)
-			return
-		}
-		if err = common.PrintCSVStringValue(attributeWrite, n.k8sVersion, false); err != nil {
-			common.LogError(err, common.DefaultLogFormat, name, common.NodeEntityKind)
-			return
-		}
-		if err = common.PrintCSVStringValue(attributeWrite, common.Empty, false); err != nil {
-			common.LogError(err, common.DefaultLogFormat, name, common.NodeEntityKind)
-			return
-		}
-		if err = common.PrintCSVLabelMap(attributeWrite, n.labelMap, false); err != nil {
-			common.LogError(err, common.DefaultLogFormat, name, common.NodeEntityKind)
-			return
-		}
-		if err = common.PrintCSVStringValue(attributeWrite, common.Empty, false); err != nil {
-			common.LogError(err, common.DefaultLogFormat, name, common.NodeEntityKind)
-			return
-		}
-		if err = common.PrintCSVLabelMap(attributeWrite, n.gpuLabelMap, false); err != nil {
-			common.LogError(err, common.DefaultLogFormat, name, common.NodeEntityKind)
-			return
-		}
-		if err = common.PrintCSVStringValue(attributeWrite, n.taints.String(), false); err != nil {
-			common.LogError(err, common.DefaultLogFormat, name, common.NodeEntityKind)
-			return
-		}
-		if err = common.PrintCSVStringValue(attributeWrite, n.gpuVendor, false); err != nil {
-			common.LogError(err, common.DefaultLogFormat, name, common.NodeEntityKind)
-			return
-		}
-		if err = common.PrintCSVStringValue(attributeWrite, n.gpuModel, false); err != nil {
-			common.LogError(err, common.DefaultLogFormat, name, common.NodeEntityKind)
-			return
-		}
-		if err = common.PrintCSVStringValue(attributeWrite, n.gpuSharingStrategy, false); err != nil {
-			common.LogError(err, common.DefaultLogFormat, name, common.NodeEntityKind)
-			return
-		}
-		if err = common.PrintCSVBoolValue(attributeWrite, n.gpuMpsCapable, false); err != nil {
-			common.LogError(err, common.DefaultLogFormat, name, common.NodeEntityKind)
-			return
-		}
-		if err = common.PrintCSVBoolValue(attributeWrite, n.gpuVgpuPresent, false); err != nil {
-			common.LogError(err, common.DefaultLogFormat, name, common.NodeEntityKind)
-			return
-		}
-		if err = common.PrintCSVBoolValue(attributeWrite, n.gpuMigCapable, false); err != nil {
-			common.LogError(err, common.DefaultLogFormat, name, common.NodeEntityKind)
-			return
-		}
-		if err = common.PrintCSVStringValue(attributeWrite, n.gpuMigStrategy, true); err != nil {
-			common.LogError(err, common.DefaultLogFormat, name, common.NodeEntityKind)
+			n.memTotal, n.gpuTotal, n.gpuMemTotal, n.gpuReplicas)...)
+		values = append(values, n.providerId, n.k8sVersion, common.LabelMap{Map: n.labelMap}, common.LabelMap{Map: n.gpuLabelMap}, n.taints.String(),
+			n.gpuVendor, n.gpuModel, n.gpuSharingStrategy, n.gpuMpsCapable, n.gpuVgpuPresent, n.gpuMigCapable, n.gpuMigStrategy)
+		if err = attributeWrite.WriteRecord(values...); err != nil {
+			st.rc.LogError(err, common.DefaultLogFormat, name, common.NodeEntityKind)
 			return
 		}
 	}
@@ -157,9 +101,9 @@ const (
 	okeProviderIdPrefix = "ocid"
 )
 
-func overrideNodeName(cluster, nodeName string) (name string) {
+func (st *state) overrideNodeName(cluster, nodeName string) (name string) {
 	name = nodeName
-	if n := nodes[cluster][nodeName]; n != nil {
+	if n := st.nodes[cluster][nodeName]; n != nil {
 		// EKS node names have the form:
 		// ip-<IP address>.<AWS region>>.compute.internal
 		// This is problematic (seen in practice) as IP addresses can be recycled, therefore
@@ -188,17 +132,18 @@ func overrideNodeName(cluster, nodeName string) (name string) {
 }
 
 // overrideNodeNameFieldsFunc assumes that the LAST field is the node name
-func overrideNodeNameFieldsFunc(cluster string, fields []string) ([]string, bool) {
+func (st *state) overrideNodeNameFieldsFunc(cluster string, fields []string) ([]string, bool) {
 	l := len(fields)
 	ok := l >= 1
 	if ok {
-		fields[l-1] = overrideNodeName(cluster, fields[l-1])
+		fields[l-1] = st.overrideNodeName(cluster, fields[l-1])
 	}
 	return fields, ok
 }
 
-func OverrideNodeNames(cluster string, nodes string, sep string) string {
-	ns := strings.Split(nodes, sep)
+func OverrideNodeNames(rc *common.RunContext, cluster string, nodeNames string, sep string) string {
+	st := getState(rc)
+	ns := strings.Split(nodeNames, sep)
 	// git rid of possible trailing empty string
 	if l := len(ns); l > 0 {
 		if ns[l-1] == common.Empty {
@@ -207,9 +152,7 @@ func OverrideNodeNames(cluster string, nodes string, sep string) string {
 		common.SortSlice(ns)
 	}
 	for i, n := range ns {
-		ns[i] = overrideNodeName(cluster, n)
+		ns[i] = st.overrideNodeName(cluster, n)
 	}
 	return strings.Join(ns, sep)
 }
-
-var nodeWorkloadWriters = common.NewWorkloadWriters()
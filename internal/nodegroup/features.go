@@ -23,10 +23,8 @@ type clusterFeature interface {
 	AdjustNodeGroupName(name string) string
 }
 
-var clusterFeatures = make(map[string]clusterFeature)
-
-func AdjustNodeGroupName(cluster, name string) (s string) {
-	if cf, f := clusterFeatures[cluster]; f {
+func (st *state) adjustNodeGroupName(cluster, name string) (s string) {
+	if cf, f := st.clusterFeatures[cluster]; f {
 		s = cf.AdjustNodeGroupName(name)
 	} else {
 		s = name
@@ -106,8 +104,8 @@ func CountQueryFmt(cf clusterFeature) string {
 	return countWqw.Wrap(cf.NodeAndGroupCoreQueryFmt())
 }
 
-func ensureFeature(cluster string, ft featureType) (cf clusterFeature, f bool) {
-	if cf, f = clusterFeatures[cluster]; !f {
+func (st *state) ensureFeature(cluster string, ft featureType) (cf clusterFeature, f bool) {
+	if cf, f = st.clusterFeatures[cluster]; !f {
 		switch ft {
 		case labelType:
 			cf = &labelFeature{}
@@ -117,18 +115,18 @@ func ensureFeature(cluster string, ft featureType) (cf clusterFeature, f bool) {
 				machineSetsSubstitutions: make(map[string]string),
 			}
 		case roleType:
-			cf = &roleFeature{}
+			cf = &roleFeature{eng: st.roleEng}
 		}
 		if cf != nil {
-			clusterFeatures[cluster], f = cf, true
+			st.clusterFeatures[cluster], f = cf, true
 		}
 	}
 	return
 }
 
-func ensureLabelFeature(cluster string) (lf *labelFeature, ok bool) {
+func (st *state) ensureLabelFeature(cluster string) (lf *labelFeature, ok bool) {
 	var cf clusterFeature
-	if cf, ok = ensureFeature(cluster, labelType); ok {
+	if cf, ok = st.ensureFeature(cluster, labelType); ok {
 		if ok = cf.Type() == labelType; ok {
 			lf, ok = cf.(*labelFeature)
 		}
@@ -136,9 +134,9 @@ func ensureLabelFeature(cluster string) (lf *labelFeature, ok bool) {
 	return
 }
 
-func ensureOpenShiftFeature(cluster string) (of *openshiftFeature, ok bool) {
+func (st *state) ensureOpenShiftFeature(cluster string) (of *openshiftFeature, ok bool) {
 	var cf clusterFeature
-	if cf, ok = ensureFeature(cluster, openshiftType); ok {
+	if cf, ok = st.ensureFeature(cluster, openshiftType); ok {
 		if ok = cf.Type() == openshiftType; ok {
 			of, ok = cf.(*openshiftFeature)
 		}
@@ -146,9 +144,9 @@ func ensureOpenShiftFeature(cluster string) (of *openshiftFeature, ok bool) {
 	return
 }
 
-func ensureRoleFeature(cluster string) (rf *roleFeature, ok bool) {
+func (st *state) ensureRoleFeature(cluster string) (rf *roleFeature, ok bool) {
 	var cf clusterFeature
-	if cf, ok = ensureFeature(cluster, roleType); ok {
+	if cf, ok = st.ensureFeature(cluster, roleType); ok {
 		if ok = cf.Type() == roleType; ok {
 			rf, ok = cf.(*roleFeature)
 		}
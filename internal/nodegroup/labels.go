@@ -88,16 +88,16 @@ func (lf *labelFeature) AdjustNodeGroupName(name string) string {
 	return name
 }
 
-func determineLabelFeatures(promRange *v1.Range) (err error) {
-	query := "avg(kube_node_labels{}) by (" + common.ToPrometheusLabelNameList(common.Params.Collection.NodeGroupList) + common.RightBracket
-	if _, err = common.CollectAndProcessMetric(query, promRange, detectNameLabel); err != nil {
+func (st *state) determineLabelFeatures(promRange *v1.Range) (err error) {
+	query := "avg(kube_node_labels{}) by (" + common.ToPrometheusLabelNameList(st.rc.Params().Collection.NodeGroupList) + common.RightBracket
+	if _, err = st.rc.CollectAndProcessMetric(query, promRange, st.detectNameLabel); err != nil {
 		// error already handled
 		return
 	}
-	for ngl := range allLabelNames {
-		ngh := &nodeGroupHolder{nodeGroupLabel: ngl}
+	for ngl := range st.allLabelNames {
+		ngh := &nodeGroupHolder{st: st, nodeGroupLabel: ngl}
 		query = common.FormatRepeatedAuto(labelCoreQueryFmt, ngl)
-		if _, err = common.CollectAndProcessMetric(query, promRange, ngh.createNodeGroup); err != nil {
+		if _, err = st.rc.CollectAndProcessMetric(query, promRange, ngh.createNodeGroup); err != nil {
 			// error already handled
 			return
 		}
@@ -109,9 +109,7 @@ func labelNameCmp(lna, lnb model.LabelName) int {
 	return cmp.Compare(GetProviderType(lna), GetProviderType(lnb))
 }
 
-var allLabelNames = make(map[model.LabelName]bool)
-
-func detectNameLabel(cluster string, result model.Matrix) {
+func (st *state) detectNameLabel(cluster string, result model.Matrix) {
 	var foundDefault bool
 	merged := make(model.Metric)
 	for _, ss := range result {
@@ -141,12 +139,12 @@ func detectNameLabel(cluster string, result model.Matrix) {
 		llns = len(lns)
 	}
 	if llns > 0 {
-		clusterFeatures[cluster] = &labelFeature{
+		st.clusterFeatures[cluster] = &labelFeature{
 			labelNames: lns,
 			useDefault: !foundDefault && llns < 2,
 		}
 		for _, ln := range lns {
-			allLabelNames[ln] = true
+			st.allLabelNames[ln] = true
 		}
 	}
 }
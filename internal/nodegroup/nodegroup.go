@@ -2,7 +2,6 @@ package nodegroup
 
 import (
 	"fmt"
-	"os"
 	"strings"
 
 	"github.com/densify-dev/container-data-collection/internal/common"
@@ -13,24 +12,46 @@ import (
 type nodeGroup struct {
 	nodes                                                                             string
 	cpuLimit, cpuRequest, cpuCapacity, memLimit, memRequest, memCapacity, currentSize int
-	labelMap                                                                          map[string]string
+	labelMap                                                                          common.LabelValues
 }
 
-var nodeGroups = make(map[string]map[string]*nodeGroup)
+// state holds the node groups and the cluster features of a run
+type state struct {
+	rc              *common.RunContext
+	nodeGroups      map[string]map[string]*nodeGroup
+	foundUnified    *common.Indicators
+	clusterFeatures map[string]clusterFeature
+	allLabelNames   map[model.LabelName]bool
+	roleEng         *roleEngine
+}
+
+type stateKey struct{}
 
-func getNodeGroup(cluster string, ss *model.SampleStream, nodeGroupLabel model.LabelName) (ng *nodeGroup, f bool) {
+func getState(rc *common.RunContext) *state {
+	return common.CollectorState(rc, stateKey{}, func(rc *common.RunContext) *state {
+		return &state{
+			rc:              rc,
+			nodeGroups:      make(map[string]map[string]*nodeGroup),
+			foundUnified:    common.NewIndicators(),
+			clusterFeatures: make(map[string]clusterFeature),
+			allLabelNames:   make(map[model.LabelName]bool),
+		}
+	})
+}
+
+func (st *state) getNodeGroup(cluster string, ss *model.SampleStream, nodeGroupLabel model.LabelName) (ng *nodeGroup, f bool) {
 	var nodeGroupLabelValue model.LabelValue
 	nodeGroupLabelValue, f = ss.Metric[nodeGroupLabel]
 	if f {
 		nodeGroupValue := string(nodeGroupLabelValue)
-		ng, f = nodeGroups[cluster][nodeGroupValue]
+		ng, f = st.nodeGroups[cluster][nodeGroupValue]
 	}
 	return
 }
 
-func getNodeGroupMetricString(cluster string, result model.Matrix, nodeGroupLabel model.LabelName) {
+func (st *state) getNodeGroupMetricString(cluster string, result model.Matrix, nodeGroupLabel model.LabelName) {
 	for _, ss := range result {
-		ng, ok := getNodeGroup(cluster, ss, nodeGroupLabel)
+		ng, ok := st.getNodeGroup(cluster, ss, nodeGroupLabel)
 		if !ok {
 			continue
 		}
@@ -41,6 +62,7 @@ func getNodeGroupMetricString(cluster string, result model.Matrix, nodeGroupLabe
 }
 
 type nodeGroupHolder struct {
+	st             *state
 	nodeGroupLabel model.LabelName
 }
 
@@ -51,7 +73,7 @@ type nodeGroupMetricHolder struct {
 
 func (ngmh *nodeGroupMetricHolder) getNodeGroupMetric(cluster string, result model.Matrix) {
 	for _, ss := range result {
-		nodeGroup, ok := getNodeGroup(cluster, ss, ngmh.nodeGroupLabel)
+		nodeGroup, ok := ngmh.st.getNodeGroup(cluster, ss, ngmh.nodeGroupLabel)
 		if !ok {
 			continue
 		}
@@ -81,119 +103,101 @@ func (ngmh *nodeGroupMetricHolder) getNodeGroupMetric(cluster string, result mod
 	}
 }
 
-func writeConfig() {
-	for name, cluster := range nodeGroups {
-		writeConf(name, cluster)
+func (st *state) writeConfig() {
+	for name, cluster := range st.nodeGroups {
+		st.writeConf(name, cluster)
 	}
 }
 
-func writeConf(name string, cluster map[string]*nodeGroup) {
-	configWrite, err := os.Create(common.GetFileNameByType(name, common.NodeGroupEntityKind, common.Config))
+var configSchema = common.NewSchema(common.NodeGroupEntityKind, common.Config, 1).
+	Add(common.TimeColumn, false, "AuditTime").
+	Add(common.StringColumn, false, "ClusterName", "NodeGroupName").
+	Add(common.IntColumn, true, "HwTotalCpus", "HwTotalPhysicalCpus", "HwCoresPerCpu", "HwThreadsPerCore", "HwTotalMemory").
+	Add(common.StringColumn, false, "HwModel", "OsName")
+
+func (st *state) writeConf(name string, cluster map[string]*nodeGroup) {
+	configWrite, err := st.rc.NewSchemaSink(name, configSchema)
 	if err != nil {
-		common.LogError(err, common.DefaultLogFormat, name, common.NodeGroupEntityKind)
+		st.rc.LogError(err, common.DefaultLogFormat, name, common.NodeGroupEntityKind)
 		return
 	}
 
-	defer func(file *os.File) {
-		if err = file.Close(); err != nil {
-			common.LogError(err, common.DefaultLogFormat, name, common.NodeGroupEntityKind)
+	defer func(sink common.Sink) {
+		if err = sink.Close(); err != nil {
+			st.rc.LogError(err, common.DefaultLogFormat, name, common.NodeGroupEntityKind)
 		}
 	}(configWrite)
 
-	if _, err = fmt.Fprintln(configWrite, "AuditTime,ClusterName,NodeGroupName,HwTotalCpus,HwTotalPhysicalCpus,HwCoresPerCpu,HwThreadsPerCore,HwTotalMemory,HwModel,OsName"); err != nil {
-		common.LogError(err, common.DefaultLogFormat, name, common.NodeGroupEntityKind)
-		return
-	}
-
 	for nodeGroupName, ng := range cluster {
-		if _, err = fmt.Fprintf(configWrite, "%s,%s,%s", common.FormatCurrentTime(), name, AdjustNodeGroupName(name, nodeGroupName)); err != nil {
-			common.LogError(err, common.DefaultLogFormat, name, common.NodeGroupEntityKind)
-			return
-		}
-		values := []int{ng.cpuCapacity, ng.cpuCapacity, 1, 1, ng.memCapacity}
-		for _, value := range values {
-			if err = common.PrintCSVNumberValue(configWrite, value, false); err != nil {
-				common.LogError(err, common.DefaultLogFormat, name, common.NodeGroupEntityKind)
-				return
-			}
-		}
+		values := []any{st.rc.CurrentTime(), name, st.adjustNodeGroupName(name, nodeGroupName)}
+		values = append(values, common.KnownValues(ng.cpuCapacity, ng.cpuCapacity, 1, 1, ng.memCapacity)...)
 		opSys, instanceType := node.GetOSInstanceType(ng.labelMap)
-		if _, err = fmt.Fprintf(configWrite, ",%s,%s\n", instanceType, opSys); err != nil {
-			common.LogError(err, common.DefaultLogFormat, name, common.NodeGroupEntityKind)
+		values = append(values, instanceType, opSys)
+		if err = configWrite.WriteRecord(values...); err != nil {
+			st.rc.LogError(err, common.DefaultLogFormat, name, common.NodeGroupEntityKind)
 			return
 		}
 	}
 }
 
-func writeAttributes() {
-	for name, cluster := range nodeGroups {
-		writeAttrs(name, cluster)
+func (st *state) writeAttributes() {
+	cas := st.rc.GetCustomAttributes(common.NodeGroupEntityKind)
+	for name, cluster := range st.nodeGroups {
+		for nodeGroupName, ng := range cluster {
+			cas.Merge(name, ng.labelMap, nodeGroupName)
+		}
+		st.writeAttrs(name, cluster)
 	}
 }
 
-func writeAttrs(name string, cluster map[string]*nodeGroup) {
-	attributeWrite, err := os.Create(common.GetFileNameByType(name, common.NodeGroupEntityKind, common.Attributes))
+var attributesSchema = common.NewSchema(common.NodeGroupEntityKind, common.Attributes, 1).
+	Add(common.StringColumn, false, "ClusterName", "NodeGroupName", "VirtualTechnology", "VirtualDomain").
+	Add(common.IntColumn, true, "CpuLimit", "CpuRequest", "MemoryLimit", "MemoryRequest", "CurrentSize").
+	Add(common.StringColumn, false, "CurrentNodes").
+	Add(common.LabelsColumn, false, "NodeLabels")
+
+func (st *state) writeAttrs(name string, cluster map[string]*nodeGroup) {
+	attributeWrite, err := st.rc.NewSchemaSink(name, attributesSchema)
 	if err != nil {
-		common.LogError(err, common.DefaultLogFormat, name, common.NodeGroupEntityKind)
+		st.rc.LogError(err, common.DefaultLogFormat, name, common.NodeGroupEntityKind)
 		return
 	}
 
-	defer func(file *os.File) {
-		if err = file.Close(); err != nil {
-			common.LogError(err, common.DefaultLogFormat, name, common.NodeGroupEntityKind)
+	defer func(sink common.Sink) {
+		if err = sink.Close(); err != nil {
+			st.rc.LogError(err, common.DefaultLogFormat, name, common.NodeGroupEntityKind)
 		}
 	}(attributeWrite)
 
-	if _, err = fmt.Fprintln(attributeWrite, "ClusterName,NodeGroupName,VirtualTechnology,VirtualDomain,CpuLimit,CpuRequest,MemoryLimit,MemoryRequest,CurrentSize,CurrentNodes,NodeLabels"); err != nil {
-		common.LogError(err, common.DefaultLogFormat, name, common.NodeGroupEntityKind)
-		return
-	}
 	for nodeGroupName, ng := range cluster {
-		if _, err = fmt.Fprintf(attributeWrite, "%s,%s,NodeGroup,%s", name, AdjustNodeGroupName(name, nodeGroupName), name); err != nil {
-			common.LogError(err, common.DefaultLogFormat, name, common.NodeGroupEntityKind)
-			return
-		}
-		values := []int{ng.cpuLimit, ng.cpuRequest, ng.memLimit, ng.memRequest, ng.currentSize}
-		for _, value := range values {
-			if err = common.PrintCSVNumberValue(attributeWrite, value, false); err != nil {
-				common.LogError(err, common.DefaultLogFormat, name, common.NodeGroupEntityKind)
-				return
-			}
-		}
-		nodes := node.OverrideNodeNames(name, ng.nodes, common.Or)
-		if err = common.PrintCSVStringValue(attributeWrite, nodes, false); err != nil {
-			common.LogError(err, common.DefaultLogFormat, name, common.NodeGroupEntityKind)
-			return
-		}
-		if err = common.PrintCSVStringValue(attributeWrite, common.Empty, false); err != nil {
-			common.LogError(err, common.DefaultLogFormat, name, common.NodeGroupEntityKind)
-			return
-		}
-		if err = common.PrintCSVLabelMap(attributeWrite, ng.labelMap, true); err != nil {
-			common.LogError(err, common.DefaultLogFormat, name, common.NodeGroupEntityKind)
+		values := []any{name, st.adjustNodeGroupName(name, nodeGroupName), "NodeGroup", name}
+		values = append(values, common.KnownValues(ng.cpuLimit, ng.cpuRequest, ng.memLimit, ng.memRequest, ng.currentSize)...)
+		values = append(values, node.OverrideNodeNames(st.rc, name, ng.nodes, common.Or), common.LabelMap{Map: ng.labelMap})
+		if err = attributeWrite.WriteRecord(values...); err != nil {
+			st.rc.LogError(err, common.DefaultLogFormat, name, common.NodeGroupEntityKind)
 			return
 		}
 	}
 }
 
 // overrideNodeGroupNameFieldsFunc assumes that the LAST field is the node group name
-func overrideNodeGroupNameFieldsFunc(cluster string, fields []string) ([]string, bool) {
+func (st *state) overrideNodeGroupNameFieldsFunc(cluster string, fields []string) ([]string, bool) {
 	l := len(fields)
 	ok := l >= 1
 	if ok {
-		fields[l-1] = AdjustNodeGroupName(cluster, fields[l-1])
+		fields[l-1] = st.adjustNodeGroupName(cluster, fields[l-1])
 	}
 	return fields, ok
 }
 
 // getWorkload used to query for the workload data and then calls write workload
-func getWorkload(wmh *common.WorkloadMetricHolder, query string, labelNames []model.LabelName, ccqa common.QueryAdjuster) {
+func (st *state) getWorkload(wmh *common.WorkloadMetricHolder, query string, labelNames []model.LabelName, ccqa common.QueryAdjuster) {
 	m := getQueryToMetricField(query, labelNames, ccqa)
 	qps := make(map[string]*common.QueryProcessor, len(m))
 	for q, mf := range m {
-		qps[q] = &common.QueryProcessor{MetricFields: mf, FF: overrideNodeGroupNameFieldsFunc}
+		qps[q] = &common.QueryProcessor{MetricFields: mf, FF: st.overrideNodeGroupNameFieldsFunc}
 	}
-	wmh.GetWorkloadQueryVariants(2, qps, common.NodeGroupEntityKind)
+	wmh.GetWorkloadQueryVariants(st.rc, 2, qps, common.NodeGroupEntityKind)
 }
 
 func getQueryToMetricField(query string, labelNames []model.LabelName, ccqa common.QueryAdjuster) map[string][]model.LabelName {
@@ -207,16 +211,16 @@ func getQueryToMetricField(query string, labelNames []model.LabelName, ccqa comm
 }
 
 func (ngh *nodeGroupHolder) createNodeGroup(cluster string, result model.Matrix) {
-	if _, f := ensureLabelFeature(cluster); f {
-		createNodeGroup(cluster, result, ngh.nodeGroupLabel)
-		getNodeGroupMetricString(cluster, result, ngh.nodeGroupLabel)
+	if _, f := ngh.st.ensureLabelFeature(cluster); f {
+		ngh.st.createNodeGroup(cluster, result, ngh.nodeGroupLabel)
+		ngh.st.getNodeGroupMetricString(cluster, result, ngh.nodeGroupLabel)
 	}
 }
 
-func createNodeGroup(cluster string, result model.Matrix, labelName model.LabelName) {
-	if _, f := nodeGroups[cluster]; !f {
+func (st *state) createNodeGroup(cluster string, result model.Matrix, labelName model.LabelName) {
+	if _, f := st.nodeGroups[cluster]; !f {
 		if l := result.Len(); l > 0 {
-			nodeGroups[cluster] = make(map[string]*nodeGroup, l)
+			st.nodeGroups[cluster] = make(map[string]*nodeGroup, l)
 		}
 	}
 	for _, ss := range result {
@@ -229,7 +233,7 @@ func createNodeGroup(cluster string, result model.Matrix, labelName model.LabelN
 			nodeGroupName = string(name)
 		}
 		var ng *nodeGroup
-		if ng, f = nodeGroups[cluster][nodeGroupName]; !f {
+		if ng, f = st.nodeGroups[cluster][nodeGroupName]; !f {
 			ng = &nodeGroup{
 				// currentSize is initialized to 0!
 				cpuLimit:    common.UnknownValue,
@@ -238,9 +242,9 @@ func createNodeGroup(cluster string, result model.Matrix, labelName model.LabelN
 				memLimit:    common.UnknownValue,
 				memRequest:  common.UnknownValue,
 				memCapacity: common.UnknownValue,
-				labelMap:    make(map[string]string),
+				labelMap:    make(common.LabelValues),
 			}
-			nodeGroups[cluster][nodeGroupName] = ng
+			st.nodeGroups[cluster][nodeGroupName] = ng
 		}
 		if name, f = ss.Metric[common.Node]; !f {
 			continue
@@ -255,19 +259,17 @@ func createNodeGroup(cluster string, result model.Matrix, labelName model.LabelN
 
 }
 
-var foundUnified = make(map[string]int)
-
-func incUnifiedLimits(_ string, result model.Matrix) {
-	incUnified(result, common.Limit)
+func (st *state) incUnifiedLimits(_ string, result model.Matrix) {
+	st.incUnified(result, common.Limit)
 }
 
-func incUnifiedRequests(_ string, result model.Matrix) {
-	incUnified(result, common.Request)
+func (st *state) incUnifiedRequests(_ string, result model.Matrix) {
+	st.incUnified(result, common.Request)
 }
 
-func incUnified(result model.Matrix, qualifier string) {
+func (st *state) incUnified(result model.Matrix, qualifier string) {
 	if result.Len() > 0 {
-		foundUnified[qualifier] = foundUnified[qualifier] + 1
+		st.foundUnified.Inc(qualifier)
 	}
 }
 
@@ -299,64 +301,65 @@ func generateQuery(queryFmt string, labelName model.LabelName, ccqa common.Query
 }
 
 // Metrics a global func for collecting node level metrics in prometheus
-func Metrics() {
+func Metrics(rc *common.RunContext) {
+	st := getState(rc)
 	var query string
 	var err error
-	range5Min := common.TimeRange()
+	range5Min := rc.TimeRange()
 
 	query = `sum(kube_pod_container_resource_limits{}) by (node, resource)`
-	if _, err = common.CollectAndProcessMetric(query, range5Min, incUnifiedLimits); err != nil {
+	if _, err = rc.CollectAndProcessMetric(query, range5Min, st.incUnifiedLimits); err != nil {
 		// error already handled
 		return
 	}
 
 	query = `sum(kube_pod_container_resource_requests{}) by (node, resource)`
-	if _, err = common.CollectAndProcessMetric(query, range5Min, incUnifiedRequests); err != nil {
+	if _, err = rc.CollectAndProcessMetric(query, range5Min, st.incUnifiedRequests); err != nil {
 		// error already handled
 		return
 	}
 
-	if err = determineLabelFeatures(range5Min); err != nil {
-		common.LogErrorWithLevel(1, common.Error, err, "entity=%s", common.NodeGroupEntityKind)
+	if err = st.determineLabelFeatures(range5Min); err != nil {
+		rc.LogErrorWithLevel(1, common.Error, err, "entity=%s", common.NodeGroupEntityKind)
 	}
 
-	if len(clusterFeatures) < common.NumClusters() {
-		if err = determineOpenshiftFeatures(range5Min); err != nil {
-			common.LogErrorWithLevel(1, common.Error, err, "entity=%s", common.NodeGroupEntityKind)
+	if len(st.clusterFeatures) < rc.NumClusters() {
+		if err = st.determineOpenshiftFeatures(range5Min); err != nil {
+			rc.LogErrorWithLevel(1, common.Error, err, "entity=%s", common.NodeGroupEntityKind)
 		}
 	}
 
-	if len(clusterFeatures) < common.NumClusters() {
-		if err = determineRoleFeatures(range5Min); err != nil {
-			common.LogErrorWithLevel(1, common.Error, err, "entity=%s", common.NodeGroupEntityKind)
+	if len(st.clusterFeatures) < rc.NumClusters() {
+		if err = st.determineRoleFeatures(range5Min); err != nil {
+			rc.LogErrorWithLevel(1, common.Error, err, "entity=%s", common.NodeGroupEntityKind)
 		}
 	}
 
-	if len(clusterFeatures) < common.NumClusters() {
+	if len(st.clusterFeatures) < rc.NumClusters() {
 		// TODO: set default
 	}
 
-	common.RegisterClusterQueryExclusion(common.ExcComment, common.ExcludeQueryByClusterComment)
+	rc.RegisterClusterQueryExclusion(common.ExcComment, common.ExcludeQueryByClusterComment)
 
-	ccqas := common.GetClusterCommentQueryAdapters()
+	ccqas := rc.GetClusterCommentQueryAdapters()
 
 	for cluster, ccqa := range ccqas {
-		cf, ok := clusterFeatures[cluster]
+		cf, ok := st.clusterFeatures[cluster]
 		if cf == nil || !ok {
 			continue
 		}
 		var queryFmt string
 		for _, labelName := range cf.LabelNames() {
 			configSuffix := QuerySuffixFmt(cf, common.ConfigSt, true)
-			ngh := &nodeGroupHolder{nodeGroupLabel: labelName}
+			ngh := &nodeGroupHolder{st: st, nodeGroupLabel: labelName}
 			ngmh := &nodeGroupMetricHolder{nodeGroupHolder: ngh}
 			for _, qualifier := range qualifiers {
-				for _, f := range common.FoundIndicatorCounter(foundUnified, qualifier) {
+				for _, f := range rc.FoundIndicatorCounter(st.foundUnified, qualifier) {
 					for res, coreQuery := range resourceCoreQueries[qualifier][f] {
 						queryFmt = fmt.Sprintf("sum(sum(%s%s) by (node)%s", coreQuery, operands[res], configSuffix)
 						query = generateQuery(queryFmt, labelName, ccqa)
 						ngmh.metric = common.DromedaryCase(res, qualifier)
-						_, _ = common.CollectAndProcessMetric(query, range5Min, ngmh.getNodeGroupMetric)
+						_, _ = rc.CollectAndProcessMetric(query, range5Min, ngmh.getNodeGroupMetric)
 					}
 				}
 			}
@@ -364,76 +367,76 @@ func Metrics() {
 			queryFmt = fmt.Sprintf("sum(kube_node_status_capacity{}%s", configSuffix)
 			query = generateQuery(queryFmt, labelName, ccqa, common.Resource)
 			ngmh.metric = common.Capacity
-			_, _ = common.CollectAndProcessMetric(query, range5Min, ngmh.getNodeGroupMetric)
+			_, _ = rc.CollectAndProcessMetric(query, range5Min, ngmh.getNodeGroupMetric)
 		}
-		writeAttributes()
-		writeConfig()
+		st.writeAttributes()
+		st.writeConfig()
 
 		nodeGroupLabels := cf.LabelNames()
 		var queryWrappers []*node.QueryWrapper
 
 		qmf := getQueryToMetricField(QuerySuffixFmt(cf, common.Metric, false), nodeGroupLabels, ccqa)
-		common.GetConditionalMetricsWorkload(foundUnified, common.Request, qmf, common.NodeGroupEntityKind, common.Metric)
+		rc.GetConditionalMetricsWorkload(st.foundUnified, common.Request, qmf, common.NodeGroupEntityKind, common.Metric)
 
 		query = CountQueryFmt(cf)
-		getWorkload(common.CurrentSize, query, nodeGroupLabels, ccqa)
+		st.getWorkload(common.CurrentSize, query, nodeGroupLabels, ccqa)
 
 		queryWrappersMap := QueryWrappersMap(cf)
-		qws := node.GetQueryWrappers(&queryWrappers, queryWrappersMap)
+		qws := node.GetQueryWrappers(rc, &queryWrappers, queryWrappersMap)
 
-		if node.HasNodeExporter(range5Min) {
+		if node.HasNodeExporter(rc, range5Min) {
 			for _, qw := range qws {
-				query = fmt.Sprintf(`sum(irate(node_cpu_seconds_total{mode!="idle"}[%sm])) by (%s) / on (%s) group_left count(node_cpu_seconds_total{mode="idle"}) by (%s) *100`, common.Params.Collection.SampleRateSt, qw.MetricField[0], qw.MetricField[0], qw.MetricField[0])
+				query = fmt.Sprintf(`sum(irate(node_cpu_seconds_total{mode!="idle"}[%sm])) by (%s) / on (%s) group_left count(node_cpu_seconds_total{mode="idle"}) by (%s) *100`, rc.Params().Collection.SampleRateSt, qw.MetricField[0], qw.MetricField[0], qw.MetricField[0])
 				query = qw.Query.GenerateWrapper(node.SumToAverage, nil).Wrap(query)
-				getWorkload(common.CpuUtilization, query, nodeGroupLabels, ccqa)
+				st.getWorkload(common.CpuUtilization, query, nodeGroupLabels, ccqa)
 
 				query = qw.Query.Wrap(`(node_memory_MemTotal_bytes{} - node_memory_MemFree_bytes{})`)
-				getWorkload(common.MemoryBytes, query, nodeGroupLabels, ccqa)
+				st.getWorkload(common.MemoryBytes, query, nodeGroupLabels, ccqa)
 
-				query = qw.Query.Wrap(fmt.Sprintf("(%s)", node.GetMemActualQuery()))
-				getWorkload(common.MemoryActualWorkload, query, nodeGroupLabels, ccqa)
+				query = qw.Query.Wrap(fmt.Sprintf("(%s)", node.GetMemActualQuery(rc)))
+				st.getWorkload(common.MemoryActualWorkload, query, nodeGroupLabels, ccqa)
 
-				query = qw.SumQuery.Wrap(`irate(node_disk_read_bytes_total{device!~"dm-.*"}[` + common.Params.Collection.SampleRateSt + `m])`)
-				getWorkload(common.DiskReadBytes, query, nodeGroupLabels, ccqa)
+				query = qw.SumQuery.Wrap(`irate(node_disk_read_bytes_total{device!~"dm-.*"}[` + rc.Params().Collection.SampleRateSt + `m])`)
+				st.getWorkload(common.DiskReadBytes, query, nodeGroupLabels, ccqa)
 
-				query = qw.SumQuery.Wrap(`irate(node_disk_written_bytes_total{device!~"dm-.*"}[` + common.Params.Collection.SampleRateSt + `m])`)
-				getWorkload(common.DiskWriteBytes, query, nodeGroupLabels, ccqa)
+				query = qw.SumQuery.Wrap(`irate(node_disk_written_bytes_total{device!~"dm-.*"}[` + rc.Params().Collection.SampleRateSt + `m])`)
+				st.getWorkload(common.DiskWriteBytes, query, nodeGroupLabels, ccqa)
 
-				query = qw.SumQuery.Wrap(`irate(node_disk_read_bytes_total{device!~"dm-.*"}[` + common.Params.Collection.SampleRateSt + `m]) + irate(node_disk_written_bytes_total{device!~"dm-.*"}[` + common.Params.Collection.SampleRateSt + `m])`)
-				getWorkload(common.DiskTotalBytes, query, nodeGroupLabels, ccqa)
+				query = qw.SumQuery.Wrap(`irate(node_disk_read_bytes_total{device!~"dm-.*"}[` + rc.Params().Collection.SampleRateSt + `m]) + irate(node_disk_written_bytes_total{device!~"dm-.*"}[` + rc.Params().Collection.SampleRateSt + `m])`)
+				st.getWorkload(common.DiskTotalBytes, query, nodeGroupLabels, ccqa)
 
-				query = qw.SumQuery.Wrap(`irate(node_disk_reads_completed_total{device!~"dm-.*"}[` + common.Params.Collection.SampleRateSt + `m])`)
-				getWorkload(common.DiskReadOps, query, nodeGroupLabels, ccqa)
+				query = qw.SumQuery.Wrap(`irate(node_disk_reads_completed_total{device!~"dm-.*"}[` + rc.Params().Collection.SampleRateSt + `m])`)
+				st.getWorkload(common.DiskReadOps, query, nodeGroupLabels, ccqa)
 
-				query = qw.SumQuery.Wrap(`irate(node_disk_writes_completed_total{device!~"dm-.*"}[` + common.Params.Collection.SampleRateSt + `m])`)
-				getWorkload(common.DiskWriteOps, query, nodeGroupLabels, ccqa)
+				query = qw.SumQuery.Wrap(`irate(node_disk_writes_completed_total{device!~"dm-.*"}[` + rc.Params().Collection.SampleRateSt + `m])`)
+				st.getWorkload(common.DiskWriteOps, query, nodeGroupLabels, ccqa)
 
-				query = qw.SumQuery.Wrap(`(irate(node_disk_reads_completed_total{device!~"dm-.*"}[` + common.Params.Collection.SampleRateSt + `m]) + irate(node_disk_writes_completed_total{device!~"dm-.*"}[` + common.Params.Collection.SampleRateSt + `m]))`)
-				getWorkload(common.DiskTotalOps, query, nodeGroupLabels, ccqa)
+				query = qw.SumQuery.Wrap(`(irate(node_disk_reads_completed_total{device!~"dm-.*"}[` + rc.Params().Collection.SampleRateSt + `m]) + irate(node_disk_writes_completed_total{device!~"dm-.*"}[` + rc.Params().Collection.SampleRateSt + `m]))`)
+				st.getWorkload(common.DiskTotalOps, query, nodeGroupLabels, ccqa)
 
-				query = qw.SumQuery.Wrap(`irate(node_network_receive_bytes_total{device!~"veth.*|docker.*|cilium.*|lxc.*"}[` + common.Params.Collection.SampleRateSt + `m])`)
-				getWorkload(common.NetReceivedBytes, query, nodeGroupLabels, ccqa)
+				query = qw.SumQuery.Wrap(`irate(node_network_receive_bytes_total{device!~"veth.*|docker.*|cilium.*|lxc.*"}[` + rc.Params().Collection.SampleRateSt + `m])`)
+				st.getWorkload(common.NetReceivedBytes, query, nodeGroupLabels, ccqa)
 
-				query = qw.SumQuery.Wrap(`irate(node_network_transmit_bytes_total{device!~"veth.*|docker.*|cilium.*|lxc.*"}[` + common.Params.Collection.SampleRateSt + `m])`)
-				getWorkload(common.NetSentBytes, query, nodeGroupLabels, ccqa)
+				query = qw.SumQuery.Wrap(`irate(node_network_transmit_bytes_total{device!~"veth.*|docker.*|cilium.*|lxc.*"}[` + rc.Params().Collection.SampleRateSt + `m])`)
+				st.getWorkload(common.NetSentBytes, query, nodeGroupLabels, ccqa)
 
-				query = qw.SumQuery.Wrap(`irate(node_network_transmit_bytes_total{device!~"veth.*|docker.*|cilium.*|lxc.*"}[` + common.Params.Collection.SampleRateSt + `m]) + irate(node_network_receive_bytes_total{device!~"veth.*|docker.*|cilium.*|lxc.*"}[` + common.Params.Collection.SampleRateSt + `m])`)
-				getWorkload(common.NetTotalBytes, query, nodeGroupLabels, ccqa)
+				query = qw.SumQuery.Wrap(`irate(node_network_transmit_bytes_total{device!~"veth.*|docker.*|cilium.*|lxc.*"}[` + rc.Params().Collection.SampleRateSt + `m]) + irate(node_network_receive_bytes_total{device!~"veth.*|docker.*|cilium.*|lxc.*"}[` + rc.Params().Collection.SampleRateSt + `m])`)
+				st.getWorkload(common.NetTotalBytes, query, nodeGroupLabels, ccqa)
 
-				query = qw.SumQuery.Wrap(`irate(node_network_receive_packets_total{device!~"veth.*|docker.*|cilium.*|lxc.*"}[` + common.Params.Collection.SampleRateSt + `m])`)
-				getWorkload(common.NetReceivedPackets, query, nodeGroupLabels, ccqa)
+				query = qw.SumQuery.Wrap(`irate(node_network_receive_packets_total{device!~"veth.*|docker.*|cilium.*|lxc.*"}[` + rc.Params().Collection.SampleRateSt + `m])`)
+				st.getWorkload(common.NetReceivedPackets, query, nodeGroupLabels, ccqa)
 
-				query = qw.SumQuery.Wrap(`irate(node_network_transmit_packets_total{device!~"veth.*|docker.*|cilium.*|lxc.*"}[` + common.Params.Collection.SampleRateSt + `m])`)
-				getWorkload(common.NetSentPackets, query, nodeGroupLabels, ccqa)
+				query = qw.SumQuery.Wrap(`irate(node_network_transmit_packets_total{device!~"veth.*|docker.*|cilium.*|lxc.*"}[` + rc.Params().Collection.SampleRateSt + `m])`)
+				st.getWorkload(common.NetSentPackets, query, nodeGroupLabels, ccqa)
 
-				query = qw.SumQuery.Wrap(`irate(node_network_transmit_packets_total{device!~"veth.*|docker.*|cilium.*|lxc.*"}[` + common.Params.Collection.SampleRateSt + `m]) + irate(node_network_receive_packets_total{device!~"veth.*|docker.*|cilium.*|lxc.*"}[` + common.Params.Collection.SampleRateSt + `m])`)
-				getWorkload(common.NetTotalPackets, query, nodeGroupLabels, ccqa)
+				query = qw.SumQuery.Wrap(`irate(node_network_transmit_packets_total{device!~"veth.*|docker.*|cilium.*|lxc.*"}[` + rc.Params().Collection.SampleRateSt + `m]) + irate(node_network_receive_packets_total{device!~"veth.*|docker.*|cilium.*|lxc.*"}[` + rc.Params().Collection.SampleRateSt + `m])`)
+				st.getWorkload(common.NetTotalPackets, query, nodeGroupLabels, ccqa)
 			}
 		} else {
-			common.LogAll(1, common.Error, "entity=%s prometheus node exporter metrics not present for any cluster", common.NodeGroupEntityKind)
+			rc.LogAll(1, common.Error, "entity=%s prometheus node exporter metrics not present for any cluster", common.NodeGroupEntityKind)
 		}
 
-		if node.HasDcgmExporter(range5Min) {
+		if node.HasDcgmExporter(rc, range5Min) {
 			gwmhs := map[string]*common.WorkloadMetricHolder{
 				common.Empty:               common.GpuUtilizationAvg,
 				node.GpuPercentQuerySuffix: common.GpuUtilizationGpusAvg,
@@ -443,20 +446,29 @@ func Metrics() {
 			for q, wmh := range gwmhs {
 				query = fmt.Sprintf("avg(%s) by (%s)", common.SafeDcgmGpuUtilizationQuery+q, qw.MetricField[0])
 				query = qw.Query.GenerateWrapper(node.SumToAverage, nil).Wrap(query)
-				getWorkload(wmh, query, nodeGroupLabels, ccqa)
+				st.getWorkload(wmh, query, nodeGroupLabels, ccqa)
 			}
 			query = fmt.Sprintf(" 100 * avg(%s) by (%s)", common.DcgmExporterLabelReplace("DCGM_FI_DEV_FB_USED{} / (DCGM_FI_DEV_FB_USED{} + DCGM_FI_DEV_FB_FREE{})"), qw.MetricField[0])
 			query = qw.Query.GenerateWrapper(node.SumToAverage, nil).Wrap(query)
-			getWorkload(common.GpuMemUtilizationAvg, query, nodeGroupLabels, ccqa)
+			st.getWorkload(common.GpuMemUtilizationAvg, query, nodeGroupLabels, ccqa)
 
 			query = qw.SumQuery.Wrap(common.DcgmExporterLabelReplace("DCGM_FI_DEV_FB_USED{}"))
-			getWorkload(common.GpuMemUsedAvg, query, nodeGroupLabels, ccqa)
+			st.getWorkload(common.GpuMemUsedAvg, query, nodeGroupLabels, ccqa)
 
 			query = qw.SumQuery.Wrap(common.DcgmExporterLabelReplace("DCGM_FI_DEV_POWER_USAGE{}"))
-			getWorkload(common.GpuPowerUsageAvg, query, nodeGroupLabels, ccqa)
+			st.getWorkload(common.GpuPowerUsageAvg, query, nodeGroupLabels, ccqa)
 		} else {
-			common.LogAll(1, common.Info, "entity=%s Nvidia DCGM exporter metrics not present for any cluster", common.NodeGroupEntityKind)
+			rc.LogAll(1, common.Info, "entity=%s Nvidia DCGM exporter metrics not present for any cluster", common.NodeGroupEntityKind)
 		}
 	}
-	common.UnregisterClusterQueryExclusion(common.ExcComment)
+	rc.UnregisterClusterQueryExclusion(common.ExcComment)
 }
+
+var _ = common.RegisterCoverage(&common.CoverageMetric{Names: []string{"kube_node_labels"}, Exporter: common.Ksm,
+	Outputs: []string{configSchema.FileOutput()}, Hint: common.KsmLabelsHint})
+
+var _ = common.RegisterOverridableOutputs(common.NodeGroupEntityKind, append(common.ConditionalMetricHolders(),
+	common.CurrentSize, common.CpuUtilization, common.MemoryBytes, common.MemoryActualWorkload,
+	common.DiskReadBytes, common.DiskWriteBytes, common.DiskTotalBytes, common.DiskReadOps, common.DiskWriteOps, common.DiskTotalOps,
+	common.NetReceivedBytes, common.NetSentBytes, common.NetTotalBytes, common.NetReceivedPackets, common.NetSentPackets, common.NetTotalPackets,
+	common.GpuUtilizationAvg, common.GpuUtilizationGpusAvg, common.GpuMemUtilizationAvg, common.GpuMemUsedAvg, common.GpuPowerUsageAvg)...)
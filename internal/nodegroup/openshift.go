@@ -53,18 +53,18 @@ var (
 		randomSuffixLength, randomSuffixLength, common.DefaultFmt, common.DefaultFmt, maxPrefixLength, randomSuffixLength)
 )
 
-func determineOpenshiftFeatures(promRange *v1.Range) (err error) {
+func (st *state) determineOpenshiftFeatures(promRange *v1.Range) (err error) {
 	// This is the best query to detect OpenShift machines, as the master/control-plane machine set
 	// is not created as a MachineSet CR, therefore `mapi_machineset_items > 0` does not detect it
 	var n int
 	query := "mapi_machine_items{} > 0"
-	if n, err = common.CollectAndProcessMetric(query, promRange, detectOpenshiftMachines); err != nil || n == 0 {
+	if n, err = st.rc.CollectAndProcessMetric(query, promRange, st.detectOpenshiftMachines); err != nil || n == 0 {
 		// error already handled
 		return
 	}
 	// detect actual machine sets names (this is worker nodes only, the master nodes have no machine test)
 	query = fmt.Sprintf(machineSetQueryFmt, common.NamePrefix, common.Name, maxPrefixLength)
-	if _, err = common.CollectAndProcessMetric(query, promRange, detectOpenshiftMachineSets); err != nil {
+	if _, err = st.rc.CollectAndProcessMetric(query, promRange, st.detectOpenshiftMachineSets); err != nil {
 		// error already handled
 		return
 	}
@@ -72,7 +72,7 @@ func determineOpenshiftFeatures(promRange *v1.Range) (err error) {
 		labelMachineSet, common.Node, openshiftMasterNodeRegex1,
 		labelOpenshiftCluster, labelMachineSet, openshiftMasterNodeRegex2)
 
-	if _, err = common.CollectAndProcessMetric(query, promRange, detectMasterNodes); err != nil {
+	if _, err = st.rc.CollectAndProcessMetric(query, promRange, st.detectMasterNodes); err != nil {
 		// error already handled
 		return
 	}
@@ -88,21 +88,21 @@ func determineOpenshiftFeatures(promRange *v1.Range) (err error) {
 	//    truncated and the 5-character string is added without a `-`:
 	//    <cluster name>-<truncated machine set name><5 character random string> (for worker nodes)
 	query = common.FormatRepeatedAuto(openshiftCoreQueryFmt, labelMachineSet)
-	if n, err = common.CollectAndProcessMetric(query, promRange, createMachineSets); err != nil {
+	if n, err = st.rc.CollectAndProcessMetric(query, promRange, st.createMachineSets); err != nil {
 		// error already handled
 		return
 	}
 	return
 }
 
-func detectOpenshiftMachines(cluster string, result model.Matrix) {
+func (st *state) detectOpenshiftMachines(cluster string, result model.Matrix) {
 	if len(result) > 0 {
-		_, _ = ensureOpenShiftFeature(cluster)
+		_, _ = st.ensureOpenShiftFeature(cluster)
 	}
 }
 
-func detectOpenshiftMachineSets(cluster string, result model.Matrix) {
-	if of, ok := ensureOpenShiftFeature(cluster); ok {
+func (st *state) detectOpenshiftMachineSets(cluster string, result model.Matrix) {
+	if of, ok := st.ensureOpenShiftFeature(cluster); ok {
 		for _, ss := range result {
 			if machineSetName, f := ss.Metric[common.Name]; f {
 				msName := string(machineSetName)
@@ -111,7 +111,7 @@ func detectOpenshiftMachineSets(cluster string, result model.Matrix) {
 					msNamePrefix := string(machineSetNamePrefix)
 					if fullMachineSetName, f3 := of.machineSetsSubstitutions[msNamePrefix]; f3 && fullMachineSetName != msName {
 						err := fmt.Errorf("found two machine sets with same %d-character prefix %s: %s and %s; only %s will be used", maxPrefixLength, msNamePrefix, fullMachineSetName, msName, fullMachineSetName)
-						common.LogError(err, common.DefaultLogFormat, cluster, common.NodeGroupEntityKind)
+						st.rc.LogError(err, common.DefaultLogFormat, cluster, common.NodeGroupEntityKind)
 					} else {
 						of.machineSetsSubstitutions[msNamePrefix] = msName
 					}
@@ -121,8 +121,8 @@ func detectOpenshiftMachineSets(cluster string, result model.Matrix) {
 	}
 }
 
-func detectMasterNodes(cluster string, result model.Matrix) {
-	if of, ok := ensureOpenShiftFeature(cluster); ok {
+func (st *state) detectMasterNodes(cluster string, result model.Matrix) {
+	if of, ok := st.ensureOpenShiftFeature(cluster); ok {
 		for _, ss := range result {
 			if clusterName, f1 := ss.Metric[labelOpenshiftCluster]; f1 {
 				cName := string(clusterName)
@@ -136,15 +136,15 @@ func detectMasterNodes(cluster string, result model.Matrix) {
 					}
 				} else if of.clusterName != cName {
 					err := fmt.Errorf("two openshift cluster names found: %v and %v", of.clusterName, clusterName)
-					common.LogError(err, common.DefaultLogFormat, cluster, common.NodeGroupEntityKind)
+					st.rc.LogError(err, common.DefaultLogFormat, cluster, common.NodeGroupEntityKind)
 				}
 			}
 		}
 	}
 }
 
-func createMachineSets(cluster string, result model.Matrix) {
-	if _, f := ensureOpenShiftFeature(cluster); f {
-		createNodeGroup(cluster, result, labelMachineSet)
+func (st *state) createMachineSets(cluster string, result model.Matrix) {
+	if _, f := st.ensureOpenShiftFeature(cluster); f {
+		st.createNodeGroup(cluster, result, labelMachineSet)
 	}
 }
@@ -17,6 +17,7 @@ const (
 )
 
 type roleFeature struct {
+	eng *roleEngine
 }
 
 func (rf *roleFeature) Type() featureType {
@@ -24,8 +25,8 @@ func (rf *roleFeature) Type() featureType {
 }
 
 func (rf *roleFeature) NodeAndGroupCoreQueryFmt() (s string) {
-	if rf != nil {
-		s = roleEng.coreQuery
+	if rf != nil && rf.eng != nil {
+		s = rf.eng.coreQuery
 	}
 	return
 }
@@ -38,15 +39,15 @@ func (rf *roleFeature) AdjustNodeGroupName(name string) string {
 	return name
 }
 
-func determineRoleFeatures(promRange *v1.Range) (err error) {
+func (st *state) determineRoleFeatures(promRange *v1.Range) (err error) {
 	var n int
 	query := fmt.Sprintf("avg(%s) by (%s)", roleQuery, common.Role)
-	if n, err = common.CollectAndProcessMetric(query, promRange, detectRoles); err != nil || n == 0 {
+	if n, err = st.rc.CollectAndProcessMetric(query, promRange, st.detectRoles); err != nil || n == 0 {
 		// error already handled
 		return
 	}
-	if roleEng != nil && roleEng.queryForRole {
-		_, err = common.CollectAndProcessMetric(roleEng.coreQuery, promRange, createRoles)
+	if st.roleEng != nil && st.roleEng.queryForRole {
+		_, err = st.rc.CollectAndProcessMetric(st.roleEng.coreQuery, promRange, st.createRoles)
 	}
 	return
 }
@@ -58,31 +59,29 @@ type roleEngine struct {
 	queryForRole       bool
 }
 
-var roleEng *roleEngine
-
-func ensureRoleEngine() *roleEngine {
-	if roleEng == nil {
-		configuredRoles := strings.Split(common.Params.Collection.RoleList, common.Comma)
+func (st *state) ensureRoleEngine() *roleEngine {
+	if st.roleEng == nil {
+		configuredRoles := strings.Split(st.rc.Params().Collection.RoleList, common.Comma)
 		if len(configuredRoles) > 0 {
 			configuredRolesMap := make(map[string]bool, len(configuredRoles))
 			for _, role := range configuredRoles {
 				configuredRolesMap[role] = true
 			}
 			coreQuery := buildCoreQuery(configuredRoles)
-			roleEng = &roleEngine{
+			st.roleEng = &roleEngine{
 				configuredRoles:    configuredRoles,
 				configuredRolesMap: configuredRolesMap,
 				coreQuery:          coreQuery,
 			}
 		}
 	}
-	return roleEng
+	return st.roleEng
 }
 
-func detectRoles(cluster string, result model.Matrix) {
+func (st *state) detectRoles(cluster string, result model.Matrix) {
 	if len(result) > 0 {
 		var err error
-		if ensureRoleEngine() == nil {
+		if st.ensureRoleEngine() == nil {
 			err = errors.New("bad role configuration")
 		}
 		if err == nil {
@@ -90,7 +89,7 @@ func detectRoles(cluster string, result model.Matrix) {
 			for _, ss := range result {
 				if roleName, f1 := ss.Metric[common.Role]; f1 {
 					rName := string(roleName)
-					if !roleEng.configuredRolesMap[rName] {
+					if !st.roleEng.configuredRolesMap[rName] {
 						missingRoles = append(missingRoles, rName)
 					}
 				}
@@ -100,10 +99,10 @@ func detectRoles(cluster string, result model.Matrix) {
 			}
 		}
 		if err == nil {
-			clusterFeatures[cluster] = &roleFeature{}
-			roleEng.queryForRole = true
+			st.clusterFeatures[cluster] = &roleFeature{eng: st.roleEng}
+			st.roleEng.queryForRole = true
 		} else {
-			common.LogError(err, common.DefaultLogFormat, cluster, common.NodeGroupEntityKind)
+			st.rc.LogError(err, common.DefaultLogFormat, cluster, common.NodeGroupEntityKind)
 		}
 	}
 }
@@ -132,8 +131,8 @@ func roleQueryClause(roleOp, role, prevRolesOp, prevRoles string) string {
 	return fmt.Sprintf(roleClauseFmt, subRoleQuery(roleOp, role), common.Node, subRoleQuery(prevRolesOp, prevRoles))
 }
 
-func createRoles(cluster string, result model.Matrix) {
-	if _, f := ensureRoleFeature(cluster); f {
-		createNodeGroup(cluster, result, common.Role)
+func (st *state) createRoles(cluster string, result model.Matrix) {
+	if _, f := st.ensureRoleFeature(cluster); f {
+		st.createNodeGroup(cluster, result, common.Role)
 	}
 }
@@ -0,0 +1,58 @@
+package pipeline
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"github.com/densify-dev/container-data-collection/internal/common"
+)
+
+// TestCoverageCatalog checks the metrics the collectors register, with no metric present
+func TestCoverageCatalog(t *testing.T) {
+	rc := common.NewRunContext(context.Background(), nil)
+	defer rc.End()
+	cr := rc.GetCoverageReport("c1")
+	want := map[string][]string{
+		"container_cpu_usage_seconds_total":                  {"container/avg_cpu_mcores_workload.csv", "container/max_cpu_mcores_workload.csv"},
+		"container_cpu_cfs_throttled_periods_total":          {"container/sum_cpu_throttling_seconds_workload.csv"},
+		"container_spec_memory_limit_bytes":                  {"container/config.csv:HwTotalMemory"},
+		"kube_pod_info":                                      {"container/config.csv", "container/attributes.csv", "node/pod_count.csv"},
+		"kube_pod_container_resource_requests":               {"container/attributes.csv:CpuRequest", "node/attributes.csv:CpuRequest", "node/cpu_reservation_percent.csv"},
+		"kube_pod_container_status_restarts_total":           {"container/max_restarts.csv"},
+		"kube_pod_container_status_last_terminated_exitcode": {"container/events.csv"},
+		"kube_node_labels":                                   {"node/attributes.csv:NodeLabels", "node_group/config.csv"},
+		"kube_horizontalpodautoscaler_labels":                {"hpa/hpa_extra_config.csv", "hpa/hpa_extra_attributes.csv"},
+		"kube_resourcequota":                                 {"rq/config.csv", "rq/cpu_limits.csv"},
+		"openshift_clusterresourcequota_usage":               {"crq/config.csv", "crq/pods.csv"},
+		"node_cpu_seconds_total":                             {"node/cpu_utilization.csv", "cluster/cpu_utilization.csv"},
+		"DCGM_FI_DEV_FB_USED":                                {"node/attributes.csv:GpuMemoryTotal"},
+		"ephemeral_storage_container_rootfs_used_bytes":      {"container/ephemeral_storage_usage_bytes_avg_workload.csv"},
+		common.SurveyInfo:                                    {"container/attributes.csv:Runtimes"},
+	}
+	metrics := make(map[string]*common.MetricCoverage, len(cr.Metrics))
+	for _, mc := range cr.Metrics {
+		if metrics[mc.Metric] != nil {
+			t.Errorf("%s reported twice", mc.Metric)
+		}
+		metrics[mc.Metric] = mc
+		if mc.Present || len(mc.EmptyOutputs) == 0 || mc.Remediation == common.Empty {
+			t.Errorf("%s = %+v, want missing with outputs and a remediation", mc.Metric, mc)
+		}
+	}
+	if len(metrics) != 35 {
+		t.Errorf("%d metrics registered, want 35", len(metrics))
+	}
+	for metric, outputs := range want {
+		mc := metrics[metric]
+		if mc == nil {
+			t.Errorf("%s not registered", metric)
+			continue
+		}
+		for _, o := range outputs {
+			if !slices.Contains(mc.EmptyOutputs, o) {
+				t.Errorf("%s: no output %s in %v", metric, o, mc.EmptyOutputs)
+			}
+		}
+	}
+}
@@ -0,0 +1,48 @@
+package pipeline
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/densify-dev/container-data-collection/internal/common"
+)
+
+func setCustomConfig(t *testing.T, config string) (*common.RunConfig, error) {
+	t.Helper()
+	fileName := filepath.Join(t.TempDir(), "custom.yaml")
+	if err := os.WriteFile(fileName, []byte(config), 0600); err != nil {
+		t.Fatal(err)
+	}
+	cfg := common.NewRunConfig()
+	return cfg, cfg.SetCustomConfig(fileName)
+}
+
+// TestQueryOverrideOutputs checks the overrides of the workload outputs the collectors register
+func TestQueryOverrideOutputs(t *testing.T) {
+	ids := []string{"container/avg_cpu_mcores_workload", "container/gpu_utilization_gpus_max_workload", "container/hpa_cpu_target_avg",
+		"container/events", "node/disk_write_bytes", "node_group/gpu_requests", "cluster/memory_actual_workload", "rq/cpu_limits", "crq/pods"}
+	var sb strings.Builder
+	sb.WriteString("overrides:\n")
+	for _, id := range ids {
+		entityKind, metric, _ := strings.Cut(id, "/")
+		sb.WriteString("  - entityKind: " + entityKind + "\n    metric: " + metric + "\n    query: \"{{.Query}}\"\n")
+	}
+	cfg, err := setCustomConfig(t, sb.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	rc := common.NewRunContext(context.Background(), cfg)
+	defer rc.End()
+	if got := rc.QueryOverrides(); strings.Join(got, ",") != strings.Join(ids, ",") {
+		t.Errorf("overrides = %v, want %v", got, ids)
+	}
+	for _, id := range []string{"container/cpu_utilization_avg", "container/config", "node/cpu_limits"} {
+		entityKind, metric, _ := strings.Cut(id, "/")
+		if _, err := setCustomConfig(t, "overrides:\n  - entityKind: "+entityKind+"\n    metric: "+metric+"\n    query: \"{{.Query}}\"\n"); err == nil {
+			t.Errorf("override of %s accepted", id)
+		}
+	}
+}
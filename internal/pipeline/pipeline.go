@@ -0,0 +1,188 @@
+// Package pipeline holds the steps of a collection run, shared by the collect command and the embedding API
+package pipeline
+
+import (
+	"strings"
+
+	cconf "github.com/densify-dev/container-config/config"
+	"github.com/densify-dev/container-data-collection/internal/cluster"
+	"github.com/densify-dev/container-data-collection/internal/common"
+	"github.com/densify-dev/container-data-collection/internal/container"
+	"github.com/densify-dev/container-data-collection/internal/crq"
+	"github.com/densify-dev/container-data-collection/internal/custom"
+	"github.com/densify-dev/container-data-collection/internal/kubernetes"
+	"github.com/densify-dev/container-data-collection/internal/node"
+	"github.com/densify-dev/container-data-collection/internal/nodegroup"
+	"github.com/densify-dev/container-data-collection/internal/rq"
+)
+
+// Configure validates the parameters and sets them for the run, with its collection window and cluster filters
+func Configure(rc *common.RunContext, params *cconf.Parameters) {
+	if err := common.ValidateParams(params); err != nil {
+		rc.FatalErrorExitCode(common.ExitConfig, err, "Invalid configuration:")
+	}
+	rc.SetParams(params)
+	rc.SetCurrentTime()
+	if err := rc.RegisterClusterFilters(params.Clusters); err != nil {
+		rc.FatalErrorExitCode(common.ExitClusterFilter, err, "Failed to register cluster filters:")
+	}
+}
+
+// Start creates the output directories and log files, checks Prometheus, detects the exporters and reports the
+// coverage of the metrics
+func Start(rc *common.RunContext) {
+	if err := rc.MkdirAll(); err != nil {
+		rc.FatalErrorExitCode(common.ExitOutput, err, "Failed to create directories:")
+	}
+	removed, staleErr := rc.RemoveStaleTempFiles()
+	if err := rc.InitLogs(); err != nil {
+		rc.FatalErrorExitCode(common.ExitOutput, err, "Failed to open log files:")
+	}
+	rc.LogAll(1, common.Info, "Container data collection version %s", common.Version)
+	if staleErr != nil {
+		rc.LogErrorWithLevel(1, common.Warn, staleErr, "Failed to remove temporary files of earlier runs:")
+	} else if removed > 0 {
+		rc.LogAll(1, common.Info, "Removed %d temporary file(s) left by earlier runs", removed)
+	}
+	if ids := rc.QueryOverrides(); len(ids) > 0 {
+		rc.LogAll(1, common.Info, "Query overrides: %s", strings.Join(ids, ", "))
+	}
+	checkPrometheus(rc)
+	if err := rc.LogPrometheusTsdbStatus(); err != nil {
+		rc.LogErrorWithLevel(1, common.Warn, err, "Failed to log Prometheus TSDB status:")
+	}
+	DetectExporters(rc)
+	if err := rc.CheckCoverage(); err != nil {
+		rc.LogErrorWithLevel(1, common.Warn, err, "Failed to check metrics coverage:")
+	} else {
+		rc.WriteCoverageReports()
+	}
+}
+
+// Finish writes the run manifest, summaries and bundles; an interrupted run ends with ExitInterrupted
+func Finish(rc *common.RunContext) common.ExitCode {
+	if err := rc.TracePhase("write run manifest", rc.WriteRunManifest); err != nil {
+		rc.LogError(err, "Failed to write run manifest:")
+	}
+	if err := rc.TracePhase("write run summaries", rc.WriteRunSummaries); err != nil {
+		rc.LogError(err, "Failed to write run summaries:")
+	}
+	if err := rc.TracePhase("write schemas", rc.WriteSchemas); err != nil {
+		rc.LogError(err, "Failed to write schemas:")
+	}
+	if err := rc.TracePhase("write pseudonym mapping", rc.WritePseudonymMapping); err != nil {
+		rc.LogError(err, "Failed to write pseudonym mapping:")
+	}
+	if err := rc.TracePhase("write bundles", rc.WriteBundles); err != nil {
+		rc.LogError(err, "Failed to write bundles:")
+	}
+	if err := rc.TracePhase("upload to S3", rc.UploadToS3); err != nil {
+		rc.LogError(err, "Failed to upload to S3:")
+	}
+	if err := rc.PublishSelfMetrics(); err != nil {
+		rc.LogError(err, "Failed to publish self metrics:")
+	}
+	rc.EndTrace()
+	if rc.Interrupted() {
+		rc.LogAll(1, common.Warn, "Collection interrupted, partial data written")
+		return common.ExitInterrupted
+	}
+	return common.ExitOK
+}
+
+// Shutdown closes the exporters of the configuration of rc - OTLP, self metrics and spans - once the runs given it
+// have finished; the failures are logged to the logs of rc
+func Shutdown(rc *common.RunContext) {
+	cfg := rc.Config()
+	if err := cfg.CloseOtlpExporter(); err != nil {
+		rc.LogError(err, "Failed to close OTLP exporter:")
+	}
+	if err := cfg.CloseSelfMetrics(); err != nil {
+		rc.LogError(err, "Failed to stop serving self metrics:")
+	}
+	if err := cfg.CloseTracing(); err != nil {
+		rc.LogError(err, "Failed to export spans:")
+	}
+}
+
+func checkPrometheus(rc *common.RunContext) {
+	if upCount := rc.CheckPrometheusUp(); upCount == 0 {
+		rc.LogAll(1, common.Warn, "Prometheus server is up but reports no `up` metrics with value 1 for any scrape config, please verify it is actually scraping / collecting data")
+	} else {
+		rc.LogAll(1, common.Info, "Prometheus server is up and reports `up` metrics with value 1 for scrape config(s)")
+	}
+	ver, verFound := rc.GetPrometheusVersion()
+	var logVerPrefix string
+	if verFound {
+		logVerPrefix = "Detected "
+	}
+	rc.LogAll(1, common.Info, "%sPrometheus version %s", logVerPrefix, ver)
+}
+
+// DetectExporters fails the run on errors, unless these are due to the run being interrupted
+func DetectExporters(rc *common.RunContext) {
+	if err := rc.CalculateScrapeIntervals(); err != nil && !rc.Interrupted() {
+		rc.FatalErrorExitCode(common.ExitPrometheus, err, "Failed to calculate scrape intervals:")
+	}
+	if err := rc.LogAllMetrics(); err != nil && !rc.Interrupted() {
+		rc.FatalErrorExitCode(common.ExitPrometheus, err, "Failed to log all metrics:")
+	}
+}
+
+var (
+	kubernetesStage      = "kubernetes"
+	nodeStage            = common.NodeEntityKind
+	nodeGroupStage       = common.NodeGroupEntityKind
+	clusterStage         = common.ClusterEntityKind
+	containerStage       = common.ContainerEntityKind
+	containerEventsStage = "container_events"
+	crqStage             = common.CrqEntityKind
+	rqStage              = common.RqEntityKind
+	customStage          = "custom_metrics"
+)
+
+// stages declares the collectors with their dependencies:
+// - the kubernetes version information is used by cluster and nodes (and by container events, through the cgroup v2 grouping)
+// - node groups are built from the node data
+// - containers use the node data (node names, GPU sharing strategy)
+// - container events use the container label holders
+func stages(rc *common.RunContext) []*common.Stage {
+	return []*common.Stage{
+		{Name: kubernetesStage, Run: kubernetes.Metrics},
+		{Name: nodeStage, DependsOn: []string{kubernetesStage}, Skip: !includes(rc, common.NodeEntityKind), Run: node.Metrics},
+		{Name: nodeGroupStage, DependsOn: []string{nodeStage}, Skip: !includes(rc, common.NodeGroupInclude), Run: nodegroup.Metrics},
+		{Name: clusterStage, DependsOn: []string{kubernetesStage}, Skip: !includes(rc, common.ClusterEntityKind), Run: cluster.Metrics},
+		{Name: containerStage, DependsOn: []string{kubernetesStage, nodeStage}, Skip: !includes(rc, common.ContainerEntityKind), Run: container.Metrics},
+		{Name: containerEventsStage, DependsOn: []string{containerStage}, Skip: !includes(rc, common.ContainerEntityKind), Run: container.Events},
+		{Name: crqStage, Skip: !includes(rc, common.Quota), Run: crq.Metrics},
+		{Name: rqStage, Skip: !includes(rc, common.Quota), Run: rq.Metrics},
+		{Name: customStage, Skip: !rc.HasCustomMetrics(), Run: func(rc *common.RunContext) { custom.Metrics(rc, includesKind) }},
+	}
+}
+
+// CollectEntities runs the collection stages, independent ones concurrently unless parallelism is 1
+func CollectEntities(rc *common.RunContext, parallelism int) {
+	if err := rc.RunStages(stages(rc), parallelism); err != nil {
+		rc.FatalError(err, "Failed to run collection stages:")
+	}
+}
+
+func includes(rc *common.RunContext, entityKind string) bool {
+	include := rc.Params().Collection.Include
+	return entityKind == common.ClusterEntityKind ||
+		entityKind == common.NodeEntityKind ||
+		len(include) == 0 ||
+		include[entityKind]
+}
+
+// includesKind tells if an entity kind is included, node groups and quotas being included by their own names
+func includesKind(rc *common.RunContext, entityKind string) bool {
+	switch entityKind {
+	case common.NodeGroupEntityKind:
+		return includes(rc, common.NodeGroupInclude)
+	case common.CrqEntityKind, common.RqEntityKind:
+		return includes(rc, common.Quota)
+	default:
+		return includes(rc, entityKind)
+	}
+}
@@ -0,0 +1,37 @@
+package pipeline
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	cconf "github.com/densify-dev/container-config/config"
+	"github.com/densify-dev/container-data-collection/internal/common"
+)
+
+func TestStagesDependencies(t *testing.T) {
+	rc := common.NewRunContext(context.Background(), nil)
+	t.Cleanup(rc.End)
+	rc.SetParams(&cconf.Parameters{Collection: &cconf.CollectionParameters{}})
+	deps := make(map[string][]string)
+	for _, s := range stages(rc) {
+		deps[s.Name] = s.DependsOn
+	}
+	for name, want := range map[string][]string{
+		kubernetesStage: nil,
+		nodeStage:       {kubernetesStage},
+		nodeGroupStage:  {nodeStage},
+		// the cluster stage used to run after the node groups; it uses no node data, so it now runs concurrently
+		// with the node and node group stages
+		clusterStage:         {kubernetesStage},
+		containerStage:       {kubernetesStage, nodeStage},
+		containerEventsStage: {containerStage},
+		crqStage:             nil,
+		rqStage:              nil,
+		customStage:          nil,
+	} {
+		if got, f := deps[name]; !f || !slices.Equal(got, want) {
+			t.Errorf("stage %s depends on %v, want %v", name, got, want)
+		}
+	}
+}
@@ -1,10 +1,8 @@
 package rq
 
 import (
-	"fmt"
 	"github.com/densify-dev/container-data-collection/internal/common"
 	"github.com/prometheus/common/model"
-	"os"
 	"strconv"
 	"time"
 )
@@ -19,13 +17,25 @@ type namespace struct {
 	rqs map[string]*resourceQuota
 }
 
-var resourceQuotas = make(map[string]map[string]*namespace)
+// state holds the resource quotas of a run
+type state struct {
+	rc             *common.RunContext
+	resourceQuotas map[string]map[string]*namespace
+}
+
+type stateKey struct{}
+
+func getState(rc *common.RunContext) *state {
+	return common.CollectorState(rc, stateKey{}, func(rc *common.RunContext) *state {
+		return &state{rc: rc, resourceQuotas: make(map[string]map[string]*namespace)}
+	})
+}
 
 const (
 	labelRQ = "resourcequota"
 )
 
-func getResourceQuota(cluster string, ss *model.SampleStream) (rq *resourceQuota) {
+func (st *state) getResourceQuota(cluster string, ss *model.SampleStream) (rq *resourceQuota) {
 	var nsNameLabel, rqNameLabel model.LabelValue
 	var ok bool
 	if nsNameLabel, ok = ss.Metric[common.Namespace]; !ok {
@@ -37,9 +47,9 @@ func getResourceQuota(cluster string, ss *model.SampleStream) (rq *resourceQuota
 	}
 	rqName := string(rqNameLabel)
 	var cl map[string]*namespace
-	if cl, ok = resourceQuotas[cluster]; !ok {
+	if cl, ok = st.resourceQuotas[cluster]; !ok {
 		cl = make(map[string]*namespace)
-		resourceQuotas[cluster] = cl
+		st.resourceQuotas[cluster] = cl
 	}
 	var ns *namespace
 	if ns, ok = cl[nsName]; !ok {
@@ -64,10 +74,10 @@ func getResourceQuota(cluster string, ss *model.SampleStream) (rq *resourceQuota
 	return
 }
 
-func getExistingQuotas(cluster string, result model.Matrix) {
+func (st *state) getExistingQuotas(cluster string, result model.Matrix) {
 	for _, val := range result {
 		var rq *resourceQuota
-		if rq = getResourceQuota(cluster, val); rq == nil {
+		if rq = st.getResourceQuota(cluster, val); rq == nil {
 			continue
 		}
 		var resource string
@@ -109,9 +119,9 @@ func getExistingQuotas(cluster string, result model.Matrix) {
 	}
 }
 
-func getCreationTime(cluster string, result model.Matrix) {
+func (st *state) getCreationTime(cluster string, result model.Matrix) {
 	for _, val := range result {
-		if rq := getResourceQuota(cluster, val); rq == nil {
+		if rq := st.getResourceQuota(cluster, val); rq == nil {
 			continue
 		} else if sec := common.LastValue(val); sec != 0 {
 			rq.createTime = time.Unix(int64(sec), 0)
@@ -119,117 +129,113 @@ func getCreationTime(cluster string, result model.Matrix) {
 	}
 }
 
-func writeConfig() {
-	for name, cluster := range resourceQuotas {
-		writeConf(name, cluster)
+func (st *state) writeConfig() {
+	for name, cluster := range st.resourceQuotas {
+		st.writeConf(name, cluster)
 	}
 }
 
-func writeConf(name string, cluster map[string]*namespace) {
-	configWrite, err := os.Create(common.GetFileNameByType(name, common.RqEntityKind, common.Config))
+var configSchema = common.NewSchema(common.RqEntityKind, common.Config, 1).
+	Add(common.TimeColumn, false, "AuditTime").
+	Add(common.StringColumn, false, "ClusterName", "Namespace", "RqName")
+
+func (st *state) writeConf(name string, cluster map[string]*namespace) {
+	configWrite, err := st.rc.NewSchemaSink(name, configSchema)
 	if err != nil {
-		common.LogError(err, common.DefaultLogFormat, name, common.RqEntityKind)
+		st.rc.LogError(err, common.DefaultLogFormat, name, common.RqEntityKind)
 		return
 	}
-	defer func(file *os.File) {
-		if err = file.Close(); err != nil {
-			common.LogError(err, common.DefaultLogFormat, name, common.RqEntityKind)
+	defer func(sink common.Sink) {
+		if err = sink.Close(); err != nil {
+			st.rc.LogError(err, common.DefaultLogFormat, name, common.RqEntityKind)
 		}
 	}(configWrite)
-	if _, err = fmt.Fprintln(configWrite, "AuditTime,ClusterName,Namespace,RqName"); err != nil {
-		common.LogError(err, common.DefaultLogFormat, name, common.RqEntityKind)
-		return
-	}
 	for nsName, ns := range cluster {
 		for rqName := range ns.rqs {
-			if _, err = fmt.Fprintf(configWrite, "%s,%s,%s,%s\n", common.FormatCurrentTime(), name, nsName, rqName); err != nil {
-				common.LogError(err, common.DefaultLogFormat, name, common.RqEntityKind)
+			if err = configWrite.WriteRecord(st.rc.CurrentTime(), name, nsName, rqName); err != nil {
+				st.rc.LogError(err, common.DefaultLogFormat, name, common.RqEntityKind)
 				return
 			}
 		}
 	}
 }
 
-func writeAttributes() {
-	for name, cluster := range resourceQuotas {
-		writeAttrs(name, cluster)
+func (st *state) writeAttributes() {
+	for name, cluster := range st.resourceQuotas {
+		st.writeAttrs(name, cluster)
 	}
 }
 
-func writeAttrs(name string, cluster map[string]*namespace) {
-	attributeWrite, err := os.Create(common.GetFileNameByType(name, common.RqEntityKind, common.Attributes))
+var attributesSchema = common.NewSchema(common.RqEntityKind, common.Attributes, 1).
+	Add(common.StringColumn, false, "ClusterName", "Namespace", "RqName", "VirtualTechnology", "VirtualDomain", "VirtualDatacenter").
+	Add(common.TimeColumn, true, "CreateTime").
+	Add(common.StringColumn, false, "ResourceMetadata").
+	Add(common.IntColumn, true, "CpuLimit", "CpuRequest", "MemoryLimit", "MemoryRequest", "CurrentSize",
+		"NamespaceCpuLimit", "NamespaceCpuRequest", "NamespaceMemoryLimit", "NamespaceMemoryRequest", "NamespacePodsLimit")
+
+func (st *state) writeAttrs(name string, cluster map[string]*namespace) {
+	attributeWrite, err := st.rc.NewSchemaSink(name, attributesSchema)
 	if err != nil {
-		common.LogError(err, common.DefaultLogFormat, name, common.RqEntityKind)
+		st.rc.LogError(err, common.DefaultLogFormat, name, common.RqEntityKind)
 		return
 	}
-	defer func(file *os.File) {
-		if err = file.Close(); err != nil {
-			common.LogError(err, common.DefaultLogFormat, name, common.RqEntityKind)
+	defer func(sink common.Sink) {
+		if err = sink.Close(); err != nil {
+			st.rc.LogError(err, common.DefaultLogFormat, name, common.RqEntityKind)
 		}
 	}(attributeWrite)
-	if _, err = fmt.Fprintln(attributeWrite, "ClusterName,Namespace,RqName,VirtualTechnology,VirtualDomain,VirtualDatacenter,CreateTime,ResourceMetadata,CpuLimit,CpuRequest,MemoryLimit,MemoryRequest,CurrentSize,NamespaceCpuLimit,NamespaceCpuRequest,NamespaceMemoryLimit,NamespaceMemoryRequest,NamespacePodsLimit"); err != nil {
-		common.LogError(err, common.DefaultLogFormat, name, common.RqEntityKind)
-		return
-	}
 	for nsName, ns := range cluster {
 		for rqName, rq := range ns.rqs {
-			if _, err = fmt.Fprintf(attributeWrite, "%s,%s,%s,ResourceQuota,%s,%s", name, nsName, rqName, name, nsName); err != nil {
-				common.LogError(err, common.DefaultLogFormat, name, common.RqEntityKind)
-				return
-			}
-			if err = common.PrintCSVTimeValue(attributeWrite, &rq.createTime, false); err != nil {
-				common.LogError(err, common.DefaultLogFormat, name, common.RqEntityKind)
-				return
-			}
-			if _, err = fmt.Fprintf(attributeWrite, ",%s", rq.resources); err != nil {
-				common.LogError(err, common.DefaultLogFormat, name, common.RqEntityKind)
+			values := []any{name, nsName, rqName, "ResourceQuota", name, nsName, common.TimeValue(&rq.createTime), rq.resources}
+			values = append(values, common.KnownValues(rq.usageCpuLimit, rq.usageCpuRequest, rq.usageMemLimit, rq.usageMemRequest, rq.usagePodsLimit,
+				rq.cpuLimit, rq.cpuRequest, rq.memLimit, rq.memRequest, rq.podsLimit)...)
+			if err = attributeWrite.WriteRecord(values...); err != nil {
+				st.rc.LogError(err, common.DefaultLogFormat, name, common.RqEntityKind)
 				return
 			}
-			values := []int{rq.usageCpuLimit, rq.usageCpuRequest, rq.usageMemLimit, rq.usageMemRequest, rq.usagePodsLimit,
-				rq.cpuLimit, rq.cpuRequest, rq.memLimit, rq.memRequest, rq.podsLimit}
-			last := len(values) - 1
-			for i, value := range values {
-				if err = common.PrintCSVNumberValue(attributeWrite, value, i == last); err != nil {
-					common.LogError(err, common.DefaultLogFormat, name, common.RqEntityKind)
-					return
-				}
-			}
 		}
 	}
 }
 
 // Metrics a global func for collecting quota level metrics in prometheus
-func Metrics() {
+func Metrics(rc *common.RunContext) {
 	var query string
-	range5Min := common.TimeRange()
+	st := getState(rc)
+	range5Min := rc.TimeRange()
 
 	query = `max(kube_resourcequota{}) by (resourcequota, resource, namespace, type)`
-	if n, err := common.CollectAndProcessMetric(query, range5Min, getExistingQuotas); err != nil || n == 0 {
+	if n, err := rc.CollectAndProcessMetric(query, range5Min, st.getExistingQuotas); err != nil || n == 0 {
 		// error already handled
 		return
 	}
 
 	// for all other queries we ignore failures
 	query = `max(kube_resourcequota_created{}) by (namespace,resourcequota)`
-	_, _ = common.CollectAndProcessMetric(query, range5Min, getCreationTime)
+	_, _ = rc.CollectAndProcessMetric(query, range5Min, st.getCreationTime)
 
-	writeAttributes()
-	writeConfig()
+	st.writeAttributes()
+	st.writeConfig()
 
 	var metricField = []model.LabelName{common.Namespace, labelRQ}
 
 	query = `sum(kube_resourcequota{type="used", resource="limits.cpu"}) by (resourcequota,namespace) * 1000`
-	common.CpuLimits.GetWorkload(query, metricField, common.RqEntityKind)
+	common.CpuLimits.GetWorkload(rc, query, metricField, common.RqEntityKind)
 
 	query = `sum(kube_resourcequota{type="used", resource=~"cpu|requests\\.cpu"}) by (resourcequota,namespace) * 1000`
-	common.CpuRequests.GetWorkload(query, metricField, common.RqEntityKind)
+	common.CpuRequests.GetWorkload(rc, query, metricField, common.RqEntityKind)
 
 	query = `sum(kube_resourcequota{type="used", resource="limits.memory"}) by (resourcequota,namespace)`
-	common.MemLimits.GetWorkload(query, metricField, common.RqEntityKind)
+	common.MemLimits.GetWorkload(rc, query, metricField, common.RqEntityKind)
 
 	query = `sum(kube_resourcequota{type="used", resource=~"memory|requests\\.memory"}) by (resourcequota,namespace) / (1024 * 1024)`
-	common.MemRequests.GetWorkload(query, metricField, common.RqEntityKind)
+	common.MemRequests.GetWorkload(rc, query, metricField, common.RqEntityKind)
 
 	query = `sum(kube_resourcequota{type="used", resource=~"pods|count\\/pods"}) by (resourcequota,namespace)`
-	common.PodsLimits.GetWorkload(query, metricField, common.RqEntityKind)
+	common.PodsLimits.GetWorkload(rc, query, metricField, common.RqEntityKind)
 }
+
+var _ = common.RegisterCoverage(&common.CoverageMetric{Names: []string{"kube_resourcequota"}, Exporter: common.Ksm,
+	Outputs: common.Outputs([]string{configSchema.FileOutput()},
+		common.WorkloadOutputs(common.RqEntityKind, common.CpuLimits, common.CpuRequests, common.MemLimits, common.MemRequests, common.PodsLimits))})
+
+var _ = common.RegisterOverridableOutputs(common.RqEntityKind, common.CpuLimits, common.CpuRequests, common.MemLimits, common.MemRequests, common.PodsLimits)
@@ -0,0 +1,51 @@
+package collector
+
+import (
+	"path"
+)
+
+// Callbacks is a SinkFactory handing the records to functions instead of writing them; a nil function drops
+// the records of its kind. The functions are called concurrently for the outputs of different stages.
+type Callbacks struct {
+	// Record receives the config and attributes records, with a value per column of the output
+	Record func(spec *OutputSpec, values []any) error
+	// Sample receives the workload records
+	Sample func(spec *OutputSpec, s *Sample) error
+	// Close is called when all the records of an output have been received
+	Close func(spec *OutputSpec) error
+}
+
+// NewSink is the SinkFactory of the callbacks
+func (cb *Callbacks) NewSink(spec *OutputSpec) (Sink, error) {
+	return &callbackSink{cb: cb, spec: spec}, nil
+}
+
+type callbackSink struct {
+	cb   *Callbacks
+	spec *OutputSpec
+}
+
+func (cs *callbackSink) Name() string {
+	return path.Join(cs.spec.Cluster, cs.spec.EntityKind, cs.spec.Name)
+}
+
+func (cs *callbackSink) WriteRecord(values ...any) error {
+	if cs.cb.Record == nil {
+		return nil
+	}
+	return cs.cb.Record(cs.spec, values)
+}
+
+func (cs *callbackSink) WriteSample(s *Sample) error {
+	if cs.cb.Sample == nil {
+		return nil
+	}
+	return cs.cb.Sample(cs.spec, s)
+}
+
+func (cs *callbackSink) Close() error {
+	if cs.cb.Close == nil {
+		return nil
+	}
+	return cs.cb.Close(cs.spec)
+}
@@ -0,0 +1,227 @@
+// Package collector embeds the container data collection in another process. A Collector queries Prometheus
+// like the collect command does and hands the config, attributes and workload records of the clusters to its
+// sinks - e.g. Callbacks - instead of writing the CSV files; the run manifest, summaries, coverage reports and
+// logs are still written under the output folder.
+//
+// Each run keeps its configuration - the parameters, the clock, the Prometheus client, the sinks, the output
+// folder and the settings of the options (output formats, custom metrics, label policy, pseudonymization,
+// logging) - and the state of the collectors in a run context of its own, and each Collector counts its self
+// metrics in a registry of its own, so the Collectors of a process may run concurrently with different
+// options; they should write under different output folders.
+package collector
+
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+
+	cconf "github.com/densify-dev/container-config/config"
+	"github.com/densify-dev/container-data-collection/internal/common"
+	"github.com/densify-dev/container-data-collection/internal/pipeline"
+	v1 "github.com/prometheus/client_golang/api/prometheus/v1"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+type (
+	// Sink receives the records of an output - the config, attributes or a workload metric of an entity kind
+	// of a cluster
+	Sink = common.Sink
+	// SinkFactory creates the sink of an output
+	SinkFactory = common.SinkFactory
+	// OutputSpec identifies an output and its columns
+	OutputSpec = common.OutputSpec
+	// Sample is a workload record
+	Sample = common.Sample
+	// LabelMap is a record value holding the labels of an entity
+	LabelMap = common.LabelMap
+	// RunError is the fatal failure of a run, with the exit code the collect command exits with
+	RunError = common.RunError
+)
+
+// DefaultOutputFolder is the folder the run manifest, summaries, reports and logs are written under
+const DefaultOutputFolder = "data"
+
+// the output formats
+const (
+	CsvFormat     = common.CsvFormat
+	ParquetFormat = common.ParquetFormat
+	JsonlFormat   = common.JsonlFormat
+)
+
+// Collector collects the data of the clusters of its configuration
+type Collector struct {
+	params      *cconf.Parameters
+	sinks       []SinkFactory
+	clock       func() time.Time
+	api         v1.API
+	folder      string
+	parallelism int
+	config      *common.RunConfig
+	// err is the first error of the options, returned by New
+	err error
+}
+
+// Option configures a Collector
+type Option func(*Collector)
+
+// WithConfig sets the configuration, as read by the collect command; it is required
+func WithConfig(params *cconf.Parameters) Option {
+	return func(c *Collector) {
+		c.params = params
+	}
+}
+
+// WithSinks sets the factories of the sinks each output is written to, instead of the output formats
+func WithSinks(factories ...SinkFactory) Option {
+	return func(c *Collector) {
+		c.sinks = append(c.sinks, factories...)
+	}
+}
+
+// WithClock sets the clock the collection window ends at, the system clock by default
+func WithClock(clock func() time.Time) Option {
+	return func(c *Collector) {
+		c.clock = clock
+	}
+}
+
+// WithPrometheusClient sets the Prometheus API client, used as is instead of the one built from the
+// prometheus parameters of the configuration
+func WithPrometheusClient(api v1.API) Option {
+	return func(c *Collector) {
+		c.api = api
+	}
+}
+
+// WithOutputFolder sets the folder the outputs are written under, DefaultOutputFolder by default
+func WithOutputFolder(folder string) Option {
+	return func(c *Collector) {
+		c.folder = folder
+	}
+}
+
+// WithParallelism sets how many collection stages run concurrently, all the independent ones by default;
+// with 1 the stages run one after the other in a deterministic order
+func WithParallelism(parallelism int) Option {
+	return func(c *Collector) {
+		c.parallelism = parallelism
+	}
+}
+
+// WithOutputFormats sets the formats each output is written in under the output folder (CsvFormat,
+// ParquetFormat, JsonlFormat), CSV by default; they are not written if sinks are set
+func WithOutputFormats(formats ...string) Option {
+	return func(c *Collector) {
+		c.setErr(c.config.SetOutputFormats(formats...))
+	}
+}
+
+// WithCsvVersion sets the encoding of the CSV files, 1 (the legacy one, by default) or 2 (RFC 4180)
+func WithCsvVersion(version int) Option {
+	return func(c *Collector) {
+		c.setErr(c.config.SetCsvVersion(version))
+	}
+}
+
+// WithCustomConfig sets the file of the custom metrics, attributes and query overrides, as the custom parameter
+// of the collect command does
+func WithCustomConfig(fileName string) Option {
+	return func(c *Collector) {
+		c.setErr(c.config.SetCustomConfig(fileName))
+	}
+}
+
+// WithLabelPolicy sets the file of the policy of the labels and annotations exported; the redaction key is read
+// from LABEL_REDACTION_KEY
+func WithLabelPolicy(fileName string) Option {
+	return func(c *Collector) {
+		c.setErr(c.config.SetLabelPolicy(fileName))
+	}
+}
+
+// WithPseudonymization pseudonymizes the names of the clusters, namespaces and nodes, the mapping to the real
+// names being written encrypted to mappingFile; the keys are read from PSEUDONYM_KEY and PSEUDONYM_MAPPING_KEY
+func WithPseudonymization(mappingFile string) Option {
+	return func(c *Collector) {
+		c.setErr(c.config.SetPseudonymization(mappingFile))
+	}
+}
+
+// WithLogging sets the format of the log messages (text or json), the minimum level logged (debug, info, warn or
+// error; if empty, debug if the debug parameter is set, else info), the size (in MiB) at which the log files are
+// rotated and the number of rotated files kept
+func WithLogging(format, level string, maxSize, maxFiles int) Option {
+	return func(c *Collector) {
+		c.setErr(c.config.SetLogging(format, level, maxSize, maxFiles))
+	}
+}
+
+// WithLogOutput sets where the messages shown on stdout are written instead, e.g. the log of the embedding
+// process; the messages are still written to the log files under the output folder
+func WithLogOutput(w io.Writer) Option {
+	return func(c *Collector) {
+		c.config.SetLogOutput(w)
+	}
+}
+
+func (c *Collector) setErr(err error) {
+	if c.err == nil {
+		c.err = err
+	}
+}
+
+// New creates a Collector
+func New(opts ...Option) (*Collector, error) {
+	c := &Collector{clock: time.Now, folder: DefaultOutputFolder, config: common.NewRunConfig()}
+	for _, opt := range opts {
+		opt(c)
+	}
+	if c.err != nil {
+		return nil, c.err
+	}
+	if c.params == nil {
+		return nil, errors.New("no configuration")
+	}
+	return c, nil
+}
+
+// SelfMetrics returns the metrics of the collector itself (queries, errors, rows written, durations etc.)
+// counted by the runs of the Collector, e.g. to be served along with the metrics of the embedding process
+func (c *Collector) SelfMetrics() prometheus.Gatherer {
+	return c.config.SelfMetricsGatherer()
+}
+
+// Run collects the data, the run is interrupted when ctx is done. It returns a *RunError on a fatal failure
+// (the collect command would have exited) and the cause of ctx if interrupted; the data written until then is
+// kept and the manifest of the partial run written.
+func (c *Collector) Run(ctx context.Context) (err error) {
+	rc := common.NewRunContext(ctx, c.config)
+	defer rc.End()
+	rc.SetEmbedded()
+	rc.SetClock(c.clock)
+	rc.SetPrometheusApi(c.api)
+	rc.SetSinkFactories(c.sinks...)
+	rc.SetRootFolder(c.folder)
+	defer func() {
+		if cerr := rc.CloseLogs(); err == nil {
+			err = cerr
+		}
+	}()
+	if err = c.prepare(rc); err != nil {
+		return
+	}
+	pipeline.CollectEntities(rc, c.parallelism)
+	pipeline.Finish(rc)
+	if err = rc.Failure(); err == nil && ctx.Err() != nil {
+		err = context.Cause(ctx)
+	}
+	return
+}
+
+func (c *Collector) prepare(rc *common.RunContext) (err error) {
+	defer rc.RecoverRunError(&err)
+	pipeline.Configure(rc, c.params)
+	pipeline.Start(rc)
+	return
+}
@@ -0,0 +1,251 @@
+package collector
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	cconf "github.com/densify-dev/container-config/config"
+	"github.com/densify-dev/container-data-collection/internal/common"
+	"github.com/prometheus/client_golang/api"
+	v1 "github.com/prometheus/client_golang/api/prometheus/v1"
+)
+
+// newTestPrometheus returns a Prometheus API client of a server answering every range query with a series of
+// node n1, and the number of queries it has answered
+func newTestPrometheus(t *testing.T) (v1.API, func() int) {
+	t.Helper()
+	var mu sync.Mutex
+	var queries int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		queries++
+		mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/query"):
+			_, _ = w.Write([]byte(`{"status":"success","data":{"resultType":"vector","result":[]}}`))
+		case strings.HasSuffix(r.URL.Path, "/query_range"):
+			_, _ = w.Write([]byte(`{"status":"success","data":{"resultType":"matrix","result":[{"metric":{"node":"n1"},"values":[[1700000000,"1"]]}]}}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	client, err := api.NewClient(api.Config{Address: srv.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return v1.NewAPI(client), func() int {
+		mu.Lock()
+		defer mu.Unlock()
+		return queries
+	}
+}
+
+func testParams() *cconf.Parameters {
+	return &cconf.Parameters{
+		Prometheus: &cconf.PrometheusParameters{UrlConfig: &cconf.UrlConfig{Url: "http://prometheus:9090", Host: "prometheus:9090"}},
+		Collection: &cconf.CollectionParameters{Interval: common.Hours, IntervalSize: 1, HistoryInt: 1, SampleRate: 5},
+		Clusters:   []*cconf.ClusterFilterParameters{{Name: "c1"}},
+	}
+}
+
+func TestCollectorRun(t *testing.T) {
+	promApi, queries := newTestPrometheus(t)
+	var mu sync.Mutex
+	records := make(map[string]int)
+	cb := &Callbacks{Record: func(spec *OutputSpec, values []any) error {
+		mu.Lock()
+		defer mu.Unlock()
+		records[spec.Cluster+"/"+spec.EntityKind+"/"+spec.Name]++
+		return nil
+	}}
+	end := time.Date(2025, 6, 1, 12, 30, 0, 0, time.UTC)
+	folder := t.TempDir()
+	c, err := New(WithConfig(testParams()), WithSinks(cb.NewSink), WithPrometheusClient(promApi),
+		WithClock(func() time.Time { return end }), WithOutputFolder(folder), WithParallelism(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the second run starts from a clean state, it does not write the entities of the first one again
+	for run := 1; run <= 2; run++ {
+		clear(records)
+		if err = c.Run(context.Background()); err != nil {
+			t.Fatalf("run %d: %v", run, err)
+		}
+		var rs common.RunSummary
+		if b, err := os.ReadFile(filepath.Join(folder, "run-summary.json")); err != nil {
+			t.Fatal(err)
+		} else if err = json.Unmarshal(b, &rs); err != nil {
+			t.Fatal(err)
+		}
+		if !rs.WindowEnd.Equal(end.Truncate(time.Hour)) {
+			t.Errorf("run %d: collection window ends at %v, want %v", run, rs.WindowEnd, end.Truncate(time.Hour))
+		}
+		for _, output := range []string{"c1/cluster/config", "c1/node/config", "c1/node/attributes"} {
+			if records[output] != 1 {
+				t.Errorf("run %d: %d record(s) of %s, want 1", run, records[output], output)
+			}
+		}
+	}
+	if queries() == 0 {
+		t.Error("no query issued to the Prometheus client")
+	}
+}
+
+func TestCollectorRunError(t *testing.T) {
+	params := testParams()
+	params.Collection.HistoryInt = 0
+	c, err := New(WithConfig(params), WithOutputFolder(t.TempDir()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var re *RunError
+	if err = c.Run(context.Background()); !errors.As(err, &re) || re.Code != common.ExitConfig {
+		t.Errorf("Run() = %v, want a configuration RunError", err)
+	}
+	if _, err = New(); err == nil {
+		t.Error("New() with no configuration: expected an error")
+	}
+}
+
+// TestCollectorsConcurrent runs two Collectors of different configurations at the same time, each of them
+// keeping to its own clusters, clock and output folder
+func TestCollectorsConcurrent(t *testing.T) {
+	type result struct {
+		folder  string
+		end     time.Time
+		mu      sync.Mutex
+		records map[string]int
+	}
+	results := map[string]*result{
+		"c1": {folder: t.TempDir(), end: time.Date(2025, 6, 1, 12, 30, 0, 0, time.UTC), records: make(map[string]int)},
+		"c2": {folder: t.TempDir(), end: time.Date(2025, 7, 1, 8, 30, 0, 0, time.UTC), records: make(map[string]int)},
+	}
+	var wg sync.WaitGroup
+	for cluster, r := range results {
+		promApi, _ := newTestPrometheus(t)
+		params := testParams()
+		params.Clusters = []*cconf.ClusterFilterParameters{{Name: cluster}}
+		cb := &Callbacks{Record: func(spec *OutputSpec, values []any) error {
+			r.mu.Lock()
+			defer r.mu.Unlock()
+			r.records[spec.Cluster]++
+			return nil
+		}}
+		c, err := New(WithConfig(params), WithSinks(cb.NewSink), WithPrometheusClient(promApi),
+			WithClock(func() time.Time { return r.end }), WithOutputFolder(r.folder))
+		if err != nil {
+			t.Fatal(err)
+		}
+		wg.Go(func() {
+			if err := c.Run(context.Background()); err != nil {
+				t.Errorf("%s: %v", cluster, err)
+			}
+		})
+	}
+	wg.Wait()
+	for cluster, r := range results {
+		if len(r.records) != 1 || r.records[cluster] == 0 {
+			t.Errorf("%s: records by cluster = %v, want the records of %s only", cluster, r.records, cluster)
+		}
+		var rs common.RunSummary
+		if b, err := os.ReadFile(filepath.Join(r.folder, "run-summary.json")); err != nil {
+			t.Fatal(err)
+		} else if err = json.Unmarshal(b, &rs); err != nil {
+			t.Fatal(err)
+		}
+		if !rs.WindowEnd.Equal(r.end.Truncate(time.Hour)) || len(rs.Clusters) != 1 || rs.Clusters[0].Cluster != cluster {
+			t.Errorf("%s: run summary of window end %v and clusters %v", cluster, rs.WindowEnd, rs.Clusters)
+		}
+	}
+}
+
+// TestCollectorsConcurrentOptions runs two Collectors of different options at the same time, each of them
+// keeping to its own output formats, custom metrics, logging and self metrics
+func TestCollectorsConcurrentOptions(t *testing.T) {
+	customFile := filepath.Join(t.TempDir(), "custom.yaml")
+	custom := "metrics:\n  - name: queue depth\n    query: app_queue_depth{}\n    entityKind: node\n    identity:\n      NodeName: node\n"
+	if err := os.WriteFile(customFile, []byte(custom), 0600); err != nil {
+		t.Fatal(err)
+	}
+	type result struct {
+		folder string
+		log    *bytes.Buffer
+		c      *Collector
+	}
+	results := map[string]*result{"c1": {folder: t.TempDir(), log: &bytes.Buffer{}}, "c2": {folder: t.TempDir(), log: &bytes.Buffer{}}}
+	options := map[string][]Option{
+		"c1": {WithOutputFormats(JsonlFormat), WithCustomConfig(customFile), WithLogging("json", "info", 1, 0)},
+		"c2": {WithCsvVersion(2)},
+	}
+	var wg sync.WaitGroup
+	for cluster, r := range results {
+		promApi, _ := newTestPrometheus(t)
+		params := testParams()
+		params.Clusters = []*cconf.ClusterFilterParameters{{Name: cluster}}
+		opts := append(options[cluster], WithConfig(params), WithPrometheusClient(promApi), WithOutputFolder(r.folder), WithLogOutput(r.log))
+		var err error
+		if r.c, err = New(opts...); err != nil {
+			t.Fatal(err)
+		}
+		wg.Go(func() {
+			if err := r.c.Run(context.Background()); err != nil {
+				t.Errorf("%s: %v", cluster, err)
+			}
+		})
+	}
+	wg.Wait()
+	exists := func(r *result, cluster, name string) bool {
+		_, err := os.Stat(filepath.Join(r.folder, cluster, common.NodeEntityKind, name))
+		return err == nil
+	}
+	if r := results["c1"]; !exists(r, "c1", "config.jsonl") || exists(r, "c1", "config.csv") || !exists(r, "c1", "queue_depth.jsonl") {
+		t.Error("c1: want the JSON lines outputs only, with the custom metric")
+	}
+	if r := results["c2"]; !exists(r, "c2", "config.csv") || exists(r, "c2", "config.jsonl") || exists(r, "c2", "queue_depth.csv") {
+		t.Error("c2: want the CSV outputs only, without the custom metric")
+	}
+	if log := results["c1"].log.String(); !strings.HasPrefix(log, "{") {
+		t.Errorf("c1: log %.40q, want JSON messages", log)
+	}
+	if log := results["c2"].log.String(); !strings.HasPrefix(log, "time=") {
+		t.Errorf("c2: log %.40q, want text messages", log)
+	}
+	for cluster, r := range results {
+		mfs, err := r.c.SelfMetrics().Gather()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var rows int
+		for _, mf := range mfs {
+			if mf.GetName() != "densify_collector_rows_written_total" {
+				continue
+			}
+			for _, m := range mf.GetMetric() {
+				for _, lp := range m.GetLabel() {
+					if lp.GetName() == "cluster" && lp.GetValue() != cluster {
+						t.Errorf("%s: rows written counted for cluster %s", cluster, lp.GetValue())
+					}
+				}
+				rows += int(m.GetCounter().GetValue())
+			}
+		}
+		if rows == 0 {
+			t.Errorf("%s: no rows written counted", cluster)
+		}
+	}
+	if _, err := New(WithConfig(testParams()), WithOutputFormats("xml")); err == nil {
+		t.Error("New() with an unknown output format: expected an error")
+	}
+}